@@ -1,47 +1,164 @@
+// Package auth_aes encrypts provider tokens at rest.
+//
+// Values are sealed with AES-GCM and stored as "v<version>:<base64url(nonce || ciphertext)>",
+// where version identifies the key in the key ring that sealed the value. New values are
+// always sealed with the newest key, older keys are kept around for decryption until
+// every value has been re-encrypted.
 package auth_aes
 
 import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 )
 
+// Key is an AES key (16, 24 or 32 bytes) with its version.
+type Key struct {
+	Version uint32
+	Secret  []byte
+}
+
 type Aes struct {
-	block cipher.Block
+	aeads   map[uint32]cipher.AEAD
+	blocks  map[uint32]cipher.Block
+	current uint32
 }
 
-func NewAes(key []byte) *Aes {
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		panic("failed to create aes cipher: " + err.Error())
+var ErrNoKeys = errors.New("no encryption keys")
+var ErrUnknownVersion = errors.New("unknown key version")
+var ErrMalformed = errors.New("malformed ciphertext")
+var ErrDecrypt = errors.New("decryption failed")
+
+// NewKeyRing creates an Aes from a set of keys. The key with
+// the highest version is used for encryption.
+func NewKeyRing(keys []Key) (*Aes, error) {
+	if len(keys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	a := &Aes{
+		aeads:  make(map[uint32]cipher.AEAD, len(keys)),
+		blocks: make(map[uint32]cipher.Block, len(keys)),
+	}
+	for i, key := range keys {
+		if key.Version == 0 {
+			return nil, fmt.Errorf("key #%d: version must be greater than zero", i)
+		}
+
+		if _, ok := a.aeads[key.Version]; ok {
+			return nil, fmt.Errorf("key #%d: duplicate version %d", i, key.Version)
+		}
+
+		block, err := aes.NewCipher(key.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("key #%d: creating aes cipher: %w", i, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key #%d: creating gcm: %w", i, err)
+		}
+
+		a.aeads[key.Version] = aead
+		a.blocks[key.Version] = block
+		if key.Version > a.current {
+			a.current = key.Version
+		}
 	}
 
-	return &Aes{
-		block: block,
+	return a, nil
+}
+
+// NewAes creates an Aes with a single key as version 1.
+func NewAes(key []byte) (*Aes, error) {
+	return NewKeyRing([]Key{{Version: 1, Secret: key}})
+}
+
+func (a *Aes) Encrypt(plaintext string) (string, error) {
+	aead := a.aeads[a.current]
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generating nonce: %w", err)
 	}
+
+	// The version is authenticated as well, so a value can't
+	// be moved to another key's slot.
+	prefix := "v" + strconv.FormatUint(uint64(a.current), 10) + ":"
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(prefix))
+
+	return prefix + base64.RawURLEncoding.EncodeToString(sealed), nil
 }
 
-func (a *Aes) Encrypt(token string) string {
-	ciphertext := make([]byte, aes.BlockSize+len(token))
-	iv := ciphertext[:aes.BlockSize]
-	if _, err := rand.Read(iv); err != nil {
-		panic("failed to generate iv: " + err.Error())
+func (a *Aes) Decrypt(encrypted string) (string, error) {
+	version, payload, ok := strings.Cut(encrypted, ":")
+	if !ok || !strings.HasPrefix(version, "v") {
+		return a.decryptLegacy(encrypted)
+	}
+
+	v, err := strconv.ParseUint(version[1:], 10, 32)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	aead, ok := a.aeads[uint32(v)]
+	if !ok {
+		return "", ErrUnknownVersion
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrMalformed
+	}
+
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(version+":"))
+	if err != nil {
+		return "", ErrDecrypt
 	}
 
-	stream := cipher.NewCFBEncrypter(a.block, iv)
-	stream.XORKeyStream(ciphertext[aes.BlockSize:], []byte(token))
+	return string(plaintext), nil
+}
 
-	return hex.EncodeToString(ciphertext)
+// NeedsReencrypt reports whether the value was not sealed by the newest key,
+// including values in the legacy format.
+func (a *Aes) NeedsReencrypt(encrypted string) bool {
+	return !strings.HasPrefix(encrypted, "v"+strconv.FormatUint(uint64(a.current), 10)+":")
 }
 
-func (a *Aes) Decrypt(encrypted string) string {
-	ciphertext, _ := hex.DecodeString(encrypted)
+// decryptLegacy reads values written before the versioned format existed,
+// which were hex encoded AES-CFB with the IV in front, sealed by the key
+// that became version 1. The format is unauthenticated, values should be
+// re-encrypted as soon as possible.
+func (a *Aes) decryptLegacy(encrypted string) (string, error) {
+	block, ok := a.blocks[1]
+	if !ok {
+		return "", ErrUnknownVersion
+	}
+
+	ciphertext, err := hex.DecodeString(encrypted)
+	if err != nil {
+		return "", ErrMalformed
+	}
+
+	if len(ciphertext) < aes.BlockSize {
+		return "", ErrMalformed
+	}
+
 	iv := ciphertext[:aes.BlockSize]
 	ciphertext = ciphertext[aes.BlockSize:]
 
-	stream := cipher.NewCFBDecrypter(a.block, iv)
+	stream := cipher.NewCFBDecrypter(block, iv)
 	stream.XORKeyStream(ciphertext, ciphertext)
 
-	return string(ciphertext)
+	return string(ciphertext), nil
 }
@@ -1,23 +1,32 @@
 package auth_aes_test
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	auth_aes "kodiiing/auth/aes"
 	"log"
 	"os"
+	"strings"
 	"testing"
 )
 
-var aes *auth_aes.Aes
+var randKey []byte
+var keyRing *auth_aes.Aes
 
 func TestMain(m *testing.M) {
-	randKey := make([]byte, 32)
+	randKey = make([]byte, 32)
 	_, err := rand.Read(randKey)
 	if err != nil {
 		log.Fatalf("failed to generate key: %v", err)
 	}
 
-	aes = auth_aes.NewAes(randKey)
+	keyRing, err = auth_aes.NewAes(randKey)
+	if err != nil {
+		log.Fatalf("failed to create aes: %v", err)
+	}
 
 	exitCode := m.Run()
 
@@ -26,23 +35,161 @@ func TestMain(m *testing.M) {
 
 func TestEncrypt(t *testing.T) {
 	token := "test"
-	encrypted := aes.Encrypt(token)
+	encrypted, err := keyRing.Encrypt(token)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
 	if encrypted == "" {
 		t.Error("encrypted token is empty")
 	}
 
+	if !strings.HasPrefix(encrypted, "v1:") {
+		t.Errorf("encrypted token is missing the version prefix: %s", encrypted)
+	}
+
 	t.Logf("encrypted: %s", encrypted)
 }
 
 func TestDecrypt(t *testing.T) {
 	token := "test"
-	encrypted := aes.Encrypt(token)
-	if encrypted == "" {
-		t.Error("encrypted token is empty")
+	encrypted, err := keyRing.Encrypt(token)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	decrypted, err := keyRing.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("failed to decrypt: %v", err)
 	}
 
-	decrypted := aes.Decrypt(encrypted)
 	if decrypted != token {
 		t.Error("decrypted token is not equal to original token")
 	}
 }
+
+func TestDecryptTampered(t *testing.T) {
+	encrypted, err := keyRing.Encrypt("test")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	// Replace a character in the middle of the payload
+	i := len("v1:") + 10
+	replacement := byte('A')
+	if encrypted[i] == 'A' {
+		replacement = 'B'
+	}
+	tampered := encrypted[:i] + string(replacement) + encrypted[i+1:]
+
+	_, err = keyRing.Decrypt(tampered)
+	if !errors.Is(err, auth_aes.ErrDecrypt) && !errors.Is(err, auth_aes.ErrMalformed) {
+		t.Errorf("expected decryption error, got: %v", err)
+	}
+}
+
+func TestDecryptMalformed(t *testing.T) {
+	inputs := []string{"", "v1:", "v1:AAAA", "vx:AAAA", "zz", "00"}
+	for _, input := range inputs {
+		_, err := keyRing.Decrypt(input)
+		if err == nil {
+			t.Errorf("expected error for %q", input)
+		}
+	}
+
+	_, err := keyRing.Decrypt("v9:AAAA")
+	if !errors.Is(err, auth_aes.ErrUnknownVersion) {
+		t.Errorf("error is not ErrUnknownVersion: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	newKey := make([]byte, 32)
+	_, err := rand.Read(newKey)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	encrypted, err := keyRing.Encrypt("test")
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	rotated, err := auth_aes.NewKeyRing([]auth_aes.Key{
+		{Version: 1, Secret: randKey},
+		{Version: 2, Secret: newKey},
+	})
+	if err != nil {
+		t.Fatalf("failed to create key ring: %v", err)
+	}
+
+	if !rotated.NeedsReencrypt(encrypted) {
+		t.Error("value sealed by the old key should need re-encryption")
+	}
+
+	decrypted, err := rotated.Decrypt(encrypted)
+	if err != nil {
+		t.Fatalf("failed to decrypt with the old key: %v", err)
+	}
+
+	reencrypted, err := rotated.Encrypt(decrypted)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	if !strings.HasPrefix(reencrypted, "v2:") {
+		t.Errorf("value is not sealed by the newest key: %s", reencrypted)
+	}
+
+	if rotated.NeedsReencrypt(reencrypted) {
+		t.Error("value sealed by the newest key should not need re-encryption")
+	}
+}
+
+func TestDecryptLegacy(t *testing.T) {
+	block, err := aes.NewCipher(randKey)
+	if err != nil {
+		t.Fatalf("failed to create cipher: %v", err)
+	}
+
+	token := "legacy"
+	ciphertext := make([]byte, aes.BlockSize+len(token))
+	iv := ciphertext[:aes.BlockSize]
+	_, err = rand.Read(iv)
+	if err != nil {
+		t.Fatalf("failed to generate iv: %v", err)
+	}
+
+	cipher.NewCFBEncrypter(block, iv).XORKeyStream(ciphertext[aes.BlockSize:], []byte(token))
+	legacy := hex.EncodeToString(ciphertext)
+
+	if !keyRing.NeedsReencrypt(legacy) {
+		t.Error("legacy value should need re-encryption")
+	}
+
+	decrypted, err := keyRing.Decrypt(legacy)
+	if err != nil {
+		t.Fatalf("failed to decrypt legacy value: %v", err)
+	}
+
+	if decrypted != token {
+		t.Errorf("decrypted token is not equal to original token: %s", decrypted)
+	}
+}
+
+func TestNewKeyRingInvalid(t *testing.T) {
+	_, err := auth_aes.NewKeyRing(nil)
+	if !errors.Is(err, auth_aes.ErrNoKeys) {
+		t.Errorf("error is not ErrNoKeys: %v", err)
+	}
+
+	_, err = auth_aes.NewAes([]byte("short"))
+	if err == nil {
+		t.Error("expected error for an invalid key size")
+	}
+
+	_, err = auth_aes.NewKeyRing([]auth_aes.Key{{Version: 1, Secret: randKey}, {Version: 1, Secret: randKey}})
+	if err == nil {
+		t.Error("expected error for duplicate versions")
+	}
+}
@@ -0,0 +1,315 @@
+// Package audit records authentication events, and blocks clients
+// that fail to authenticate too often.
+//
+// Events are appended to the auth_events table and never updated. Failures
+// that may be guesses are counted per IP address and per user, a key that
+// reaches the limit is blocked for a while, so tokens can't be guessed by
+// brute force.
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_jwt "kodiiing/auth/jwt"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+type EventType string
+
+const (
+	EventLogin        EventType = "login"
+	EventLogout       EventType = "logout"
+	EventLogoutAll    EventType = "logout_all"
+	EventRefresh      EventType = "refresh"
+	EventAuthenticate EventType = "authenticate"
+	// EventImpersonate is recorded for the admin, when an
+	// impersonation token is issued to them.
+	EventImpersonate EventType = "impersonate"
+)
+
+type Outcome string
+
+const (
+	OutcomeSuccess Outcome = "success"
+	// OutcomeFailure is counted against the client and the
+	// user when the event is a Guess.
+	OutcomeFailure Outcome = "failure"
+	// OutcomeError is a failure on Kodiiing's side, it is not counted.
+	OutcomeError Outcome = "error"
+)
+
+type Event struct {
+	ID      int64
+	Type    EventType
+	Outcome Outcome
+	// UserID is zero when the user is unknown.
+	UserID int64
+	// Provider is nil when the event is not about a provider.
+	Provider  *auth.Provider
+	IP        string
+	UserAgent string
+	// Detail is a short description, usually the error of a failure.
+	Detail string
+	// Guess marks a failure that may be guessing a credential, see
+	// Guessed. It is not stored.
+	Guess     bool
+	CreatedAt time.Time
+}
+
+// Guessed reports whether a failure may be guessing a credential: a token
+// with a bad signature, an unknown token, or a bad credential. Expired and
+// revoked tokens were issued to someone, and are not counted.
+func Guessed(err error) bool {
+	return errors.Is(err, auth.ErrBadCredential) || auth_jwt.IsForged(err)
+}
+
+// Filter narrows down Query, zero values match everything.
+type Filter struct {
+	UserID  int64
+	Type    EventType
+	Outcome Outcome
+	IP      string
+	Since   time.Time
+	Until   time.Time
+	// BeforeID pages through the events, pass the ID of
+	// the last event of the previous page.
+	BeforeID int64
+	// Limit defaults to 50, and is at most 500.
+	Limit int
+}
+
+type Config struct {
+	Pool *pgxpool.Pool
+	// IPs and Users count the failures per IP address and per user.
+	IPs   LimiterConfig
+	Users LimiterConfig
+}
+
+type Log struct {
+	pool  *pgxpool.Pool
+	ips   *Limiter
+	users *Limiter
+}
+
+func NewLog(config Config) (*Log, error) {
+	if config.Pool == nil {
+		return nil, fmt.Errorf("database connection required on auth/audit module")
+	}
+
+	return &Log{
+		pool:  config.Pool,
+		ips:   NewLimiter(config.IPs),
+		users: NewLimiter(config.Users),
+	}, nil
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+func userKey(userId int64) string {
+	return "user:" + strconv.FormatInt(userId, 10)
+}
+
+// Blocked returns auth.ErrTooManyAttempts when the client of the
+// context, or the user when it is known, is blocked.
+func (l *Log) Blocked(ctx context.Context, userId int64) error {
+	client := ClientFromContext(ctx)
+	if client.IP != "" {
+		if until, blocked := l.ips.Blocked(ipKey(client.IP)); blocked {
+			return fmt.Errorf("%w: retry after %s", auth.ErrTooManyAttempts, until.Format(time.RFC3339))
+		}
+	}
+
+	if userId != 0 {
+		if until, blocked := l.users.Blocked(userKey(userId)); blocked {
+			return fmt.Errorf("%w: retry after %s", auth.ErrTooManyAttempts, until.Format(time.RFC3339))
+		}
+	}
+
+	return nil
+}
+
+// Record appends the event, filling in the client from the context. A failure
+// that is a guess is counted against the client and the user. Errors are logged rather than
+// returned, the audit log never fails the request it records.
+func (l *Log) Record(ctx context.Context, event Event) {
+	client := ClientFromContext(ctx)
+	if event.IP == "" {
+		event.IP = client.IP
+	}
+	if event.UserAgent == "" {
+		event.UserAgent = client.UserAgent
+	}
+
+	if event.Outcome == OutcomeFailure && event.Guess {
+		if event.IP != "" && l.ips.Fail(ipKey(event.IP)) {
+			log.Warn().Str("ip", event.IP).Msg("blocking ip after repeated authentication failures")
+		}
+
+		if event.UserID != 0 && l.users.Fail(userKey(event.UserID)) {
+			log.Warn().Int64("user_id", event.UserID).Msg("blocking user after repeated authentication failures")
+		}
+	}
+
+	var userId *int64
+	if event.UserID != 0 {
+		userId = &event.UserID
+	}
+
+	var provider *uint8
+	if event.Provider != nil {
+		p := event.Provider.ToUint8()
+		provider = &p
+	}
+
+	_, err := l.pool.Exec(
+		ctx,
+		`INSERT INTO
+			auth_events
+			(
+				type,
+				outcome,
+				user_id,
+				provider,
+				ip,
+				user_agent,
+				detail,
+				created_at
+			)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $7, $8)`,
+		string(event.Type),
+		string(event.Outcome),
+		userId,
+		provider,
+		truncate(event.IP, 45),
+		truncate(event.UserAgent, 511),
+		truncate(event.Detail, 511),
+		time.Now(),
+	)
+	if err != nil {
+		log.Warn().Err(err).Str("type", string(event.Type)).Msg("recording auth event")
+	}
+}
+
+// Query returns the events matching the filter, newest first.
+func (l *Log) Query(ctx context.Context, filter Filter) ([]Event, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = 50
+	}
+	if filter.Limit > 500 {
+		filter.Limit = 500
+	}
+
+	var since, until *time.Time
+	if !filter.Since.IsZero() {
+		since = &filter.Since
+	}
+	if !filter.Until.IsZero() {
+		until = &filter.Until
+	}
+
+	rows, err := l.pool.Query(
+		ctx,
+		`SELECT
+			id,
+			type,
+			outcome,
+			user_id,
+			provider,
+			ip,
+			user_agent,
+			detail,
+			created_at
+		FROM
+			auth_events
+		WHERE
+			($1 = 0 OR user_id = $1)
+			AND ($2 = '' OR type = $2)
+			AND ($3 = '' OR outcome = $3)
+			AND ($4 = '' OR ip = $4)
+			AND ($5::TIMESTAMPTZ IS NULL OR created_at >= $5)
+			AND ($6::TIMESTAMPTZ IS NULL OR created_at < $6)
+			AND ($7 = 0 OR id < $7)
+		ORDER BY
+			id DESC
+		LIMIT $8`,
+		filter.UserID,
+		string(filter.Type),
+		string(filter.Outcome),
+		filter.IP,
+		since,
+		until,
+		filter.BeforeID,
+		filter.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying auth events: %w", err)
+	}
+
+	events, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Event, error) {
+		var event Event
+		var eventType, outcome string
+		var userId *int64
+		var provider *uint8
+		err := row.Scan(&event.ID, &eventType, &outcome, &userId, &provider, &event.IP, &event.UserAgent, &event.Detail, &event.CreatedAt)
+		if err != nil {
+			return event, err
+		}
+
+		event.Type = EventType(eventType)
+		event.Outcome = Outcome(outcome)
+		if userId != nil {
+			event.UserID = *userId
+		}
+		if provider != nil {
+			p := auth.Provider(*provider)
+			event.Provider = &p
+		}
+
+		return event, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading auth events: %w", err)
+	}
+
+	return events, nil
+}
+
+// RunSweeper forgets the failures that no longer count, until the context is done.
+func (l *Log) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.ips.Sweep()
+			l.users.Sweep()
+		}
+	}
+}
+
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+
+	// Keep the string valid UTF-8.
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+
+	return s[:max]
+}
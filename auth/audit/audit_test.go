@@ -0,0 +1,28 @@
+package audit_test
+
+import (
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
+	"testing"
+)
+
+func TestGuessed(t *testing.T) {
+	cases := map[error]bool{
+		auth_jwt.ErrInvalid:    true,
+		auth_jwt.ErrUnknownKey: true,
+		fmt.Errorf("%w: %w: unknown personal access token", auth.ErrUnauthenticated, auth.ErrBadCredential): true,
+		auth_jwt.ErrExpired: false,
+		fmt.Errorf("%w: personal access token", auth.ErrTokenRevoked): false,
+		auth.ErrTokenReused:                          false,
+		errors.New("invalid or expired login state"): false,
+	}
+
+	for err, expected := range cases {
+		if got := audit.Guessed(err); got != expected {
+			t.Errorf("%v: expected %v, got %v", err, expected, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package audit_test
+
+import (
+	"kodiiing/auth/audit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	trustedProxies, err := audit.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("failed to parse trusted proxies: %v", err)
+	}
+
+	cases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIP   string
+	}{
+		{"direct", "203.0.113.7:4321", nil, "203.0.113.7"},
+		{"untrusted peer", "203.0.113.7:4321", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:4321", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed hop", "10.1.2.3:4321", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chained proxies", "192.0.2.1:4321", []string{"198.51.100.1, 10.0.0.5"}, "198.51.100.1"},
+		{"several headers", "10.1.2.3:4321", []string{"1.1.1.1", "198.51.100.1"}, "198.51.100.1"},
+		{"garbled hop", "10.1.2.3:4321", []string{"garbage, 10.0.0.5"}, "10.0.0.5"},
+		{"no header", "10.1.2.3:4321", nil, "10.1.2.3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var got audit.Client
+			handler := audit.Middleware(trustedProxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = audit.ClientFromContext(r.Context())
+			}))
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			r.RemoteAddr = c.remoteAddr
+			for _, value := range c.forwardedFor {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			if got.IP != c.expectedIP {
+				t.Errorf("expected %s, got %s", c.expectedIP, got.IP)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	_, err := audit.ParseTrustedProxies([]string{"not-an-ip"})
+	if err == nil {
+		t.Error("expected an error for an invalid address")
+	}
+}
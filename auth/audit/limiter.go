@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"sync"
+	"time"
+)
+
+// LimiterConfig configures NewLimiter.
+type LimiterConfig struct {
+	// MaxFailures within Window blocks the key for BlockFor.
+	MaxFailures int
+	Window      time.Duration
+	BlockFor    time.Duration
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Limiter counts failures per key, and blocks a key that failed too often.
+// It is kept in memory, every instance of Kodiiing counts on its own.
+type Limiter struct {
+	mu      sync.Mutex
+	config  LimiterConfig
+	entries map[string]*limiterEntry
+}
+
+type limiterEntry struct {
+	failures     int
+	windowStart  time.Time
+	blockedUntil time.Time
+}
+
+func NewLimiter(config LimiterConfig) *Limiter {
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = 10
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute * 15
+	}
+	if config.BlockFor <= 0 {
+		config.BlockFor = time.Minute * 15
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	return &Limiter{config: config, entries: make(map[string]*limiterEntry)}
+}
+
+// Blocked reports whether the key is blocked, and until when.
+func (l *Limiter) Blocked(key string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, ok := l.entries[key]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	if l.config.Now().Before(entry.blockedUntil) {
+		return entry.blockedUntil, true
+	}
+
+	return time.Time{}, false
+}
+
+// Fail counts a failure of the key, and reports whether
+// the key is blocked from now on.
+func (l *Limiter) Fail(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.config.Now()
+	entry, ok := l.entries[key]
+	if !ok || now.Sub(entry.windowStart) >= l.config.Window {
+		entry = &limiterEntry{windowStart: now}
+		l.entries[key] = entry
+	}
+
+	entry.failures++
+	if entry.failures >= l.config.MaxFailures {
+		entry.blockedUntil = now.Add(l.config.BlockFor)
+		// The next window starts once the block is over.
+		entry.failures = 0
+		entry.windowStart = entry.blockedUntil
+	}
+
+	return now.Before(entry.blockedUntil)
+}
+
+// Sweep forgets the keys that are neither blocked nor within a window.
+func (l *Limiter) Sweep() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.config.Now()
+	for key, entry := range l.entries {
+		if !now.Before(entry.blockedUntil) && now.Sub(entry.windowStart) >= l.config.Window {
+			delete(l.entries, key)
+		}
+	}
+}
+
+// Len returns how many keys are tracked.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return len(l.entries)
+}
@@ -0,0 +1,76 @@
+package audit_test
+
+import (
+	"kodiiing/auth/audit"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiter(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)}
+	l := audit.NewLimiter(audit.LimiterConfig{
+		MaxFailures: 3,
+		Window:      time.Minute,
+		BlockFor:    time.Minute * 5,
+		Now:         c.Now,
+	})
+
+	for i := 0; i < 2; i++ {
+		if l.Fail("ip:10.0.0.1") {
+			t.Fatalf("blocked after %d failures", i+1)
+		}
+	}
+
+	if _, blocked := l.Blocked("ip:10.0.0.1"); blocked {
+		t.Fatal("blocked before reaching the maximum")
+	}
+
+	if !l.Fail("ip:10.0.0.1") {
+		t.Fatal("not blocked after reaching the maximum")
+	}
+
+	until, blocked := l.Blocked("ip:10.0.0.1")
+	if !blocked || !until.Equal(c.now.Add(time.Minute*5)) {
+		t.Errorf("unexpected block: %v %v", blocked, until)
+	}
+
+	if _, blocked := l.Blocked("ip:10.0.0.2"); blocked {
+		t.Error("another key is blocked")
+	}
+
+	c.now = c.now.Add(time.Minute * 5)
+	if _, blocked := l.Blocked("ip:10.0.0.1"); blocked {
+		t.Error("still blocked after the block is over")
+	}
+}
+
+func TestLimiterWindow(t *testing.T) {
+	c := &clock{now: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)}
+	l := audit.NewLimiter(audit.LimiterConfig{
+		MaxFailures: 2,
+		Window:      time.Minute,
+		BlockFor:    time.Minute,
+		Now:         c.Now,
+	})
+
+	l.Fail("user:1")
+	c.now = c.now.Add(time.Minute)
+
+	if l.Fail("user:1") {
+		t.Error("failures of a past window are counted")
+	}
+
+	c.now = c.now.Add(time.Minute)
+	l.Sweep()
+	if l.Len() != 0 {
+		t.Errorf("expected the limiter to be empty after a sweep, got %d keys", l.Len())
+	}
+}
@@ -13,6 +13,10 @@ type Provider uint8
 const (
 	ProviderGithub Provider = iota
 	ProviderGitlab
+	ProviderOIDC
+	// ProviderEmail is the passwordless email login, its identities
+	// are keyed by the normalized email address.
+	ProviderEmail
 )
 
 func (p Provider) ToUint8() uint8 {
@@ -20,9 +24,16 @@ func (p Provider) ToUint8() uint8 {
 }
 
 type User struct {
+	// ID refers to the Kodiiing user ID when the user is read from
+	// the database, and to the provider's user ID when the user
+	// is returned by a provider.
 	ID       int64
 	Provider Provider
-	NodeID   string
+	// ProviderID identifies the user on its provider, it is only set when
+	// the user is returned by a provider. It is the decimal ID for the
+	// providers that have a numeric one, and an opaque string otherwise.
+	ProviderID string
+	NodeID     string
 	// Name refers to the display name of the user
 	// that is displayed on their corresponding profile page.
 	Name             string
@@ -40,6 +51,16 @@ type User struct {
 	// RegisteredAt refers to the time that the user is register
 	// to the Kodiiing platform
 	RegisteredAt time.Time
+	// Roles that were granted to the user, besides being a learner.
+	Roles []Role
+	// Scopes restricts the permissions of the user when it was
+	// authenticated by a personal access token. It is nil otherwise.
+	Scopes []Permission
+	// ImpersonatedBy is the ID of the admin acting as the user, when it
+	// was authenticated by an impersonation token. It is zero otherwise.
+	ImpersonatedBy int64
+	// ReadOnly restricts an impersonated user to read permissions.
+	ReadOnly bool
 }
 
 type Repository struct {
@@ -67,3 +88,34 @@ var ErrUserNotFound = errors.New("user not found")
 // ErrParameterEmpty is returned when a parameter is empty
 // for a function call
 var ErrParameterEmpty = errors.New("empty parameter")
+
+// ErrTokenRevoked is returned when a token was valid, but has been
+// revoked before it expires.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// ErrTokenReused is returned when a refresh token that has already been
+// exchanged is presented again. The whole token family is revoked
+// when this happens.
+var ErrTokenReused = errors.New("token reused")
+
+// ErrBadCredential is returned for a credential that Kodiiing doesn't
+// know of, such as an unknown personal access token or magic link, or an
+// access code the provider refused. Unlike an expired or revoked token, it
+// may be a guess.
+var ErrBadCredential = errors.New("bad credential")
+
+// ErrTooManyAttempts is returned when a client failed to
+// authenticate too often, and is blocked for a while.
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+
+// ErrIdentityLinked is returned when a provider identity is
+// already linked to another Kodiiing user.
+var ErrIdentityLinked = errors.New("identity is linked to another user")
+
+// ErrIdentityConflict is returned when a user already has an
+// identity of the same provider.
+var ErrIdentityConflict = errors.New("user already has an identity of this provider")
+
+// ErrLastIdentity is returned when unlinking the only identity of
+// a user, which would make the user unable to log in.
+var ErrLastIdentity = errors.New("cannot unlink the last identity")
@@ -0,0 +1,36 @@
+package auth
+
+import "strconv"
+
+// Prefixes of the cache keys a user is kept under. Every package that
+// changes users evicts them through these keys.
+const (
+	CacheKeyUserById       = "user:id:"
+	CacheKeyUserByUsername = "user:username:"
+	CacheKeyUserByEmail    = "user:email:"
+	CacheKeyRepositories   = "user:repository:id:"
+)
+
+// UserCacheKeys returns the cache keys of the users with the given IDs,
+// usernames and emails. Empty usernames and emails are skipped.
+func UserCacheKeys(ids []int64, usernames []string, emails []string) []string {
+	keys := make([]string, 0, len(ids)*2+len(usernames)+len(emails))
+	for _, id := range ids {
+		keys = append(keys,
+			CacheKeyUserById+strconv.FormatInt(id, 10),
+			CacheKeyRepositories+strconv.FormatInt(id, 10),
+		)
+	}
+	for _, username := range usernames {
+		if username != "" {
+			keys = append(keys, CacheKeyUserByUsername+username)
+		}
+	}
+	for _, email := range emails {
+		if email != "" {
+			keys = append(keys, CacheKeyUserByEmail+email)
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,23 @@
+package auth_test
+
+import (
+	"kodiiing/auth"
+	"slices"
+	"testing"
+)
+
+func TestUserCacheKeys(t *testing.T) {
+	keys := auth.UserCacheKeys([]int64{1, 2}, []string{"ronald", ""}, []string{"", "ronald@example.com"})
+	expected := []string{
+		"user:id:1",
+		"user:repository:id:1",
+		"user:id:2",
+		"user:repository:id:2",
+		"user:username:ronald",
+		"user:email:ronald@example.com",
+	}
+
+	if !slices.Equal(keys, expected) {
+		t.Errorf("expected %q, got %q", expected, keys)
+	}
+}
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"context"
+	"strconv"
+)
+
+type userKey struct{}
+
+// WithUser puts the authenticated user in the context, services do so
+// once the access token of a request has been authorized.
+func WithUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the user set by WithUser.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userKey{}).(*User)
+	return user, ok && user != nil
+}
+
+// ImpersonatorFromContext returns the ID of the admin acting as the
+// user of the context, if the user is being impersonated.
+func ImpersonatorFromContext(ctx context.Context) (int64, bool) {
+	user, ok := UserFromContext(ctx)
+	if !ok || user.ImpersonatedBy == 0 {
+		return 0, false
+	}
+
+	return user.ImpersonatedBy, true
+}
+
+// UpdatedBy returns the value of the updated_by columns for a write made
+// on behalf of the user of the context. Writes made while impersonating
+// are attributed to the admin, others to the given default.
+func UpdatedBy(ctx context.Context, fallback string) string {
+	impersonator, ok := ImpersonatorFromContext(ctx)
+	if !ok {
+		return fallback
+	}
+
+	return "impersonator:" + strconv.FormatInt(impersonator, 10)
+}
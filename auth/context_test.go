@@ -0,0 +1,33 @@
+package auth_test
+
+import (
+	"context"
+	"kodiiing/auth"
+	"testing"
+)
+
+func TestUpdatedBy(t *testing.T) {
+	ctx := context.Background()
+	if got := auth.UpdatedBy(ctx, "system"); got != "system" {
+		t.Errorf("expected system without a user, got %s", got)
+	}
+
+	ctx = auth.WithUser(ctx, &auth.User{ID: 2})
+	if _, ok := auth.ImpersonatorFromContext(ctx); ok {
+		t.Error("user should not be impersonated")
+	}
+
+	if got := auth.UpdatedBy(ctx, "system"); got != "system" {
+		t.Errorf("expected system for a regular user, got %s", got)
+	}
+
+	ctx = auth.WithUser(ctx, &auth.User{ID: 2, ImpersonatedBy: 1})
+	impersonator, ok := auth.ImpersonatorFromContext(ctx)
+	if !ok || impersonator != 1 {
+		t.Errorf("expected impersonator 1, got %d", impersonator)
+	}
+
+	if got := auth.UpdatedBy(ctx, "system"); got != "impersonator:1" {
+		t.Errorf("expected impersonator:1, got %s", got)
+	}
+}
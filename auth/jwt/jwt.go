@@ -3,6 +3,7 @@ package auth_jwt
 import (
 	"crypto/ed25519"
 	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
@@ -11,153 +12,316 @@ import (
 )
 
 type AuthJwt struct {
-	accessPrivateKey  ed25519.PrivateKey
-	accessPublicKey   ed25519.PublicKey
-	refreshPrivateKey ed25519.PrivateKey
-	refreshPublicKey  ed25519.PublicKey
-	issuer            string
-	subject           string
-	audience          string
+	accessKeys      []Key
+	refreshKeys     []Key
+	issuer          string
+	subject         string
+	audience        string
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
 }
 
+// Config configures New.
+type Config struct {
+	// AccessKeys are used to sign and verify access tokens. The first key
+	// signs new tokens, while every key is accepted during verification.
+	// Retired keys should be kept until the tokens they signed have expired.
+	AccessKeys []Key
+	// RefreshKeys works the same way as AccessKeys, for refresh tokens.
+	RefreshKeys []Key
+	Issuer      string
+	Subject     string
+	Audience    string
+	// AccessTokenTTL defaults to an hour.
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL defaults to 30 days.
+	RefreshTokenTTL time.Duration
+}
+
+var ErrNoKeys = errors.New("no signing keys")
+
+func New(config Config) (*AuthJwt, error) {
+	if len(config.AccessKeys) == 0 || len(config.RefreshKeys) == 0 {
+		return nil, ErrNoKeys
+	}
+
+	for _, key := range append(append([]Key{}, config.AccessKeys...), config.RefreshKeys...) {
+		if len(key.PrivateKey) != ed25519.PrivateKeySize || len(key.PublicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 key %q", key.ID)
+		}
+	}
+
+	if config.AccessTokenTTL <= 0 {
+		config.AccessTokenTTL = time.Hour
+	}
+
+	if config.RefreshTokenTTL <= 0 {
+		config.RefreshTokenTTL = time.Hour * 24 * 30
+	}
+
+	return &AuthJwt{
+		accessKeys:      config.AccessKeys,
+		refreshKeys:     config.RefreshKeys,
+		issuer:          config.Issuer,
+		subject:         config.Subject,
+		audience:        config.Audience,
+		accessTokenTTL:  config.AccessTokenTTL,
+		refreshTokenTTL: config.RefreshTokenTTL,
+	}, nil
+}
+
+// NewJwt creates an AuthJwt with a single key for each token type.
 func NewJwt(accessPrivateKey []byte, accessPublicKey []byte, refreshPrivateKey []byte, refreshPublicKey []byte, issuer string, subject string, audience string) *AuthJwt {
 	return &AuthJwt{
-		accessPrivateKey:  accessPrivateKey,
-		accessPublicKey:   accessPublicKey,
-		refreshPrivateKey: refreshPrivateKey,
-		refreshPublicKey:  refreshPublicKey,
-		issuer:            issuer,
-		subject:           subject,
-		audience:          audience,
+		accessKeys:      []Key{{PrivateKey: accessPrivateKey, PublicKey: accessPublicKey}},
+		refreshKeys:     []Key{{PrivateKey: refreshPrivateKey, PublicKey: refreshPublicKey}},
+		issuer:          issuer,
+		subject:         subject,
+		audience:        audience,
+		accessTokenTTL:  time.Hour,
+		refreshTokenTTL: time.Hour * 24 * 30,
 	}
 }
 
-func (j *AuthJwt) Sign(userId int64) (accessToken string, refreshToken string, err error) {
-	accessRandId := make([]byte, 32)
-	rand.Read(accessRandId)
+// Claims is the set of claims that Kodiiing puts on both
+// the access token and the refresh token.
+type Claims struct {
+	// ID is the unique identifier of the token (the "jti" claim).
+	ID     string
+	UserID int64
+	// FamilyID groups every refresh token that descends from the same
+	// login. Rotating a refresh token keeps the family, logging in again
+	// starts a new one.
+	FamilyID string
+	// Generation is the user's token generation at the time the token
+	// was issued. Bumping the generation invalidates every token that
+	// was issued before.
+	Generation int64
+	// ImpersonatorID is the admin that the access token was issued to,
+	// acting as UserID. It is zero on a regular token.
+	ImpersonatorID int64
+	// ReadOnly restricts an impersonation token to read permissions.
+	ReadOnly  bool
+	IssuedAt  time.Time
+	NotBefore time.Time
+	ExpiresAt time.Time
+}
 
-	accessClaims := jwt.MapClaims{
-		"iss": j.issuer,
-		"sub": j.subject,
-		"aud": j.audience,
-		"exp": time.Now().Add(time.Hour * 1).Unix(),
-		"nbf": time.Now().Unix(),
-		"iat": time.Now().Unix(),
-		"jti": string(accessRandId),
-		"uid": userId,
-	}
+// Subject describes who a token pair is issued for.
+type Subject struct {
+	UserID int64
+	// FamilyID is the refresh token family to issue the pair in.
+	// An empty FamilyID starts a new family.
+	FamilyID   string
+	Generation int64
+	// ImpersonatorID and ReadOnly are only set by IssueAccessToken.
+	ImpersonatorID int64
+	ReadOnly       bool
+}
 
-	accessToken, err = jwt.NewWithClaims(jwt.SigningMethodEdDSA, accessClaims).SignedString(j.accessPrivateKey)
+// TokenPair is the result of Issue.
+type TokenPair struct {
+	AccessToken   string
+	RefreshToken  string
+	AccessClaims  Claims
+	RefreshClaims Claims
+}
+
+func randomId() (string, error) {
+	id := make([]byte, 32)
+	_, err := rand.Read(id)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to sign access token: %w", err)
+		return "", err
 	}
 
-	refreshRandId := make([]byte, 32)
-	rand.Read(refreshRandId)
-
-	refreshClaims := jwt.MapClaims{
-		"iss": j.issuer,
-		"sub": j.subject,
-		"aud": j.audience,
-		"exp": time.Now().Add(time.Hour * 24 * 30).Unix(),
-		"nbf": time.Now().Add(time.Minute * 59).Unix(),
-		"iat": time.Now().Unix(),
-		"jti": string(refreshRandId),
-		"uid": userId,
-	}
+	return hex.EncodeToString(id), nil
+}
 
-	refreshToken, err = jwt.NewWithClaims(jwt.SigningMethodEdDSA, refreshClaims).SignedString(j.refreshPrivateKey)
+func (j *AuthJwt) Sign(userId int64) (accessToken string, refreshToken string, err error) {
+	pair, err := j.Issue(Subject{UserID: userId})
 	if err != nil {
-		return "", "", fmt.Errorf("failed to sign refresh token: %w", err)
+		return "", "", err
 	}
 
-	return accessToken, refreshToken, nil
+	return pair.AccessToken, pair.RefreshToken, nil
 }
 
-var ErrInvalidSigningMethod = errors.New("invalid signing method")
-var ErrExpired = errors.New("token expired")
-var ErrInvalid = errors.New("token invalid")
-var ErrClaims = errors.New("token claims invalid")
+// Issue signs a new access and refresh token pair for the given subject.
+func (j *AuthJwt) Issue(subject Subject) (TokenPair, error) {
+	familyId := subject.FamilyID
+	if familyId == "" {
+		id, err := randomId()
+		if err != nil {
+			return TokenPair{}, fmt.Errorf("failed to generate family id: %w", err)
+		}
 
-func (j *AuthJwt) VerifyAccessToken(token string) (userId int64, err error) {
-	if token == "" {
-		return 0, ErrInvalid
+		familyId = id
 	}
 
-	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
-		_, ok := t.Method.(*jwt.SigningMethodEd25519)
-		if !ok {
-			return nil, ErrInvalidSigningMethod
-		}
-		return j.accessPublicKey, nil
-	})
+	now := time.Now()
+
+	accessId, err := randomId()
 	if err != nil {
-		if parsedToken != nil && !parsedToken.Valid {
-			// Check if the error is a type of jwt.ValidationError
-			validationError, ok := err.(*jwt.ValidationError)
-			if ok {
-				if validationError.Errors&jwt.ValidationErrorExpired != 0 {
-					return 0, ErrExpired
-				}
+		return TokenPair{}, fmt.Errorf("failed to generate access token id: %w", err)
+	}
 
-				if validationError.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
-					return 0, ErrInvalid
-				}
+	accessClaims := Claims{
+		ID:         accessId,
+		UserID:     subject.UserID,
+		FamilyID:   familyId,
+		Generation: subject.Generation,
+		IssuedAt:   now,
+		NotBefore:  now,
+		ExpiresAt:  now.Add(j.accessTokenTTL),
+	}
 
-				if validationError.Errors&jwt.ValidationErrorClaimsInvalid != 0 {
-					return 0, ErrClaims
-				}
+	accessToken, err := j.sign(accessClaims, j.accessKeys[0])
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to sign access token: %w", err)
+	}
 
-				return 0, fmt.Errorf("failed to parse access token: %w", err)
-			}
+	refreshId, err := randomId()
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to generate refresh token id: %w", err)
+	}
 
-			return 0, fmt.Errorf("non-validation error during parsing token: %w", err)
-		}
+	refreshClaims := Claims{
+		ID:         refreshId,
+		UserID:     subject.UserID,
+		FamilyID:   familyId,
+		Generation: subject.Generation,
+		IssuedAt:   now,
+		// The refresh token only becomes usable shortly
+		// before the access token expires.
+		NotBefore: now.Add(j.accessTokenTTL - time.Minute),
+		ExpiresAt: now.Add(j.refreshTokenTTL),
+	}
 
-		return 0, fmt.Errorf("token is valid or parsedToken is not nil: %w", err)
+	refreshToken, err := j.sign(refreshClaims, j.refreshKeys[0])
+	if err != nil {
+		return TokenPair{}, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
 
-	claims, ok := parsedToken.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, ErrClaims
+	return TokenPair{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		AccessClaims:  accessClaims,
+		RefreshClaims: refreshClaims,
+	}, nil
+}
+
+// IssueAccessToken signs a single access token that can't be refreshed,
+// valid for ttl. It is used for impersonation, where the token must not
+// outlive the reason it was issued for.
+func (j *AuthJwt) IssueAccessToken(subject Subject, ttl time.Duration) (string, Claims, error) {
+	if ttl <= 0 || ttl > j.accessTokenTTL {
+		ttl = j.accessTokenTTL
 	}
 
-	if !claims.VerifyAudience(j.audience, true) {
-		return 0, ErrInvalid
+	id, err := randomId()
+	if err != nil {
+		return "", Claims{}, fmt.Errorf("failed to generate access token id: %w", err)
 	}
 
-	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
-		return 0, ErrExpired
+	now := time.Now()
+	claims := Claims{
+		ID:             id,
+		UserID:         subject.UserID,
+		FamilyID:       subject.FamilyID,
+		Generation:     subject.Generation,
+		ImpersonatorID: subject.ImpersonatorID,
+		ReadOnly:       subject.ReadOnly,
+		IssuedAt:       now,
+		NotBefore:      now,
+		ExpiresAt:      now.Add(ttl),
 	}
 
-	if !claims.VerifyIssuer(j.issuer, true) {
-		return 0, ErrInvalid
+	token, err := j.sign(claims, j.accessKeys[0])
+	if err != nil {
+		return "", Claims{}, fmt.Errorf("failed to sign access token: %w", err)
 	}
 
-	if !claims.VerifyNotBefore(time.Now().Unix(), true) {
-		return 0, ErrInvalid
+	return token, claims, nil
+}
+
+func (j *AuthJwt) sign(claims Claims, key Key) (string, error) {
+	mapClaims := jwt.MapClaims{
+		"iss": j.issuer,
+		"sub": j.subject,
+		"aud": j.audience,
+		"exp": claims.ExpiresAt.Unix(),
+		"nbf": claims.NotBefore.Unix(),
+		"iat": claims.IssuedAt.Unix(),
+		"jti": claims.ID,
+		"uid": claims.UserID,
+		"fam": claims.FamilyID,
+		"gen": claims.Generation,
 	}
 
-	jwtId, ok := claims["jti"].(string)
-	if !ok {
-		return 0, ErrClaims
+	if claims.ImpersonatorID != 0 {
+		mapClaims["imp"] = claims.ImpersonatorID
+		mapClaims["ro"] = claims.ReadOnly
 	}
 
-	if jwtId == "" {
-		return 0, ErrClaims
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, mapClaims)
+
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
 	}
 
-	userIdF, ok := claims["uid"].(float64)
-	if !ok {
-		return 0, ErrClaims
+	return token.SignedString(key.PrivateKey)
+}
+
+var ErrInvalidSigningMethod = errors.New("invalid signing method")
+var ErrExpired = errors.New("token expired")
+var ErrInvalid = errors.New("token invalid")
+var ErrClaims = errors.New("token claims invalid")
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// IsForged reports whether the error of a parse means the token was not
+// issued by Kodiiing: it is malformed, has a bad signature, or is signed by
+// an unknown key. Expired tokens are not forged.
+func IsForged(err error) bool {
+	return errors.Is(err, ErrInvalid) ||
+		errors.Is(err, ErrClaims) ||
+		errors.Is(err, ErrInvalidSigningMethod) ||
+		errors.Is(err, ErrUnknownKey) ||
+		errors.Is(err, jwt.ErrTokenMalformed) ||
+		errors.Is(err, jwt.ErrTokenSignatureInvalid) ||
+		errors.Is(err, jwt.ErrTokenUnverifiable)
+}
+
+func (j *AuthJwt) VerifyAccessToken(token string) (userId int64, err error) {
+	claims, err := j.ParseAccessToken(token)
+	if err != nil {
+		return 0, err
 	}
 
-	return int64(userIdF), nil
+	return claims.UserID, nil
 }
 
 func (j *AuthJwt) VerifyRefreshToken(token string) (userId int64, err error) {
+	claims, err := j.ParseRefreshToken(token)
+	if err != nil {
+		return 0, err
+	}
+
+	return claims.UserID, nil
+}
+
+// ParseAccessToken verifies the access token and returns its claims.
+func (j *AuthJwt) ParseAccessToken(token string) (Claims, error) {
+	return j.parse(token, j.accessKeys)
+}
+
+// ParseRefreshToken verifies the refresh token and returns its claims.
+func (j *AuthJwt) ParseRefreshToken(token string) (Claims, error) {
+	return j.parse(token, j.refreshKeys)
+}
+
+func (j *AuthJwt) parse(token string, keys []Key) (Claims, error) {
 	if token == "" {
-		return 0, ErrInvalid
+		return Claims{}, ErrInvalid
 	}
 
 	parsedToken, err := jwt.Parse(token, func(t *jwt.Token) (interface{}, error) {
@@ -165,7 +329,17 @@ func (j *AuthJwt) VerifyRefreshToken(token string) (userId int64, err error) {
 		if !ok {
 			return nil, ErrInvalidSigningMethod
 		}
-		return j.refreshPublicKey, nil
+
+		// Tokens signed without a key ID have a kid of "",
+		// which matches keys that were configured without one.
+		keyId, _ := t.Header["kid"].(string)
+		for _, key := range keys {
+			if key.ID == keyId {
+				return key.PublicKey, nil
+			}
+		}
+
+		return nil, ErrUnknownKey
 	})
 	if err != nil {
 		if parsedToken != nil && !parsedToken.Valid {
@@ -173,64 +347,91 @@ func (j *AuthJwt) VerifyRefreshToken(token string) (userId int64, err error) {
 			validationError, ok := err.(*jwt.ValidationError)
 			if ok {
 				if validationError.Errors&jwt.ValidationErrorExpired != 0 {
-					return 0, ErrExpired
+					return Claims{}, ErrExpired
 				}
 
 				if validationError.Errors&jwt.ValidationErrorSignatureInvalid != 0 {
-					return 0, ErrInvalid
+					return Claims{}, ErrInvalid
 				}
 
 				if validationError.Errors&jwt.ValidationErrorClaimsInvalid != 0 {
-					return 0, ErrClaims
+					return Claims{}, ErrClaims
 				}
 
 				if validationError.Errors&jwt.ValidationErrorNotValidYet != 0 {
-					return 0, ErrInvalid
+					return Claims{}, ErrInvalid
 				}
 
-				return 0, fmt.Errorf("failed to parse access token: %w", err)
+				return Claims{}, fmt.Errorf("failed to parse token: %w", err)
 			}
 
-			return 0, fmt.Errorf("non-validation error during parsing token: %w", err)
+			return Claims{}, fmt.Errorf("non-validation error during parsing token: %w", err)
 		}
 
-		return 0, fmt.Errorf("token is valid or parsedToken is not nil: %w", err)
+		return Claims{}, fmt.Errorf("token is valid or parsedToken is not nil: %w", err)
 	}
 
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 	if !ok {
-		return 0, ErrClaims
+		return Claims{}, ErrClaims
 	}
 
 	if !claims.VerifyAudience(j.audience, true) {
-		return 0, ErrInvalid
+		return Claims{}, ErrInvalid
 	}
 
 	if !claims.VerifyExpiresAt(time.Now().Unix(), true) {
-		return 0, ErrExpired
+		return Claims{}, ErrExpired
 	}
 
 	if !claims.VerifyIssuer(j.issuer, true) {
-		return 0, ErrInvalid
+		return Claims{}, ErrInvalid
 	}
 
 	if !claims.VerifyNotBefore(time.Now().Unix(), true) {
-		return 0, ErrInvalid
+		return Claims{}, ErrInvalid
 	}
 
 	jwtId, ok := claims["jti"].(string)
 	if !ok {
-		return 0, ErrClaims
+		return Claims{}, ErrClaims
 	}
 
 	if jwtId == "" {
-		return 0, ErrClaims
+		return Claims{}, ErrClaims
 	}
 
-	userId, ok = claims["uid"].(int64)
+	// JSON numbers are always decoded as float64 by MapClaims.
+	userIdF, ok := claims["uid"].(float64)
+	if !ok {
+		return Claims{}, ErrClaims
+	}
+
+	// Tokens that were issued before token families and generations
+	// existed do not carry these claims.
+	familyId, _ := claims["fam"].(string)
+	generation, _ := claims["gen"].(float64)
+	impersonatorId, _ := claims["imp"].(float64)
+	readOnly, _ := claims["ro"].(bool)
+
+	return Claims{
+		ID:             jwtId,
+		UserID:         int64(userIdF),
+		FamilyID:       familyId,
+		Generation:     int64(generation),
+		ImpersonatorID: int64(impersonatorId),
+		ReadOnly:       readOnly,
+		IssuedAt:       numericDate(claims["iat"]),
+		NotBefore:      numericDate(claims["nbf"]),
+		ExpiresAt:      numericDate(claims["exp"]),
+	}, nil
+}
+
+func numericDate(v any) time.Time {
+	f, ok := v.(float64)
 	if !ok {
-		return 0, ErrClaims
+		return time.Time{}
 	}
 
-	return userId, nil
+	return time.Unix(int64(f), 0)
 }
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 var authJwt *auth_jwt.AuthJwt
@@ -95,3 +96,118 @@ func TestVerifyEmpty(t *testing.T) {
 		t.Errorf("error is not ErrInvalid: %v", err)
 	}
 }
+
+func TestIsForged(t *testing.T) {
+	accessToken, _, err := authJwt.Sign(1)
+	if err != nil {
+		t.Fatalf("failed to sign access token: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"malformed":     "not-a-token",
+		"bad signature": accessToken[:len(accessToken)-4] + "AAAA",
+	} {
+		_, err := authJwt.ParseAccessToken(token)
+		if err == nil || !auth_jwt.IsForged(err) {
+			t.Errorf("%s: expected a forged token, got %v", name, err)
+		}
+	}
+
+	if auth_jwt.IsForged(auth_jwt.ErrExpired) {
+		t.Error("expired tokens are not forged")
+	}
+}
+
+func TestIssueFamily(t *testing.T) {
+	pair, err := authJwt.Issue(auth_jwt.Subject{UserID: 1})
+	if err != nil {
+		t.Fatalf("failed to issue token pair: %v", err)
+	}
+
+	if pair.AccessClaims.FamilyID == "" {
+		t.Error("family id is empty")
+	}
+
+	if pair.AccessClaims.FamilyID != pair.RefreshClaims.FamilyID {
+		t.Errorf("access and refresh family id differ: %s != %s", pair.AccessClaims.FamilyID, pair.RefreshClaims.FamilyID)
+	}
+
+	rotated, err := authJwt.Issue(auth_jwt.Subject{UserID: 1, FamilyID: pair.RefreshClaims.FamilyID, Generation: 2})
+	if err != nil {
+		t.Fatalf("failed to issue token pair: %v", err)
+	}
+
+	if rotated.RefreshClaims.FamilyID != pair.RefreshClaims.FamilyID {
+		t.Errorf("rotated family id differ: %s != %s", rotated.RefreshClaims.FamilyID, pair.RefreshClaims.FamilyID)
+	}
+
+	if rotated.RefreshClaims.ID == pair.RefreshClaims.ID {
+		t.Error("rotated refresh token has the same id")
+	}
+
+	claims, err := authJwt.ParseAccessToken(rotated.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to parse access token: %v", err)
+	}
+
+	if claims.ID != rotated.AccessClaims.ID {
+		t.Errorf("unexpected token id: %s", claims.ID)
+	}
+
+	if claims.FamilyID != pair.AccessClaims.FamilyID {
+		t.Errorf("unexpected family id: %s", claims.FamilyID)
+	}
+
+	if claims.Generation != 2 {
+		t.Errorf("unexpected generation: %d", claims.Generation)
+	}
+}
+
+func TestIssueAccessToken(t *testing.T) {
+	token, issued, err := authJwt.IssueAccessToken(auth_jwt.Subject{UserID: 2, ImpersonatorID: 1, ReadOnly: true}, time.Minute*15)
+	if err != nil {
+		t.Fatalf("failed to issue access token: %v", err)
+	}
+
+	if issued.ExpiresAt.Sub(issued.IssuedAt) != time.Minute*15 {
+		t.Errorf("unexpected ttl: %s", issued.ExpiresAt.Sub(issued.IssuedAt))
+	}
+
+	claims, err := authJwt.ParseAccessToken(token)
+	if err != nil {
+		t.Fatalf("failed to parse access token: %v", err)
+	}
+
+	if claims.UserID != 2 || claims.ImpersonatorID != 1 || !claims.ReadOnly {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+
+	_, err = authJwt.ParseRefreshToken(token)
+	if err == nil {
+		t.Error("access token is accepted as a refresh token")
+	}
+
+	// The ttl can't exceed the one of regular access tokens.
+	_, issued, err = authJwt.IssueAccessToken(auth_jwt.Subject{UserID: 2, ImpersonatorID: 1}, time.Hour*24)
+	if err != nil {
+		t.Fatalf("failed to issue access token: %v", err)
+	}
+
+	if issued.ExpiresAt.Sub(issued.IssuedAt) != time.Hour {
+		t.Errorf("unexpected ttl: %s", issued.ExpiresAt.Sub(issued.IssuedAt))
+	}
+
+	pair, err := authJwt.Issue(auth_jwt.Subject{UserID: 1})
+	if err != nil {
+		t.Fatalf("failed to issue token pair: %v", err)
+	}
+
+	claims, err = authJwt.ParseAccessToken(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to parse access token: %v", err)
+	}
+
+	if claims.ImpersonatorID != 0 || claims.ReadOnly {
+		t.Errorf("regular token has impersonation claims: %+v", claims)
+	}
+}
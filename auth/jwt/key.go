@@ -0,0 +1,134 @@
+package auth_jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Key is an Ed25519 key pair, identified by its key ID ("kid").
+type Key struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// GenerateKey creates a new Ed25519 key pair. The key ID is set
+// to the key's thumbprint.
+func GenerateKey() (Key, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Key{}, fmt.Errorf("generating ed25519 key: %w", err)
+	}
+
+	return Key{
+		ID:         Thumbprint(publicKey),
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}, nil
+}
+
+var ErrInvalidPEM = errors.New("invalid pem block")
+
+// ParsePrivateKeyPEM parses a PKCS #8 PEM encoded Ed25519 private key, such as
+// the one produced by `openssl genpkey -algorithm ed25519`. An empty id falls
+// back to the key's thumbprint.
+func ParsePrivateKeyPEM(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return Key{}, ErrInvalidPEM
+	}
+
+	parsedKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return Key{}, fmt.Errorf("parsing private key: %w", err)
+	}
+
+	privateKey, ok := parsedKey.(ed25519.PrivateKey)
+	if !ok {
+		return Key{}, fmt.Errorf("private key is not an ed25519 key")
+	}
+
+	publicKey := privateKey.Public().(ed25519.PublicKey)
+	if id == "" {
+		id = Thumbprint(publicKey)
+	}
+
+	return Key{
+		ID:         id,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+	}, nil
+}
+
+// MarshalPrivateKeyPEM encodes the private key as a PKCS #8 PEM block.
+func MarshalPrivateKeyPEM(key Key) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling private key: %w", err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Thumbprint computes the RFC 7638 JWK thumbprint of an Ed25519 public key.
+func Thumbprint(publicKey ed25519.PublicKey) string {
+	// The members must be in lexicographical order, without whitespace.
+	canonical := `{"crv":"Ed25519","kty":"OKP","x":"` + base64.RawURLEncoding.EncodeToString(publicKey) + `"}`
+	sum := sha256.Sum256([]byte(canonical))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// JSONWebKey is the JWK representation of an Ed25519 public key.
+// See https://www.rfc-editor.org/rfc/rfc8037#section-2
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys that access tokens can be verified with.
+// Refresh tokens are only ever verified by Kodiiing itself, so their
+// keys are not published.
+func (j *AuthJwt) JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: make([]JSONWebKey, 0, len(j.accessKeys))}
+	for _, key := range j.accessKeys {
+		set.Keys = append(set.Keys, JSONWebKey{
+			KeyType:   "OKP",
+			Curve:     "Ed25519",
+			X:         base64.RawURLEncoding.EncodeToString(key.PublicKey),
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: "EdDSA",
+		})
+	}
+
+	return set
+}
+
+// ServeJWKS writes the JWKS document, meant to be mounted
+// on /.well-known/jwks.json.
+func (j *AuthJwt) ServeJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	e := json.NewEncoder(w).Encode(j.JWKS())
+	if e != nil {
+		log.Printf("[AuthJwt - ServeJWKS] writing to response stream: %s", e.Error())
+	}
+}
@@ -0,0 +1,129 @@
+package auth_jwt_test
+
+import (
+	"encoding/base64"
+	"errors"
+	auth_jwt "kodiiing/auth/jwt"
+	"testing"
+)
+
+func TestPrivateKeyPEM(t *testing.T) {
+	key, err := auth_jwt.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	encoded, err := auth_jwt.MarshalPrivateKeyPEM(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	parsed, err := auth_jwt.ParsePrivateKeyPEM("", encoded)
+	if err != nil {
+		t.Fatalf("failed to parse key: %v", err)
+	}
+
+	if parsed.ID != key.ID {
+		t.Errorf("key id differ: %s != %s", parsed.ID, key.ID)
+	}
+
+	if !parsed.PublicKey.Equal(key.PublicKey) {
+		t.Error("public key differ")
+	}
+
+	_, err = auth_jwt.ParsePrivateKeyPEM("", []byte("not a pem"))
+	if !errors.Is(err, auth_jwt.ErrInvalidPEM) {
+		t.Errorf("error is not ErrInvalidPEM: %v", err)
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldAccessKey, err := auth_jwt.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	newAccessKey, err := auth_jwt.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	refreshKey, err := auth_jwt.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	before, err := auth_jwt.New(auth_jwt.Config{
+		AccessKeys:  []auth_jwt.Key{oldAccessKey},
+		RefreshKeys: []auth_jwt.Key{refreshKey},
+		Issuer:      "kodiiing",
+		Subject:     "user",
+		Audience:    "kodiiing",
+	})
+	if err != nil {
+		t.Fatalf("failed to create jwt: %v", err)
+	}
+
+	accessToken, _, err := before.Sign(1)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+
+	// The new key signs, the old one is still accepted.
+	after, err := auth_jwt.New(auth_jwt.Config{
+		AccessKeys:  []auth_jwt.Key{newAccessKey, oldAccessKey},
+		RefreshKeys: []auth_jwt.Key{refreshKey},
+		Issuer:      "kodiiing",
+		Subject:     "user",
+		Audience:    "kodiiing",
+	})
+	if err != nil {
+		t.Fatalf("failed to create jwt: %v", err)
+	}
+
+	userId, err := after.VerifyAccessToken(accessToken)
+	if err != nil {
+		t.Errorf("failed to verify token signed by the old key: %v", err)
+	}
+
+	if userId != 1 {
+		t.Errorf("user id is not 1: %d", userId)
+	}
+
+	// Once the old key is retired, its tokens are rejected.
+	retired, err := auth_jwt.New(auth_jwt.Config{
+		AccessKeys:  []auth_jwt.Key{newAccessKey},
+		RefreshKeys: []auth_jwt.Key{refreshKey},
+		Issuer:      "kodiiing",
+		Subject:     "user",
+		Audience:    "kodiiing",
+	})
+	if err != nil {
+		t.Fatalf("failed to create jwt: %v", err)
+	}
+
+	_, err = retired.VerifyAccessToken(accessToken)
+	if !errors.Is(err, auth_jwt.ErrUnknownKey) {
+		t.Errorf("error is not ErrUnknownKey: %v", err)
+	}
+
+	jwks := after.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+	}
+
+	if jwks.Keys[0].KeyID != newAccessKey.ID {
+		t.Errorf("unexpected key id: %s", jwks.Keys[0].KeyID)
+	}
+
+	if jwks.Keys[0].X != base64.RawURLEncoding.EncodeToString(newAccessKey.PublicKey) {
+		t.Errorf("unexpected public key: %s", jwks.Keys[0].X)
+	}
+}
+
+func TestNewWithoutKeys(t *testing.T) {
+	_, err := auth_jwt.New(auth_jwt.Config{})
+	if !errors.Is(err, auth_jwt.ErrNoKeys) {
+		t.Errorf("error is not ErrNoKeys: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package auth_magiclink signs the single-use links of the email login.
+//
+// A token is "<base64url(payload)>.<base64url(HMAC-SHA256(payload))>" where the
+// payload is "<id>|<expires at, unix seconds>|<email>". The signature only proves
+// that Kodiiing issued the link, the caller records the ID when the link is
+// issued and marks it as used when it is consumed.
+package auth_magiclink
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinKeySize is the minimum size of the HMAC key.
+const MinKeySize = 32
+
+// DefaultTTL is how long a link is valid for.
+const DefaultTTL = time.Minute * 15
+
+var ErrInvalidToken = errors.New("invalid magic link")
+var ErrExpired = errors.New("magic link is expired")
+
+type Config struct {
+	Key []byte
+	// URL is the page of the frontend that consumes the link, the
+	// token is added as the "token" query parameter.
+	URL string
+	// TTL defaults to DefaultTTL.
+	TTL time.Duration
+}
+
+type MagicLink struct {
+	key []byte
+	url *url.URL
+	ttl time.Duration
+}
+
+// Link is an issued magic link.
+type Link struct {
+	ID        string
+	Email     string
+	ExpiresAt time.Time
+	Token     string
+	URL       string
+}
+
+func New(config Config) (*MagicLink, error) {
+	if len(config.Key) < MinKeySize {
+		return nil, fmt.Errorf("magic link key must be at least %d bytes", MinKeySize)
+	}
+
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing magic link url: %w", err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("magic link url must be an absolute http(s) url: %q", config.URL)
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultTTL
+	}
+
+	return &MagicLink{key: config.Key, url: u, ttl: config.TTL}, nil
+}
+
+// NormalizeEmail validates the address, and returns it in the form
+// that identifies a user.
+func NormalizeEmail(address string) (string, error) {
+	parsed, err := mail.ParseAddress(strings.TrimSpace(address))
+	if err != nil {
+		return "", fmt.Errorf("invalid email address: %w", err)
+	}
+
+	return strings.ToLower(parsed.Address), nil
+}
+
+// Issue signs a new link for the normalized email address.
+func (m *MagicLink) Issue(email string, now time.Time) (Link, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Link{}, fmt.Errorf("generating id: %w", err)
+	}
+
+	link := Link{
+		ID:        hex.EncodeToString(id),
+		Email:     email,
+		ExpiresAt: now.Add(m.ttl).Truncate(time.Second),
+	}
+
+	payload := link.ID + "|" + strconv.FormatInt(link.ExpiresAt.Unix(), 10) + "|" + link.Email
+	link.Token = base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." + base64.RawURLEncoding.EncodeToString(m.sign(payload))
+
+	u := *m.url
+	query := u.Query()
+	query.Set("token", link.Token)
+	u.RawQuery = query.Encode()
+	link.URL = u.String()
+
+	return link, nil
+}
+
+// Verify checks the signature and the expiry of the token. Link.Token and
+// Link.URL are left empty.
+func (m *MagicLink) Verify(token string, now time.Time) (Link, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return Link{}, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return Link{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return Link{}, ErrInvalidToken
+	}
+
+	if !hmac.Equal(signature, m.sign(string(payload))) {
+		return Link{}, ErrInvalidToken
+	}
+
+	parts := strings.SplitN(string(payload), "|", 3)
+	if len(parts) != 3 {
+		return Link{}, ErrInvalidToken
+	}
+
+	expiresAt, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return Link{}, ErrInvalidToken
+	}
+
+	link := Link{ID: parts[0], ExpiresAt: time.Unix(expiresAt, 0), Email: parts[2]}
+	if !now.Before(link.ExpiresAt) {
+		return Link{}, ErrExpired
+	}
+
+	return link, nil
+}
+
+func (m *MagicLink) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
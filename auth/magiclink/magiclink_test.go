@@ -0,0 +1,111 @@
+package auth_magiclink_test
+
+import (
+	"bytes"
+	"errors"
+	auth_magiclink "kodiiing/auth/magiclink"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newMagicLink(t *testing.T, key byte) *auth_magiclink.MagicLink {
+	t.Helper()
+
+	m, err := auth_magiclink.New(auth_magiclink.Config{
+		Key: bytes.Repeat([]byte{key}, auth_magiclink.MinKeySize),
+		URL: "https://kodiiing.test/login/email?lang=id",
+	})
+	if err != nil {
+		t.Fatalf("failed to create magic link: %v", err)
+	}
+
+	return m
+}
+
+func TestIssueVerify(t *testing.T) {
+	m := newMagicLink(t, 1)
+	now := time.Now()
+
+	link, err := m.Issue("student@example.com", now)
+	if err != nil {
+		t.Fatalf("failed to issue link: %v", err)
+	}
+
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		t.Fatalf("failed to parse link url: %v", err)
+	}
+
+	if u.Query().Get("token") != link.Token || u.Query().Get("lang") != "id" {
+		t.Errorf("unexpected link url: %s", link.URL)
+	}
+
+	verified, err := m.Verify(link.Token, now)
+	if err != nil {
+		t.Fatalf("failed to verify link: %v", err)
+	}
+
+	if verified.ID != link.ID || verified.Email != link.Email || !verified.ExpiresAt.Equal(link.ExpiresAt) {
+		t.Errorf("verified link does not match: %+v, %+v", verified, link)
+	}
+
+	_, err = m.Verify(link.Token, now.Add(auth_magiclink.DefaultTTL+time.Second))
+	if !errors.Is(err, auth_magiclink.ErrExpired) {
+		t.Errorf("error is not ErrExpired: %v", err)
+	}
+}
+
+func TestVerifyInvalid(t *testing.T) {
+	m := newMagicLink(t, 1)
+	now := time.Now()
+
+	link, err := m.Issue("student@example.com", now)
+	if err != nil {
+		t.Fatalf("failed to issue link: %v", err)
+	}
+
+	other, err := newMagicLink(t, 2).Issue("student@example.com", now)
+	if err != nil {
+		t.Fatalf("failed to issue link: %v", err)
+	}
+
+	payload, signature, _ := strings.Cut(link.Token, ".")
+	otherPayload, _, _ := strings.Cut(other.Token, ".")
+
+	for _, token := range []string{"", "abc", payload, payload + ".", other.Token, otherPayload + "." + signature, "!!." + signature} {
+		_, err := m.Verify(token, now)
+		if !errors.Is(err, auth_magiclink.ErrInvalidToken) {
+			t.Errorf("%q: error is not ErrInvalidToken: %v", token, err)
+		}
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	email, err := auth_magiclink.NormalizeEmail("  Student <Student@Example.COM> ")
+	if err != nil {
+		t.Fatalf("failed to normalize email: %v", err)
+	}
+
+	if email != "student@example.com" {
+		t.Errorf("unexpected email: %s", email)
+	}
+
+	_, err = auth_magiclink.NormalizeEmail("student")
+	if err == nil {
+		t.Error("expected error for an invalid email address")
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := auth_magiclink.New(auth_magiclink.Config{Key: []byte("short"), URL: "https://kodiiing.test"})
+	if err == nil {
+		t.Error("expected error for a short key")
+	}
+
+	_, err = auth_magiclink.New(auth_magiclink.Config{Key: bytes.Repeat([]byte{1}, 32), URL: "/login"})
+	if err == nil {
+		t.Error("expected error for a relative url")
+	}
+}
@@ -5,19 +5,30 @@ import (
 	"errors"
 	"fmt"
 	"kodiiing/auth"
+	"kodiiing/auth/audit"
 	auth_jwt "kodiiing/auth/jwt"
+	auth_pat "kodiiing/auth/pat"
+	"kodiiing/auth/revocation"
 	auth_stub "kodiiing/auth/stub"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type AuthMiddleware struct {
-	jwt     *auth_jwt.AuthJwt
-	service auth_stub.AuthenticationServiceServer
+	jwt        *auth_jwt.AuthJwt
+	revocation *revocation.Store
+	audit      *audit.Log
+	service    auth_stub.AuthenticationServiceServer
 }
 
-func NewAuthMiddleware(service auth_stub.AuthenticationServiceServer, jwt *auth_jwt.AuthJwt) *AuthMiddleware {
+func NewAuthMiddleware(service auth_stub.AuthenticationServiceServer, jwt *auth_jwt.AuthJwt, revocation *revocation.Store, audit *audit.Log) *AuthMiddleware {
 	return &AuthMiddleware{
-		jwt:     jwt,
-		service: service,
+		jwt:        jwt,
+		revocation: revocation,
+		audit:      audit,
+		service:    service,
 	}
 }
 
@@ -27,14 +38,46 @@ func (a *AuthMiddleware) Authenticate(ctx context.Context, accessToken string) (
 		return nil, auth.ErrParameterEmpty
 	}
 
+	// Refuse clients that are guessing tokens
+	err := a.audit.Blocked(ctx, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// Personal access tokens are looked up on the database, and
+	// carry the scopes that the token was created with.
+	if auth_pat.IsPersonalAccessToken(accessToken) {
+		user, err := a.service.AuthenticatePersonalAccessToken(ctx, accessToken)
+		if err != nil {
+			a.recordFailure(ctx, 0, err)
+			return nil, err
+		}
+
+		return &user, nil
+	}
+
 	// Parse accessToken as json web token
-	userId, err := a.jwt.VerifyAccessToken(accessToken)
+	claims, err := a.jwt.ParseAccessToken(accessToken)
 	if err != nil {
+		err = fmt.Errorf("%w: %w", auth.ErrUnauthenticated, err)
+		a.recordFailure(ctx, 0, err)
+		return nil, err
+	}
+
+	err = a.audit.Blocked(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make sure the token was not revoked by a logout
+	err = a.revocation.Check(ctx, claims)
+	if err != nil {
+		a.recordFailure(ctx, claims.UserID, err)
 		return nil, err
 	}
 
 	// Get user from service
-	user, err := a.service.GetUserById(ctx, userId)
+	user, err := a.service.GetUserById(ctx, claims.UserID)
 	if err != nil {
 		if errors.Is(err, auth.ErrUserNotFound) {
 			return nil, auth.ErrUserNotFound
@@ -43,5 +86,73 @@ func (a *AuthMiddleware) Authenticate(ctx context.Context, accessToken string) (
 		return nil, fmt.Errorf("getting user: %w", err)
 	}
 
+	if claims.ImpersonatorID != 0 {
+		err = a.impersonate(ctx, &user, claims)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &user, nil
 }
+
+// impersonate marks the user as acted on by the admin that the token was
+// issued to. The admin must still be allowed to impersonate, so removing
+// the role ends every impersonation right away.
+func (a *AuthMiddleware) impersonate(ctx context.Context, user *auth.User, claims auth_jwt.Claims) error {
+	admin, err := a.service.GetUserById(ctx, claims.ImpersonatorID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return fmt.Errorf("%w: impersonator not found", auth.ErrUnauthenticated)
+		}
+
+		return fmt.Errorf("getting impersonator: %w", err)
+	}
+
+	if !admin.HasPermission(auth.PermissionUserImpersonate) {
+		err = fmt.Errorf("%w: impersonator lost the %s permission", auth.ErrTokenRevoked, auth.PermissionUserImpersonate)
+		a.recordFailure(ctx, admin.ID, err)
+		return err
+	}
+
+	user.ImpersonatedBy = admin.ID
+	user.ReadOnly = claims.ReadOnly
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Int64("auth.user_id", user.ID),
+		attribute.Int64("auth.impersonator_id", admin.ID),
+		attribute.Bool("auth.read_only", claims.ReadOnly),
+	)
+
+	return nil
+}
+
+// recordFailure records a failed authentication, errors on
+// Kodiiing's side are not the client's failure. Only guesses
+// count towards blocking the client.
+func (a *AuthMiddleware) recordFailure(ctx context.Context, userId int64, err error) {
+	if auth.StatusCode(err) != http.StatusUnauthorized {
+		return
+	}
+
+	a.audit.Record(ctx, audit.Event{
+		Type:    audit.EventAuthenticate,
+		Outcome: audit.OutcomeFailure,
+		UserID:  userId,
+		Detail:  err.Error(),
+		Guess:   audit.Guessed(err),
+	})
+}
+
+// Authorize checks whether any role of the user allows the permission.
+func (a *AuthMiddleware) Authorize(ctx context.Context, user *auth.User, permission auth.Permission) error {
+	if user == nil {
+		return auth.ErrUnauthenticated
+	}
+
+	if !user.HasPermission(permission) {
+		return fmt.Errorf("%w: %s is required", auth.ErrForbidden, permission)
+	}
+
+	return nil
+}
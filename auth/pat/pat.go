@@ -0,0 +1,45 @@
+// Package auth_pat generates personal access tokens.
+//
+// A token is "kdi_pat_<base64url(32 random bytes)>". Only the SHA-256 hash of
+// a token is stored, the token itself is shown once to the user who created it.
+// The prefix tells tokens apart from JSON web tokens, and makes leaked tokens
+// easy to scan for.
+package auth_pat
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Prefix is prepended to every personal access token.
+const Prefix = "kdi_pat_"
+
+const secretSize = 32
+
+// Generate returns a new token along with the hash to store.
+func Generate() (token string, hash string, err error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("generating secret: %w", err)
+	}
+
+	token = Prefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, Hash(token), nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the token. The secret has
+// enough entropy that a slow password hash is not needed.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsPersonalAccessToken reports whether the value looks like a personal
+// access token rather than a JSON web token.
+func IsPersonalAccessToken(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
@@ -0,0 +1,49 @@
+package auth_pat_test
+
+import (
+	auth_pat "kodiiing/auth/pat"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	token, hash, err := auth_pat.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if !strings.HasPrefix(token, auth_pat.Prefix) {
+		t.Errorf("token is missing the prefix: %s", token)
+	}
+
+	if !auth_pat.IsPersonalAccessToken(token) {
+		t.Error("generated token is not recognized")
+	}
+
+	if hash != auth_pat.Hash(token) {
+		t.Error("returned hash does not match the token")
+	}
+
+	if len(hash) != 64 {
+		t.Errorf("expected a 64 characters hash, got %d", len(hash))
+	}
+
+	other, _, err := auth_pat.Generate()
+	if err != nil {
+		t.Fatalf("failed to generate token: %v", err)
+	}
+
+	if other == token {
+		t.Error("generated the same token twice")
+	}
+}
+
+func TestIsPersonalAccessToken(t *testing.T) {
+	if auth_pat.IsPersonalAccessToken("eyJhbGciOiJFZERTQSJ9.eyJzdWIiOiIxIn0.c2ln") {
+		t.Error("json web token is recognized as a personal access token")
+	}
+
+	if auth_pat.IsPersonalAccessToken("") {
+		t.Error("empty value is recognized as a personal access token")
+	}
+}
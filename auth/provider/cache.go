@@ -0,0 +1,141 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// CachedResponse is a previous response that can be revalidated.
+type CachedResponse struct {
+	ETag   string
+	Header http.Header
+	Body   []byte
+}
+
+// ResponseCache stores responses by their URL. Only responses to
+// unauthenticated requests are stored, so a URL identifies the
+// response regardless of the user.
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (CachedResponse, bool)
+	Set(ctx context.Context, key string, response CachedResponse)
+}
+
+// ResponseStore is a ResponseCache in the database. Responses are kept
+// until they have not been revalidated for the retention of Prune, which
+// outlives the interval between two syncs of a user, so a sync sends a
+// conditional request rather than using up the quota.
+type ResponseStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewResponseStore(pool *pgxpool.Pool) (*ResponseStore, error) {
+	if pool == nil {
+		return nil, fmt.Errorf("database connection required on auth/provider module")
+	}
+
+	return &ResponseStore{pool: pool}, nil
+}
+
+// Get marks the response as revalidated, it is about to be.
+func (r *ResponseStore) Get(ctx context.Context, key string) (CachedResponse, bool) {
+	var response CachedResponse
+	var header []byte
+	err := r.pool.QueryRow(
+		ctx,
+		`UPDATE
+			provider_responses
+		SET
+			validated_at = NOW()
+		WHERE
+			key = $1
+		RETURNING
+			etag, header, body`,
+		key,
+	).Scan(&response.ETag, &header, &response.Body)
+	if err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Warn().Err(err).Str("key", key).Msg("getting provider response")
+		}
+
+		return CachedResponse{}, false
+	}
+
+	err = json.Unmarshal(header, &response.Header)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("decoding provider response header")
+		return CachedResponse{}, false
+	}
+
+	return response, true
+}
+
+func (r *ResponseStore) Set(ctx context.Context, key string, response CachedResponse) {
+	header, err := json.Marshal(response.Header)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("encoding provider response header")
+		return
+	}
+
+	// Losing a response only costs a full request, errors are not returned.
+	_, err = r.pool.Exec(
+		ctx,
+		`INSERT INTO
+			provider_responses
+			(key, etag, header, body, validated_at)
+		VALUES
+			($1, $2, $3, $4, NOW())
+		ON CONFLICT (key) DO UPDATE
+			SET
+				etag = EXCLUDED.etag,
+				header = EXCLUDED.header,
+				body = EXCLUDED.body,
+				validated_at = EXCLUDED.validated_at`,
+		key,
+		response.ETag,
+		header,
+		response.Body,
+	)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("storing provider response")
+	}
+}
+
+// Prune deletes the responses that were not revalidated since before.
+func (r *ResponseStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.pool.Exec(ctx, `DELETE FROM provider_responses WHERE validated_at < $1`, before)
+	if err != nil {
+		return 0, fmt.Errorf("pruning provider responses: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// RunPruner deletes the responses that were not revalidated for retention,
+// on every interval until ctx is done.
+func (r *ResponseStore) RunPruner(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := r.Prune(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Error().Err(err).Msg("pruning provider responses")
+				continue
+			}
+
+			log.Debug().Int64("pruned", pruned).Msg("pruned provider responses")
+		}
+	}
+}
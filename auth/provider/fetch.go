@@ -0,0 +1,212 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrRateLimited is returned when the provider rate limits a request
+// for longer than the fetcher is willing to wait.
+var ErrRateLimited = errors.New("rate limited by provider")
+
+// DefaultMaxRepositories caps how many repositories are fetched per user.
+const DefaultMaxRepositories = 1000
+
+// Fetcher performs GET requests against a provider's REST API. Requests
+// that are rate limited are retried with backoff, and responses carrying
+// an ETag are revalidated with If-None-Match on the next request, which
+// does not count against the quota of most providers.
+type Fetcher struct {
+	HTTPClient *http.Client
+	UserAgent  string
+	// Cache stores the responses to revalidate, nil disables
+	// conditional requests.
+	Cache ResponseCache
+	// MaxRetries is how many times a rate limited request is retried.
+	MaxRetries int
+	// MaxWait is the longest the fetcher sleeps before a retry, a
+	// provider asking for a longer wait fails with ErrRateLimited.
+	MaxWait time.Duration
+}
+
+// NewFetcher creates a Fetcher with the default retry policy.
+func NewFetcher(httpClient *http.Client, userAgent string, cache ResponseCache) *Fetcher {
+	return &Fetcher{
+		HTTPClient: httpClient,
+		UserAgent:  userAgent,
+		Cache:      cache,
+		MaxRetries: 3,
+		MaxWait:    time.Minute,
+	}
+}
+
+// Response is a response read in full. NotModified is set when
+// the body is served from the cache after revalidation.
+type Response struct {
+	Header      http.Header
+	Body        []byte
+	NotModified bool
+}
+
+// Get sends a GET request. Only status 200 and 304 are considered
+// successful, the latter being answered from the cache.
+func (f *Fetcher) Get(ctx context.Context, requestUrl string, header http.Header) (Response, error) {
+	var cached CachedResponse
+	var hasCached bool
+	if f.Cache != nil {
+		cached, hasCached = f.Cache.Get(ctx, requestUrl)
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+		if err != nil {
+			return Response{}, fmt.Errorf("error creating request: %w", err)
+		}
+
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		req.Header.Set("User-Agent", f.UserAgent)
+		if hasCached && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		resp, err := f.HTTPClient.Do(req)
+		if err != nil {
+			return Response{}, fmt.Errorf("error sending request: %w", err)
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return Response{}, fmt.Errorf("error reading response: %w", err)
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			if f.Cache != nil && resp.Header.Get("ETag") != "" {
+				f.Cache.Set(ctx, requestUrl, CachedResponse{
+					ETag:   resp.Header.Get("ETag"),
+					Header: paginationHeader(resp.Header),
+					Body:   body,
+				})
+			}
+
+			return Response{Header: resp.Header, Body: body}, nil
+		case resp.StatusCode == http.StatusNotModified && hasCached:
+			return Response{Header: cached.Header, Body: cached.Body, NotModified: true}, nil
+		case isRateLimited(resp):
+			if attempt >= f.MaxRetries {
+				return Response{}, ErrRateLimited
+			}
+
+			wait := retryAfter(resp.Header, attempt, time.Now())
+			if wait > f.MaxWait {
+				return Response{}, fmt.Errorf("%w: retry after %s", ErrRateLimited, wait)
+			}
+
+			select {
+			case <-ctx.Done():
+				return Response{}, ctx.Err()
+			case <-time.After(wait):
+			}
+		default:
+			return Response{}, fmt.Errorf("error response: %d", resp.StatusCode)
+		}
+	}
+}
+
+// isRateLimited reports whether the response is a rate limit rejection.
+// GitHub answers 403 once the quota is exhausted, others answer 429.
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+
+	return resp.StatusCode == http.StatusForbidden &&
+		(resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("Retry-After") != "")
+}
+
+// retryAfter computes how long to wait before retrying, from Retry-After,
+// then from the reset time of the quota, then falling back to an
+// exponential backoff.
+func retryAfter(header http.Header, attempt int, now time.Time) time.Duration {
+	if value := header.Get("Retry-After"); value != "" {
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds) * time.Second
+		}
+
+		if date, err := http.ParseTime(value); err == nil {
+			return max(date.Sub(now), 0)
+		}
+	}
+
+	// GitHub sends X-RateLimit-Reset, GitLab sends RateLimit-Reset,
+	// both as a unix timestamp.
+	for _, key := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if value := header.Get(key); value != "" {
+			if reset, err := strconv.ParseInt(value, 10, 64); err == nil {
+				return max(time.Unix(reset, 0).Sub(now), 0)
+			}
+		}
+	}
+
+	return time.Second * time.Duration(math.Pow(2, float64(attempt)))
+}
+
+// paginationHeader keeps the headers needed to find the next page,
+// so a revalidated page can still be followed.
+func paginationHeader(header http.Header) http.Header {
+	kept := http.Header{}
+	for _, key := range []string{"Link", "X-Next-Page"} {
+		if value := header.Get(key); value != "" {
+			kept.Set(key, value)
+		}
+	}
+
+	return kept
+}
+
+// NextPageURL returns the URL of the next page from the Link header,
+// see https://www.rfc-editor.org/rfc/rfc8288. It returns an empty string
+// on the last page.
+func NextPageURL(header http.Header) string {
+	for _, link := range strings.Split(header.Get("Link"), ",") {
+		target, params, ok := strings.Cut(link, ";")
+		if !ok {
+			continue
+		}
+
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "rel" && strings.Trim(value, `"`) == "next" {
+				target = strings.TrimSpace(target)
+				return strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+			}
+		}
+	}
+
+	return ""
+}
+
+// WithPage returns the URL with the page query parameter set.
+func WithPage(requestUrl string, page string) (string, error) {
+	u, err := url.Parse(requestUrl)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("page", page)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
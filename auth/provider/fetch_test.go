@@ -0,0 +1,129 @@
+package provider_test
+
+import (
+	"context"
+	"errors"
+	"kodiiing/auth/provider"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapResponseCache struct {
+	mu      sync.Mutex
+	entries map[string]provider.CachedResponse
+}
+
+func (m *mapResponseCache) Get(ctx context.Context, key string) (provider.CachedResponse, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	response, ok := m.entries[key]
+	return response, ok
+}
+
+func (m *mapResponseCache) Set(ctx context.Context, key string, response provider.CachedResponse) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries[key] = response
+}
+
+func TestNextPageURL(t *testing.T) {
+	header := http.Header{}
+	header.Set("Link", `<https://api.github.com/user/repos?page=3&per_page=100>; rel="next", <https://api.github.com/user/repos?page=50&per_page=100>; rel="last"`)
+
+	next := provider.NextPageURL(header)
+	if next != "https://api.github.com/user/repos?page=3&per_page=100" {
+		t.Errorf("unexpected next page: %s", next)
+	}
+
+	header.Set("Link", `<https://api.github.com/user/repos?page=1&per_page=100>; rel="first"`)
+	if next := provider.NextPageURL(header); next != "" {
+		t.Errorf("expected no next page, got: %s", next)
+	}
+}
+
+func TestFetcherRateLimited(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	fetcher := provider.NewFetcher(server.Client(), "kodiiing", nil)
+
+	resp, err := fetcher.Get(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+
+	if string(resp.Body) != "[]" || requests != 2 {
+		t.Errorf("unexpected response after %d requests: %s", requests, resp.Body)
+	}
+}
+
+func TestFetcherRateLimitedTooLong(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", "9999999999")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	fetcher := provider.NewFetcher(server.Client(), "kodiiing", nil)
+	fetcher.MaxWait = time.Second
+
+	_, err := fetcher.Get(context.Background(), server.URL, nil)
+	if !errors.Is(err, provider.ErrRateLimited) {
+		t.Errorf("error is not ErrRateLimited: %v", err)
+	}
+}
+
+func TestFetcherConditionalRequest(t *testing.T) {
+	var fullResponses int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		fullResponses++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Link", `<https://example.com/?page=2>; rel="next"`)
+		_, _ = w.Write([]byte(`[{"id":1}]`))
+	}))
+	defer server.Close()
+
+	cache := &mapResponseCache{entries: map[string]provider.CachedResponse{}}
+	fetcher := provider.NewFetcher(server.Client(), "kodiiing", cache)
+
+	first, err := fetcher.Get(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+
+	second, err := fetcher.Get(context.Background(), server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to fetch: %v", err)
+	}
+
+	if !second.NotModified || fullResponses != 1 {
+		t.Errorf("expected the second response to be revalidated, full responses: %d", fullResponses)
+	}
+
+	if string(second.Body) != string(first.Body) {
+		t.Errorf("cached body differ: %s", second.Body)
+	}
+
+	if provider.NextPageURL(second.Header) != "https://example.com/?page=2" {
+		t.Errorf("pagination header is not kept: %v", second.Header)
+	}
+}
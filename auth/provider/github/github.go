@@ -7,65 +7,207 @@ import (
 	"kodiiing/auth/provider"
 	"net/http"
 	"net/url"
+	"strings"
+	"time"
 )
 
-type github struct {
+type Config struct {
 	ClientId     string
 	ClientSecret string
+	// BaseURL is the web URL of the instance, where the OAuth
+	// endpoints live. Defaults to https://github.com.
+	BaseURL string
+	// APIURL is the REST API URL of the instance. Defaults to
+	// https://api.github.com, GitHub Enterprise Server serves
+	// it on <BaseURL>/api/v3.
+	APIURL string
+	// RedirectURL is the callback URL of the OAuth app, it is
+	// optional when the app has a single callback URL.
+	RedirectURL string
+	HTTPClient  *http.Client
+	UserAgent   string
+	// ResponseCache enables conditional requests when listing repositories.
+	ResponseCache provider.ResponseCache
+	// MaxRepositories caps how many repositories are fetched,
+	// defaults to provider.DefaultMaxRepositories.
+	MaxRepositories int
+}
+
+type github struct {
+	clientId        string
+	clientSecret    string
+	baseUrl         *url.URL
+	apiUrl          *url.URL
+	redirectUrl     string
+	httpClient      *http.Client
+	userAgent       string
+	fetcher         *provider.Fetcher
+	maxRepositories int
 }
 
-func New(id, secret string) provider.Authentication {
+func New(config Config) (provider.Authentication, error) {
+	if config.ClientId == "" {
+		return nil, fmt.Errorf("client id is required")
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = "https://github.com"
+	}
+	if config.APIURL == "" {
+		if config.BaseURL == "https://github.com" {
+			config.APIURL = "https://api.github.com"
+		} else {
+			config.APIURL = strings.TrimSuffix(config.BaseURL, "/") + "/api/v3"
+		}
+	}
+
+	baseUrl, err := provider.ParseBaseURL(config.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base url: %w", err)
+	}
+
+	apiUrl, err := provider.ParseBaseURL(config.APIURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing api url: %w", err)
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = provider.NewHTTPClient()
+	}
+
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = provider.DefaultUserAgent
+	}
+
+	maxRepositories := config.MaxRepositories
+	if maxRepositories <= 0 {
+		maxRepositories = provider.DefaultMaxRepositories
+	}
+
 	return &github{
-		ClientId:     id,
-		ClientSecret: secret,
+		clientId:     config.ClientId,
+		clientSecret: config.ClientSecret,
+		baseUrl:      baseUrl,
+		apiUrl:       apiUrl,
+		redirectUrl:  config.RedirectURL,
+		httpClient:   httpClient,
+		userAgent:    userAgent,
+		fetcher:      provider.NewFetcher(httpClient, userAgent, config.ResponseCache),
+
+		maxRepositories: maxRepositories,
+	}, nil
+}
+
+// newRequest creates a request against base, the path elements
+// are expected to be escaped already.
+func (g *github) newRequest(ctx context.Context, method string, base *url.URL, query url.Values, elem ...string) (*http.Request, error) {
+	requestUrl := base.JoinPath(elem...)
+	if query != nil {
+		requestUrl.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl.String(), nil)
+	if err != nil {
+		return nil, err
 	}
+
+	req.Header.Set("User-Agent", g.userAgent)
+
+	return req, nil
 }
 
 type acquireAccessTokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	Scope       string `json:"scope"`
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	Scope        string `json:"scope"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Error        string `json:"error"`
+}
+
+func (g *github) AuthorizeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error) {
+	query := url.Values{}
+	query.Set("client_id", g.clientId)
+	query.Set("scope", "read:user user:email")
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", provider.CodeChallengeMethod)
+	if g.redirectUrl != "" {
+		query.Set("redirect_uri", g.redirectUrl)
+	}
+
+	authorizeUrl := g.baseUrl.JoinPath("login", "oauth", "authorize")
+	authorizeUrl.RawQuery = query.Encode()
+
+	return authorizeUrl.String(), nil
 }
 
-func (g *github) AcquireAccessToken(ctx context.Context, code string) (string, error) {
+func (g *github) AcquireAccessToken(ctx context.Context, code string, codeVerifier string, nonce string) (provider.Token, error) {
 	if code == "" {
-		return "", provider.ErrCodeEmpty
+		return provider.Token{}, provider.ErrCodeEmpty
 	}
 
 	requestQuery := url.Values{}
-	requestQuery.Set("client_id", g.ClientId)
-	requestQuery.Set("client_secret", g.ClientSecret)
 	requestQuery.Set("code", code)
+	requestQuery.Set("code_verifier", codeVerifier)
+	if g.redirectUrl != "" {
+		requestQuery.Set("redirect_uri", g.redirectUrl)
+	}
+
+	return g.requestToken(ctx, requestQuery)
+}
 
-	requestUrl := url.URL{
-		Scheme:   "https",
-		Host:     "github.com",
-		Path:     "/login/oauth/access_token",
-		RawQuery: requestQuery.Encode(),
+// RefreshAccessToken only succeeds for GitHub Apps that have expiring user
+// tokens enabled, the tokens of OAuth Apps do not expire.
+func (g *github) RefreshAccessToken(ctx context.Context, refreshToken string) (provider.Token, error) {
+	if refreshToken == "" {
+		return provider.Token{}, provider.ErrNoRefreshToken
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestUrl.String(), nil)
+	requestQuery := url.Values{}
+	requestQuery.Set("grant_type", "refresh_token")
+	requestQuery.Set("refresh_token", refreshToken)
+
+	return g.requestToken(ctx, requestQuery)
+}
+
+func (g *github) requestToken(ctx context.Context, requestQuery url.Values) (provider.Token, error) {
+	requestQuery.Set("client_id", g.clientId)
+	requestQuery.Set("client_secret", g.clientSecret)
+
+	req, err := g.newRequest(ctx, http.MethodPost, g.baseUrl, requestQuery, "login", "oauth", "access_token")
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+		return provider.Token{}, fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := g.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %w", err)
+		return provider.Token{}, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error response: %d", resp.StatusCode)
+		return provider.Token{}, fmt.Errorf("error response: %d", resp.StatusCode)
 	}
 
 	var response acquireAccessTokenResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		return "", fmt.Errorf("error decoding response: %w", err)
+		return provider.Token{}, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	// GitHub reports errors with status 200.
+	if response.Error != "" {
+		return provider.Token{}, fmt.Errorf("error response: %s", response.Error)
 	}
 
-	return response.AccessToken, nil
+	return provider.Token{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    provider.ExpiresAt(response.ExpiresIn, time.Now()),
+	}, nil
 }
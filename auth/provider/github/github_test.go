@@ -0,0 +1,129 @@
+package github_test
+
+import (
+	"context"
+	"encoding/json"
+	"kodiiing/auth"
+	"kodiiing/auth/provider/github"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGithubEnterprise(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login/oauth/access_token", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Query().Get("code") != "valid-code" || r.URL.Query().Get("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "access-token", "token_type": "bearer"})
+	})
+	mux.HandleFunc("/api/v3/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token access-token" || r.Header.Get("User-Agent") != "kodiiing-test" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"login":      "octocat",
+			"id":         1,
+			"node_id":    "MDQ6VXNlcjE=",
+			"avatar_url": "https://github.example.com/avatars/octocat",
+			"html_url":   "https://github.example.com/octocat",
+			"name":       "The Octocat",
+			"created_at": "2011-01-25T18:44:36Z",
+		})
+	})
+	var server *httptest.Server
+	mux.HandleFunc("/api/v3/users/octocat/repos", func(w http.ResponseWriter, r *http.Request) {
+		name := "Hello-World"
+		if r.URL.Query().Get("page") == "2" {
+			name = "Spoon-Knife"
+		} else {
+			w.Header().Set("Link", "<"+server.URL+`/api/v3/users/octocat/repos?page=2&per_page=100>; rel="next"`)
+		}
+
+		_ = json.NewEncoder(w).Encode([]map[string]any{{
+			"id":         1296269,
+			"name":       name,
+			"html_url":   "https://github.example.com/octocat/" + name,
+			"owner":      map[string]any{"login": "octocat"},
+			"created_at": "2011-01-26T19:01:12Z",
+			"updated_at": "2011-01-26T19:14:43Z",
+		}})
+	})
+
+	server = httptest.NewServer(mux)
+	defer server.Close()
+
+	p, err := github.New(github.Config{
+		ClientId:     "client",
+		ClientSecret: "secret",
+		BaseURL:      server.URL,
+		HTTPClient:   server.Client(),
+		UserAgent:    "kodiiing-test",
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	ctx := context.Background()
+
+	token, err := p.AcquireAccessToken(ctx, "valid-code", "verifier", "")
+	if err != nil {
+		t.Fatalf("failed to acquire access token: %v", err)
+	}
+
+	user, err := p.GetProfile(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+
+	if user.ID != 1 || user.ProviderID != "1" || user.Username != "octocat" || user.Provider != auth.ProviderGithub {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	repositories, complete, err := p.GetPublicRepositories(ctx, user.Username)
+	if err != nil {
+		t.Fatalf("failed to get repositories: %v", err)
+	}
+
+	if !complete {
+		t.Error("expected the repository listing to be complete")
+	}
+
+	if len(repositories) != 2 || repositories[0].Name != "Hello-World" || repositories[1].Name != "Spoon-Knife" {
+		t.Errorf("unexpected repositories: %+v", repositories)
+	}
+
+	// A capped listing is not complete, so callers keep repositories past the cap.
+	capped, err := github.New(github.Config{
+		ClientId:        "client",
+		ClientSecret:    "secret",
+		BaseURL:         server.URL,
+		HTTPClient:      server.Client(),
+		UserAgent:       "kodiiing-test",
+		MaxRepositories: 1,
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	repositories, complete, err = capped.GetPublicRepositories(ctx, user.Username)
+	if err != nil {
+		t.Fatalf("failed to get repositories: %v", err)
+	}
+
+	if complete || len(repositories) != 1 {
+		t.Errorf("expected one repository from an incomplete listing, got %d (complete: %v)", len(repositories), complete)
+	}
+}
+
+func TestNewInvalidBaseURL(t *testing.T) {
+	_, err := github.New(github.Config{ClientId: "client", BaseURL: "ftp://github.example.com"})
+	if err == nil {
+		t.Error("expected error for an unsupported scheme")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"kodiiing/auth/provider"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -36,13 +37,7 @@ func (g *github) GetProfile(ctx context.Context, accessToken string) (auth.User,
 
 	// For reference, see:
 	// https://docs.github.com/en/rest/users/users#get-the-authenticated-user
-	requestUrl := url.URL{
-		Scheme: "https",
-		Host:   "api.github.com",
-		Path:   "/user",
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
+	req, err := g.newRequest(ctx, http.MethodGet, g.apiUrl, nil, "user")
 	if err != nil {
 		return auth.User{}, fmt.Errorf("error creating request: %w", err)
 	}
@@ -50,7 +45,7 @@ func (g *github) GetProfile(ctx context.Context, accessToken string) (auth.User,
 	req.Header.Set("Accept", "application/vnd.github+json")
 	req.Header.Set("Authorization", fmt.Sprintf("token %s", accessToken))
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := g.httpClient.Do(req)
 	if err != nil {
 		return auth.User{}, fmt.Errorf("error sending request: %w", err)
 	}
@@ -83,6 +78,7 @@ func (g *github) GetProfile(ctx context.Context, accessToken string) (auth.User,
 
 	return auth.User{
 		ID:               responseBody.ID,
+		ProviderID:       strconv.FormatInt(responseBody.ID, 10),
 		Provider:         auth.ProviderGithub,
 		NodeID:           responseBody.NodeID,
 		Name:             responseBody.Name,
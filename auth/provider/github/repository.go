@@ -33,57 +33,58 @@ type getPublicRepositoriesResponse struct {
 	DefaultBranch   string `json:"default_branch"`
 }
 
-func (g *github) GetPublicRepositories(ctx context.Context, username string) ([]auth.Repository, error) {
+func (g *github) GetPublicRepositories(ctx context.Context, username string) ([]auth.Repository, bool, error) {
 	if username == "" {
-		return []auth.Repository{}, provider.ErrCodeEmpty
+		return []auth.Repository{}, false, provider.ErrCodeEmpty
 	}
 
 	// For reference, see:
 	// https://docs.github.com/en/rest/repos/repos#list-repositories-for-a-user
-	requestUrl := url.URL{
-		Scheme: "https",
-		Host:   "api.github.com",
-		Path:   "/users/" + username + "/repos",
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
-	if err != nil {
-		return []auth.Repository{}, fmt.Errorf("error creating request: %w", err)
-	}
+	// https://docs.github.com/en/rest/using-the-rest-api/using-pagination-in-the-rest-api
+	requestQuery := url.Values{}
+	requestQuery.Set("per_page", "100")
+	requestUrl := g.apiUrl.JoinPath("users", url.PathEscape(username), "repos")
+	requestUrl.RawQuery = requestQuery.Encode()
 
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	var responseBody []getPublicRepositoriesResponse
+	next := requestUrl.String()
+	for next != "" && len(responseBody) < g.maxRepositories {
+		resp, err := g.fetcher.Get(ctx, next, http.Header{"Accept": {"application/vnd.github.v3+json"}})
+		if err != nil {
+			return []auth.Repository{}, false, fmt.Errorf("error getting public repositories: %w", err)
+		}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return []auth.Repository{}, fmt.Errorf("error sending request: %w", err)
-	}
-	defer resp.Body.Close()
+		var page []getPublicRepositoriesResponse
+		err = json.Unmarshal(resp.Body, &page)
+		if err != nil {
+			return []auth.Repository{}, false, fmt.Errorf("error decoding response: %w", err)
+		}
 
-	if resp.StatusCode != http.StatusOK {
-		return []auth.Repository{}, fmt.Errorf("error getting public repositories: %s", resp.Status)
+		responseBody = append(responseBody, page...)
+		next = provider.NextPageURL(resp.Header)
 	}
 
-	var responseBody []getPublicRepositoriesResponse
-	err = json.NewDecoder(resp.Body).Decode(&responseBody)
-	if err != nil {
-		return []auth.Repository{}, fmt.Errorf("error decoding response: %w", err)
+	// Any repository past the maximum is left out.
+	complete := next == "" && len(responseBody) <= g.maxRepositories
+	if len(responseBody) > g.maxRepositories {
+		responseBody = responseBody[:g.maxRepositories]
 	}
 
 	repositories := make([]auth.Repository, 0, len(responseBody))
 	for _, repo := range responseBody {
 		repoUrl, err := url.Parse(repo.HtmlUrl)
 		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("error parsing repository url: %w", err)
+			return []auth.Repository{}, false, fmt.Errorf("error parsing repository url: %w", err)
 		}
 
 		repoCreatedAt, err := time.Parse(time.RFC3339, repo.CreatedAt)
 		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("error parsing repository created at: %w", err)
+			return []auth.Repository{}, false, fmt.Errorf("error parsing repository created at: %w", err)
 		}
 
 		repoLastActivityAt, err := time.Parse(time.RFC3339, repo.UpdatedAt)
 		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("error parsing repository last activity at: %w", err)
+			return []auth.Repository{}, false, fmt.Errorf("error parsing repository last activity at: %w", err)
 		}
 
 		repositories = append(repositories, auth.Repository{
@@ -101,5 +102,5 @@ func (g *github) GetPublicRepositories(ctx context.Context, username string) ([]
 		})
 	}
 
-	return repositories, nil
+	return repositories, complete, nil
 }
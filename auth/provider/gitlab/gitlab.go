@@ -7,18 +7,98 @@ import (
 	"kodiiing/auth/provider"
 	"net/http"
 	"net/url"
+	"time"
 )
 
-type gitlab struct {
+type Config struct {
 	ClientId     string
 	ClientSecret string
+	// BaseURL is the URL of the instance, defaults to https://gitlab.com.
+	// The REST API is expected on <BaseURL>/api/v4.
+	BaseURL string
+	// RedirectURL is the callback URL of the application,
+	// GitLab requires it on the token exchange.
+	RedirectURL string
+	HTTPClient  *http.Client
+	UserAgent   string
+	// ResponseCache enables conditional requests when listing repositories.
+	ResponseCache provider.ResponseCache
+	// MaxRepositories caps how many repositories are fetched,
+	// defaults to provider.DefaultMaxRepositories.
+	MaxRepositories int
 }
 
-func New(id, secret string) provider.Authentication {
+type gitlab struct {
+	clientId        string
+	clientSecret    string
+	baseUrl         *url.URL
+	apiUrl          *url.URL
+	redirectUrl     string
+	httpClient      *http.Client
+	userAgent       string
+	fetcher         *provider.Fetcher
+	maxRepositories int
+}
+
+func New(config Config) (provider.Authentication, error) {
+	if config.ClientId == "" {
+		return nil, fmt.Errorf("client id is required")
+	}
+
+	if config.BaseURL == "" {
+		config.BaseURL = "https://gitlab.com"
+	}
+
+	baseUrl, err := provider.ParseBaseURL(config.BaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parsing base url: %w", err)
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = provider.NewHTTPClient()
+	}
+
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = provider.DefaultUserAgent
+	}
+
+	maxRepositories := config.MaxRepositories
+	if maxRepositories <= 0 {
+		maxRepositories = provider.DefaultMaxRepositories
+	}
+
 	return &gitlab{
-		ClientId:     id,
-		ClientSecret: secret,
+		clientId:     config.ClientId,
+		clientSecret: config.ClientSecret,
+		baseUrl:      baseUrl,
+		apiUrl:       baseUrl.JoinPath("api", "v4"),
+		redirectUrl:  config.RedirectURL,
+		httpClient:   httpClient,
+		userAgent:    userAgent,
+		fetcher:      provider.NewFetcher(httpClient, userAgent, config.ResponseCache),
+
+		maxRepositories: maxRepositories,
+	}, nil
+}
+
+// newRequest creates a request against base, the path elements
+// are expected to be escaped already.
+func (g *gitlab) newRequest(ctx context.Context, method string, base *url.URL, query url.Values, elem ...string) (*http.Request, error) {
+	requestUrl := base.JoinPath(elem...)
+	if query != nil {
+		requestUrl.RawQuery = query.Encode()
 	}
+
+	req, err := http.NewRequestWithContext(ctx, method, requestUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", g.userAgent)
+
+	return req, nil
 }
 
 type acquireAccessTokenResponse struct {
@@ -29,46 +109,84 @@ type acquireAccessTokenResponse struct {
 	CreatedAt    int64  `json:"created_at"`
 }
 
-func (g *gitlab) AcquireAccessToken(ctx context.Context, code string) (string, error) {
+func (g *gitlab) AuthorizeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error) {
+	query := url.Values{}
+	query.Set("client_id", g.clientId)
+	query.Set("response_type", "code")
+	query.Set("scope", "read_user")
+	query.Set("state", state)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", provider.CodeChallengeMethod)
+	if g.redirectUrl != "" {
+		query.Set("redirect_uri", g.redirectUrl)
+	}
+
+	authorizeUrl := g.baseUrl.JoinPath("oauth", "authorize")
+	authorizeUrl.RawQuery = query.Encode()
+
+	return authorizeUrl.String(), nil
+}
+
+func (g *gitlab) AcquireAccessToken(ctx context.Context, code string, codeVerifier string, nonce string) (provider.Token, error) {
 	if code == "" {
-		return "", provider.ErrCodeEmpty
+		return provider.Token{}, provider.ErrCodeEmpty
 	}
 
 	requestQuery := url.Values{}
-	requestQuery.Set("client_id", g.ClientId)
-	requestQuery.Set("client_secret", g.ClientSecret)
 	requestQuery.Set("code", code)
 	requestQuery.Set("grant_type", "authorization_code")
+	requestQuery.Set("code_verifier", codeVerifier)
+
+	return g.requestToken(ctx, requestQuery)
+}
+
+// RefreshAccessToken exchanges the refresh token, GitLab access tokens
+// expire after two hours.
+func (g *gitlab) RefreshAccessToken(ctx context.Context, refreshToken string) (provider.Token, error) {
+	if refreshToken == "" {
+		return provider.Token{}, provider.ErrNoRefreshToken
+	}
+
+	requestQuery := url.Values{}
+	requestQuery.Set("refresh_token", refreshToken)
+	requestQuery.Set("grant_type", "refresh_token")
+
+	return g.requestToken(ctx, requestQuery)
+}
 
-	requestUrl := url.URL{
-		Scheme:   "https",
-		Host:     "gitlab.com",
-		Path:     "/oauth/token",
-		RawQuery: requestQuery.Encode(),
+func (g *gitlab) requestToken(ctx context.Context, requestQuery url.Values) (provider.Token, error) {
+	requestQuery.Set("client_id", g.clientId)
+	requestQuery.Set("client_secret", g.clientSecret)
+	if g.redirectUrl != "" {
+		requestQuery.Set("redirect_uri", g.redirectUrl)
 	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, requestUrl.String(), nil)
+	req, err := g.newRequest(ctx, http.MethodPost, g.baseUrl, requestQuery, "oauth", "token")
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %w", err)
+		return provider.Token{}, fmt.Errorf("error creating request: %w", err)
 	}
 
 	req.Header.Set("Accept", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := g.httpClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %w", err)
+		return provider.Token{}, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("error response: %d", resp.StatusCode)
+		return provider.Token{}, fmt.Errorf("error response: %d", resp.StatusCode)
 	}
 
 	var response acquireAccessTokenResponse
 	err = json.NewDecoder(resp.Body).Decode(&response)
 	if err != nil {
-		return "", fmt.Errorf("error decoding response: %w", err)
+		return provider.Token{}, fmt.Errorf("error decoding response: %w", err)
 	}
 
-	return response.AccessToken, nil
+	return provider.Token{
+		AccessToken:  response.AccessToken,
+		RefreshToken: response.RefreshToken,
+		ExpiresAt:    provider.ExpiresAt(response.ExpiresIn, time.Now()),
+	}, nil
 }
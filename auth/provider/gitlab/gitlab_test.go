@@ -0,0 +1,127 @@
+package gitlab_test
+
+import (
+	"context"
+	"encoding/json"
+	"kodiiing/auth"
+	"kodiiing/auth/provider/gitlab"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSelfHosted(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/gitlab/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch query.Get("grant_type") {
+		case "authorization_code":
+			if query.Get("code") != "valid-code" || query.Get("code_verifier") != "verifier" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		case "refresh_token":
+			if query.Get("refresh_token") != "refresh-token" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  "access-token",
+			"refresh_token": "refresh-token",
+			"token_type":    "Bearer",
+			"expires_in":    7200,
+		})
+	})
+	mux.HandleFunc("/gitlab/api/v4/user", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("PRIVATE-TOKEN") != "access-token" || r.Header.Get("User-Agent") != "kodiiing" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":         42,
+			"username":   "tanuki",
+			"name":       "Tanuki",
+			"avatar_url": "https://gitlab.example.com/uploads/tanuki.png",
+			"web_url":    "https://gitlab.example.com/tanuki",
+			"created_at": "2012-05-23T08:00:58.000Z",
+		})
+	})
+	mux.HandleFunc("/gitlab/api/v4/users/tanuki/projects", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]any{{
+			"id":               3,
+			"name":             "diaspora",
+			"web_url":          "https://gitlab.example.com/tanuki/diaspora",
+			"created_at":       "2013-09-30T13:46:02.000Z",
+			"last_activity_at": "2013-09-30T13:46:02.000Z",
+			"namespace":        map[string]any{"path": "tanuki"},
+		}})
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// Instances can be served from a relative path.
+	p, err := gitlab.New(gitlab.Config{
+		ClientId:     "client",
+		ClientSecret: "secret",
+		BaseURL:      server.URL + "/gitlab",
+		HTTPClient:   server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	ctx := context.Background()
+
+	token, err := p.AcquireAccessToken(ctx, "valid-code", "verifier", "")
+	if err != nil {
+		t.Fatalf("failed to acquire access token: %v", err)
+	}
+
+	if token.RefreshToken != "refresh-token" || token.ExpiresAt.IsZero() || token.Expired(time.Now()) {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	refreshed, err := p.RefreshAccessToken(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to refresh access token: %v", err)
+	}
+
+	if refreshed.AccessToken != "access-token" || refreshed.RefreshToken != "refresh-token" {
+		t.Errorf("unexpected refreshed token: %+v", refreshed)
+	}
+
+	user, err := p.GetProfile(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+
+	if user.ID != 42 || user.ProviderID != "42" || user.Username != "tanuki" || user.Provider != auth.ProviderGitlab {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	repositories, complete, err := p.GetPublicRepositories(ctx, user.Username)
+	if err != nil {
+		t.Fatalf("failed to get repositories: %v", err)
+	}
+
+	if !complete {
+		t.Error("expected the repository listing to be complete")
+	}
+
+	if len(repositories) != 1 || repositories[0].OwnerUsername != "tanuki" {
+		t.Errorf("unexpected repositories: %+v", repositories)
+	}
+}
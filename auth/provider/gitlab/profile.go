@@ -8,6 +8,7 @@ import (
 	"kodiiing/auth/provider"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -31,13 +32,7 @@ func (g *gitlab) GetProfile(ctx context.Context, accessToken string) (auth.User,
 
 	// For reference, see:
 	// https://docs.gitlab.com/ee/api/users.html#for-normal-users-1
-	requestUrl := url.URL{
-		Scheme: "https",
-		Host:   "gitlab.com",
-		Path:   "/api/v4/user",
-	}
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
+	req, err := g.newRequest(ctx, http.MethodGet, g.apiUrl, nil, "user")
 	if err != nil {
 		return auth.User{}, fmt.Errorf("error creating request: %w", err)
 	}
@@ -45,7 +40,7 @@ func (g *gitlab) GetProfile(ctx context.Context, accessToken string) (auth.User,
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("PRIVATE-TOKEN", accessToken)
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := g.httpClient.Do(req)
 	if err != nil {
 		return auth.User{}, fmt.Errorf("error sending request: %w", err)
 	}
@@ -78,6 +73,7 @@ func (g *gitlab) GetProfile(ctx context.Context, accessToken string) (auth.User,
 
 	return auth.User{
 		ID:               responseBody.ID,
+		ProviderID:       strconv.FormatInt(responseBody.ID, 10),
 		Provider:         auth.ProviderGitlab,
 		NodeID:           "",
 		Name:             responseBody.Name,
@@ -34,57 +34,68 @@ type getPublicRepositoriesResponse struct {
 	} `json:"namespace"`
 }
 
-func (g *gitlab) GetPublicRepositories(ctx context.Context, username string) ([]auth.Repository, error) {
+func (g *gitlab) GetPublicRepositories(ctx context.Context, username string) ([]auth.Repository, bool, error) {
 	if username == "" {
-		return []auth.Repository{}, provider.ErrCodeEmpty
+		return []auth.Repository{}, false, provider.ErrCodeEmpty
 	}
 
 	// For reference, see:
 	// https://docs.gitlab.com/ee/api/projects.html#list-user-projects
-	requestUrl := url.URL{
-		Scheme: "https",
-		Host:   "gitlab.com",
-		Path:   "/api/v4/users/" + username + "/projects",
-	}
+	// https://docs.gitlab.com/ee/api/rest/#pagination
+	requestQuery := url.Values{}
+	requestQuery.Set("per_page", "100")
+	requestUrl := g.apiUrl.JoinPath("users", url.PathEscape(username), "projects")
+	requestUrl.RawQuery = requestQuery.Encode()
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl.String(), nil)
-	if err != nil {
-		return []auth.Repository{}, fmt.Errorf("error creating request: %w", err)
-	}
+	var responseBody []getPublicRepositoriesResponse
+	next := requestUrl.String()
+	for next != "" && len(responseBody) < g.maxRepositories {
+		resp, err := g.fetcher.Get(ctx, next, http.Header{"Accept": {"application/json"}})
+		if err != nil {
+			return []auth.Repository{}, false, fmt.Errorf("error getting public repositories: %w", err)
+		}
 
-	req.Header.Set("Accept", "application/json")
+		var page []getPublicRepositoriesResponse
+		err = json.Unmarshal(resp.Body, &page)
+		if err != nil {
+			return []auth.Repository{}, false, fmt.Errorf("error decoding response: %w", err)
+		}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return []auth.Repository{}, fmt.Errorf("error sending request: %w", err)
-	}
-	defer resp.Body.Close()
+		responseBody = append(responseBody, page...)
 
-	if resp.StatusCode != http.StatusOK {
-		return []auth.Repository{}, fmt.Errorf("error response: %d", resp.StatusCode)
+		// GitLab omits the Link header when counting would be too
+		// expensive, X-Next-Page is always present though.
+		current := next
+		next = provider.NextPageURL(resp.Header)
+		if next == "" && resp.Header.Get("X-Next-Page") != "" {
+			next, err = provider.WithPage(current, resp.Header.Get("X-Next-Page"))
+			if err != nil {
+				return []auth.Repository{}, false, fmt.Errorf("error building next page url: %w", err)
+			}
+		}
 	}
 
-	var responseBody []getPublicRepositoriesResponse
-	err = json.NewDecoder(resp.Body).Decode(&responseBody)
-	if err != nil {
-		return []auth.Repository{}, fmt.Errorf("error decoding response: %w", err)
+	// Any repository past the maximum is left out.
+	complete := next == "" && len(responseBody) <= g.maxRepositories
+	if len(responseBody) > g.maxRepositories {
+		responseBody = responseBody[:g.maxRepositories]
 	}
 
 	repositories := make([]auth.Repository, 0, len(responseBody))
 	for _, repo := range responseBody {
 		repoUrl, err := url.Parse(repo.WebUrl)
 		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("error parsing repository URL: %w", err)
+			return []auth.Repository{}, false, fmt.Errorf("error parsing repository URL: %w", err)
 		}
 
 		repoCreatedAt, err := time.Parse(time.RFC3339Nano, repo.CreatedAt)
 		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("error parsing repository created at: %w", err)
+			return []auth.Repository{}, false, fmt.Errorf("error parsing repository created at: %w", err)
 		}
 
 		repoLastActivityAt, err := time.Parse(time.RFC3339Nano, repo.LastActivityAt)
 		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("error parsing repository last activity at: %w", err)
+			return []auth.Repository{}, false, fmt.Errorf("error parsing repository last activity at: %w", err)
 		}
 
 		repositories = append(repositories, auth.Repository{
@@ -102,5 +113,5 @@ func (g *gitlab) GetPublicRepositories(ctx context.Context, username string) ([]
 		})
 	}
 
-	return repositories, nil
+	return repositories, complete, nil
 }
@@ -0,0 +1,40 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// DefaultTimeout bounds every request to a provider when the
+// provider is not given its own HTTP client.
+const DefaultTimeout = time.Second * 10
+
+// DefaultUserAgent is sent to providers when none is configured.
+// GitHub rejects requests without a user agent.
+const DefaultUserAgent = "kodiiing"
+
+// NewHTTPClient creates the HTTP client providers use by default.
+func NewHTTPClient() *http.Client {
+	return &http.Client{Timeout: DefaultTimeout}
+}
+
+// ParseBaseURL parses the base URL of a provider instance,
+// such as a self-hosted GitLab.
+func ParseBaseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported scheme: %q", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("host is empty")
+	}
+
+	return u, nil
+}
@@ -0,0 +1,267 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+var ErrInvalidIdToken = errors.New("invalid id token")
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+}
+
+type keySet struct {
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// minimumRefetchInterval limits how often an unknown key ID can trigger
+// fetching the key set again, so forged tokens can't be used to hammer
+// the identity provider.
+const minimumRefetchInterval = time.Minute
+
+// getKey returns the public key for the key ID. The key set is fetched on
+// first use, and fetched again when the key ID is unknown, as the identity
+// provider might have rotated its keys.
+func (o *oidc) getKey(ctx context.Context, discovery *discoveryDocument, kid string) (crypto.PublicKey, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.keys != nil {
+		if key, ok := o.keys.lookup(kid); ok {
+			return key, nil
+		}
+
+		if time.Since(o.keys.fetchedAt) < minimumRefetchInterval {
+			return nil, ErrUnknownKey
+		}
+	}
+
+	keys, err := o.fetchKeys(ctx, discovery.JwksUri)
+	if err != nil {
+		return nil, err
+	}
+
+	o.keys = keys
+
+	key, ok := o.keys.lookup(kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	return key, nil
+}
+
+// lookup finds the key by its ID. A token without a key ID is only
+// accepted when the key set has a single key.
+func (k *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(k.keys) != 1 {
+			return nil, false
+		}
+
+		for _, key := range k.keys {
+			return key, true
+		}
+	}
+
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (o *oidc) fetchKeys(ctx context.Context, jwksUri string) (*keySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksUri, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", o.userAgent)
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error response: %d", resp.StatusCode)
+	}
+
+	var responseBody struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	keys := &keySet{
+		keys:      make(map[string]crypto.PublicKey, len(responseBody.Keys)),
+		fetchedAt: time.Now(),
+	}
+	for _, jwk := range responseBody.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// Keys of an unsupported type are skipped rather than failing
+		// the whole set, identity providers may publish other keys.
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys.keys[jwk.KeyID] = key
+	}
+
+	return keys, nil
+}
+
+func (j jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("decoding modulus: %w", err)
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, fmt.Errorf("decoding exponent: %w", err)
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("exponent is too large")
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve: %s", j.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding x: %w", err)
+		}
+
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, fmt.Errorf("decoding y: %w", err)
+		}
+
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+
+		return key, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve: %s", j.Curve)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, fmt.Errorf("decoding x: %w", err)
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid ed25519 public key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", j.KeyType)
+	}
+}
+
+// verifyIdToken checks the signature of the ID token against the issuer's
+// key set, and validates the claims required by
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+// The nonce must be the one sent on the authorization request, so the token
+// can't be replayed into another login.
+func (o *oidc) verifyIdToken(ctx context.Context, discovery *discoveryDocument, idToken string, nonce string) (jwt.MapClaims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{
+		"RS256", "RS384", "RS512",
+		"PS256", "PS384", "PS512",
+		"ES256", "ES384", "ES512",
+		"EdDSA",
+	}))
+
+	var claims jwt.MapClaims
+	_, err := parser.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.getKey(ctx, discovery, kid)
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnknownKey) {
+			return nil, ErrUnknownKey
+		}
+
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIdToken, err.Error())
+	}
+
+	if !claims.VerifyIssuer(discovery.Issuer, true) {
+		return nil, fmt.Errorf("%w: issuer mismatch", ErrInvalidIdToken)
+	}
+
+	if !claims.VerifyAudience(o.clientId, true) {
+		return nil, fmt.Errorf("%w: audience mismatch", ErrInvalidIdToken)
+	}
+
+	// MapClaims only validates exp when it is present, it is required here.
+	if _, ok := claims["exp"]; !ok {
+		return nil, fmt.Errorf("%w: missing expiration", ErrInvalidIdToken)
+	}
+
+	if sub, _ := claims["sub"].(string); sub == "" {
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIdToken)
+	}
+
+	if claimedNonce, _ := claims["nonce"].(string); nonce == "" || subtle.ConstantTimeCompare([]byte(claimedNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIdToken)
+	}
+
+	// With several audiences, the token must have been issued to us.
+	if azp, ok := claims["azp"].(string); ok && azp != o.clientId {
+		return nil, fmt.Errorf("%w: authorized party mismatch", ErrInvalidIdToken)
+	}
+
+	return claims, nil
+}
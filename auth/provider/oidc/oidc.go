@@ -0,0 +1,268 @@
+// Package oidc implements provider.Authentication for any OpenID Connect
+// identity provider, configured through its discovery document.
+// See https://openid.net/specs/openid-connect-discovery-1_0.html
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kodiiing/auth/provider"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	// Issuer is the issuer identifier of the identity provider,
+	// the discovery document is fetched from
+	// Issuer + "/.well-known/openid-configuration".
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	// RedirectURL must match the redirect URI that
+	// was used on the authorization request.
+	RedirectURL string
+	HTTPClient  *http.Client
+	UserAgent   string
+}
+
+type oidc struct {
+	issuer       string
+	clientId     string
+	clientSecret string
+	redirectUrl  string
+	httpClient   *http.Client
+	userAgent    string
+
+	mu        sync.Mutex
+	discovery *discoveryDocument
+	keys      *keySet
+}
+
+func New(config Config) (provider.Authentication, error) {
+	if config.Issuer == "" {
+		return nil, fmt.Errorf("issuer is required")
+	}
+	if config.ClientId == "" {
+		return nil, fmt.Errorf("client id is required")
+	}
+
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = provider.NewHTTPClient()
+	}
+
+	userAgent := config.UserAgent
+	if userAgent == "" {
+		userAgent = provider.DefaultUserAgent
+	}
+
+	return &oidc{
+		issuer:       strings.TrimSuffix(config.Issuer, "/"),
+		clientId:     config.ClientId,
+		clientSecret: config.ClientSecret,
+		redirectUrl:  config.RedirectURL,
+		httpClient:   httpClient,
+		userAgent:    userAgent,
+	}, nil
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+var ErrIssuerMismatch = errors.New("issuer mismatch")
+
+// getDiscovery fetches the discovery document once, and keeps it for the
+// lifetime of the provider. It is not fetched on New, so Kodiiing can start
+// while the identity provider is unreachable.
+func (o *oidc) getDiscovery(ctx context.Context) (*discoveryDocument, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.discovery != nil {
+		return o.discovery, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", o.userAgent)
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error response: %d", resp.StatusCode)
+	}
+
+	var document discoveryDocument
+	err = json.NewDecoder(resp.Body).Decode(&document)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	// The issuer in the document must be identical to the one that was used
+	// to fetch it, otherwise tokens from another issuer could be accepted.
+	if strings.TrimSuffix(document.Issuer, "/") != o.issuer {
+		return nil, ErrIssuerMismatch
+	}
+
+	if document.TokenEndpoint == "" || document.UserinfoEndpoint == "" || document.JwksUri == "" {
+		return nil, fmt.Errorf("discovery document is missing required endpoints")
+	}
+
+	o.discovery = &document
+	return o.discovery, nil
+}
+
+type acquireAccessTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	IdToken      string `json:"id_token"`
+}
+
+func (o *oidc) AuthorizeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error) {
+	discovery, err := o.getDiscovery(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error getting discovery document: %w", err)
+	}
+
+	authorizeUrl, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil || discovery.AuthorizationEndpoint == "" {
+		return "", fmt.Errorf("invalid authorization endpoint: %q", discovery.AuthorizationEndpoint)
+	}
+
+	query := authorizeUrl.Query()
+	query.Set("client_id", o.clientId)
+	query.Set("response_type", "code")
+	query.Set("scope", "openid profile email")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", provider.CodeChallengeMethod)
+	if o.redirectUrl != "" {
+		query.Set("redirect_uri", o.redirectUrl)
+	}
+	authorizeUrl.RawQuery = query.Encode()
+
+	return authorizeUrl.String(), nil
+}
+
+func (o *oidc) AcquireAccessToken(ctx context.Context, code string, codeVerifier string, nonce string) (provider.Token, error) {
+	if code == "" {
+		return provider.Token{}, provider.ErrCodeEmpty
+	}
+
+	discovery, err := o.getDiscovery(ctx)
+	if err != nil {
+		return provider.Token{}, fmt.Errorf("error getting discovery document: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("code_verifier", codeVerifier)
+	if o.redirectUrl != "" {
+		form.Set("redirect_uri", o.redirectUrl)
+	}
+
+	response, err := o.requestToken(ctx, discovery, form)
+	if err != nil {
+		return provider.Token{}, err
+	}
+
+	if response.IdToken == "" {
+		return provider.Token{}, fmt.Errorf("token response is missing the id token")
+	}
+
+	claims, err := o.verifyIdToken(ctx, discovery, response.IdToken, nonce)
+	if err != nil {
+		return provider.Token{}, fmt.Errorf("error verifying id token: %w", err)
+	}
+
+	token := response.token()
+	token.Subject, _ = claims["sub"].(string)
+
+	return token, nil
+}
+
+// RefreshAccessToken exchanges the refresh token. The ID token that may come
+// along is not used, GetProfile tells whom the access token is for.
+func (o *oidc) RefreshAccessToken(ctx context.Context, refreshToken string) (provider.Token, error) {
+	if refreshToken == "" {
+		return provider.Token{}, provider.ErrNoRefreshToken
+	}
+
+	discovery, err := o.getDiscovery(ctx)
+	if err != nil {
+		return provider.Token{}, fmt.Errorf("error getting discovery document: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", refreshToken)
+
+	response, err := o.requestToken(ctx, discovery, form)
+	if err != nil {
+		return provider.Token{}, err
+	}
+
+	return response.token(), nil
+}
+
+func (o *oidc) requestToken(ctx context.Context, discovery *discoveryDocument, form url.Values) (acquireAccessTokenResponse, error) {
+	form.Set("client_id", o.clientId)
+	form.Set("client_secret", o.clientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return acquireAccessTokenResponse{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", o.userAgent)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return acquireAccessTokenResponse{}, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return acquireAccessTokenResponse{}, fmt.Errorf("error response: %d", resp.StatusCode)
+	}
+
+	var response acquireAccessTokenResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return acquireAccessTokenResponse{}, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	return response, nil
+}
+
+func (r acquireAccessTokenResponse) token() provider.Token {
+	return provider.Token{
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+		ExpiresAt:    provider.ExpiresAt(r.ExpiresIn, time.Now()),
+	}
+}
@@ -0,0 +1,386 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"kodiiing/auth"
+	"kodiiing/auth/provider"
+	"kodiiing/auth/provider/oidc"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const clientId = "kodiiing"
+
+// fakeIssuer is a minimal OpenID Connect identity provider.
+type fakeIssuer struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	keyId    string
+	audience string
+	// signingKey signs the ID token, defaults to key.
+	signingKey *rsa.PrivateKey
+	// issuer is advertised by the discovery document, defaults to the server URL.
+	issuer string
+	// nonce is put in the ID token.
+	nonce string
+	// subject is returned by the userinfo endpoint, defaults to the subject
+	// of the ID token.
+	subject string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	f := &fakeIssuer{key: key, keyId: "key-1", audience: clientId, nonce: "nonce-1"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := f.issuer
+		if issuer == "" {
+			issuer = f.server.URL
+		}
+
+		writeJSON(w, map[string]string{
+			"issuer":                 issuer,
+			"authorization_endpoint": f.server.URL + "/authorize",
+			"token_endpoint":         f.server.URL + "/token",
+			"userinfo_endpoint":      f.server.URL + "/userinfo",
+			"jwks_uri":               f.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": f.keyId,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(f.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(f.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("grant_type") == "refresh_token" {
+			if r.PostFormValue("refresh_token") != "refresh-token" || r.PostFormValue("client_id") != clientId {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			writeJSON(w, map[string]any{
+				"access_token": "refreshed-access-token",
+				"token_type":   "Bearer",
+				"expires_in":   3600,
+			})
+			return
+		}
+
+		if r.PostFormValue("grant_type") != "authorization_code" || r.PostFormValue("code") != "valid-code" || r.PostFormValue("client_id") != clientId || r.PostFormValue("code_verifier") != "verifier" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		signingKey := f.signingKey
+		if signingKey == nil {
+			signingKey = f.key
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":   f.server.URL,
+			"sub":   "d3b1e7a0-subject",
+			"aud":   f.audience,
+			"nonce": f.nonce,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Minute).Unix(),
+		})
+		token.Header["kid"] = f.keyId
+		idToken, err := token.SignedString(signingKey)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string]any{
+			"access_token":  "access-token",
+			"refresh_token": "refresh-token",
+			"token_type":    "Bearer",
+			"expires_in":    3600,
+			"id_token":      idToken,
+		})
+	})
+	mux.HandleFunc("/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		subject := f.subject
+		if subject == "" {
+			subject = "d3b1e7a0-subject"
+		}
+
+		writeJSON(w, map[string]string{
+			"sub":     subject,
+			"name":    "Jane Doe",
+			"email":   "jane@example.com",
+			"picture": "https://example.com/jane.png",
+		})
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	return f
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newProvider(t *testing.T, f *fakeIssuer) provider.Authentication {
+	t.Helper()
+
+	p, err := oidc.New(oidc.Config{
+		Issuer:       f.server.URL,
+		ClientId:     clientId,
+		ClientSecret: "secret",
+		RedirectURL:  "https://kodiiing.example/callback",
+		HTTPClient:   f.server.Client(),
+	})
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+
+	return p
+}
+
+func TestLogin(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newProvider(t, f)
+	ctx := context.Background()
+
+	token, err := p.AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+	if err != nil {
+		t.Fatalf("failed to acquire access token: %v", err)
+	}
+
+	if token.AccessToken != "access-token" || token.Subject != "d3b1e7a0-subject" {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	user, err := p.GetProfile(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+
+	if err := token.CheckProfile(user); err != nil {
+		t.Errorf("profile does not match the token: %v", err)
+	}
+
+	if user.Provider != auth.ProviderOIDC {
+		t.Errorf("unexpected provider: %d", user.Provider)
+	}
+
+	if user.NodeID != "d3b1e7a0-subject" {
+		t.Errorf("unexpected node id: %s", user.NodeID)
+	}
+
+	if user.ProviderID != "d3b1e7a0-subject" {
+		t.Errorf("unexpected provider id: %s", user.ProviderID)
+	}
+
+	if user.Username != "jane" {
+		t.Errorf("unexpected username: %s", user.Username)
+	}
+
+	if user.Name != "Jane Doe" || user.Email != "jane@example.com" {
+		t.Errorf("unexpected profile: %+v", user)
+	}
+
+	if user.AvatarURL == nil || user.AvatarURL.String() != "https://example.com/jane.png" {
+		t.Errorf("unexpected avatar url: %v", user.AvatarURL)
+	}
+}
+
+func TestRefreshAccessToken(t *testing.T) {
+	f := newFakeIssuer(t)
+	p := newProvider(t, f)
+	ctx := context.Background()
+
+	token, err := p.AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+	if err != nil {
+		t.Fatalf("failed to acquire access token: %v", err)
+	}
+
+	if token.RefreshToken != "refresh-token" || token.ExpiresAt.IsZero() {
+		t.Fatalf("unexpected token: %+v", token)
+	}
+
+	refreshed, err := p.RefreshAccessToken(ctx, token.RefreshToken)
+	if err != nil {
+		t.Fatalf("failed to refresh access token: %v", err)
+	}
+
+	if refreshed.AccessToken != "refreshed-access-token" || refreshed.ExpiresAt.IsZero() {
+		t.Errorf("unexpected refreshed token: %+v", refreshed)
+	}
+
+	if _, err := p.RefreshAccessToken(ctx, ""); !errors.Is(err, provider.ErrNoRefreshToken) {
+		t.Errorf("expected ErrNoRefreshToken, got %v", err)
+	}
+}
+
+func TestSubjectMismatch(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.subject = "someone-else"
+	p := newProvider(t, f)
+	ctx := context.Background()
+
+	token, err := p.AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+	if err != nil {
+		t.Fatalf("failed to acquire access token: %v", err)
+	}
+
+	user, err := p.GetProfile(ctx, token.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to get profile: %v", err)
+	}
+
+	if err := token.CheckProfile(user); !errors.Is(err, provider.ErrSubjectMismatch) {
+		t.Errorf("error is not ErrSubjectMismatch: %v", err)
+	}
+}
+
+func TestAuthorizeURL(t *testing.T) {
+	f := newFakeIssuer(t)
+
+	authorizeUrl, err := newProvider(t, f).AuthorizeURL(context.Background(), "state-1", "challenge-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("failed to get authorize url: %v", err)
+	}
+
+	u, err := url.Parse(authorizeUrl)
+	if err != nil {
+		t.Fatalf("failed to parse authorize url: %v", err)
+	}
+
+	if u.Path != "/authorize" {
+		t.Errorf("unexpected authorize path: %s", u.Path)
+	}
+
+	expected := map[string]string{
+		"client_id":             clientId,
+		"response_type":         "code",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge-1",
+		"code_challenge_method": "S256",
+		"redirect_uri":          "https://kodiiing.example/callback",
+	}
+	for key, value := range expected {
+		if got := u.Query().Get(key); got != value {
+			t.Errorf("%s: expected %q, got %q", key, value, got)
+		}
+	}
+}
+
+func TestAcquireAccessTokenInvalidIdToken(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("bad signature", func(t *testing.T) {
+		f := newFakeIssuer(t)
+		otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("failed to generate key: %v", err)
+		}
+		f.signingKey = otherKey
+
+		_, err = newProvider(t, f).AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+		if !errors.Is(err, oidc.ErrInvalidIdToken) {
+			t.Errorf("error is not ErrInvalidIdToken: %v", err)
+		}
+	})
+
+	t.Run("wrong audience", func(t *testing.T) {
+		f := newFakeIssuer(t)
+		f.audience = "someone-else"
+
+		_, err := newProvider(t, f).AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+		if !errors.Is(err, oidc.ErrInvalidIdToken) {
+			t.Errorf("error is not ErrInvalidIdToken: %v", err)
+		}
+	})
+
+	t.Run("wrong nonce", func(t *testing.T) {
+		f := newFakeIssuer(t)
+		f.nonce = "replayed"
+
+		_, err := newProvider(t, f).AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+		if !errors.Is(err, oidc.ErrInvalidIdToken) {
+			t.Errorf("error is not ErrInvalidIdToken: %v", err)
+		}
+	})
+
+	t.Run("missing nonce", func(t *testing.T) {
+		f := newFakeIssuer(t)
+		f.nonce = ""
+
+		_, err := newProvider(t, f).AcquireAccessToken(ctx, "valid-code", "verifier", "")
+		if !errors.Is(err, oidc.ErrInvalidIdToken) {
+			t.Errorf("error is not ErrInvalidIdToken: %v", err)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		f := newFakeIssuer(t)
+		p := newProvider(t, f)
+
+		_, err := p.AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+		if err != nil {
+			t.Fatalf("failed to acquire access token: %v", err)
+		}
+
+		// The issuer rotated its key, but the key set was
+		// fetched too recently to be fetched again.
+		f.keyId = "key-2"
+		_, err = p.AcquireAccessToken(ctx, "valid-code", "verifier", "nonce-1")
+		if !errors.Is(err, oidc.ErrUnknownKey) {
+			t.Errorf("error is not ErrUnknownKey: %v", err)
+		}
+	})
+}
+
+func TestAcquireAccessTokenEmptyCode(t *testing.T) {
+	f := newFakeIssuer(t)
+
+	_, err := newProvider(t, f).AcquireAccessToken(context.Background(), "", "verifier", "nonce-1")
+	if !errors.Is(err, provider.ErrCodeEmpty) {
+		t.Errorf("error is not ErrCodeEmpty: %v", err)
+	}
+}
+
+func TestIssuerMismatch(t *testing.T) {
+	f := newFakeIssuer(t)
+	f.issuer = "https://attacker.example"
+
+	_, err := newProvider(t, f).AcquireAccessToken(context.Background(), "valid-code", "verifier", "nonce-1")
+	if !errors.Is(err, oidc.ErrIssuerMismatch) {
+		t.Errorf("error is not ErrIssuerMismatch: %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/provider"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// getProfileResponse holds the standard claims returned by the userinfo endpoint.
+// See https://openid.net/specs/openid-connect-core-1_0.html#StandardClaims
+type getProfileResponse struct {
+	Subject           string `json:"sub"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nickname          string `json:"nickname"`
+	Picture           string `json:"picture"`
+	Profile           string `json:"profile"`
+	Email             string `json:"email"`
+	Locale            string `json:"locale"`
+}
+
+func (o *oidc) GetProfile(ctx context.Context, accessToken string) (auth.User, error) {
+	if accessToken == "" {
+		return auth.User{}, provider.ErrCodeEmpty
+	}
+
+	discovery, err := o.getDiscovery(ctx)
+	if err != nil {
+		return auth.User{}, fmt.Errorf("error getting discovery document: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return auth.User{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", o.userAgent)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return auth.User{}, fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return auth.User{}, fmt.Errorf("error response: %d", resp.StatusCode)
+	}
+
+	var responseBody getProfileResponse
+	err = json.NewDecoder(resp.Body).Decode(&responseBody)
+	if err != nil {
+		return auth.User{}, fmt.Errorf("error decoding response: %w", err)
+	}
+
+	if responseBody.Subject == "" {
+		return auth.User{}, fmt.Errorf("userinfo response is missing the subject")
+	}
+
+	var userAvatarUrl *url.URL
+	if responseBody.Picture != "" {
+		userAvatarUrl, err = url.Parse(responseBody.Picture)
+		if err != nil {
+			return auth.User{}, fmt.Errorf("error parsing avatar url: %w", err)
+		}
+	}
+
+	// The profile URL is required by the users table, fall back
+	// to the issuer when the identity provider has none.
+	userProfileUrl, err := url.Parse(o.issuer)
+	if err != nil {
+		return auth.User{}, fmt.Errorf("error parsing profile url: %w", err)
+	}
+	if responseBody.Profile != "" {
+		userProfileUrl, err = url.Parse(responseBody.Profile)
+		if err != nil {
+			return auth.User{}, fmt.Errorf("error parsing profile url: %w", err)
+		}
+	}
+
+	username := responseBody.PreferredUsername
+	if username == "" {
+		username = responseBody.Nickname
+	}
+	if username == "" && responseBody.Email != "" {
+		username, _, _ = strings.Cut(responseBody.Email, "@")
+	}
+	if username == "" {
+		username = responseBody.Subject
+	}
+
+	name := responseBody.Name
+	if name == "" {
+		name = username
+	}
+
+	return auth.User{
+		Provider:   auth.ProviderOIDC,
+		ProviderID: responseBody.Subject,
+		NodeID:     responseBody.Subject,
+		Name:       name,
+		Username:   username,
+		AvatarURL:  userAvatarUrl,
+		ProfileURL: userProfileUrl,
+		Email:      responseBody.Email,
+	}, nil
+}
@@ -0,0 +1,12 @@
+package oidc
+
+import (
+	"context"
+	"kodiiing/auth"
+)
+
+// GetPublicRepositories returns no repositories, OpenID Connect
+// has no notion of them.
+func (o *oidc) GetPublicRepositories(ctx context.Context, username string) ([]auth.Repository, bool, error) {
+	return []auth.Repository{}, true, nil
+}
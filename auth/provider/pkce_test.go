@@ -0,0 +1,23 @@
+package provider_test
+
+import (
+	"kodiiing/auth/provider"
+	"testing"
+)
+
+func TestCodeChallenge(t *testing.T) {
+	// https://datatracker.ietf.org/doc/html/rfc7636#appendix-B
+	challenge := provider.CodeChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("unexpected code challenge: %s", challenge)
+	}
+
+	verifier, err := provider.NewCodeVerifier()
+	if err != nil {
+		t.Fatalf("failed to generate code verifier: %v", err)
+	}
+
+	if len(verifier) < 43 || len(verifier) > 128 {
+		t.Errorf("code verifier length is out of range: %d", len(verifier))
+	}
+}
@@ -4,12 +4,73 @@ import (
 	"context"
 	"errors"
 	"kodiiing/auth"
+	"time"
 )
 
 var ErrCodeEmpty = errors.New("code is empty")
 
+// ErrNoRefreshToken is returned when refreshing a token that the provider
+// issued without a refresh token.
+var ErrNoRefreshToken = errors.New("no refresh token")
+
+// ErrSubjectMismatch is returned when the profile is not of the subject of
+// the ID token.
+var ErrSubjectMismatch = errors.New("profile does not match the id token")
+
+// Token is what the provider grants in exchange for a code.
+type Token struct {
+	AccessToken string
+	// RefreshToken is empty when the provider issued none.
+	RefreshToken string
+	// ExpiresAt is zero when the access token does not expire.
+	ExpiresAt time.Time
+	// Subject is the subject of the verified ID token, it is only set by
+	// OpenID Connect providers. The profile must be of the same subject.
+	Subject string
+}
+
+// ExpiresAt is when a token that expires in the given number of seconds
+// from now expires, zero if it does not.
+func ExpiresAt(expiresIn int64, now time.Time) time.Time {
+	if expiresIn <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(time.Duration(expiresIn) * time.Second)
+}
+
+// Expired reports whether the access token has expired, or is about to.
+func (t Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && now.Add(time.Minute).After(t.ExpiresAt)
+}
+
+// CheckProfile ensures the profile, as returned by GetProfile with the
+// access token, is of the subject of the ID token.
+func (t Token) CheckProfile(user auth.User) error {
+	if t.Subject != "" && t.Subject != user.ProviderID {
+		return ErrSubjectMismatch
+	}
+
+	return nil
+}
+
 type Authentication interface {
-	AcquireAccessToken(ctx context.Context, code string) (string, error)
+	// AuthorizeURL returns the authorization page of the provider that the
+	// user is sent to. The state and the S256 PKCE code challenge are
+	// passed along, the provider sends the state back with the code.
+	// OpenID Connect providers bind the ID token to the nonce.
+	AuthorizeURL(ctx context.Context, state string, codeChallenge string, nonce string) (string, error)
+	// AcquireAccessToken exchanges the code, proving the possession of
+	// the code verifier that the code challenge was derived from. The ID
+	// token, if any, must carry the nonce of the authorization request.
+	AcquireAccessToken(ctx context.Context, code string, codeVerifier string, nonce string) (Token, error)
+	// RefreshAccessToken exchanges the refresh token for a new access
+	// token. The returned refresh token is empty when the provider keeps
+	// the previous one valid.
+	RefreshAccessToken(ctx context.Context, refreshToken string) (Token, error)
 	GetProfile(ctx context.Context, accessToken string) (auth.User, error)
-	GetPublicRepositories(ctx context.Context, username string) ([]auth.Repository, error)
+	// GetPublicRepositories lists the public repositories of the user, up
+	// to the configured maximum. Complete is not set when the list was cut
+	// off by the maximum, repositories left out may still exist.
+	GetPublicRepositories(ctx context.Context, username string) (repositories []auth.Repository, complete bool, err error)
 }
@@ -0,0 +1,289 @@
+// Package revocation keeps track of Kodiiing tokens that were revoked
+// before they expire.
+//
+// Individual tokens are revoked by their "jti" claim. Every token of a user
+// can be revoked at once by bumping the user's token generation, tokens
+// carrying an older generation are then rejected. A session, every token
+// issued from the same login, is revoked by its family.
+package revocation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_jwt "kodiiing/auth/jwt"
+	"kodiiing/cache"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+type Store struct {
+	pool  *pgxpool.Pool
+	cache cache.Cache
+}
+
+func NewStore(pool *pgxpool.Pool, c cache.Cache) (*Store, error) {
+	if pool == nil {
+		return nil, fmt.Errorf("database connection required on auth/revocation module")
+	}
+	if c == nil {
+		return nil, fmt.Errorf("cache required on auth/revocation module")
+	}
+
+	return &Store{pool: pool, cache: c}, nil
+}
+
+func revokedKey(id string) string {
+	return "token:revoked:" + id
+}
+
+func sessionRevokedKey(familyId string) string {
+	return "session:revoked:" + familyId
+}
+
+// Revoke revokes a single token. The revocation is kept until
+// the token would have expired by itself.
+func (s *Store) Revoke(ctx context.Context, claims auth_jwt.Claims) error {
+	if claims.ID == "" {
+		return auth.ErrParameterEmpty
+	}
+
+	_, err := s.pool.Exec(
+		ctx,
+		`INSERT INTO
+			revoked_tokens
+			(
+				id,
+				user_id,
+				expires_at,
+				revoked_at
+			)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT (id) DO NOTHING`,
+		claims.ID,
+		claims.UserID,
+		claims.ExpiresAt,
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("inserting revoked token: %w", err)
+	}
+
+	s.cacheRevocation(ctx, revokedKey(claims.ID), claims.ExpiresAt)
+
+	return nil
+}
+
+// cacheRevocation caches a revocation until the token or session it
+// revokes expires by itself.
+func (s *Store) cacheRevocation(ctx context.Context, key string, expiresAt time.Time) {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return
+	}
+
+	err := s.cache.Set(ctx, key, []byte{1}, ttl)
+	if err != nil {
+		log.Warn().Err(err).Str("key", key).Msg("setting revocation in cache")
+	}
+}
+
+// isCached reports whether the revocation is cached.
+func (s *Store) isCached(ctx context.Context, key string) bool {
+	_, err := s.cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, cache.ErrNotFound) {
+			log.Warn().Err(err).Str("key", key).Msg("getting revocation from cache")
+		}
+
+		return false
+	}
+
+	return true
+}
+
+// BumpGeneration increments the user's token generation, which revokes every
+// token that has been issued to the user so far. The new generation is returned.
+func (s *Store) BumpGeneration(ctx context.Context, userId int64) (int64, error) {
+	var generation int64
+	err := s.pool.QueryRow(
+		ctx,
+		`INSERT INTO
+			user_token_generations
+			(
+				user_id,
+				generation,
+				updated_at
+			)
+		VALUES
+			($1, 1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+			SET
+				generation = user_token_generations.generation + 1,
+				updated_at = EXCLUDED.updated_at
+		RETURNING generation`,
+		userId,
+		time.Now(),
+	).Scan(&generation)
+	if err != nil {
+		return 0, fmt.Errorf("bumping token generation: %w", err)
+	}
+
+	return generation, nil
+}
+
+// Generation returns the user's current token generation.
+func (s *Store) Generation(ctx context.Context, userId int64) (int64, error) {
+	var generation int64
+	err := s.pool.QueryRow(
+		ctx,
+		`SELECT generation FROM user_token_generations WHERE user_id = $1`,
+		userId,
+	).Scan(&generation)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, nil
+		}
+
+		return 0, fmt.Errorf("getting token generation: %w", err)
+	}
+
+	return generation, nil
+}
+
+// RevokeSession revokes every token issued from the same login as the
+// user's session. It returns false when the user has no such session
+// that is still active.
+func (s *Store) RevokeSession(ctx context.Context, userId int64, familyId string) (bool, error) {
+	if familyId == "" {
+		return false, auth.ErrParameterEmpty
+	}
+
+	var expiresAt time.Time
+	err := s.pool.QueryRow(
+		ctx,
+		`UPDATE user_sessions SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL RETURNING expires_at`,
+		familyId,
+		userId,
+		time.Now(),
+	).Scan(&expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("revoking session: %w", err)
+	}
+
+	s.cacheRevocation(ctx, sessionRevokedKey(familyId), expiresAt)
+
+	return true, nil
+}
+
+// RevokeUserSessions marks every session of the user as revoked. Their tokens
+// are rejected by the generation bump that goes along with it.
+func (s *Store) RevokeUserSessions(ctx context.Context, userId int64) error {
+	_, err := s.pool.Exec(
+		ctx,
+		`UPDATE user_sessions SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL`,
+		userId,
+		time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("revoking user sessions: %w", err)
+	}
+
+	return nil
+}
+
+// Check returns auth.ErrTokenRevoked if the token was revoked, either by itself,
+// by the revocation of its session or by a generation bump.
+func (s *Store) Check(ctx context.Context, claims auth_jwt.Claims) error {
+	// Only revocations are cached. Caching a negative answer would let
+	// a token that was just revoked on another replica through.
+	if s.isCached(ctx, revokedKey(claims.ID)) {
+		return auth.ErrTokenRevoked
+	}
+
+	if claims.FamilyID != "" && s.isCached(ctx, sessionRevokedKey(claims.FamilyID)) {
+		return auth.ErrTokenRevoked
+	}
+
+	var revoked bool
+	var sessionRevoked bool
+	var generation int64
+	err := s.pool.QueryRow(
+		ctx,
+		`SELECT
+			EXISTS (SELECT 1 FROM revoked_tokens WHERE id = $1),
+			EXISTS (SELECT 1 FROM user_sessions WHERE id = $3 AND revoked_at IS NOT NULL),
+			COALESCE((SELECT generation FROM user_token_generations WHERE user_id = $2), 0)`,
+		claims.ID,
+		claims.UserID,
+		claims.FamilyID,
+	).Scan(&revoked, &sessionRevoked, &generation)
+	if err != nil {
+		return fmt.Errorf("checking token revocation: %w", err)
+	}
+
+	if revoked {
+		s.cacheRevocation(ctx, revokedKey(claims.ID), claims.ExpiresAt)
+		return auth.ErrTokenRevoked
+	}
+
+	if sessionRevoked {
+		// The session may outlive the token, a token that expires
+		// later misses the cache and is checked here again.
+		s.cacheRevocation(ctx, sessionRevokedKey(claims.FamilyID), claims.ExpiresAt)
+		return auth.ErrTokenRevoked
+	}
+
+	if claims.Generation < generation {
+		return auth.ErrTokenRevoked
+	}
+
+	return nil
+}
+
+// Prune deletes revocations of tokens and sessions that have expired by
+// themselves, as those will be rejected anyway.
+func (s *Store) Prune(ctx context.Context) (int64, error) {
+	now := time.Now()
+	commandTag, err := s.pool.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired revoked tokens: %w", err)
+	}
+
+	sessionTag, err := s.pool.Exec(ctx, `DELETE FROM user_sessions WHERE expires_at < $1`, now)
+	if err != nil {
+		return 0, fmt.Errorf("deleting expired sessions: %w", err)
+	}
+
+	return commandTag.RowsAffected() + sessionTag.RowsAffected(), nil
+}
+
+// RunSweeper calls Prune on every interval until ctx is done.
+func (s *Store) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := s.Prune(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("pruning revoked tokens")
+				continue
+			}
+
+			log.Debug().Int64("pruned", pruned).Msg("pruned revoked tokens")
+		}
+	}
+}
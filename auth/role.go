@@ -0,0 +1,239 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Role is granted to a user, every user is implicitly a learner.
+type Role uint8
+
+const (
+	RoleLearner Role = iota
+	RoleReviewer
+	RoleTaskAuthor
+	RoleModerator
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleLearner:    "learner",
+	RoleReviewer:   "reviewer",
+	RoleTaskAuthor: "task_author",
+	RoleModerator:  "moderator",
+	RoleAdmin:      "admin",
+}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("role(%d)", uint8(r))
+}
+
+func (r Role) ToUint8() uint8 {
+	return uint8(r)
+}
+
+// ParseRole parses the name of a role, as returned by Role.String.
+func ParseRole(name string) (Role, error) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown role: %q", name)
+}
+
+// Permission is an action that a role allows.
+type Permission string
+
+const (
+	PermissionTaskRead     Permission = "task:read"
+	PermissionTaskAttempt  Permission = "task:attempt"
+	PermissionTaskAuthor   Permission = "task:author"
+	PermissionTaskModerate Permission = "task:moderate"
+
+	PermissionHackPost     Permission = "hack:post"
+	PermissionHackVote     Permission = "hack:vote"
+	PermissionHackComment  Permission = "hack:comment"
+	PermissionHackModerate Permission = "hack:moderate"
+
+	PermissionReviewRead    Permission = "review:read"
+	PermissionReviewApply   Permission = "review:apply"
+	PermissionReviewSubmit  Permission = "review:submit"
+	PermissionReviewApprove Permission = "review:approve"
+
+	PermissionUserOnboard     Permission = "user:onboard"
+	PermissionUserAccount     Permission = "user:account"
+	PermissionUserManageRoles Permission = "user:manage_roles"
+	PermissionUserAudit       Permission = "user:audit"
+	PermissionUserImpersonate Permission = "user:impersonate"
+)
+
+// readPermissions are the permissions that don't change anything,
+// and are allowed to read only impersonation tokens.
+var readPermissions = []Permission{
+	PermissionTaskRead,
+	PermissionReviewRead,
+	PermissionUserAudit,
+}
+
+var learnerPermissions = []Permission{
+	PermissionTaskRead,
+	PermissionTaskAttempt,
+	PermissionHackPost,
+	PermissionHackVote,
+	PermissionHackComment,
+	PermissionReviewApply,
+	PermissionUserOnboard,
+	PermissionUserAccount,
+}
+
+// rolePermissions lists what each role allows on top of
+// what a learner is allowed to do.
+var rolePermissions = map[Role][]Permission{
+	RoleLearner:    nil,
+	RoleReviewer:   {PermissionReviewRead, PermissionReviewSubmit},
+	RoleTaskAuthor: {PermissionTaskAuthor},
+	RoleModerator:  {PermissionTaskModerate, PermissionHackModerate, PermissionReviewApprove},
+	RoleAdmin: {
+		PermissionTaskAuthor,
+		PermissionTaskModerate,
+		PermissionHackModerate,
+		PermissionReviewRead,
+		PermissionReviewSubmit,
+		PermissionReviewApprove,
+		PermissionUserManageRoles,
+		PermissionUserAudit,
+		PermissionUserImpersonate,
+	},
+}
+
+// HasRole reports whether the user was granted the role.
+func (u *User) HasRole(role Role) bool {
+	if role == RoleLearner {
+		return true
+	}
+
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasPermission reports whether any role of the user allows the permission,
+// and whether the scopes of the token that authenticated the user include it.
+func (u *User) HasPermission(permission Permission) bool {
+	if u.Scopes != nil && !containsPermission(u.Scopes, permission) {
+		return false
+	}
+
+	if u.ReadOnly && !containsPermission(readPermissions, permission) {
+		return false
+	}
+
+	if containsPermission(learnerPermissions, permission) {
+		return true
+	}
+
+	for _, role := range u.Roles {
+		if containsPermission(rolePermissions[role], permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsPermission(permissions []Permission, permission Permission) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParsePermission parses the name of a permission, such as "task:read".
+func ParsePermission(name string) (Permission, error) {
+	permission := Permission(name)
+	if containsPermission(learnerPermissions, permission) || containsPermission(rolePermissions[RoleAdmin], permission) {
+		return permission, nil
+	}
+
+	return "", fmt.Errorf("unknown permission: %q", name)
+}
+
+// ErrUnauthenticated is returned when an access token is not valid.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// ErrForbidden is returned when the user is authenticated, but
+// none of its roles allows the requested permission.
+var ErrForbidden = errors.New("forbidden")
+
+type Authorize interface {
+	Authenticate
+	Authorize(ctx context.Context, user *User, permission Permission) error
+}
+
+// Require authenticates the access token, and checks that the user is
+// allowed the permission. Services declare the permission of each RPC,
+// and answer errors with the status code given by StatusCode.
+func Require(ctx context.Context, authorization Authorize, accessToken string, permission Permission) (*User, error) {
+	user, err := authorization.Authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorization.Authorize(ctx, user, permission)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// RPC declares the permission that an RPC requires. Services declare one
+// for each of their RPCs, so an RPC without a permission doesn't compile.
+type RPC struct {
+	Name       string
+	Permission Permission
+}
+
+// AuthorizeRPC authenticates the access token, and checks that the user is
+// allowed to call the RPC. The returned context carries the user.
+func AuthorizeRPC(ctx context.Context, authorization Authorize, accessToken string, rpc RPC) (context.Context, *User, error) {
+	user, err := Require(ctx, authorization, accessToken, rpc.Permission)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("authorizing user for %s: %w", rpc.Name, err)
+	}
+
+	return WithUser(ctx, user), user, nil
+}
+
+// StatusCode maps an error returned by Authenticate, Authorize, Require
+// or AuthorizeRPC to the HTTP status code to answer with.
+func StatusCode(err error) int {
+	switch {
+	case errors.Is(err, ErrParameterEmpty),
+		errors.Is(err, ErrUnauthenticated),
+		errors.Is(err, ErrUserNotFound),
+		errors.Is(err, ErrTokenRevoked):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, ErrTooManyAttempts):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
+	}
+}
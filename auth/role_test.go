@@ -0,0 +1,171 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"net/http"
+	"testing"
+)
+
+func TestHasPermission(t *testing.T) {
+	learner := &auth.User{}
+	if !learner.HasPermission(auth.PermissionTaskAttempt) {
+		t.Error("learner should be allowed to attempt tasks")
+	}
+
+	if learner.HasPermission(auth.PermissionReviewSubmit) {
+		t.Error("learner should not be allowed to submit reviews")
+	}
+
+	reviewer := &auth.User{Roles: []auth.Role{auth.RoleReviewer}}
+	if !reviewer.HasPermission(auth.PermissionReviewSubmit) {
+		t.Error("reviewer should be allowed to submit reviews")
+	}
+
+	if reviewer.HasPermission(auth.PermissionUserManageRoles) {
+		t.Error("reviewer should not be allowed to manage roles")
+	}
+
+	admin := &auth.User{Roles: []auth.Role{auth.RoleAdmin}}
+	if !admin.HasPermission(auth.PermissionUserManageRoles) {
+		t.Error("admin should be allowed to manage roles")
+	}
+
+	if !admin.HasRole(auth.RoleLearner) {
+		t.Error("every user should be a learner")
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range []auth.Role{auth.RoleLearner, auth.RoleReviewer, auth.RoleTaskAuthor, auth.RoleModerator, auth.RoleAdmin} {
+		parsed, err := auth.ParseRole(role.String())
+		if err != nil {
+			t.Errorf("parsing %s: %v", role, err)
+		}
+
+		if parsed != role {
+			t.Errorf("expected %s, got %s", role, parsed)
+		}
+	}
+
+	_, err := auth.ParseRole("superuser")
+	if err == nil {
+		t.Error("expected error for an unknown role")
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	cases := map[error]int{
+		auth.ErrParameterEmpty: http.StatusUnauthorized,
+		fmt.Errorf("%w: token is expired", auth.ErrUnauthenticated): http.StatusUnauthorized,
+		auth.ErrTokenRevoked: http.StatusUnauthorized,
+		fmt.Errorf("%w: task:author is required", auth.ErrForbidden): http.StatusForbidden,
+		errors.New("connection refused"):                             http.StatusInternalServerError,
+	}
+
+	for err, expected := range cases {
+		if got := auth.StatusCode(err); got != expected {
+			t.Errorf("%v: expected %d, got %d", err, expected, got)
+		}
+	}
+}
+
+func TestHasPermissionScoped(t *testing.T) {
+	user := &auth.User{
+		Roles:  []auth.Role{auth.RoleTaskAuthor},
+		Scopes: []auth.Permission{auth.PermissionTaskRead, auth.PermissionTaskAuthor, auth.PermissionHackModerate},
+	}
+
+	if !user.HasPermission(auth.PermissionTaskAuthor) {
+		t.Error("scoped permission held by the role should be allowed")
+	}
+
+	if user.HasPermission(auth.PermissionTaskAttempt) {
+		t.Error("permission outside of the scopes should not be allowed")
+	}
+
+	if user.HasPermission(auth.PermissionHackModerate) {
+		t.Error("scope should not grant a permission the roles do not allow")
+	}
+}
+
+func TestParsePermission(t *testing.T) {
+	permission, err := auth.ParsePermission("user:manage_roles")
+	if err != nil {
+		t.Fatalf("parsing permission: %v", err)
+	}
+
+	if permission != auth.PermissionUserManageRoles {
+		t.Errorf("expected %s, got %s", auth.PermissionUserManageRoles, permission)
+	}
+
+	_, err = auth.ParsePermission("task:delete")
+	if err == nil {
+		t.Error("expected error for an unknown permission")
+	}
+}
+
+func TestHasPermissionReadOnly(t *testing.T) {
+	user := &auth.User{ImpersonatedBy: 1, ReadOnly: true}
+	if !user.HasPermission(auth.PermissionTaskRead) {
+		t.Error("read only user should be allowed to read tasks")
+	}
+
+	if user.HasPermission(auth.PermissionTaskAttempt) {
+		t.Error("read only user should not be allowed to attempt tasks")
+	}
+
+	user.ReadOnly = false
+	if !user.HasPermission(auth.PermissionTaskAttempt) {
+		t.Error("impersonated user should keep its permissions when writes are allowed")
+	}
+}
+
+// fakeAuthorization accepts "valid-token" for the user, and allows
+// only the permissions the user has.
+type fakeAuthorization struct {
+	user *auth.User
+}
+
+func (f fakeAuthorization) Authenticate(ctx context.Context, accessToken string) (*auth.User, error) {
+	if accessToken != "valid-token" {
+		return nil, auth.ErrUnauthenticated
+	}
+
+	return f.user, nil
+}
+
+func (f fakeAuthorization) Authorize(ctx context.Context, user *auth.User, permission auth.Permission) error {
+	if !user.HasPermission(permission) {
+		return fmt.Errorf("%w: %s is required", auth.ErrForbidden, permission)
+	}
+
+	return nil
+}
+
+func TestAuthorizeRPC(t *testing.T) {
+	authorization := fakeAuthorization{user: &auth.User{ID: 1}}
+	rpcListTasks := auth.RPC{Name: "ListTasks", Permission: auth.PermissionTaskRead}
+	rpcCreateTestCase := auth.RPC{Name: "CreateTestCase", Permission: auth.PermissionTaskAuthor}
+
+	ctx, user, err := auth.AuthorizeRPC(context.Background(), authorization, "valid-token", rpcListTasks)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fromContext, ok := auth.UserFromContext(ctx); !ok || fromContext != user || user.ID != 1 {
+		t.Errorf("expected the context to carry the user, got %+v", fromContext)
+	}
+
+	_, _, err = auth.AuthorizeRPC(context.Background(), authorization, "valid-token", rpcCreateTestCase)
+	if auth.StatusCode(err) != http.StatusForbidden {
+		t.Errorf("expected forbidden, got %v", err)
+	}
+
+	_, _, err = auth.AuthorizeRPC(context.Background(), authorization, "invalid-token", rpcListTasks)
+	if auth.StatusCode(err) != http.StatusUnauthorized {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package auth_service
+
+import (
+	"context"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+	"time"
+)
+
+func (d *AuthService) ListAuthEvents(ctx context.Context, req *auth_stub.ListAuthEventsRequest) (*auth_stub.ListAuthEventsResponse, *auth_stub.AuthenticationServiceError) {
+	_, authErr := d.requirePermission(ctx, req.AccessToken, auth.PermissionUserAudit)
+	if authErr != nil {
+		return &auth_stub.ListAuthEventsResponse{}, authErr
+	}
+
+	filter := audit.Filter{
+		UserID:   req.UserId,
+		Type:     audit.EventType(req.Type),
+		Outcome:  audit.Outcome(req.Outcome),
+		IP:       req.Ip,
+		BeforeID: req.BeforeId,
+		Limit:    int(req.Limit),
+	}
+	if req.Since != 0 {
+		filter.Since = time.Unix(req.Since, 0)
+	}
+	if req.Until != 0 {
+		filter.Until = time.Unix(req.Until, 0)
+	}
+
+	events, err := d.audit.Query(ctx, filter)
+	if err != nil {
+		return &auth_stub.ListAuthEventsResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	response := &auth_stub.ListAuthEventsResponse{Events: make([]auth_stub.AuthEvent, 0, len(events))}
+	for _, event := range events {
+		e := auth_stub.AuthEvent{
+			Id:        event.ID,
+			Type:      string(event.Type),
+			Outcome:   string(event.Outcome),
+			UserId:    event.UserID,
+			Ip:        event.IP,
+			UserAgent: event.UserAgent,
+			Detail:    event.Detail,
+			CreatedAt: event.CreatedAt.Unix(),
+		}
+		if event.Provider != nil {
+			e.Provider = providerToStub(*event.Provider)
+		}
+
+		response.Events = append(response.Events, e)
+	}
+
+	return response, nil
+}
@@ -0,0 +1,118 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+)
+
+// authenticate verifies an access token given in a request body,
+// including whether it has been revoked. Impersonation tokens are refused.
+func (d *AuthService) authenticate(ctx context.Context, accessToken string) (auth_jwt.Claims, *auth_stub.AuthenticationServiceError) {
+	err := d.audit.Blocked(ctx, 0)
+	if err != nil {
+		return auth_jwt.Claims{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	claims, err := d.jwt.ParseAccessToken(accessToken)
+	if err != nil {
+		d.audit.Record(ctx, audit.Event{Type: audit.EventAuthenticate, Outcome: audit.OutcomeFailure, Detail: err.Error(), Guess: audit.Guessed(err)})
+		return auth_jwt.Claims{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      fmt.Errorf("unauthenticated: %w", err),
+		}
+	}
+
+	err = d.audit.Blocked(ctx, claims.UserID)
+	if err != nil {
+		return auth_jwt.Claims{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	// Impersonation is for seeing what the user sees, not for managing
+	// the account. Logout parses the token by itself, so it can still
+	// be revoked.
+	if claims.ImpersonatorID != 0 {
+		return auth_jwt.Claims{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusForbidden,
+			Error:      fmt.Errorf("%w: impersonation tokens can't be used on the authentication service", auth.ErrForbidden),
+		}
+	}
+
+	err = d.revocation.Check(ctx, claims)
+	if err != nil {
+		if errors.Is(err, auth.ErrTokenRevoked) {
+			d.audit.Record(ctx, audit.Event{Type: audit.EventAuthenticate, Outcome: audit.OutcomeFailure, UserID: claims.UserID, Detail: err.Error(), Guess: audit.Guessed(err)})
+			return auth_jwt.Claims{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusUnauthorized,
+				Error:      fmt.Errorf("unauthenticated: %w", err),
+			}
+		}
+
+		return auth_jwt.Claims{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return claims, nil
+}
+
+// requirePermission authenticates the access token, and checks that
+// the roles of the user allow the permission.
+func (d *AuthService) requirePermission(ctx context.Context, accessToken string, permission auth.Permission) (auth.User, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, accessToken)
+	if authErr != nil {
+		return auth.User{}, authErr
+	}
+
+	user, err := d.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		return auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: auth.StatusCode(err),
+			Error:      err,
+		}
+	}
+
+	if !user.HasPermission(permission) {
+		return auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusForbidden,
+			Error:      fmt.Errorf("%w: %s is required", auth.ErrForbidden, permission),
+		}
+	}
+
+	return user, nil
+}
+
+// recordLogin records the outcome of an RPC that issues a token pair. Errors
+// on the client's side are failures, only bad credentials count towards
+// blocking the client. The user is read from the issued access token.
+func (d *AuthService) recordLogin(ctx context.Context, eventType audit.EventType, provider *auth.Provider, resp *auth_stub.LoginResponse, authErr *auth_stub.AuthenticationServiceError) {
+	event := audit.Event{Type: eventType, Provider: provider, Outcome: audit.OutcomeSuccess}
+	switch {
+	case authErr != nil && authErr.StatusCode >= http.StatusInternalServerError:
+		event.Outcome = audit.OutcomeError
+		event.Detail = authErr.Error.Error()
+	case authErr != nil:
+		event.Outcome = audit.OutcomeFailure
+		event.Detail = authErr.Error.Error()
+		event.Guess = audit.Guessed(authErr.Error)
+	case resp != nil:
+		claims, err := d.jwt.ParseAccessToken(resp.AccessToken)
+		if err == nil {
+			event.UserID = claims.UserID
+		}
+	}
+
+	d.audit.Record(ctx, event)
+}
@@ -0,0 +1,137 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"kodiiing/auth"
+	"kodiiing/cache"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+// CacheTTL is how long each kind of entry is cached. Zero values fall back
+// to the defaults.
+type CacheTTL struct {
+	User time.Duration
+	// UserNotFound is how long a user that does not exist is remembered.
+	UserNotFound time.Duration
+	Repositories time.Duration
+	// LoginState bounds the time between BeginLogin and Login.
+	LoginState time.Duration
+}
+
+func (t CacheTTL) withDefaults() CacheTTL {
+	if t.User <= 0 {
+		t.User = time.Minute * 3
+	}
+	if t.UserNotFound <= 0 {
+		t.UserNotFound = time.Second * 30
+	}
+	if t.Repositories <= 0 {
+		t.Repositories = time.Minute * 3
+	}
+	if t.LoginState <= 0 {
+		t.LoginState = time.Minute * 10
+	}
+
+	return t
+}
+
+// useCache sets up the key families of the service on top of c.
+func (d *AuthService) useCache(c cache.Cache, ttl CacheTTL) {
+	ttl = ttl.withDefaults()
+
+	userConfig := func(prefix string) cache.FamilyConfig {
+		return cache.FamilyConfig{
+			Prefix:      prefix,
+			TTL:         ttl.User,
+			NotFound:    auth.ErrUserNotFound,
+			NegativeTTL: ttl.UserNotFound,
+		}
+	}
+
+	d.usersById = cache.NewFamily[auth.User](c, userConfig(auth.CacheKeyUserById))
+	d.usersByUsername = cache.NewFamily[auth.User](c, userConfig(auth.CacheKeyUserByUsername))
+	d.usersByEmail = cache.NewFamily[auth.User](c, userConfig(auth.CacheKeyUserByEmail))
+	d.repositories = cache.NewFamily[[]auth.Repository](c, cache.FamilyConfig{
+		Prefix: auth.CacheKeyRepositories,
+		TTL:    ttl.Repositories,
+	})
+	d.loginStates = cache.NewFamily[loginState](c, cache.FamilyConfig{
+		Prefix: "login:state:",
+		TTL:    ttl.LoginState,
+	})
+}
+
+// invalidateUser drops every cache entry of the user. Entries are dropped
+// under the current username and email of the user, and under the given
+// ones, which the user may still be cached under after a change. Tombstones
+// that were merged into the user are dropped as well.
+func (d *AuthService) invalidateUser(ctx context.Context, userId int64, username string, email string) {
+	ids := []string{strconv.FormatInt(userId, 10)}
+	usernames := []string{}
+	emails := []string{}
+	if username != "" {
+		usernames = append(usernames, username)
+	}
+	if email != "" {
+		emails = append(emails, email)
+	}
+
+	var currentUsername, currentEmail string
+	var mergedIds []int64
+	err := d.pool.QueryRow(
+		ctx,
+		`SELECT
+			username,
+			email,
+			ARRAY(SELECT id FROM users WHERE merged_into = $1)
+		FROM
+			users
+		WHERE
+			id = $1`,
+		userId,
+	).Scan(&currentUsername, &currentEmail, &mergedIds)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		// The entries keyed by ID are dropped anyway.
+		log.Warn().Err(err).Int64("user_id", userId).Msg("getting user to invalidate")
+	}
+
+	if currentUsername != "" && currentUsername != username {
+		usernames = append(usernames, currentUsername)
+	}
+	if currentEmail != "" && currentEmail != email {
+		emails = append(emails, currentEmail)
+	}
+	for _, mergedId := range mergedIds {
+		ids = append(ids, strconv.FormatInt(mergedId, 10))
+	}
+
+	invalidate(ctx, d.usersById, ids...)
+	invalidate(ctx, d.usersByUsername, usernames...)
+	invalidate(ctx, d.usersByEmail, emails...)
+	d.invalidateRepositories(ctx, userId)
+}
+
+// invalidateUserId drops the cache entries of the user, for a user whose
+// previous username and email do not matter.
+func (d *AuthService) invalidateUserId(ctx context.Context, userId int64) {
+	d.invalidateUser(ctx, userId, "", "")
+}
+
+// invalidateRepositories drops the cached repositories of the user.
+func (d *AuthService) invalidateRepositories(ctx context.Context, userId int64) {
+	invalidate(ctx, d.repositories, strconv.FormatInt(userId, 10))
+}
+
+// invalidate deletes the keys of the family. A failure is only logged, the
+// entries then expire by themselves.
+func invalidate[T any](ctx context.Context, family *cache.Family[T], keys ...string) {
+	err := family.Delete(ctx, keys...)
+	if err != nil {
+		log.Warn().Err(err).Strs("keys", keys).Msg("invalidating cache")
+	}
+}
@@ -0,0 +1,291 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// GetUserIdByIdentity returns the Kodiiing user that the provider identity is
+// linked to. Primary is set when the identity is the one the user's profile
+// is taken from.
+func (d *AuthService) GetUserIdByIdentity(ctx context.Context, provider auth.Provider, providerId string) (userId int64, primary bool, err error) {
+	err = d.pool.QueryRow(
+		ctx,
+		`SELECT
+			user_identities.user_id,
+			users.provider = user_identities.provider AND users.provider_id = user_identities.provider_id
+		FROM
+			user_identities
+			JOIN users ON users.id = user_identities.user_id
+		WHERE
+			user_identities.provider = $1
+			AND user_identities.provider_id = $2`,
+		provider.ToUint8(),
+		providerId,
+	).Scan(&userId, &primary)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, false, auth.ErrUserNotFound
+		}
+
+		return 0, false, fmt.Errorf("error getting user identity: %w", err)
+	}
+
+	return userId, primary, nil
+}
+
+// CreateUserIdentity links the identity returned by a provider to the user,
+// or refreshes it if it is already linked to the user. It returns
+// ErrIdentityLinked if the identity belongs to another user, and
+// ErrIdentityConflict if the user has another identity of the provider.
+func (d *AuthService) CreateUserIdentity(ctx context.Context, userId int64, user *auth.User) error {
+	commandTag, err := d.pool.Exec(
+		ctx,
+		`INSERT INTO
+			user_identities
+			(
+				user_id,
+				provider,
+				provider_id,
+				username,
+				email,
+				linked_at,
+				updated_at,
+				updated_by
+			)
+		VALUES
+			($1, $2, $3, $4, $5, $6, $6, $7)
+		ON CONFLICT (provider, provider_id) DO UPDATE
+			SET
+				username = EXCLUDED.username,
+				email = EXCLUDED.email,
+				updated_at = EXCLUDED.updated_at,
+				updated_by = EXCLUDED.updated_by
+			WHERE
+				user_identities.user_id = EXCLUDED.user_id`,
+		userId,
+		user.Provider.ToUint8(),
+		user.ProviderID,
+		user.Username,
+		user.Email,
+		time.Now(),
+		"system",
+	)
+	if err != nil {
+		if isUniqueViolation(err, "user_identities_user_id_provider") {
+			return auth.ErrIdentityConflict
+		}
+
+		return fmt.Errorf("error inserting user identity: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return auth.ErrIdentityLinked
+	}
+
+	return nil
+}
+
+// DeleteUserIdentity unlinks the user's identity of the provider, along with
+// its provider token and repositories. When it was the primary identity,
+// the user's profile is taken from one of the remaining identities.
+func (d *AuthService) DeleteUserIdentity(ctx context.Context, userId int64, provider auth.Provider) error {
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Lock the user, so two concurrent unlinks can't both
+	// see the other identity remaining.
+	var primaryProvider auth.Provider
+	err = tx.QueryRow(ctx, `SELECT provider FROM users WHERE id = $1 FOR UPDATE`, userId).Scan(&primaryProvider)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth.ErrUserNotFound
+		}
+
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	var remaining int
+	err = tx.QueryRow(ctx, `SELECT COUNT(*) FROM user_identities WHERE user_id = $1 AND provider <> $2`, userId, provider.ToUint8()).Scan(&remaining)
+	if err != nil {
+		return fmt.Errorf("error counting user identities: %w", err)
+	}
+
+	if remaining == 0 {
+		return auth.ErrLastIdentity
+	}
+
+	commandTag, err := tx.Exec(ctx, `DELETE FROM user_identities WHERE user_id = $1 AND provider = $2`, userId, provider.ToUint8())
+	if err != nil {
+		return fmt.Errorf("error deleting user identity: %w", err)
+	}
+
+	if commandTag.RowsAffected() == 0 {
+		return auth.ErrUserNotFound
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_accesstoken WHERE user_id = $1 AND provider = $2`, userId, provider.ToUint8())
+	if err != nil {
+		return fmt.Errorf("error deleting user access token: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM user_repositories WHERE user_id = $1 AND provider = $2`, userId, provider.ToUint8())
+	if err != nil {
+		return fmt.Errorf("error deleting user repositories: %w", err)
+	}
+
+	if primaryProvider == provider {
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE
+				users
+			SET
+				provider = identity.provider,
+				provider_id = identity.provider_id,
+				username = identity.username,
+				email = identity.email,
+				synced_at = NULL,
+				updated_at = $2,
+				updated_by = $3
+			FROM
+				(
+					SELECT provider, provider_id, username, email
+					FROM user_identities
+					WHERE user_id = $1
+					ORDER BY linked_at
+					LIMIT 1
+				) AS identity
+			WHERE
+				users.id = $1`,
+			userId,
+			time.Now(),
+			"system",
+		)
+		if err != nil {
+			return fmt.Errorf("error updating primary identity: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// MergeUsers moves everything owned by the source user into the target user,
+// for a person that accidentally created two accounts. The source user is
+// kept as a tombstone pointing to the target, so its tokens keep resolving
+// to the target. Its provider key is cleared, as the identity now belongs
+// to the target and may become its primary one. Both users must not have an
+// identity of the same provider.
+func (d *AuthService) MergeUsers(ctx context.Context, sourceId int64, targetId int64) error {
+	if sourceId == targetId {
+		return nil
+	}
+
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return fmt.Errorf("starting transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Lock both users in a stable order to avoid deadlocks.
+	rows, err := tx.Query(ctx, `SELECT id FROM users WHERE id = ANY($1) AND merged_into IS NULL ORDER BY id FOR UPDATE`, []int64{sourceId, targetId})
+	if err != nil {
+		return fmt.Errorf("error locking users: %w", err)
+	}
+
+	locked, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return fmt.Errorf("error locking users: %w", err)
+	}
+
+	if len(locked) != 2 {
+		return auth.ErrUserNotFound
+	}
+
+	var conflicts int
+	err = tx.QueryRow(
+		ctx,
+		`SELECT
+			COUNT(*)
+		FROM
+			user_identities AS source
+			JOIN user_identities AS target ON target.provider = source.provider
+		WHERE
+			source.user_id = $1
+			AND target.user_id = $2`,
+		sourceId,
+		targetId,
+	).Scan(&conflicts)
+	if err != nil {
+		return fmt.Errorf("error checking identities: %w", err)
+	}
+
+	if conflicts > 0 {
+		return auth.ErrIdentityConflict
+	}
+
+	statements := []string{
+		`UPDATE user_identities SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE user_accesstoken SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE user_repositories SET user_id = $2 WHERE user_id = $1`,
+		// Progress on a task both users have started is kept from the target.
+		`UPDATE user_tasks SET user_id = $2 WHERE user_id = $1 AND task_id NOT IN (SELECT task_id FROM user_tasks WHERE user_id = $2 AND task_id IS NOT NULL)`,
+		// A task both users have started is finished if either finished it.
+		`UPDATE user_tasks AS target SET status = source.status, finished_at = source.finished_at FROM user_tasks AS source WHERE source.user_id = $1 AND target.user_id = $2 AND source.task_id = target.task_id AND source.finished_at IS NOT NULL AND target.finished_at IS NULL`,
+		`DELETE FROM user_tasks WHERE user_id = $1`,
+		// Every submission is kept.
+		`UPDATE task_submissions SET user_id = $2 WHERE user_id = $1`,
+		`UPDATE user_profiles SET user_id = $2 WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM user_profiles WHERE user_id = $2)`,
+		`DELETE FROM user_profiles WHERE user_id = $1`,
+		`UPDATE tasks SET author = $2 WHERE author = $1`,
+		`INSERT INTO user_roles (user_id, role, granted_at, granted_by) SELECT $2, role, granted_at, granted_by FROM user_roles WHERE user_id = $1 ON CONFLICT DO NOTHING`,
+		`DELETE FROM user_roles WHERE user_id = $1`,
+		`UPDATE personal_access_tokens SET user_id = $2 WHERE user_id = $1`,
+		`DELETE FROM user_statistics WHERE user_id = $1`,
+		`UPDATE users SET merged_into = $2 WHERE merged_into = $1`,
+		`UPDATE users SET merged_into = $2, provider_id = NULL, updated_at = NOW(), updated_by = 'system:merge' WHERE id = $1`,
+	}
+	for _, statement := range statements {
+		_, err := tx.Exec(ctx, statement, sourceId, targetId)
+		if err != nil {
+			return fmt.Errorf("error merging users: %w", err)
+		}
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether err is a violation of the unique
+// constraint or index with the given name.
+func isUniqueViolation(err error, name string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == name
+}
+
+// isForeignKeyViolation reports whether err is a violation of a foreign key.
+func isForeignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23503"
+}
@@ -0,0 +1,155 @@
+package auth_service_test
+
+import (
+	"context"
+	"database/sql"
+	"kodiiing/auth"
+	auth_aes "kodiiing/auth/aes"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
+	"kodiiing/auth/revocation"
+	auth_service "kodiiing/auth/service"
+	"kodiiing/cache"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	_ "github.com/lib/pq"
+	"github.com/pressly/goose/v3"
+)
+
+// newAuthService migrates the database of KODIIING_TEST_DATABASE_URL and
+// returns a service on top of it. The test is skipped when it is not set.
+func newAuthService(t *testing.T) *auth_service.AuthService {
+	t.Helper()
+
+	databaseUrl := os.Getenv("KODIIING_TEST_DATABASE_URL")
+	if databaseUrl == "" {
+		t.Skip("KODIIING_TEST_DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+
+	db, err := sql.Open("postgres", databaseUrl)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	if err := goose.SetDialect("postgres"); err != nil {
+		t.Fatalf("failed to set dialect: %v", err)
+	}
+
+	if err := goose.UpContext(ctx, db, "../../migrations"); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+
+	pool, err := pgxpool.New(ctx, databaseUrl)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	memory, err := cache.NewMemory(ctx, cache.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	aes, err := auth_aes.NewAes([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatalf("failed to create aes: %v", err)
+	}
+
+	key, err := auth_jwt.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	jwt, err := auth_jwt.New(auth_jwt.Config{AccessKeys: []auth_jwt.Key{key}, RefreshKeys: []auth_jwt.Key{key}})
+	if err != nil {
+		t.Fatalf("failed to create jwt: %v", err)
+	}
+
+	revocationStore, err := revocation.NewStore(pool, memory)
+	if err != nil {
+		t.Fatalf("failed to create revocation store: %v", err)
+	}
+
+	auditLog, err := audit.NewLog(audit.Config{Pool: pool})
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+
+	service, err := auth_service.NewAuthService(&auth_service.Config{
+		Pool:       pool,
+		Cache:      memory,
+		Aes:        aes,
+		Jwt:        jwt,
+		Revocation: revocationStore,
+		Audit:      auditLog,
+	})
+	if err != nil {
+		t.Fatalf("failed to create auth service: %v", err)
+	}
+
+	return service.(*auth_service.AuthService)
+}
+
+func createUser(t *testing.T, d *auth_service.AuthService, user auth.User) int64 {
+	t.Helper()
+
+	ctx := context.Background()
+
+	userId, err := d.CreateUser(ctx, &user)
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+
+	if err := d.CreateUserIdentity(ctx, userId, &user); err != nil {
+		t.Fatalf("failed to create user identity: %v", err)
+	}
+
+	return userId
+}
+
+func TestDeleteIdentityAfterMerge(t *testing.T) {
+	d := newAuthService(t)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 10)
+	sourceId := createUser(t, d, auth.User{
+		Provider:   auth.ProviderGithub,
+		ProviderID: "github-" + suffix,
+		Username:   "source-" + suffix,
+		Email:      "source-" + suffix + "@example.com",
+		CreatedAt:  time.Now(),
+	})
+	targetId := createUser(t, d, auth.User{
+		Provider:   auth.ProviderGitlab,
+		ProviderID: "gitlab-" + suffix,
+		Username:   "target-" + suffix,
+		Email:      "target-" + suffix + "@example.com",
+		CreatedAt:  time.Now(),
+	})
+
+	if err := d.MergeUsers(ctx, sourceId, targetId); err != nil {
+		t.Fatalf("failed to merge users: %v", err)
+	}
+
+	// The identity merged from the source becomes the primary one,
+	// which takes the provider key the source user had.
+	if err := d.DeleteUserIdentity(ctx, targetId, auth.ProviderGitlab); err != nil {
+		t.Fatalf("failed to delete primary identity after merge: %v", err)
+	}
+
+	userId, primary, err := d.GetUserIdByIdentity(ctx, auth.ProviderGithub, "github-"+suffix)
+	if err != nil {
+		t.Fatalf("failed to get user by identity: %v", err)
+	}
+
+	if userId != targetId || !primary {
+		t.Errorf("expected identity to be the primary one of user %d, got user %d (primary: %v)", targetId, userId, primary)
+	}
+}
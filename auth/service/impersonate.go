@@ -0,0 +1,96 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+	"time"
+)
+
+// impersonationTTL is how long an impersonation token is valid,
+// it can't be refreshed.
+const impersonationTTL = 15 * time.Minute
+
+// Impersonate issues an access token acting as another user, so support
+// staff can see what the user sees. The token is read only unless writes
+// are allowed, and every token issued is recorded on the audit trail.
+func (d *AuthService) Impersonate(ctx context.Context, req *auth_stub.ImpersonateRequest) (*auth_stub.ImpersonateResponse, *auth_stub.AuthenticationServiceError) {
+	admin, authErr := d.requirePermission(ctx, req.AccessToken, auth.PermissionUserImpersonate)
+	if authErr != nil {
+		return &auth_stub.ImpersonateResponse{}, authErr
+	}
+
+	if req.Reason == "" {
+		return &auth_stub.ImpersonateResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("reason is required"),
+		}
+	}
+
+	target, err := d.GetUserById(ctx, req.UserId)
+	if err != nil {
+		statusCode := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrUserNotFound) {
+			statusCode = http.StatusNotFound
+		}
+
+		return &auth_stub.ImpersonateResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: statusCode,
+			Error:      err,
+		}
+	}
+
+	if target.ID == admin.ID {
+		return &auth_stub.ImpersonateResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("cannot impersonate yourself"),
+		}
+	}
+
+	// An admin acting as another admin would hide who did what.
+	if target.HasRole(auth.RoleAdmin) {
+		return &auth_stub.ImpersonateResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusForbidden,
+			Error:      fmt.Errorf("%w: cannot impersonate an admin", auth.ErrForbidden),
+		}
+	}
+
+	generation, err := d.revocation.Generation(ctx, target.ID)
+	if err != nil {
+		return &auth_stub.ImpersonateResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	readOnly := !req.AllowWrites
+	token, claims, err := d.jwt.IssueAccessToken(auth_jwt.Subject{
+		UserID:         target.ID,
+		Generation:     generation,
+		ImpersonatorID: admin.ID,
+		ReadOnly:       readOnly,
+	}, impersonationTTL)
+	if err != nil {
+		return &auth_stub.ImpersonateResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("signing token: %w", err),
+		}
+	}
+
+	d.audit.Record(ctx, audit.Event{
+		Type:    audit.EventImpersonate,
+		Outcome: audit.OutcomeSuccess,
+		UserID:  admin.ID,
+		Detail:  fmt.Sprintf("user %d, read only %t, token %s: %s", target.ID, readOnly, claims.ID, req.Reason),
+	})
+
+	return &auth_stub.ImpersonateResponse{
+		AccessToken: token,
+		ExpiresAt:   claims.ExpiresAt.Unix(),
+	}, nil
+}
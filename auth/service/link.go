@@ -0,0 +1,187 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+)
+
+// LinkProvider links another provider identity to the logged in user, so the
+// user can log in with either. If the identity already belongs to another
+// user, that user is merged into the logged in one when the request allows it.
+func (d *AuthService) LinkProvider(ctx context.Context, req *auth_stub.LinkProviderRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	if req.AccessCode == "" {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("access code is required"),
+		}
+	}
+
+	providerKind, ok := providerFromStub(req.Provider)
+	if !ok {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("unsupported provider: %d", req.Provider),
+		}
+	}
+
+	authProvider, ok := d.providers[providerKind]
+	if !ok || authProvider == nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("provider is not configured: %d", req.Provider),
+		}
+	}
+
+	// Resolve the canonical user, the token might have been
+	// issued to a user that was merged since.
+	user, err := d.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusUnauthorized,
+				Error:      fmt.Errorf("unauthenticated: %w", err),
+			}
+		}
+
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	token, profile, authErr := d.acquireProfile(ctx, authProvider, providerKind, req.State, req.LoginSecret, req.AccessCode)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	repositories, _, err := authProvider.GetPublicRepositories(ctx, profile.Username)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadGateway,
+			Error:      fmt.Errorf("getting public repositories: %w", err),
+		}
+	}
+
+	ownerId, _, err := d.GetUserIdByIdentity(ctx, profile.Provider, profile.ProviderID)
+	if err != nil && !errors.Is(err, auth.ErrUserNotFound) {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	if err == nil && ownerId != user.ID {
+		if !req.Merge {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusConflict,
+				Error:      auth.ErrIdentityLinked,
+			}
+		}
+
+		// The caller is logged in as the current user and has just proven
+		// ownership of the other account's identity, so both accounts
+		// belong to the same person.
+		err = d.MergeUsers(ctx, ownerId, user.ID)
+		if err != nil {
+			if errors.Is(err, auth.ErrIdentityConflict) {
+				return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+					StatusCode: http.StatusConflict,
+					Error:      err,
+				}
+			}
+
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Error:      err,
+			}
+		}
+
+		d.invalidateUserId(ctx, ownerId)
+	}
+
+	err = d.storeIdentity(ctx, user.ID, profile, repositories, token)
+	if err != nil {
+		if errors.Is(err, auth.ErrIdentityConflict) || errors.Is(err, auth.ErrIdentityLinked) {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusConflict,
+				Error:      err,
+			}
+		}
+
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	d.invalidateUser(ctx, user.ID, user.Username, user.Email)
+
+	return &auth_stub.EmptyResponse{}, nil
+}
+
+// UnlinkProvider unlinks a provider identity from the logged in user. The
+// last identity of a user can't be unlinked.
+func (d *AuthService) UnlinkProvider(ctx context.Context, req *auth_stub.UnlinkProviderRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	providerKind, ok := providerFromStub(req.Provider)
+	if !ok {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("unsupported provider: %d", req.Provider),
+		}
+	}
+
+	user, err := d.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusUnauthorized,
+				Error:      fmt.Errorf("unauthenticated: %w", err),
+			}
+		}
+
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	err = d.DeleteUserIdentity(ctx, user.ID, providerKind)
+	if err != nil {
+		if errors.Is(err, auth.ErrLastIdentity) {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusBadRequest,
+				Error:      err,
+			}
+		}
+
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusNotFound,
+				Error:      fmt.Errorf("no identity of provider %d is linked", req.Provider),
+			}
+		}
+
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	d.invalidateUser(ctx, user.ID, user.Username, user.Email)
+
+	return &auth_stub.EmptyResponse{}, nil
+}
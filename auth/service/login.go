@@ -2,9 +2,205 @@ package auth_service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
+	"kodiiing/auth/provider"
 	auth_stub "kodiiing/auth/stub"
+	"net/http"
 )
 
+// providerFromStub maps the provider enum from the API contract
+// into the provider enum being used internally.
+func providerFromStub(p auth_stub.Provider) (auth.Provider, bool) {
+	switch p {
+	case auth_stub.PROVIDER_GITHUB:
+		return auth.ProviderGithub, true
+	case auth_stub.PROVIDER_GITLAB:
+		return auth.ProviderGitlab, true
+	case auth_stub.PROVIDER_OIDC:
+		return auth.ProviderOIDC, true
+	case auth_stub.PROVIDER_EMAIL:
+		return auth.ProviderEmail, true
+	default:
+		return 0, false
+	}
+}
+
+// providerToStub is the inverse of providerFromStub.
+func providerToStub(p auth.Provider) auth_stub.Provider {
+	switch p {
+	case auth.ProviderGithub:
+		return auth_stub.PROVIDER_GITHUB
+	case auth.ProviderGitlab:
+		return auth_stub.PROVIDER_GITLAB
+	case auth.ProviderOIDC:
+		return auth_stub.PROVIDER_OIDC
+	case auth.ProviderEmail:
+		return auth_stub.PROVIDER_EMAIL
+	default:
+		return auth_stub.PROVIDER_UNSPECIFIED
+	}
+}
+
 func (d *AuthService) Login(ctx context.Context, req *auth_stub.LoginRequest) (*auth_stub.LoginResponse, *auth_stub.AuthenticationServiceError) {
-	return &auth_stub.LoginResponse{}, nil
+	err := d.audit.Blocked(ctx, 0)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	var provider *auth.Provider
+	if providerKind, ok := providerFromStub(req.Provider); ok {
+		provider = &providerKind
+	}
+
+	resp, authErr := d.login(ctx, req)
+	d.recordLogin(ctx, audit.EventLogin, provider, resp, authErr)
+
+	return resp, authErr
+}
+
+func (d *AuthService) login(ctx context.Context, req *auth_stub.LoginRequest) (*auth_stub.LoginResponse, *auth_stub.AuthenticationServiceError) {
+	if req.AccessCode == "" {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("access code is required"),
+		}
+	}
+
+	providerKind, ok := providerFromStub(req.Provider)
+	if !ok {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("unsupported provider: %d", req.Provider),
+		}
+	}
+
+	authProvider, ok := d.providers[providerKind]
+	if !ok || authProvider == nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("provider is not configured: %d", req.Provider),
+		}
+	}
+
+	token, profile, authErr := d.acquireProfile(ctx, authProvider, providerKind, req.State, req.LoginSecret, req.AccessCode)
+	if authErr != nil {
+		return &auth_stub.LoginResponse{}, authErr
+	}
+
+	repositories, _, err := authProvider.GetPublicRepositories(ctx, profile.Username)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadGateway,
+			Error:      fmt.Errorf("getting public repositories: %w", err),
+		}
+	}
+
+	userId, err := d.resolveUser(ctx, profile)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	err = d.storeIdentity(ctx, userId, profile, repositories, token)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return d.issueLogin(ctx, userId)
+}
+
+// resolveUser returns the user the identity is linked to. An identity that is
+// not linked to anyone signs up a new user. The profile of the user is only
+// taken from its primary identity.
+func (d *AuthService) resolveUser(ctx context.Context, profile auth.User) (int64, error) {
+	userId, primary, err := d.GetUserIdByIdentity(ctx, profile.Provider, profile.ProviderID)
+	if err != nil && !errors.Is(err, auth.ErrUserNotFound) {
+		return 0, err
+	}
+
+	if errors.Is(err, auth.ErrUserNotFound) || primary {
+		// CreateUser is an upsert, returning users will keep their ID.
+		userId, err = d.CreateUser(ctx, &profile)
+		if err != nil {
+			return 0, err
+		}
+
+		err = d.CreateUserStatistics(ctx, userId, profile)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return userId, nil
+}
+
+// issueLogin issues a new token pair for the user, starting a new
+// refresh token family and session.
+func (d *AuthService) issueLogin(ctx context.Context, userId int64) (*auth_stub.LoginResponse, *auth_stub.AuthenticationServiceError) {
+	generation, err := d.revocation.Generation(ctx, userId)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	pair, err := d.jwt.Issue(auth_jwt.Subject{UserID: userId, Generation: generation})
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("signing token: %w", err),
+		}
+	}
+
+	err = d.CreateUserRefreshToken(ctx, pair.RefreshClaims)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	err = d.CreateUserSession(ctx, pair.RefreshClaims)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return &auth_stub.LoginResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+	}, nil
+}
+
+// storeIdentity links the identity to the user, and stores its
+// repositories and provider token.
+func (d *AuthService) storeIdentity(ctx context.Context, userId int64, profile auth.User, repositories []auth.Repository, token provider.Token) error {
+	err := d.CreateUserIdentity(ctx, userId, &profile)
+	if err != nil {
+		return err
+	}
+
+	if len(repositories) > 0 {
+		err = d.CreateUserRepository(ctx, userId, repositories)
+		if err != nil {
+			return err
+		}
+	}
+
+	return d.CreateUserAccessToken(ctx, userId, profile.Provider, token)
 }
@@ -0,0 +1,225 @@
+package auth_service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/provider"
+	auth_stub "kodiiing/auth/stub"
+	"kodiiing/cache"
+	"net/http"
+)
+
+// errInvalidLoginState is returned when the state of a login is unknown,
+// expired, already used, was issued for another provider, or is given
+// without the login secret of the client that began the login.
+var errInvalidLoginState = errors.New("invalid or expired login state")
+
+// loginState is kept in the cache between BeginLogin and Login or
+// LinkProvider, for as long as CacheTTL.LoginState.
+type loginState struct {
+	Provider     auth.Provider
+	CodeVerifier string
+	Nonce        string
+	// SecretHash is the hash of the login secret that was returned
+	// to the client, the state alone can be replayed by anyone who
+	// gets hold of the callback URL.
+	SecretHash []byte
+}
+
+// BeginLogin returns the authorization page of the provider, bound to a
+// state and a PKCE code challenge that Login verifies. The login secret
+// binds the state to the client, so a callback URL planted by someone else
+// doesn't log the client into their account.
+func (d *AuthService) BeginLogin(ctx context.Context, req *auth_stub.BeginLoginRequest) (*auth_stub.BeginLoginResponse, *auth_stub.AuthenticationServiceError) {
+	providerKind, ok := providerFromStub(req.Provider)
+	if !ok {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("unsupported provider: %d", req.Provider),
+		}
+	}
+
+	authProvider, ok := d.providers[providerKind]
+	if !ok || authProvider == nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("provider is not configured: %d", req.Provider),
+		}
+	}
+
+	state, err := randomString()
+	if err != nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("generating state: %w", err),
+		}
+	}
+
+	nonce, err := randomString()
+	if err != nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("generating nonce: %w", err),
+		}
+	}
+
+	loginSecret, err := randomString()
+	if err != nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("generating login secret: %w", err),
+		}
+	}
+
+	codeVerifier, err := provider.NewCodeVerifier()
+	if err != nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	authorizeUrl, err := authProvider.AuthorizeURL(ctx, state, provider.CodeChallenge(codeVerifier), nonce)
+	if err != nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadGateway,
+			Error:      fmt.Errorf("getting authorize url: %w", err),
+		}
+	}
+
+	err = d.loginStates.Set(ctx, state, loginState{
+		Provider:     providerKind,
+		CodeVerifier: codeVerifier,
+		Nonce:        nonce,
+		SecretHash:   hashLoginSecret(loginSecret),
+	})
+	if err != nil {
+		return &auth_stub.BeginLoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("storing login state: %w", err),
+		}
+	}
+
+	return &auth_stub.BeginLoginResponse{
+		AuthorizeUrl: authorizeUrl,
+		State:        state,
+		LoginSecret:  loginSecret,
+	}, nil
+}
+
+func hashLoginSecret(loginSecret string) []byte {
+	sum := sha256.Sum256([]byte(loginSecret))
+	return sum[:]
+}
+
+// randomString returns 32 random bytes, encoded for URLs.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// consumeLoginState returns what BeginLogin stored for the state, and
+// forgets the state so it can only be used once.
+func (d *AuthService) consumeLoginState(ctx context.Context, state string, loginSecret string, providerKind auth.Provider) (loginState, error) {
+	if state == "" || loginSecret == "" {
+		return loginState{}, errInvalidLoginState
+	}
+
+	// Whoever takes the entry first gets to use it.
+	stored, err := d.loginStates.Take(ctx, state)
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return loginState{}, errInvalidLoginState
+		}
+
+		return loginState{}, fmt.Errorf("getting login state: %w", err)
+	}
+
+	if stored.Provider != providerKind {
+		return loginState{}, errInvalidLoginState
+	}
+
+	if subtle.ConstantTimeCompare(stored.SecretHash, hashLoginSecret(loginSecret)) != 1 {
+		return loginState{}, errInvalidLoginState
+	}
+
+	return stored, nil
+}
+
+// acquireProfile verifies the state of the login, exchanges the code with
+// the provider, and gets the profile of the user the code was issued to.
+func (d *AuthService) acquireProfile(ctx context.Context, authProvider provider.Authentication, providerKind auth.Provider, state string, loginSecret string, code string) (provider.Token, auth.User, *auth_stub.AuthenticationServiceError) {
+	if code == "" {
+		return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("access code is required"),
+		}
+	}
+
+	stored, err := d.consumeLoginState(ctx, state, loginSecret, providerKind)
+	if err != nil {
+		if errors.Is(err, errInvalidLoginState) {
+			return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusBadRequest,
+				Error:      err,
+			}
+		}
+
+		return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	// Exchange the access code that was given by the provider's
+	// authorization page into an access token.
+	token, err := authProvider.AcquireAccessToken(ctx, code, stored.CodeVerifier, stored.Nonce)
+	if err != nil {
+		if errors.Is(err, provider.ErrCodeEmpty) {
+			return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusBadRequest,
+				Error:      fmt.Errorf("access code is required"),
+			}
+		}
+
+		return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      fmt.Errorf("%w: acquiring access token: %w", auth.ErrBadCredential, err),
+		}
+	}
+
+	if token.AccessToken == "" {
+		return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      fmt.Errorf("invalid access code"),
+		}
+	}
+
+	profile, err := authProvider.GetProfile(ctx, token.AccessToken)
+	if err != nil {
+		return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadGateway,
+			Error:      fmt.Errorf("getting profile: %w", err),
+		}
+	}
+
+	err = token.CheckProfile(profile)
+	if err != nil {
+		return provider.Token{}, auth.User{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      err,
+		}
+	}
+
+	return token, profile, nil
+}
@@ -2,9 +2,95 @@ package auth_service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
 	auth_stub "kodiiing/auth/stub"
+	"net/http"
 )
 
 func (d *AuthService) Logout(ctx context.Context, req *auth_stub.LogoutRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	claims, err := d.jwt.ParseAccessToken(req.AccessToken)
+	if err != nil {
+		// An expired access token can't be used anymore, there is nothing to revoke.
+		if errors.Is(err, auth_jwt.ErrExpired) {
+			return &auth_stub.EmptyResponse{}, nil
+		}
+
+		d.audit.Record(ctx, audit.Event{Type: audit.EventLogout, Outcome: audit.OutcomeFailure, Detail: err.Error(), Guess: audit.Guessed(err)})
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      fmt.Errorf("unauthenticated: %w", err),
+		}
+	}
+
+	err = d.revocation.Revoke(ctx, claims)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	// Revoke the refresh token that was issued together with this
+	// access token, otherwise the client could simply refresh.
+	if claims.FamilyID != "" {
+		err = d.RevokeRefreshTokenFamily(ctx, claims.FamilyID)
+		if err != nil {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Error:      err,
+			}
+		}
+
+		_, err = d.revocation.RevokeSession(ctx, claims.UserID, claims.FamilyID)
+		if err != nil {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Error:      err,
+			}
+		}
+	}
+
+	d.audit.Record(ctx, audit.Event{Type: audit.EventLogout, Outcome: audit.OutcomeSuccess, UserID: claims.UserID})
+
+	return &auth_stub.EmptyResponse{}, nil
+}
+
+// LogoutAll logs the user out of every device by bumping the user's
+// token generation, which revokes every token that was issued so far.
+func (d *AuthService) LogoutAll(ctx context.Context, req *auth_stub.LogoutRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	_, err := d.revocation.BumpGeneration(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	err = d.RevokeUserRefreshTokens(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	err = d.revocation.RevokeUserSessions(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	d.audit.Record(ctx, audit.Event{Type: audit.EventLogoutAll, Outcome: audit.OutcomeSuccess, UserID: claims.UserID})
+
 	return &auth_stub.EmptyResponse{}, nil
 }
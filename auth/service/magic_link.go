@@ -0,0 +1,212 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_magiclink "kodiiing/auth/magiclink"
+	auth_stub "kodiiing/auth/stub"
+	"kodiiing/mail"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxPendingMagicLinks caps how many unused links an address can have at
+// once, so the RPC can't be used to flood someone's inbox.
+const maxPendingMagicLinks = 3
+
+func (d *AuthService) RequestMagicLink(ctx context.Context, req *auth_stub.RequestMagicLinkRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	if d.magicLink == nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("email login is not configured"),
+		}
+	}
+
+	err := d.audit.Blocked(ctx, 0)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	email, err := auth_magiclink.NormalizeEmail(req.Email)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      err,
+		}
+	}
+
+	now := time.Now()
+
+	// Expired links of the address are of no use anymore.
+	_, err = d.pool.Exec(ctx, `DELETE FROM magic_links WHERE email = $1 AND expires_at <= $2`, email, now)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error deleting expired magic links: %w", err),
+		}
+	}
+
+	var pending int
+	err = d.pool.QueryRow(ctx, `SELECT COUNT(*) FROM magic_links WHERE email = $1 AND used_at IS NULL`, email).Scan(&pending)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error counting magic links: %w", err),
+		}
+	}
+
+	if pending >= maxPendingMagicLinks {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      fmt.Errorf("too many pending magic links, check your inbox"),
+		}
+	}
+
+	link, err := d.magicLink.Issue(email, now)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	_, err = d.pool.Exec(
+		ctx,
+		`INSERT INTO
+			magic_links
+			(
+				id,
+				email,
+				created_at,
+				expires_at
+			)
+		VALUES
+			($1, $2, $3, $4)`,
+		link.ID,
+		link.Email,
+		now,
+		link.ExpiresAt,
+	)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error inserting magic link: %w", err),
+		}
+	}
+
+	err = d.mailer.Send(ctx, mail.Message{
+		To:      link.Email,
+		Subject: "Sign in to Kodiiing",
+		Body: "Hi,\n\n" +
+			"Open the link below to sign in to Kodiiing:\n\n" +
+			link.URL + "\n\n" +
+			"The link can only be used once, and expires in " + link.ExpiresAt.Sub(now).Round(time.Minute).String() + ".\n" +
+			"If you did not ask to sign in, you can ignore this email.\n",
+	})
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadGateway,
+			Error:      fmt.Errorf("sending magic link: %w", err),
+		}
+	}
+
+	return &auth_stub.EmptyResponse{}, nil
+}
+
+func (d *AuthService) ConsumeMagicLink(ctx context.Context, req *auth_stub.ConsumeMagicLinkRequest) (*auth_stub.LoginResponse, *auth_stub.AuthenticationServiceError) {
+	err := d.audit.Blocked(ctx, 0)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	provider := auth.ProviderEmail
+	resp, authErr := d.consumeMagicLink(ctx, req)
+	d.recordLogin(ctx, audit.EventLogin, &provider, resp, authErr)
+
+	return resp, authErr
+}
+
+func (d *AuthService) consumeMagicLink(ctx context.Context, req *auth_stub.ConsumeMagicLinkRequest) (*auth_stub.LoginResponse, *auth_stub.AuthenticationServiceError) {
+	if d.magicLink == nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("email login is not configured"),
+		}
+	}
+
+	now := time.Now()
+	link, err := d.magicLink.Verify(req.Token, now)
+	if err != nil {
+		if errors.Is(err, auth_magiclink.ErrInvalidToken) {
+			err = fmt.Errorf("%w: %w", auth.ErrBadCredential, err)
+		}
+
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      fmt.Errorf("unauthenticated: %w", err),
+		}
+	}
+
+	var id string
+	err = d.pool.QueryRow(
+		ctx,
+		`UPDATE magic_links SET used_at = $3 WHERE id = $1 AND email = $2 AND used_at IS NULL RETURNING id`,
+		link.ID,
+		link.Email,
+		now,
+	).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusUnauthorized,
+				Error:      fmt.Errorf("unauthenticated: magic link was already used"),
+			}
+		}
+
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error consuming magic link: %w", err),
+		}
+	}
+
+	localPart, _, _ := strings.Cut(link.Email, "@")
+	profile := auth.User{
+		Provider:   auth.ProviderEmail,
+		ProviderID: link.Email,
+		Name:       localPart,
+		Username:   localPart,
+		Email:      link.Email,
+		CreatedAt:  now,
+	}
+
+	userId, err := d.resolveUser(ctx, profile)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	// There are no repositories nor provider token to store.
+	err = d.CreateUserIdentity(ctx, userId, &profile)
+	if err != nil {
+		return &auth_stub.LoginResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return d.issueLogin(ctx, userId)
+}
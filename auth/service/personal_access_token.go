@@ -0,0 +1,304 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_pat "kodiiing/auth/pat"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+)
+
+const defaultPersonalAccessTokenDays = 30
+const maxPersonalAccessTokenDays = 365
+
+// personalAccessTokenTouchInterval throttles how often the last used
+// timestamp of a token is written, a busy script would otherwise write
+// on every request.
+const personalAccessTokenTouchInterval = time.Minute
+
+// AuthenticatePersonalAccessToken resolves the user of a personal access token,
+// with the scopes of the token. Unknown, expired and revoked tokens return
+// auth.ErrUnauthenticated.
+func (d *AuthService) AuthenticatePersonalAccessToken(ctx context.Context, token string) (auth.User, error) {
+	var id int64
+	var userId int64
+	var scopes []string
+	var expiresAt time.Time
+	var lastUsedAt *time.Time
+	var revokedAt *time.Time
+	err := d.pool.QueryRow(
+		ctx,
+		`SELECT
+			id,
+			user_id,
+			scopes,
+			expires_at,
+			last_used_at,
+			revoked_at
+		FROM
+			personal_access_tokens
+		WHERE
+			token_hash = $1`,
+		auth_pat.Hash(token),
+	).Scan(&id, &userId, &scopes, &expiresAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth.User{}, fmt.Errorf("%w: %w: unknown personal access token", auth.ErrUnauthenticated, auth.ErrBadCredential)
+		}
+
+		return auth.User{}, fmt.Errorf("error getting personal access token: %w", err)
+	}
+
+	if revokedAt != nil {
+		return auth.User{}, fmt.Errorf("%w: personal access token", auth.ErrTokenRevoked)
+	}
+
+	now := time.Now()
+	if now.After(expiresAt) {
+		return auth.User{}, fmt.Errorf("%w: personal access token is expired", auth.ErrUnauthenticated)
+	}
+
+	user, err := d.GetUserById(ctx, userId)
+	if err != nil {
+		return auth.User{}, err
+	}
+
+	// The last used timestamp is informational, failing to
+	// write it must not fail the request.
+	if lastUsedAt == nil || now.Sub(*lastUsedAt) > personalAccessTokenTouchInterval {
+		_, err = d.pool.Exec(ctx, `UPDATE personal_access_tokens SET last_used_at = $2 WHERE id = $1`, id, now)
+		if err != nil {
+			log.Warn().Err(err).Int64("personal_access_token_id", id).Msg("updating personal access token last used at")
+		}
+	}
+
+	// The user is a copy of the cached one, setting its scopes
+	// does not leak into other requests.
+	user.Scopes = make([]auth.Permission, 0, len(scopes))
+	for _, scope := range scopes {
+		user.Scopes = append(user.Scopes, auth.Permission(scope))
+	}
+
+	return user, nil
+}
+
+func (d *AuthService) CreatePersonalAccessToken(ctx context.Context, req *auth_stub.CreatePersonalAccessTokenRequest) (*auth_stub.CreatePersonalAccessTokenResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, authErr
+	}
+
+	if req.Name == "" {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("name is required"),
+		}
+	}
+
+	if len(req.Scopes) == 0 {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("at least one scope is required"),
+		}
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = defaultPersonalAccessTokenDays
+	}
+
+	if days < 0 || days > maxPersonalAccessTokenDays {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("expiration must be between 1 and %d days", maxPersonalAccessTokenDays),
+		}
+	}
+
+	user, err := d.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: auth.StatusCode(err),
+			Error:      err,
+		}
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		permission, err := auth.ParsePermission(scope)
+		if err != nil {
+			return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusBadRequest,
+				Error:      err,
+			}
+		}
+
+		if !user.HasPermission(permission) {
+			return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusForbidden,
+				Error:      fmt.Errorf("%w: %s is not allowed for this user", auth.ErrForbidden, permission),
+			}
+		}
+
+		scopes = append(scopes, string(permission))
+	}
+
+	token, hash, err := auth_pat.Generate()
+	if err != nil {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Duration(days) * 24 * time.Hour)
+
+	var id int64
+	err = d.pool.QueryRow(
+		ctx,
+		`INSERT INTO
+			personal_access_tokens
+			(
+				user_id,
+				name,
+				token_hash,
+				scopes,
+				created_at,
+				expires_at
+			)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		RETURNING id`,
+		user.ID,
+		req.Name,
+		hash,
+		scopes,
+		now,
+		expiresAt,
+	).Scan(&id)
+	if err != nil {
+		return &auth_stub.CreatePersonalAccessTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error inserting personal access token: %w", err),
+		}
+	}
+
+	return &auth_stub.CreatePersonalAccessTokenResponse{
+		Id:        id,
+		Token:     token,
+		ExpiresAt: expiresAt.Unix(),
+	}, nil
+}
+
+func (d *AuthService) ListPersonalAccessTokens(ctx context.Context, req *auth_stub.ListPersonalAccessTokensRequest) (*auth_stub.ListPersonalAccessTokensResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.ListPersonalAccessTokensResponse{}, authErr
+	}
+
+	user, err := d.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.ListPersonalAccessTokensResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: auth.StatusCode(err),
+			Error:      err,
+		}
+	}
+
+	// Revoked tokens are left out, expired ones are kept so the
+	// user knows which integration stopped working.
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT
+			id,
+			name,
+			scopes,
+			created_at,
+			expires_at,
+			last_used_at
+		FROM
+			personal_access_tokens
+		WHERE
+			user_id = $1
+			AND revoked_at IS NULL
+		ORDER BY
+			created_at DESC`,
+		user.ID,
+	)
+	if err != nil {
+		return &auth_stub.ListPersonalAccessTokensResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error querying personal access tokens: %w", err),
+		}
+	}
+
+	tokens, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (auth_stub.PersonalAccessToken, error) {
+		var token auth_stub.PersonalAccessToken
+		var createdAt time.Time
+		var expiresAt time.Time
+		var lastUsedAt *time.Time
+		err := row.Scan(&token.Id, &token.Name, &token.Scopes, &createdAt, &expiresAt, &lastUsedAt)
+		if err != nil {
+			return token, err
+		}
+
+		token.CreatedAt = createdAt.Unix()
+		token.ExpiresAt = expiresAt.Unix()
+		if lastUsedAt != nil {
+			token.LastUsedAt = lastUsedAt.Unix()
+		}
+
+		return token, nil
+	})
+	if err != nil {
+		return &auth_stub.ListPersonalAccessTokensResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error reading personal access tokens: %w", err),
+		}
+	}
+
+	return &auth_stub.ListPersonalAccessTokensResponse{Tokens: tokens}, nil
+}
+
+func (d *AuthService) RevokePersonalAccessToken(ctx context.Context, req *auth_stub.RevokePersonalAccessTokenRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	user, err := d.GetUserById(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: auth.StatusCode(err),
+			Error:      err,
+		}
+	}
+
+	tag, err := d.pool.Exec(
+		ctx,
+		`UPDATE personal_access_tokens SET revoked_at = $3 WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		req.Id,
+		user.ID,
+		time.Now(),
+	)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error revoking personal access token: %w", err),
+		}
+	}
+
+	if tag.RowsAffected() == 0 {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("personal access token not found"),
+		}
+	}
+
+	return &auth_stub.EmptyResponse{}, nil
+}
@@ -0,0 +1,61 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+)
+
+func (d *AuthService) RefreshToken(ctx context.Context, req *auth_stub.RefreshTokenRequest) (*auth_stub.RefreshTokenResponse, *auth_stub.AuthenticationServiceError) {
+	err := d.audit.Blocked(ctx, 0)
+	if err != nil {
+		return &auth_stub.RefreshTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	claims, err := d.jwt.ParseRefreshToken(req.RefreshToken)
+	if err != nil {
+		d.audit.Record(ctx, audit.Event{Type: audit.EventRefresh, Outcome: audit.OutcomeFailure, Detail: err.Error(), Guess: audit.Guessed(err)})
+		return &auth_stub.RefreshTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusUnauthorized,
+			Error:      fmt.Errorf("unauthenticated: %w", err),
+		}
+	}
+
+	err = d.audit.Blocked(ctx, claims.UserID)
+	if err != nil {
+		return &auth_stub.RefreshTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      err,
+		}
+	}
+
+	pair, err := d.RotateRefreshToken(ctx, claims)
+	if err != nil {
+		if errors.Is(err, auth.ErrTokenRevoked) || errors.Is(err, auth.ErrTokenReused) {
+			d.audit.Record(ctx, audit.Event{Type: audit.EventRefresh, Outcome: audit.OutcomeFailure, UserID: claims.UserID, Detail: err.Error(), Guess: audit.Guessed(err)})
+			return &auth_stub.RefreshTokenResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusUnauthorized,
+				Error:      fmt.Errorf("unauthenticated: %w", err),
+			}
+		}
+
+		return &auth_stub.RefreshTokenResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	d.audit.Record(ctx, audit.Event{Type: audit.EventRefresh, Outcome: audit.OutcomeSuccess, UserID: claims.UserID})
+
+	return &auth_stub.RefreshTokenResponse{
+		AccessToken:  pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+	}, nil
+}
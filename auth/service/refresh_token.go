@@ -0,0 +1,231 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_jwt "kodiiing/auth/jwt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateUserRefreshToken records a freshly issued refresh token, so it can be
+// exchanged exactly once through RotateRefreshToken.
+func (d *AuthService) CreateUserRefreshToken(ctx context.Context, claims auth_jwt.Claims) error {
+	_, err := d.pool.Exec(
+		ctx,
+		`INSERT INTO
+			user_refresh_tokens
+			(
+				id,
+				family_id,
+				user_id,
+				issued_at,
+				expires_at
+			)
+		VALUES
+			($1, $2, $3, $4, $5)`,
+		claims.ID,
+		claims.FamilyID,
+		claims.UserID,
+		claims.IssuedAt,
+		claims.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert user refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// RotateRefreshToken marks the given refresh token as used and issues a new
+// token pair within the same family. Presenting a refresh token that has
+// already been used revokes every token in its family and returns
+// auth.ErrTokenReused.
+func (d *AuthService) RotateRefreshToken(ctx context.Context, claims auth_jwt.Claims) (auth_jwt.TokenPair, error) {
+	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadWrite})
+	if err != nil {
+		return auth_jwt.TokenPair{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	var userId int64
+	var familyId string
+	var usedAt *time.Time
+	var revokedAt *time.Time
+	err = tx.QueryRow(
+		ctx,
+		`SELECT
+			user_id,
+			family_id,
+			used_at,
+			revoked_at
+		FROM
+			user_refresh_tokens
+		WHERE
+			id = $1
+		FOR UPDATE`,
+		claims.ID,
+	).Scan(&userId, &familyId, &usedAt, &revokedAt)
+	if err != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth_jwt.TokenPair{}, auth.ErrTokenRevoked
+		}
+
+		return auth_jwt.TokenPair{}, fmt.Errorf("failed to get user refresh token: %w", err)
+	}
+
+	if userId != claims.UserID || familyId != claims.FamilyID || revokedAt != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, auth.ErrTokenRevoked
+	}
+
+	now := time.Now()
+
+	if usedAt != nil {
+		// Someone is replaying a refresh token that was already exchanged.
+		// We can't tell the legitimate client apart from the attacker, so
+		// every token descending from the same login is revoked.
+		_, err = tx.Exec(
+			ctx,
+			`UPDATE user_refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`,
+			now,
+			familyId,
+		)
+		if err != nil {
+			if e := tx.Rollback(ctx); e != nil {
+				return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+			}
+
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to revoke refresh token family: %w", err)
+		}
+
+		err = tx.Commit(ctx)
+		if err != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to commit transaction: %w", err)
+		}
+
+		return auth_jwt.TokenPair{}, auth.ErrTokenReused
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE user_refresh_tokens SET used_at = $1 WHERE id = $2`, now, claims.ID)
+	if err != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	generation, err := d.revocation.Generation(ctx, userId)
+	if err != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, err
+	}
+
+	if claims.Generation < generation {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, auth.ErrTokenRevoked
+	}
+
+	pair, err := d.jwt.Issue(auth_jwt.Subject{UserID: userId, FamilyID: familyId, Generation: generation})
+	if err != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, fmt.Errorf("failed to issue token pair: %w", err)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO
+			user_refresh_tokens
+			(
+				id,
+				family_id,
+				user_id,
+				issued_at,
+				expires_at
+			)
+		VALUES
+			($1, $2, $3, $4, $5)`,
+		pair.RefreshClaims.ID,
+		pair.RefreshClaims.FamilyID,
+		pair.RefreshClaims.UserID,
+		pair.RefreshClaims.IssuedAt,
+		pair.RefreshClaims.ExpiresAt,
+	)
+	if err != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, fmt.Errorf("failed to insert user refresh token: %w", err)
+	}
+
+	err = touchUserSession(ctx, tx, pair.RefreshClaims)
+	if err != nil {
+		if e := tx.Rollback(ctx); e != nil {
+			return auth_jwt.TokenPair{}, fmt.Errorf("failed to rollback transaction: %w", e)
+		}
+
+		return auth_jwt.TokenPair{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return auth_jwt.TokenPair{}, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return pair, nil
+}
+
+// RevokeRefreshTokenFamily revokes every refresh token that descends
+// from the same login.
+func (d *AuthService) RevokeRefreshTokenFamily(ctx context.Context, familyId string) error {
+	if familyId == "" {
+		return auth.ErrParameterEmpty
+	}
+
+	_, err := d.pool.Exec(
+		ctx,
+		`UPDATE user_refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`,
+		time.Now(),
+		familyId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke refresh token family: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRefreshTokens revokes every refresh token of the user.
+func (d *AuthService) RevokeUserRefreshTokens(ctx context.Context, userId int64) error {
+	_, err := d.pool.Exec(
+		ctx,
+		`UPDATE user_refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`,
+		time.Now(),
+		userId,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to revoke user refresh tokens: %w", err)
+	}
+
+	return nil
+}
@@ -3,15 +3,11 @@ package auth_service
 import (
 	"context"
 	"database/sql"
-	"errors"
 	"fmt"
 	"kodiiing/auth"
-	"kodiiing/fgob"
-	"log"
 	"strconv"
 	"time"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/jackc/pgx/v5"
 )
 
@@ -47,7 +43,20 @@ func (d *AuthService) CreateUserRepository(ctx context.Context, userId int64, re
 		updated_by
 	)
 	VALUES
-	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+	($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	ON CONFLICT (provider, repository_id) DO UPDATE
+		SET
+			user_id = EXCLUDED.user_id,
+			name = EXCLUDED.name,
+			url = EXCLUDED.url,
+			description = EXCLUDED.description,
+			fork = EXCLUDED.fork,
+			fork_count = EXCLUDED.fork_count,
+			star_count = EXCLUDED.star_count,
+			owner_username = EXCLUDED.owner_username,
+			last_activity_at = EXCLUDED.last_activity_at,
+			updated_at = EXCLUDED.updated_at,
+			updated_by = EXCLUDED.updated_by`
 
 	stmt, err := tx.Prepare(ctx, "CreateUserRepository", sql)
 	if err != nil {
@@ -95,25 +104,42 @@ func (d *AuthService) CreateUserRepository(ctx context.Context, userId int64, re
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	d.invalidateRepositories(ctx, userId)
+
 	return nil
 }
 
-func (d *AuthService) GetUserRepositoryByUserId(ctx context.Context, userId int64) ([]auth.Repository, error) {
-	cachedRepository, err := d.memory.Get("user:repository:id:" + strconv.FormatInt(userId, 10))
-	if err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
-		return []auth.Repository{}, fmt.Errorf("failed to get user repository from cache: %w", err)
+// DeleteUserRepositoriesExcept deletes the repositories of the user on the
+// provider that are not in keep, as they were deleted or made private.
+func (d *AuthService) DeleteUserRepositoriesExcept(ctx context.Context, userId int64, provider auth.Provider, keep []int64) error {
+	_, err := d.pool.Exec(
+		ctx,
+		`DELETE FROM
+			user_repositories
+		WHERE
+			user_id = $1
+			AND provider = $2
+			AND repository_id <> ALL($3)`,
+		userId,
+		provider.ToUint8(),
+		keep,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete user repositories: %w", err)
 	}
 
-	if cachedRepository != nil {
-		var repositories []auth.Repository
-		err := fgob.Unmarshal(cachedRepository, &repositories)
-		if err != nil {
-			return []auth.Repository{}, fmt.Errorf("failed to unmarshal user repository from cache: %w", err)
-		}
+	d.invalidateRepositories(ctx, userId)
 
-		return repositories, nil
-	}
+	return nil
+}
+
+func (d *AuthService) GetUserRepositoryByUserId(ctx context.Context, userId int64) ([]auth.Repository, error) {
+	return d.repositories.Get(ctx, strconv.FormatInt(userId, 10), func(ctx context.Context) ([]auth.Repository, error) {
+		return d.queryUserRepositories(ctx, userId)
+	})
+}
 
+func (d *AuthService) queryUserRepositories(ctx context.Context, userId int64) ([]auth.Repository, error) {
 	conn, err := d.pool.Acquire(ctx)
 	if err != nil {
 		return []auth.Repository{}, fmt.Errorf("failed to acquire connection from pool: %w", err)
@@ -173,18 +199,5 @@ func (d *AuthService) GetUserRepositoryByUserId(ctx context.Context, userId int6
 		repositories = append(repositories, repository)
 	}
 
-	go func(repositories []auth.Repository) {
-		marshaledRepositories, err := fgob.Marshal(repositories)
-		if err != nil {
-			log.Printf("failed to marshal user repositories: %v", err)
-			return
-		}
-
-		err = d.memory.Set("user:repository:id:"+strconv.FormatInt(userId, 10), marshaledRepositories)
-		if err != nil {
-			log.Printf("failed to set user repository in cache: %v", err)
-		}
-	}(repositories)
-
 	return repositories, nil
 }
@@ -0,0 +1,155 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// GetUserRoles returns the roles that were granted to the user.
+func (d *AuthService) GetUserRoles(ctx context.Context, userId int64) ([]auth.Role, error) {
+	rows, err := d.pool.Query(ctx, `SELECT role FROM user_roles WHERE user_id = $1 ORDER BY role`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying user roles: %w", err)
+	}
+
+	roles, err := pgx.CollectRows(rows, pgx.RowTo[auth.Role])
+	if err != nil {
+		return nil, fmt.Errorf("error reading user roles: %w", err)
+	}
+
+	return roles, nil
+}
+
+// CreateUserRole grants the role to the user, grantedBy is recorded for auditing.
+func (d *AuthService) CreateUserRole(ctx context.Context, userId int64, role auth.Role, grantedBy string) error {
+	err := GrantUserRole(ctx, d.pool, userId, role, grantedBy)
+	if err != nil {
+		return err
+	}
+
+	d.invalidateUserId(ctx, userId)
+
+	return nil
+}
+
+// DeleteUserRole revokes the role from the user.
+func (d *AuthService) DeleteUserRole(ctx context.Context, userId int64, role auth.Role) error {
+	err := RevokeUserRole(ctx, d.pool, userId, role)
+	if err != nil {
+		return err
+	}
+
+	d.invalidateUserId(ctx, userId)
+
+	return nil
+}
+
+// GrantUserRole stores the role without going through an AuthService, it is
+// used by the command line to bootstrap the first admin. Cached users are not
+// invalidated.
+func GrantUserRole(ctx context.Context, pool *pgxpool.Pool, userId int64, role auth.Role, grantedBy string) error {
+	// Every user is a learner, there is nothing to store.
+	if role == auth.RoleLearner {
+		return nil
+	}
+
+	_, err := pool.Exec(
+		ctx,
+		`INSERT INTO
+			user_roles
+			(
+				user_id,
+				role,
+				granted_at,
+				granted_by
+			)
+		VALUES
+			($1, $2, $3, $4)
+		ON CONFLICT (user_id, role) DO NOTHING`,
+		userId,
+		role.ToUint8(),
+		time.Now(),
+		grantedBy,
+	)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return auth.ErrUserNotFound
+		}
+
+		return fmt.Errorf("error granting role: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeUserRole is the counterpart of GrantUserRole.
+func RevokeUserRole(ctx context.Context, pool *pgxpool.Pool, userId int64, role auth.Role) error {
+	_, err := pool.Exec(ctx, `DELETE FROM user_roles WHERE user_id = $1 AND role = $2`, userId, role.ToUint8())
+	if err != nil {
+		return fmt.Errorf("error revoking role: %w", err)
+	}
+
+	return nil
+}
+
+func (d *AuthService) GrantRole(ctx context.Context, req *auth_stub.RoleRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	return d.changeRole(ctx, req, true)
+}
+
+func (d *AuthService) RevokeRole(ctx context.Context, req *auth_stub.RoleRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	return d.changeRole(ctx, req, false)
+}
+
+func (d *AuthService) changeRole(ctx context.Context, req *auth_stub.RoleRequest, grant bool) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	caller, authErr := d.requirePermission(ctx, req.AccessToken, auth.PermissionUserManageRoles)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      err,
+		}
+	}
+
+	if grant {
+		err = d.CreateUserRole(ctx, req.UserId, role, "user:"+strconv.FormatInt(caller.ID, 10))
+	} else {
+		// An admin can't lock everyone out of role management
+		// by revoking its own admin role.
+		if role == auth.RoleAdmin && req.UserId == caller.ID {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusBadRequest,
+				Error:      fmt.Errorf("cannot revoke your own admin role"),
+			}
+		}
+
+		err = d.DeleteUserRole(ctx, req.UserId, role)
+	}
+	if err != nil {
+		if errors.Is(err, auth.ErrUserNotFound) {
+			return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+				StatusCode: http.StatusNotFound,
+				Error:      err,
+			}
+		}
+
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return &auth_stub.EmptyResponse{}, nil
+}
@@ -1,26 +1,93 @@
 package auth_service
 
 import (
+	"fmt"
+	"kodiiing/auth"
 	auth_aes "kodiiing/auth/aes"
+	"kodiiing/auth/audit"
 	auth_jwt "kodiiing/auth/jwt"
+	auth_magiclink "kodiiing/auth/magiclink"
+	"kodiiing/auth/provider"
+	"kodiiing/auth/revocation"
 	auth_stub "kodiiing/auth/stub"
+	"kodiiing/cache"
+	"kodiiing/mail"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type AuthService struct {
 	pool        *pgxpool.Pool
-	memory      *bigcache.BigCache
 	aes         *auth_aes.Aes
 	jwt         *auth_jwt.AuthJwt
+	revocation  *revocation.Store
+	audit       *audit.Log
+	providers   map[auth.Provider]provider.Authentication
+	magicLink   *auth_magiclink.MagicLink
+	mailer      mail.Sender
 	environment string
+
+	usersById       *cache.Family[auth.User]
+	usersByUsername *cache.Family[auth.User]
+	usersByEmail    *cache.Family[auth.User]
+	repositories    *cache.Family[[]auth.Repository]
+	loginStates     *cache.Family[loginState]
+}
+
+type Config struct {
+	Environment string
+	Pool        *pgxpool.Pool
+	Cache       cache.Cache
+	CacheTTL    CacheTTL
+	Aes         *auth_aes.Aes
+	Jwt         *auth_jwt.AuthJwt
+	Revocation  *revocation.Store
+	Audit       *audit.Log
+	// Providers maps every supported identity provider to its
+	// OAuth implementation. Providers that are not configured
+	// are simply rejected during Login.
+	Providers map[auth.Provider]provider.Authentication
+	// MagicLink enables the email login, which sends the
+	// links through Mailer. It is disabled when nil.
+	MagicLink *auth_magiclink.MagicLink
+	Mailer    mail.Sender
 }
 
-func NewAuthService(env string, pool *pgxpool.Pool, memory *bigcache.BigCache) auth_stub.AuthenticationServiceServer {
-	return &AuthService{
-		environment: env,
-		pool:        pool,
-		memory:      memory,
+func NewAuthService(config *Config) (auth_stub.AuthenticationServiceServer, error) {
+	if config.Pool == nil {
+		return nil, fmt.Errorf("database connection required on auth/service module")
+	}
+	if config.Cache == nil {
+		return nil, fmt.Errorf("cache required on auth/service module")
+	}
+	if config.Aes == nil {
+		return nil, fmt.Errorf("aes required on auth/service module")
+	}
+	if config.Jwt == nil {
+		return nil, fmt.Errorf("jwt required on auth/service module")
+	}
+	if config.Revocation == nil {
+		return nil, fmt.Errorf("revocation store required on auth/service module")
+	}
+	if config.Audit == nil {
+		return nil, fmt.Errorf("audit log required on auth/service module")
+	}
+	if config.MagicLink != nil && config.Mailer == nil {
+		return nil, fmt.Errorf("mailer required on auth/service module when magic link is set")
+	}
+
+	service := &AuthService{
+		environment: config.Environment,
+		pool:        config.Pool,
+		aes:         config.Aes,
+		jwt:         config.Jwt,
+		revocation:  config.Revocation,
+		audit:       config.Audit,
+		providers:   config.Providers,
+		magicLink:   config.MagicLink,
+		mailer:      config.Mailer,
 	}
+	service.useCache(config.Cache, config.CacheTTL)
+
+	return service, nil
 }
@@ -0,0 +1,177 @@
+package auth_service
+
+import (
+	"context"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/auth/audit"
+	auth_jwt "kodiiing/auth/jwt"
+	auth_stub "kodiiing/auth/stub"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// CreateUserSession records the device that a login was made from. The
+// session is keyed by the family of the refresh token, every token that
+// is refreshed from it belongs to the same session.
+func (d *AuthService) CreateUserSession(ctx context.Context, claims auth_jwt.Claims) error {
+	client := audit.ClientFromContext(ctx)
+	_, err := d.pool.Exec(
+		ctx,
+		`INSERT INTO
+			user_sessions
+			(
+				id,
+				user_id,
+				ip,
+				user_agent,
+				created_at,
+				last_seen_at,
+				expires_at
+			)
+		VALUES
+			($1, $2, $3, $4, $5, $5, $6)`,
+		claims.FamilyID,
+		claims.UserID,
+		client.IP,
+		client.UserAgent,
+		claims.IssuedAt,
+		claims.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert user session: %w", err)
+	}
+
+	return nil
+}
+
+// touchUserSession updates the session of a refresh token that was just
+// rotated, with the device that refreshed it.
+func touchUserSession(ctx context.Context, tx pgx.Tx, claims auth_jwt.Claims) error {
+	client := audit.ClientFromContext(ctx)
+	_, err := tx.Exec(
+		ctx,
+		`UPDATE
+			user_sessions
+		SET
+			ip = $2,
+			user_agent = $3,
+			last_seen_at = $4,
+			expires_at = $5
+		WHERE
+			id = $1`,
+		claims.FamilyID,
+		client.IP,
+		client.UserAgent,
+		claims.IssuedAt,
+		claims.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update user session: %w", err)
+	}
+
+	return nil
+}
+
+func (d *AuthService) ListSessions(ctx context.Context, req *auth_stub.ListSessionsRequest) (*auth_stub.ListSessionsResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.ListSessionsResponse{}, authErr
+	}
+
+	rows, err := d.pool.Query(
+		ctx,
+		`SELECT
+			id,
+			ip,
+			user_agent,
+			created_at,
+			last_seen_at,
+			expires_at
+		FROM
+			user_sessions
+		WHERE
+			user_id = $1
+			AND revoked_at IS NULL
+			AND expires_at > $2
+		ORDER BY
+			last_seen_at DESC`,
+		claims.UserID,
+		time.Now(),
+	)
+	if err != nil {
+		return &auth_stub.ListSessionsResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error querying user sessions: %w", err),
+		}
+	}
+
+	sessions, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (auth_stub.Session, error) {
+		var session auth_stub.Session
+		var createdAt time.Time
+		var lastSeenAt time.Time
+		var expiresAt time.Time
+		err := row.Scan(&session.Id, &session.Ip, &session.UserAgent, &createdAt, &lastSeenAt, &expiresAt)
+		if err != nil {
+			return session, err
+		}
+
+		session.CreatedAt = createdAt.Unix()
+		session.LastSeenAt = lastSeenAt.Unix()
+		session.ExpiresAt = expiresAt.Unix()
+		session.Current = session.Id == claims.FamilyID
+
+		return session, nil
+	})
+	if err != nil {
+		return &auth_stub.ListSessionsResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("error reading user sessions: %w", err),
+		}
+	}
+
+	return &auth_stub.ListSessionsResponse{Sessions: sessions}, nil
+}
+
+// RevokeSession signs one device of the user out. Its refresh tokens are
+// revoked, and its access tokens are rejected from now on.
+func (d *AuthService) RevokeSession(ctx context.Context, req *auth_stub.RevokeSessionRequest) (*auth_stub.EmptyResponse, *auth_stub.AuthenticationServiceError) {
+	claims, authErr := d.authenticate(ctx, req.AccessToken)
+	if authErr != nil {
+		return &auth_stub.EmptyResponse{}, authErr
+	}
+
+	if req.Id == "" {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("session id is required: %w", auth.ErrParameterEmpty),
+		}
+	}
+
+	revoked, err := d.revocation.RevokeSession(ctx, claims.UserID, req.Id)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	if !revoked {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("session not found"),
+		}
+	}
+
+	err = d.RevokeRefreshTokenFamily(ctx, req.Id)
+	if err != nil {
+		return &auth_stub.EmptyResponse{}, &auth_stub.AuthenticationServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return &auth_stub.EmptyResponse{}, nil
+}
@@ -2,12 +2,18 @@ package auth_service
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"kodiiing/auth"
 	"time"
 )
 
 func (d *AuthService) CreateUserStatistics(ctx context.Context, userId int64, user auth.User) error {
+	var avatarUrl sql.NullString
+	if user.AvatarURL != nil {
+		avatarUrl = sql.NullString{String: user.AvatarURL.String(), Valid: true}
+	}
+
 	tx, err := d.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to begin transaction: %w", err)
@@ -29,9 +35,18 @@ func (d *AuthService) CreateUserStatistics(ctx context.Context, userId int64, us
 				updated_by
 			)
 		VALUES
-			($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (user_id) DO UPDATE
+			SET
+				avatar_url = EXCLUDED.avatar_url,
+				location = EXCLUDED.location,
+				public_repositories = EXCLUDED.public_repositories,
+				followers = EXCLUDED.followers,
+				following = EXCLUDED.following,
+				updated_at = EXCLUDED.updated_at,
+				updated_by = EXCLUDED.updated_by`,
 		userId,
-		user.AvatarURL.String(),
+		avatarUrl,
 		user.Location,
 		user.PublicRepository,
 		user.Followers,
@@ -57,5 +72,7 @@ func (d *AuthService) CreateUserStatistics(ctx context.Context, userId int64, us
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	d.invalidateUserId(ctx, userId)
+
 	return nil
 }
@@ -0,0 +1,277 @@
+package auth_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	auth_aes "kodiiing/auth/aes"
+	"kodiiing/auth/provider"
+	"kodiiing/cache"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Syncer refreshes the profile, statistics and repositories of users from
+// the provider of their primary identity, using the provider token that
+// was stored on Login.
+type Syncer struct {
+	service *AuthService
+}
+
+type SyncConfig struct {
+	Pool      *pgxpool.Pool
+	Cache     cache.Cache
+	CacheTTL  CacheTTL
+	Aes       *auth_aes.Aes
+	Providers map[auth.Provider]provider.Authentication
+}
+
+func NewSyncer(config *SyncConfig) (*Syncer, error) {
+	if config.Pool == nil {
+		return nil, fmt.Errorf("database connection required on auth/service module")
+	}
+	if config.Cache == nil {
+		return nil, fmt.Errorf("cache required on auth/service module")
+	}
+	if config.Aes == nil {
+		return nil, fmt.Errorf("aes required on auth/service module")
+	}
+
+	service := &AuthService{
+		pool:      config.Pool,
+		aes:       config.Aes,
+		providers: config.Providers,
+	}
+	service.useCache(config.Cache, config.CacheTTL)
+
+	return &Syncer{service: service}, nil
+}
+
+// SyncUser re-fetches a single user from its provider. An expired provider
+// token is refreshed first. The attempt is recorded even when it fails, so
+// a user with a revoked provider token does not get retried on every run.
+func (s *Syncer) SyncUser(ctx context.Context, userId int64) error {
+	d := s.service
+
+	var providerKind auth.Provider
+	var providerId string
+	var username, email, encryptedAccessToken string
+	var encryptedRefreshToken *string
+	var expiresAt *time.Time
+	err := d.pool.QueryRow(
+		ctx,
+		`SELECT
+			users.provider,
+			users.provider_id,
+			users.username,
+			users.email,
+			user_accesstoken.access_token,
+			user_accesstoken.refresh_token,
+			user_accesstoken.expires_at
+		FROM
+			users
+			JOIN user_accesstoken ON user_accesstoken.user_id = users.id
+				AND user_accesstoken.provider = users.provider
+		WHERE
+			users.id = $1`,
+		userId,
+	).Scan(&providerKind, &providerId, &username, &email, &encryptedAccessToken, &encryptedRefreshToken, &expiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return auth.ErrUserNotFound
+		}
+
+		return fmt.Errorf("error getting user: %w", err)
+	}
+
+	defer func() {
+		_, e := d.pool.Exec(ctx, `UPDATE users SET synced_at = $1 WHERE id = $2`, time.Now(), userId)
+		if e != nil {
+			log.Error().Err(e).Int64("user_id", userId).Msg("recording user sync")
+		}
+
+		// Previous and current keys are both dropped, in case the
+		// username or email has changed.
+		d.invalidateUser(ctx, userId, username, email)
+	}()
+
+	authProvider, ok := d.providers[providerKind]
+	if !ok || authProvider == nil {
+		return fmt.Errorf("provider is not configured: %d", providerKind)
+	}
+
+	var token provider.Token
+	token.AccessToken, err = d.aes.Decrypt(encryptedAccessToken)
+	if err != nil {
+		return fmt.Errorf("error decrypting access token: %w", err)
+	}
+
+	if encryptedRefreshToken != nil {
+		token.RefreshToken, err = d.aes.Decrypt(*encryptedRefreshToken)
+		if err != nil {
+			return fmt.Errorf("error decrypting refresh token: %w", err)
+		}
+	}
+
+	if expiresAt != nil {
+		token.ExpiresAt = *expiresAt
+	}
+
+	if token.Expired(time.Now()) {
+		token, err = d.refreshAccessToken(ctx, authProvider, userId, providerKind, token)
+		if err != nil {
+			return err
+		}
+	}
+
+	profile, err := authProvider.GetProfile(ctx, token.AccessToken)
+	if err != nil && token.ExpiresAt.IsZero() && token.RefreshToken != "" {
+		// Tokens stored before their expiry was recorded may have
+		// expired already, they get one refresh to find out.
+		token, err = d.refreshAccessToken(ctx, authProvider, userId, providerKind, token)
+		if err != nil {
+			return err
+		}
+
+		profile, err = authProvider.GetProfile(ctx, token.AccessToken)
+	}
+	if err != nil {
+		return fmt.Errorf("error getting profile: %w", err)
+	}
+
+	// A token that now belongs to another account must
+	// not overwrite this user.
+	if profile.ProviderID != providerId {
+		return fmt.Errorf("provider returned another user: %s", profile.ProviderID)
+	}
+
+	_, err = d.CreateUser(ctx, &profile)
+	if err != nil {
+		return fmt.Errorf("error updating user: %w", err)
+	}
+
+	err = d.CreateUserStatistics(ctx, userId, profile)
+	if err != nil {
+		return fmt.Errorf("error updating user statistics: %w", err)
+	}
+
+	repositories, complete, err := authProvider.GetPublicRepositories(ctx, profile.Username)
+	if err != nil {
+		return fmt.Errorf("error getting repositories: %w", err)
+	}
+
+	if len(repositories) > 0 {
+		err = d.CreateUserRepository(ctx, userId, repositories)
+		if err != nil {
+			return fmt.Errorf("error updating user repositories: %w", err)
+		}
+	}
+
+	// Repositories past the listing cap are not known to be gone.
+	if complete {
+		keep := make([]int64, 0, len(repositories))
+		for _, repository := range repositories {
+			keep = append(keep, repository.ID)
+		}
+
+		err = d.DeleteUserRepositoriesExcept(ctx, userId, providerKind, keep)
+		if err != nil {
+			return fmt.Errorf("error deleting user repositories: %w", err)
+		}
+	}
+
+	d.invalidateUser(ctx, userId, profile.Username, profile.Email)
+
+	return nil
+}
+
+// refreshAccessToken exchanges the refresh token and stores the new tokens.
+func (d *AuthService) refreshAccessToken(ctx context.Context, authProvider provider.Authentication, userId int64, providerKind auth.Provider, token provider.Token) (provider.Token, error) {
+	refreshed, err := authProvider.RefreshAccessToken(ctx, token.RefreshToken)
+	if err != nil {
+		return provider.Token{}, fmt.Errorf("error refreshing access token: %w", err)
+	}
+
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+
+	err = d.CreateUserAccessToken(ctx, userId, providerKind, refreshed)
+	if err != nil {
+		return provider.Token{}, fmt.Errorf("error storing refreshed access token: %w", err)
+	}
+
+	return refreshed, nil
+}
+
+// SyncStaleUsers syncs up to limit users that were not synced within
+// staleAfter, the least recently synced first. A zero staleAfter syncs
+// every user. Failures of individual users are logged and skipped.
+func (s *Syncer) SyncStaleUsers(ctx context.Context, staleAfter time.Duration, limit int) (synced int, err error) {
+	rows, err := s.service.pool.Query(
+		ctx,
+		`SELECT
+			users.id
+		FROM
+			users
+			JOIN user_accesstoken ON user_accesstoken.user_id = users.id
+				AND user_accesstoken.provider = users.provider
+		WHERE
+			users.merged_into IS NULL
+			AND (users.synced_at IS NULL OR users.synced_at < $1)
+		ORDER BY
+			users.synced_at NULLS FIRST
+		LIMIT $2`,
+		time.Now().Add(-staleAfter),
+		limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error querying stale users: %w", err)
+	}
+
+	userIds, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("error reading stale users: %w", err)
+	}
+
+	for _, userId := range userIds {
+		if ctx.Err() != nil {
+			return synced, ctx.Err()
+		}
+
+		err := s.SyncUser(ctx, userId)
+		if err != nil {
+			log.Warn().Err(err).Int64("user_id", userId).Msg("syncing user")
+			continue
+		}
+
+		synced++
+	}
+
+	return synced, nil
+}
+
+// RunWorker calls SyncStaleUsers on every interval until ctx is done.
+func (s *Syncer) RunWorker(ctx context.Context, interval time.Duration, staleAfter time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			synced, err := s.SyncStaleUsers(ctx, staleAfter, batchSize)
+			if err != nil {
+				log.Error().Err(err).Msg("syncing stale users")
+				continue
+			}
+
+			log.Debug().Int("synced", synced).Msg("synced stale users")
+		}
+	}
+}
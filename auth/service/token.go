@@ -3,13 +3,38 @@ package auth_service
 import (
 	"context"
 	"fmt"
+	"kodiiing/auth"
+	auth_aes "kodiiing/auth/aes"
+	"kodiiing/auth/provider"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func (d *AuthService) CreateUserAccessToken(ctx context.Context, userId int64, accessToken string, refreshToken string) error {
+// CreateUserAccessToken stores the tokens of the user's identity of the provider.
+// A token without a refresh token keeps the one that was stored before, as
+// providers don't always hand out a new one on refresh.
+func (d *AuthService) CreateUserAccessToken(ctx context.Context, userId int64, providerKind auth.Provider, token provider.Token) error {
 	// Encrypt both the access and refresh token
-	encryptedAccessToken := d.aes.Encrypt(accessToken)
-	encryptedRefreshToken := d.aes.Encrypt(refreshToken)
+	encryptedAccessToken, err := d.aes.Encrypt(token.AccessToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+
+	var encryptedRefreshToken *string
+	if token.RefreshToken != "" {
+		value, err := d.aes.Encrypt(token.RefreshToken)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt refresh token: %w", err)
+		}
+
+		encryptedRefreshToken = &value
+	}
+
+	var expiresAt *time.Time
+	if !token.ExpiresAt.IsZero() {
+		expiresAt = &token.ExpiresAt
+	}
 
 	tx, err := d.pool.Begin(ctx)
 	if err != nil {
@@ -22,23 +47,28 @@ func (d *AuthService) CreateUserAccessToken(ctx context.Context, userId int64, a
 			user_accesstoken
 			(
 				user_id,
+				provider,
 				access_token,
 				refresh_token,
+				expires_at,
 				created_at,
 				updated_at,
 				updated_by
 			)
 		VALUES
-			($1, $2, $3, $4, $4, $5)
-		ON CONFLICT (user_id) DO UPDATE
+			($1, $2, $3, $4, $5, $6, $6, $7)
+		ON CONFLICT (user_id, provider) DO UPDATE
 			SET
-				access_token = $2,
-				refresh_token = $3,
-				updated_at = $4,
-				updated_by = $5`,
+				access_token = $3,
+				refresh_token = COALESCE($4, user_accesstoken.refresh_token),
+				expires_at = $5,
+				updated_at = $6,
+				updated_by = $7`,
 		userId,
+		providerKind.ToUint8(),
 		encryptedAccessToken,
 		encryptedRefreshToken,
+		expiresAt,
 		time.Now(),
 		"system",
 	)
@@ -61,3 +91,96 @@ func (d *AuthService) CreateUserAccessToken(ctx context.Context, userId int64, a
 
 	return nil
 }
+
+// ReencryptUserAccessTokens re-wraps every stored provider token that was not
+// sealed by the newest key of the key ring. It returns the number of rows
+// that were updated.
+func ReencryptUserAccessTokens(ctx context.Context, pool *pgxpool.Pool, keyRing *auth_aes.Aes) (updated int64, err error) {
+	rows, err := pool.Query(ctx, `SELECT id, access_token, refresh_token FROM user_accesstoken ORDER BY id`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query user access tokens: %w", err)
+	}
+
+	type row struct {
+		id           int64
+		accessToken  string
+		refreshToken *string
+	}
+
+	var stale []row
+	for rows.Next() {
+		var r row
+		err := rows.Scan(&r.id, &r.accessToken, &r.refreshToken)
+		if err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan user access token: %w", err)
+		}
+
+		if keyRing.NeedsReencrypt(r.accessToken) || (r.refreshToken != nil && keyRing.NeedsReencrypt(*r.refreshToken)) {
+			stale = append(stale, r)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read user access tokens: %w", err)
+	}
+
+	for _, r := range stale {
+		accessToken, err := reencrypt(keyRing, r.accessToken)
+		if err != nil {
+			return updated, fmt.Errorf("row %d: access token: %w", r.id, err)
+		}
+
+		var refreshToken *string
+		if r.refreshToken != nil {
+			value, err := reencrypt(keyRing, *r.refreshToken)
+			if err != nil {
+				return updated, fmt.Errorf("row %d: refresh token: %w", r.id, err)
+			}
+
+			refreshToken = &value
+		}
+
+		// Only overwrite the row if nobody has written a new token in
+		// the meantime, a fresh token is already sealed by the newest key.
+		commandTag, err := pool.Exec(
+			ctx,
+			`UPDATE
+				user_accesstoken
+			SET
+				access_token = $1,
+				refresh_token = $2,
+				updated_at = $3,
+				updated_by = $4
+			WHERE
+				id = $5
+				AND access_token = $6`,
+			accessToken,
+			refreshToken,
+			time.Now(),
+			"system:reencrypt",
+			r.id,
+			r.accessToken,
+		)
+		if err != nil {
+			return updated, fmt.Errorf("row %d: failed to update user access token: %w", r.id, err)
+		}
+
+		updated += commandTag.RowsAffected()
+	}
+
+	return updated, nil
+}
+
+func reencrypt(keyRing *auth_aes.Aes, value string) (string, error) {
+	if !keyRing.NeedsReencrypt(value) {
+		return value, nil
+	}
+
+	plaintext, err := keyRing.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+
+	return keyRing.Encrypt(plaintext)
+}
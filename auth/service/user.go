@@ -6,17 +6,24 @@ import (
 	"errors"
 	"fmt"
 	"kodiiing/auth"
-	"kodiiing/fgob"
-	"log"
 	"net/url"
 	"strconv"
 	"time"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/jackc/pgx/v5"
 )
 
+// CreateUser inserts the user that was returned by a provider, or updates
+// the existing row if the user has logged in with the same provider before.
+// The returned id is the Kodiiing user ID. Users that were merged into
+// another one no longer hold their provider key, so an identity that has
+// since been unlinked signs up a new user.
 func (d *AuthService) CreateUser(ctx context.Context, user *auth.User) (id int64, err error) {
+	var profileUrl string
+	if user.ProfileURL != nil {
+		profileUrl = user.ProfileURL.String()
+	}
+
 	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{
 		IsoLevel:   pgx.ReadCommitted,
 		AccessMode: pgx.ReadWrite,
@@ -25,9 +32,15 @@ func (d *AuthService) CreateUser(ctx context.Context, user *auth.User) (id int64
 		return 0, fmt.Errorf("starting transaction: %w", err)
 	}
 
+	// The previous username and email are returned along with the ID,
+	// the user may still be cached under them.
+	var previousUsername, previousEmail string
 	err = tx.QueryRow(
 		ctx,
-		`INSERT INTO users
+		`WITH previous AS (
+			SELECT username, email FROM users WHERE provider = $1 AND provider_id = $2
+		)
+		INSERT INTO users
 			(
 				provider,
 				provider_id,
@@ -42,18 +55,29 @@ func (d *AuthService) CreateUser(ctx context.Context, user *auth.User) (id int64
 			)
 			VALUES
 			($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-			RETURNING id`,
+			ON CONFLICT (provider, provider_id) DO UPDATE
+				SET
+					name = EXCLUDED.name,
+					username = EXCLUDED.username,
+					email = EXCLUDED.email,
+					profile_url = EXCLUDED.profile_url,
+					updated_at = EXCLUDED.updated_at,
+					updated_by = EXCLUDED.updated_by
+			RETURNING
+				id,
+				COALESCE((SELECT username FROM previous), ''),
+				COALESCE((SELECT email FROM previous), '')`,
 		user.Provider.ToUint8(),
-		user.ID,
+		user.ProviderID,
 		user.Name,
 		user.Username,
 		user.Email,
-		user.ProfileURL,
+		profileUrl,
 		user.CreatedAt,
 		time.Now(),
 		time.Now(),
 		"system",
-	).Scan(&id)
+	).Scan(&id, &previousUsername, &previousEmail)
 	if err != nil {
 		if e := tx.Rollback(ctx); e != nil {
 			return 0, fmt.Errorf("error rolling back transaction: %w", e)
@@ -71,122 +95,16 @@ func (d *AuthService) CreateUser(ctx context.Context, user *auth.User) (id int64
 		return 0, fmt.Errorf("error committing transaction: %w", err)
 	}
 
+	d.invalidateUser(ctx, id, previousUsername, previousEmail)
+
 	return
 }
 
+// GetUserById returns the user, or the user it was merged into.
 func (d *AuthService) GetUserById(ctx context.Context, id int64) (auth.User, error) {
-	// Is it cached?
-	cachedUser, err := d.memory.Get("user:id:" + strconv.FormatInt(id, 10))
-	if err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
-		return auth.User{}, fmt.Errorf("error getting user from cache: %w", err)
-	}
-
-	if cachedUser != nil {
-		var user auth.User
-		err := fgob.Unmarshal(cachedUser, &user)
-		if err != nil {
-			return auth.User{}, fmt.Errorf("error unmarshalling user from cache: %w", err)
-		}
-
-		return user, nil
-	}
-
-	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
-	if err != nil {
-		return auth.User{}, fmt.Errorf("starting transaction: %w", err)
-	}
-
-	var user auth.User
-	var nullAvatarUrl sql.NullString
-	var nullLocation sql.NullString
-	err = tx.QueryRow(
-		ctx,
-		`SELECT
-			users.provider,
-			users.provider_id,
-			users.name,
-			users.username,
-			users.email,
-			users.profile_url,
-			users.created_at,
-			users.registered_at,
-			user_statistics.avatar_url,
-			user_statistics.location,
-			user_statistics.public_repositories,
-			user_statistics.followers,
-			user_statistics.following
-		FROM
-			users
-		INNER JOIN
-			user_statistics
-		ON
-			users.id = user_statistics.user_id
-		WHERE
-			users.id = $1`,
-		id,
-	).Scan(
-		&user.Provider,
-		&user.ID,
-		&user.Name,
-		&user.Username,
-		&user.Email,
-		&user.ProfileURL,
-		&user.CreatedAt,
-		&user.RegisteredAt,
-		&nullAvatarUrl,
-		&nullLocation,
-		&user.PublicRepository,
-		&user.Followers,
-		&user.Following,
-	)
-	if err != nil {
-		if e := tx.Rollback(ctx); e != nil {
-			return auth.User{}, fmt.Errorf("error rolling back transaction: %w", e)
-		}
-
-		if errors.Is(err, sql.ErrNoRows) {
-			return auth.User{}, auth.ErrUserNotFound
-		}
-
-		return auth.User{}, fmt.Errorf("error getting user: %w", err)
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		if e := tx.Rollback(ctx); e != nil {
-			return auth.User{}, fmt.Errorf("error rolling back transaction: %w", e)
-		}
-
-		return auth.User{}, fmt.Errorf("error committing transaction: %w", err)
-	}
-
-	if nullAvatarUrl.Valid {
-		avatarUrl, err := url.Parse(nullAvatarUrl.String)
-		if err != nil {
-			return auth.User{}, fmt.Errorf("error parsing avatar url: %w", err)
-		}
-
-		user.AvatarURL = avatarUrl
-	}
-
-	if nullLocation.Valid {
-		user.Location = nullLocation.String
-	}
-
-	defer func(user auth.User) {
-		marshaledUser, err := fgob.Marshal(user)
-		if err != nil {
-			log.Printf("error marshalling user: %v", err)
-			return
-		}
-
-		err = d.memory.Set("user:id:"+strconv.FormatInt(id, 10), marshaledUser)
-		if err != nil {
-			log.Printf("error setting user in cache: %v", err)
-		}
-	}(user)
-
-	return user, nil
+	return d.usersById.Get(ctx, strconv.FormatInt(id, 10), func(ctx context.Context) (auth.User, error) {
+		return d.queryUser(ctx, `users.id = COALESCE((SELECT merged_into FROM users WHERE id = $1), $1)`, id)
+	})
 }
 
 func (d *AuthService) GetUserByUsername(ctx context.Context, username string) (auth.User, error) {
@@ -194,118 +112,9 @@ func (d *AuthService) GetUserByUsername(ctx context.Context, username string) (a
 		return auth.User{}, auth.ErrParameterEmpty
 	}
 
-	// Is it cached?
-	cachedUser, err := d.memory.Get("user:username:" + username)
-	if err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
-		return auth.User{}, fmt.Errorf("error getting user from cache: %w", err)
-	}
-
-	if cachedUser != nil {
-		var user auth.User
-		err := fgob.Unmarshal(cachedUser, &user)
-		if err != nil {
-			return auth.User{}, fmt.Errorf("error unmarshalling user from cache: %w", err)
-		}
-
-		return user, nil
-	}
-
-	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
-	if err != nil {
-		return auth.User{}, fmt.Errorf("starting transaction: %w", err)
-	}
-
-	var user auth.User
-	var nullAvatarUrl sql.NullString
-	var nullLocation sql.NullString
-	err = tx.QueryRow(
-		ctx,
-		`SELECT
-			users.provider,
-			users.provider_id,
-			users.name,
-			users.username,
-			users.email,
-			users.profile_url,
-			users.created_at,
-			users.registered_at,
-			user_statistics.avatar_url,
-			user_statistics.location,
-			user_statistics.public_repositories,
-			user_statistics.followers,
-			user_statistics.following
-		FROM
-			users
-		INNER JOIN
-			user_statistics
-		ON
-			users.id = user_statistics.user_id
-		WHERE
-			users.username = $1`,
-		username,
-	).Scan(
-		&user.Provider,
-		&user.ID,
-		&user.Name,
-		&user.Username,
-		&user.Email,
-		&user.ProfileURL,
-		&user.CreatedAt,
-		&user.RegisteredAt,
-		&nullAvatarUrl,
-		&nullLocation,
-		&user.PublicRepository,
-		&user.Followers,
-		&user.Following,
-	)
-	if err != nil {
-		if e := tx.Rollback(ctx); e != nil {
-			return auth.User{}, fmt.Errorf("error rolling back transaction: %w", e)
-		}
-
-		if errors.Is(err, sql.ErrNoRows) {
-			return auth.User{}, auth.ErrUserNotFound
-		}
-
-		return auth.User{}, fmt.Errorf("error getting user: %w", err)
-	}
-
-	err = tx.Commit(ctx)
-	if err != nil {
-		if e := tx.Rollback(ctx); e != nil {
-			return auth.User{}, fmt.Errorf("error rolling back transaction: %w", e)
-		}
-
-		return auth.User{}, fmt.Errorf("error committing transaction: %w", err)
-	}
-
-	if nullAvatarUrl.Valid {
-		avatarUrl, err := url.Parse(nullAvatarUrl.String)
-		if err != nil {
-			return auth.User{}, fmt.Errorf("error parsing avatar url: %w", err)
-		}
-
-		user.AvatarURL = avatarUrl
-	}
-
-	if nullLocation.Valid {
-		user.Location = nullLocation.String
-	}
-
-	defer func(user auth.User) {
-		marshaledUser, err := fgob.Marshal(user)
-		if err != nil {
-			log.Printf("error marshalling user: %v", err)
-			return
-		}
-
-		err = d.memory.Set("user:username:"+username, marshaledUser)
-		if err != nil {
-			log.Printf("error setting user in cache: %v", err)
-		}
-	}(user)
-
-	return user, nil
+	return d.usersByUsername.Get(ctx, username, func(ctx context.Context) (auth.User, error) {
+		return d.queryUser(ctx, `users.username = $1 AND users.merged_into IS NULL`, username)
+	})
 }
 
 func (d *AuthService) GetUserByEmail(ctx context.Context, email string) (auth.User, error) {
@@ -313,35 +122,28 @@ func (d *AuthService) GetUserByEmail(ctx context.Context, email string) (auth.Us
 		return auth.User{}, auth.ErrParameterEmpty
 	}
 
-	// Is it cached?
-	cachedUser, err := d.memory.Get("user:email:" + email)
-	if err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
-		return auth.User{}, fmt.Errorf("error getting user from cache: %w", err)
-	}
-
-	if cachedUser != nil {
-		var user auth.User
-		err := fgob.Unmarshal(cachedUser, &user)
-		if err != nil {
-			return auth.User{}, fmt.Errorf("error unmarshalling user from cache: %w", err)
-		}
-
-		return user, nil
-	}
+	return d.usersByEmail.Get(ctx, email, func(ctx context.Context) (auth.User, error) {
+		return d.queryUser(ctx, `users.email = $1 AND users.merged_into IS NULL`, email)
+	})
+}
 
+// queryUser reads the user that matches the condition, which takes arg
+// as $1, along with its statistics and roles.
+func (d *AuthService) queryUser(ctx context.Context, condition string, arg any) (auth.User, error) {
 	tx, err := d.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted, AccessMode: pgx.ReadOnly})
 	if err != nil {
 		return auth.User{}, fmt.Errorf("starting transaction: %w", err)
 	}
 
 	var user auth.User
+	var profileUrl string
 	var nullAvatarUrl sql.NullString
 	var nullLocation sql.NullString
 	err = tx.QueryRow(
 		ctx,
 		`SELECT
 			users.provider,
-			users.provider_id,
+			users.id,
 			users.name,
 			users.username,
 			users.email,
@@ -360,15 +162,15 @@ func (d *AuthService) GetUserByEmail(ctx context.Context, email string) (auth.Us
 		ON
 			users.id = user_statistics.user_id
 		WHERE
-			users.email = $1`,
-		email,
+			`+condition,
+		arg,
 	).Scan(
 		&user.Provider,
 		&user.ID,
 		&user.Name,
 		&user.Username,
 		&user.Email,
-		&user.ProfileURL,
+		&profileUrl,
 		&user.CreatedAt,
 		&user.RegisteredAt,
 		&nullAvatarUrl,
@@ -382,7 +184,7 @@ func (d *AuthService) GetUserByEmail(ctx context.Context, email string) (auth.Us
 			return auth.User{}, fmt.Errorf("error rolling back transaction: %w", e)
 		}
 
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return auth.User{}, auth.ErrUserNotFound
 		}
 
@@ -398,6 +200,11 @@ func (d *AuthService) GetUserByEmail(ctx context.Context, email string) (auth.Us
 		return auth.User{}, fmt.Errorf("error committing transaction: %w", err)
 	}
 
+	user.ProfileURL, err = url.Parse(profileUrl)
+	if err != nil {
+		return auth.User{}, fmt.Errorf("error parsing profile url: %w", err)
+	}
+
 	if nullAvatarUrl.Valid {
 		avatarUrl, err := url.Parse(nullAvatarUrl.String)
 		if err != nil {
@@ -411,18 +218,10 @@ func (d *AuthService) GetUserByEmail(ctx context.Context, email string) (auth.Us
 		user.Location = nullLocation.String
 	}
 
-	defer func(user auth.User) {
-		marshaledUser, err := fgob.Marshal(user)
-		if err != nil {
-			log.Printf("error marshalling user: %v", err)
-			return
-		}
-
-		err = d.memory.Set("user:email:"+email, marshaledUser)
-		if err != nil {
-			log.Printf("error setting user in cache: %v", err)
-		}
-	}(user)
+	user.Roles, err = d.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return auth.User{}, err
+	}
 
 	return user, nil
 }
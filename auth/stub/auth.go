@@ -15,19 +15,199 @@ type AuthenticationServiceError struct {
 	Error      error
 }
 
+type BeginLoginRequest struct {
+	Provider Provider `json:"provider"`
+}
+
+type BeginLoginResponse struct {
+	// AuthorizeUrl is the page of the provider to send the user to.
+	AuthorizeUrl string `json:"authorize_url"`
+	// State is sent back by the provider along with the access code,
+	// and must be given to Login or LinkProvider.
+	State string `json:"state"`
+	// LoginSecret stays with the client that began the login, and must
+	// be given to Login or LinkProvider along with the state.
+	LoginSecret string `json:"login_secret"`
+}
+
 type LoginRequest struct {
 	Provider   Provider `json:"provider"`
 	AccessCode string   `json:"access_code"`
+	// State is the state returned by BeginLogin.
+	State string `json:"state"`
+	// LoginSecret is the login secret returned by BeginLogin.
+	LoginSecret string `json:"login_secret"`
 }
 
 type LoginResponse struct {
-	AccessToken string `json:"access_token"`
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
 type LogoutRequest struct {
 	AccessToken string `json:"access_token"`
 }
 
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LinkProviderRequest struct {
+	AccessToken string   `json:"access_token"`
+	Provider    Provider `json:"provider"`
+	AccessCode  string   `json:"access_code"`
+	// State is the state returned by BeginLogin.
+	State string `json:"state"`
+	// LoginSecret is the login secret returned by BeginLogin.
+	LoginSecret string `json:"login_secret"`
+	// Merge allows merging the account the identity is linked to
+	// into the current one.
+	Merge bool `json:"merge"`
+}
+
+type UnlinkProviderRequest struct {
+	AccessToken string   `json:"access_token"`
+	Provider    Provider `json:"provider"`
+}
+
+type RoleRequest struct {
+	AccessToken string `json:"access_token"`
+	UserId      int64  `json:"user_id"`
+	// Role is one of "reviewer", "task_author", "moderator" or "admin".
+	Role string `json:"role"`
+}
+
+type CreatePersonalAccessTokenRequest struct {
+	AccessToken string `json:"access_token"`
+	Name        string `json:"name"`
+	// Scopes are permission names such as "task:read". A token never
+	// allows more than the roles of its user do.
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays defaults to 30, and is at most 365.
+	ExpiresInDays int64 `json:"expires_in_days"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	Id int64 `json:"id"`
+	// Token is only returned once, it can not be retrieved afterwards.
+	Token     string `json:"token"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type ListPersonalAccessTokensRequest struct {
+	AccessToken string `json:"access_token"`
+}
+
+type ListPersonalAccessTokensResponse struct {
+	Tokens []PersonalAccessToken `json:"tokens"`
+}
+
+// PersonalAccessToken timestamps are in unix seconds, LastUsedAt
+// is zero when the token has never been used.
+type PersonalAccessToken struct {
+	Id         int64    `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  int64    `json:"created_at"`
+	ExpiresAt  int64    `json:"expires_at"`
+	LastUsedAt int64    `json:"last_used_at"`
+}
+
+type RevokePersonalAccessTokenRequest struct {
+	AccessToken string `json:"access_token"`
+	Id          int64  `json:"id"`
+}
+
+type RequestMagicLinkRequest struct {
+	Email string `json:"email"`
+}
+
+type ConsumeMagicLinkRequest struct {
+	// Token is the "token" query parameter of the emailed link.
+	Token string `json:"token"`
+}
+
+// ListAuthEventsRequest filters are ignored when left empty,
+// timestamps are in unix seconds.
+type ListAuthEventsRequest struct {
+	AccessToken string `json:"access_token"`
+	UserId      int64  `json:"user_id"`
+	// Type is one of "login", "logout", "logout_all", "refresh", "authenticate" or "impersonate".
+	Type string `json:"type"`
+	// Outcome is one of "success", "failure" or "error".
+	Outcome string `json:"outcome"`
+	Ip      string `json:"ip"`
+	Since   int64  `json:"since"`
+	Until   int64  `json:"until"`
+	// BeforeId is the id of the last event of the previous page.
+	BeforeId int64 `json:"before_id"`
+	// Limit defaults to 50, and is at most 500.
+	Limit int64 `json:"limit"`
+}
+
+type ListAuthEventsResponse struct {
+	Events []AuthEvent `json:"events"`
+}
+
+type AuthEvent struct {
+	Id        int64    `json:"id"`
+	Type      string   `json:"type"`
+	Outcome   string   `json:"outcome"`
+	UserId    int64    `json:"user_id"`
+	Provider  Provider `json:"provider"`
+	Ip        string   `json:"ip"`
+	UserAgent string   `json:"user_agent"`
+	Detail    string   `json:"detail"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+type ListSessionsRequest struct {
+	AccessToken string `json:"access_token"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+// Session is a device that the user signed in on. Timestamps are in
+// unix seconds, Current is set on the session of the access token.
+type Session struct {
+	Id         string `json:"id"`
+	Ip         string `json:"ip"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  int64  `json:"created_at"`
+	LastSeenAt int64  `json:"last_seen_at"`
+	ExpiresAt  int64  `json:"expires_at"`
+	Current    bool   `json:"current"`
+}
+
+type RevokeSessionRequest struct {
+	AccessToken string `json:"access_token"`
+	Id          string `json:"id"`
+}
+
+type ImpersonateRequest struct {
+	AccessToken string `json:"access_token"`
+	UserId      int64  `json:"user_id"`
+	// Reason is recorded on the audit trail, such as a support ticket.
+	Reason string `json:"reason"`
+	// AllowWrites lets the token change things on behalf of the user,
+	// the token is read only otherwise.
+	AllowWrites bool `json:"allow_writes"`
+}
+
+// ImpersonateResponse carries an access token that can't be refreshed,
+// ExpiresAt is in unix seconds.
+type ImpersonateResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresAt   int64  `json:"expires_at"`
+}
+
 type EmptyResponse struct {
 }
 
@@ -37,12 +217,46 @@ const (
 	PROVIDER_UNSPECIFIED Provider = 0
 	PROVIDER_GITHUB      Provider = 1
 	PROVIDER_GITLAB      Provider = 2
+	PROVIDER_OIDC        Provider = 3
+	PROVIDER_EMAIL       Provider = 4
 )
 
 type AuthenticationServiceServer interface {
 	Login(ctx context.Context, req *LoginRequest) (*LoginResponse, *AuthenticationServiceError)
 	Logout(ctx context.Context, req *LogoutRequest) (*EmptyResponse, *AuthenticationServiceError)
+	RefreshToken(ctx context.Context, req *RefreshTokenRequest) (*RefreshTokenResponse, *AuthenticationServiceError)
+	// Revokes every token of the user, logging the user out of every device.
+	LogoutAll(ctx context.Context, req *LogoutRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Links another provider identity to the logged in user.
+	LinkProvider(ctx context.Context, req *LinkProviderRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Unlinks a provider identity from the logged in user.
+	UnlinkProvider(ctx context.Context, req *UnlinkProviderRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Grants a role to a user, requires the user:manage_roles permission.
+	GrantRole(ctx context.Context, req *RoleRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Revokes a role from a user, requires the user:manage_roles permission.
+	RevokeRole(ctx context.Context, req *RoleRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Creates a scoped and expiring token for scripts and integrations.
+	CreatePersonalAccessToken(ctx context.Context, req *CreatePersonalAccessTokenRequest) (*CreatePersonalAccessTokenResponse, *AuthenticationServiceError)
+	// Lists the personal access tokens of the logged in user.
+	ListPersonalAccessTokens(ctx context.Context, req *ListPersonalAccessTokensRequest) (*ListPersonalAccessTokensResponse, *AuthenticationServiceError)
+	// Revokes a personal access token of the logged in user.
+	RevokePersonalAccessToken(ctx context.Context, req *RevokePersonalAccessTokenRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Emails a single-use login link, signing up the address if it is new.
+	RequestMagicLink(ctx context.Context, req *RequestMagicLinkRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Exchanges an emailed login link for a token pair.
+	ConsumeMagicLink(ctx context.Context, req *ConsumeMagicLinkRequest) (*LoginResponse, *AuthenticationServiceError)
+	// Returns the authorization page of a provider, with a state and PKCE challenge to log in with.
+	BeginLogin(ctx context.Context, req *BeginLoginRequest) (*BeginLoginResponse, *AuthenticationServiceError)
+	// Lists authentication events, requires the user:audit permission.
+	ListAuthEvents(ctx context.Context, req *ListAuthEventsRequest) (*ListAuthEventsResponse, *AuthenticationServiceError)
+	// Lists the devices the logged in user is signed in on.
+	ListSessions(ctx context.Context, req *ListSessionsRequest) (*ListSessionsResponse, *AuthenticationServiceError)
+	// Signs a device of the logged in user out.
+	RevokeSession(ctx context.Context, req *RevokeSessionRequest) (*EmptyResponse, *AuthenticationServiceError)
+	// Issues a short-lived access token acting as another user, requires the user:impersonate permission.
+	Impersonate(ctx context.Context, req *ImpersonateRequest) (*ImpersonateResponse, *AuthenticationServiceError)
 	GetUserById(ctx context.Context, id int64) (auth.User, error)
+	AuthenticatePersonalAccessToken(ctx context.Context, token string) (auth.User, error)
 }
 
 func NewAuthenticationServiceServer(implementation AuthenticationServiceServer) *chi.Mux {
@@ -115,5 +329,549 @@ func NewAuthenticationServiceServer(implementation AuthenticationServiceServer)
 		}
 	})
 
+	mux.Post("/RefreshToken", func(w http.ResponseWriter, r *http.Request) {
+		var req RefreshTokenRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RefreshTokenerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.RefreshToken(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RefreshTokenerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - RefreshTokenerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/LogoutAll", func(w http.ResponseWriter, r *http.Request) {
+		var req LogoutRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - LogoutAllerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.LogoutAll(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - LogoutAllerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - LogoutAllerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/LinkProvider", func(w http.ResponseWriter, r *http.Request) {
+		var req LinkProviderRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - LinkProvidererror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.LinkProvider(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - LinkProvidererror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - LinkProvidererror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/UnlinkProvider", func(w http.ResponseWriter, r *http.Request) {
+		var req UnlinkProviderRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - UnlinkProvidererror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.UnlinkProvider(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - UnlinkProvidererror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - UnlinkProvidererror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/GrantRole", func(w http.ResponseWriter, r *http.Request) {
+		var req RoleRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - GrantRoleerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.GrantRole(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - GrantRoleerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - GrantRoleerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/RevokeRole", func(w http.ResponseWriter, r *http.Request) {
+		var req RoleRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RevokeRoleerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.RevokeRole(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RevokeRoleerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - RevokeRoleerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/CreatePersonalAccessToken", func(w http.ResponseWriter, r *http.Request) {
+		var req CreatePersonalAccessTokenRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - CreatePersonalAccessTokenerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.CreatePersonalAccessToken(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - CreatePersonalAccessTokenerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - CreatePersonalAccessTokenerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/ListPersonalAccessTokens", func(w http.ResponseWriter, r *http.Request) {
+		var req ListPersonalAccessTokensRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ListPersonalAccessTokenserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ListPersonalAccessTokens(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ListPersonalAccessTokenserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - ListPersonalAccessTokenserror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/RevokePersonalAccessToken", func(w http.ResponseWriter, r *http.Request) {
+		var req RevokePersonalAccessTokenRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RevokePersonalAccessTokenerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.RevokePersonalAccessToken(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RevokePersonalAccessTokenerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - RevokePersonalAccessTokenerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/RequestMagicLink", func(w http.ResponseWriter, r *http.Request) {
+		var req RequestMagicLinkRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RequestMagicLinkerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.RequestMagicLink(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RequestMagicLinkerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - RequestMagicLinkerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/ConsumeMagicLink", func(w http.ResponseWriter, r *http.Request) {
+		var req ConsumeMagicLinkRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ConsumeMagicLinkerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ConsumeMagicLink(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ConsumeMagicLinkerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - ConsumeMagicLinkerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/BeginLogin", func(w http.ResponseWriter, r *http.Request) {
+		var req BeginLoginRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - BeginLoginerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.BeginLogin(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - BeginLoginerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - BeginLoginerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/ListAuthEvents", func(w http.ResponseWriter, r *http.Request) {
+		var req ListAuthEventsRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ListAuthEventserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ListAuthEvents(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ListAuthEventserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - ListAuthEventserror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/ListSessions", func(w http.ResponseWriter, r *http.Request) {
+		var req ListSessionsRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ListSessionserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ListSessions(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - ListSessionserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - ListSessionserror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/RevokeSession", func(w http.ResponseWriter, r *http.Request) {
+		var req RevokeSessionRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RevokeSessionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.RevokeSession(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - RevokeSessionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - RevokeSessionerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/Impersonate", func(w http.ResponseWriter, r *http.Request) {
+		var req ImpersonateRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - Impersonateerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.Impersonate(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[AuthenticationService - Impersonateerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[AuthenticationService - Impersonateerror] writing to response stream: %s", e.Error())
+		}
+	})
+
 	return mux
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	authservice "kodiiing/auth/service"
+	"kodiiing/cache"
+	"kodiiing/cache/invalidation"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// NewCache builds the configured cache. Deleted keys are notified through
+// the database, for the invalidation listener of every instance to evict.
+func NewCache(ctx context.Context, config Config, pool *pgxpool.Pool) (cache.Cache, error) {
+	driver, err := newCacheDriver(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return invalidation.NewCache(driver, pool)
+}
+
+func newCacheDriver(ctx context.Context, config Config) (cache.Cache, error) {
+	switch config.Cache.Driver {
+	case "", "memory":
+		// Entries carry their own TTL, bigcache only has to
+		// keep them for as long as the longest one.
+		lifeWindow := max(
+			config.Cache.UserTTL,
+			config.Cache.UserNotFoundTTL,
+			config.Cache.RepositoriesTTL,
+			config.Cache.LoginStateTTL,
+		)
+
+		return cache.NewMemory(ctx, cache.MemoryConfig{
+			LifeWindow: lifeWindow,
+			MaxSizeMB:  config.Cache.MaxSizeMB,
+		})
+	case "redis":
+		return cache.NewRedis(cache.RedisConfig{
+			Address:  config.Cache.Redis.Address,
+			Password: config.Cache.Redis.Password,
+			DB:       config.Cache.Redis.DB,
+		})
+	default:
+		return nil, fmt.Errorf("unknown cache driver: %s", config.Cache.Driver)
+	}
+}
+
+// NewCacheTTL returns how long the auth service caches each kind of entry.
+func NewCacheTTL(config Config) authservice.CacheTTL {
+	return authservice.CacheTTL{
+		User:         config.Cache.UserTTL,
+		UserNotFound: config.Cache.UserNotFoundTTL,
+		Repositories: config.Cache.RepositoriesTTL,
+		LoginState:   config.Cache.LoginStateTTL,
+	}
+}
@@ -0,0 +1,201 @@
+// Package cache keeps values between requests, either in the memory of the
+// instance or in a Redis server shared by every instance.
+//
+// Cache stores raw bytes, Family is a typed view on the keys that share a
+// prefix and a TTL.
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/fgob"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// ErrNotFound is returned when the key is not cached, or has expired.
+var ErrNotFound = errors.New("cache: entry not found")
+
+// Cache stores values by their key, each with its own TTL.
+type Cache interface {
+	// Get returns ErrNotFound when the key is not cached.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores the value until the TTL is over. A TTL of zero keeps
+	// the value for as long as the implementation allows.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes the keys, keys that are not cached are ignored.
+	Delete(ctx context.Context, keys ...string) error
+	// Take gets and removes the key at once. Among concurrent callers,
+	// only one gets the value, the others get ErrNotFound.
+	Take(ctx context.Context, key string) ([]byte, error)
+	Close() error
+}
+
+// FamilyConfig configures NewFamily.
+type FamilyConfig struct {
+	// Prefix is prepended to every key of the family, e.g. "user:id:".
+	Prefix string
+	TTL    time.Duration
+	// NotFound is the error of a load that found nothing. When set
+	// along with NegativeTTL, the absence is cached as well, and Get
+	// returns NotFound until NegativeTTL is over.
+	NotFound    error
+	NegativeTTL time.Duration
+}
+
+// Family is a set of keys that share a prefix, a TTL and the type of
+// their values. Values are gob encoded.
+type Family[T any] struct {
+	cache  Cache
+	config FamilyConfig
+	group  singleflight.Group
+}
+
+// An entry starts with its kind, so a cached absence can be told apart
+// from a cached value.
+const (
+	entryValue byte = iota + 1
+	entryNotFound
+)
+
+func NewFamily[T any](cache Cache, config FamilyConfig) *Family[T] {
+	return &Family[T]{cache: cache, config: config}
+}
+
+// Key returns the key of the cache that holds the key of the family.
+func (f *Family[T]) Key(key string) string {
+	return f.config.Prefix + key
+}
+
+// Get returns the cached value of the key, or calls load and caches what
+// it returns. Concurrent calls for the same key share a single load, made
+// with the context of the first caller. Errors of the cache are logged
+// and fall through to load, the cache is never required to answer.
+func (f *Family[T]) Get(ctx context.Context, key string, load func(ctx context.Context) (T, error)) (T, error) {
+	data, err := f.cache.Get(ctx, f.Key(key))
+	if err == nil {
+		value, err := f.decode(data)
+		if err == nil || errors.Is(err, f.config.NotFound) {
+			return value, err
+		}
+
+		log.Warn().Err(err).Str("key", f.Key(key)).Msg("decoding cache entry")
+	} else if !errors.Is(err, ErrNotFound) {
+		log.Warn().Err(err).Str("key", f.Key(key)).Msg("getting cache entry")
+	}
+
+	result, err, _ := f.group.Do(key, func() (any, error) {
+		value, err := load(ctx)
+		if err != nil {
+			if f.cachesNotFound() && errors.Is(err, f.config.NotFound) {
+				f.store(ctx, key, []byte{entryNotFound}, f.config.NegativeTTL)
+			}
+
+			return value, err
+		}
+
+		encoded, e := fgob.Marshal(value)
+		if e != nil {
+			log.Warn().Err(e).Str("key", f.Key(key)).Msg("encoding cache entry")
+			return value, nil
+		}
+
+		f.store(ctx, key, append([]byte{entryValue}, encoded...), f.config.TTL)
+		return value, nil
+	})
+
+	value, _ := result.(T)
+	return value, err
+}
+
+// Lookup returns the cached value of the key without loading it. It returns
+// ErrNotFound when the key is not cached.
+func (f *Family[T]) Lookup(ctx context.Context, key string) (T, error) {
+	var zero T
+	data, err := f.cache.Get(ctx, f.Key(key))
+	if err != nil {
+		return zero, err
+	}
+
+	return f.decode(data)
+}
+
+// Set caches the value of the key.
+func (f *Family[T]) Set(ctx context.Context, key string, value T) error {
+	encoded, err := fgob.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding cache entry: %w", err)
+	}
+
+	return f.cache.Set(ctx, f.Key(key), append([]byte{entryValue}, encoded...), f.config.TTL)
+}
+
+// Take returns the cached value of the key and removes it, see Cache.Take.
+func (f *Family[T]) Take(ctx context.Context, key string) (T, error) {
+	var zero T
+	data, err := f.cache.Take(ctx, f.Key(key))
+	if err != nil {
+		return zero, err
+	}
+
+	value, err := f.decode(data)
+	if errors.Is(err, f.config.NotFound) {
+		return zero, ErrNotFound
+	}
+
+	return value, err
+}
+
+// Delete invalidates the keys, along with their cached absence.
+func (f *Family[T]) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	prefixed := make([]string, 0, len(keys))
+	for _, key := range keys {
+		prefixed = append(prefixed, f.Key(key))
+	}
+
+	return f.cache.Delete(ctx, prefixed...)
+}
+
+func (f *Family[T]) cachesNotFound() bool {
+	return f.config.NotFound != nil && f.config.NegativeTTL > 0
+}
+
+func (f *Family[T]) decode(data []byte) (T, error) {
+	var value T
+	if len(data) == 0 {
+		return value, fmt.Errorf("empty cache entry")
+	}
+
+	switch data[0] {
+	case entryValue:
+		err := fgob.Unmarshal(data[1:], &value)
+		if err != nil {
+			return value, fmt.Errorf("decoding cache entry: %w", err)
+		}
+
+		return value, nil
+	case entryNotFound:
+		if f.config.NotFound == nil {
+			return value, fmt.Errorf("unexpected cached absence")
+		}
+
+		return value, f.config.NotFound
+	default:
+		return value, fmt.Errorf("unknown cache entry kind: %d", data[0])
+	}
+}
+
+// store caches an entry, a failure only costs another load.
+func (f *Family[T]) store(ctx context.Context, key string, data []byte, ttl time.Duration) {
+	err := f.cache.Set(ctx, f.Key(key), data, ttl)
+	if err != nil {
+		log.Warn().Err(err).Str("key", f.Key(key)).Msg("setting cache entry")
+	}
+}
@@ -0,0 +1,245 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"kodiiing/cache"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newMemory(t *testing.T) *cache.Memory {
+	t.Helper()
+
+	memory, err := cache.NewMemory(context.Background(), cache.MemoryConfig{LifeWindow: time.Minute})
+	if err != nil {
+		t.Fatalf("creating memory cache: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = memory.Close()
+	})
+
+	return memory
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	memory := newMemory(t)
+
+	_, err := memory.Get(ctx, "missing")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	err = memory.Set(ctx, "key", []byte("value"), time.Minute)
+	if err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+
+	value, err := memory.Get(ctx, "key")
+	if err != nil || string(value) != "value" {
+		t.Errorf("expected value, got %q, %v", value, err)
+	}
+
+	err = memory.Delete(ctx, "key", "missing")
+	if err != nil {
+		t.Errorf("deleting: %v", err)
+	}
+
+	_, err = memory.Get(ctx, "key")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+}
+
+func TestMemoryReset(t *testing.T) {
+	ctx := context.Background()
+	memory := newMemory(t)
+
+	err := memory.Set(ctx, "key", []byte("value"), time.Minute)
+	if err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+
+	err = memory.Reset(ctx)
+	if err != nil {
+		t.Fatalf("resetting: %v", err)
+	}
+
+	_, err = memory.Get(ctx, "key")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after reset, got %v", err)
+	}
+}
+
+func TestMemoryTTL(t *testing.T) {
+	ctx := context.Background()
+	memory := newMemory(t)
+
+	err := memory.Set(ctx, "key", []byte("value"), time.Millisecond*20)
+	if err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+
+	time.Sleep(time.Millisecond * 40)
+
+	_, err = memory.Get(ctx, "key")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected the entry to expire, got %v", err)
+	}
+}
+
+func TestMemoryTake(t *testing.T) {
+	ctx := context.Background()
+	memory := newMemory(t)
+
+	err := memory.Set(ctx, "key", []byte("value"), time.Minute)
+	if err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+
+	value, err := memory.Take(ctx, "key")
+	if err != nil || string(value) != "value" {
+		t.Errorf("expected value, got %q, %v", value, err)
+	}
+
+	_, err = memory.Take(ctx, "key")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on the second take, got %v", err)
+	}
+}
+
+type user struct {
+	ID   int64
+	Name string
+}
+
+var errUserNotFound = errors.New("user not found")
+
+func TestFamilyGet(t *testing.T) {
+	ctx := context.Background()
+	users := cache.NewFamily[user](newMemory(t), cache.FamilyConfig{Prefix: "user:", TTL: time.Minute})
+
+	var loads int
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{ID: 1, Name: "ronald"}, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		got, err := users.Get(ctx, "1", load)
+		if err != nil {
+			t.Fatalf("getting: %v", err)
+		}
+
+		if got.Name != "ronald" {
+			t.Errorf("expected ronald, got %q", got.Name)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("expected a single load, got %d", loads)
+	}
+
+	err := users.Delete(ctx, "1")
+	if err != nil {
+		t.Fatalf("deleting: %v", err)
+	}
+
+	_, err = users.Get(ctx, "1", load)
+	if err != nil {
+		t.Fatalf("getting: %v", err)
+	}
+
+	if loads != 2 {
+		t.Errorf("expected a load after delete, got %d loads", loads)
+	}
+}
+
+func TestFamilyGetSharesLoads(t *testing.T) {
+	ctx := context.Background()
+	users := cache.NewFamily[user](newMemory(t), cache.FamilyConfig{Prefix: "user:", TTL: time.Minute})
+
+	var loads atomic.Int32
+	release := make(chan struct{})
+	load := func(ctx context.Context) (user, error) {
+		loads.Add(1)
+		<-release
+		return user{ID: 1}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = users.Get(ctx, "1", load)
+		}()
+	}
+
+	// Let every caller reach the load before it returns.
+	time.Sleep(time.Millisecond * 50)
+	close(release)
+	wg.Wait()
+
+	if n := loads.Load(); n != 1 {
+		t.Errorf("expected a single load, got %d", n)
+	}
+}
+
+func TestFamilyNegativeCaching(t *testing.T) {
+	ctx := context.Background()
+	users := cache.NewFamily[user](newMemory(t), cache.FamilyConfig{
+		Prefix:      "user:",
+		TTL:         time.Minute,
+		NotFound:    errUserNotFound,
+		NegativeTTL: time.Minute,
+	})
+
+	var loads int
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{}, errUserNotFound
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := users.Get(ctx, "1", load)
+		if !errors.Is(err, errUserNotFound) {
+			t.Errorf("expected errUserNotFound, got %v", err)
+		}
+	}
+
+	if loads != 1 {
+		t.Errorf("expected the absence to be cached, got %d loads", loads)
+	}
+}
+
+func TestFamilyDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	users := cache.NewFamily[user](newMemory(t), cache.FamilyConfig{
+		Prefix:      "user:",
+		TTL:         time.Minute,
+		NotFound:    errUserNotFound,
+		NegativeTTL: time.Minute,
+	})
+
+	failure := errors.New("connection refused")
+	var loads int
+	load := func(ctx context.Context) (user, error) {
+		loads++
+		return user{}, failure
+	}
+
+	for i := 0; i < 2; i++ {
+		_, err := users.Get(ctx, "1", load)
+		if !errors.Is(err, failure) {
+			t.Errorf("expected the load error, got %v", err)
+		}
+	}
+
+	if loads != 2 {
+		t.Errorf("expected every failed load to be retried, got %d loads", loads)
+	}
+}
@@ -0,0 +1,231 @@
+// Package invalidation evicts cache entries on every instance, through the
+// LISTEN and NOTIFY commands of PostgreSQL.
+//
+// A writer notifies the keys it has changed, and the Listener of every
+// instance deletes them from its cache. Notifications sent within a
+// transaction are only delivered once it commits.
+package invalidation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"kodiiing/cache"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Channel is the channel that the notifications are sent on.
+const Channel = "cache_invalidation"
+
+// maxPayloadLength keeps a payload under the 8000 bytes that
+// PostgreSQL accepts, keys are spread over several notifications.
+const maxPayloadLength = 7000
+
+type payload struct {
+	Keys []string `json:"keys"`
+}
+
+// Execer is a connection, a pool or a transaction.
+type Execer interface {
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+}
+
+// Notify tells every instance to delete the keys from its cache.
+func Notify(ctx context.Context, db Execer, keys ...string) error {
+	for _, batch := range batches(keys) {
+		encoded, err := json.Marshal(payload{Keys: batch})
+		if err != nil {
+			return fmt.Errorf("encoding invalidation: %w", err)
+		}
+
+		_, err = db.Exec(ctx, `SELECT pg_notify($1, $2)`, Channel, string(encoded))
+		if err != nil {
+			return fmt.Errorf("notifying invalidation: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// batches splits the keys so that each batch fits in a payload.
+func batches(keys []string) [][]string {
+	var result [][]string
+	var batch []string
+	length := 0
+	for _, key := range keys {
+		// The key is encoded as a JSON string, and separated by a comma.
+		encoded, _ := json.Marshal(key)
+		keyLength := len(encoded) + 1
+		if len(batch) > 0 && length+keyLength > maxPayloadLength {
+			result = append(result, batch)
+			batch = nil
+			length = 0
+		}
+
+		batch = append(batch, key)
+		length += keyLength
+	}
+
+	if len(batch) > 0 {
+		result = append(result, batch)
+	}
+
+	return result
+}
+
+// Cache wraps a cache so that deleted keys are deleted on every
+// instance. Keys are deleted locally first, so the instance that made
+// the change never reads what it has just invalidated.
+type Cache struct {
+	cache.Cache
+	pool *pgxpool.Pool
+}
+
+func NewCache(c cache.Cache, pool *pgxpool.Pool) (*Cache, error) {
+	if c == nil {
+		return nil, fmt.Errorf("cache required on cache/invalidation module")
+	}
+	if pool == nil {
+		return nil, fmt.Errorf("database connection required on cache/invalidation module")
+	}
+
+	return &Cache{Cache: c, pool: pool}, nil
+}
+
+func (c *Cache) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	localErr := c.Cache.Delete(ctx, keys...)
+	notifyErr := Notify(ctx, c.pool, keys...)
+
+	return errors.Join(localErr, notifyErr)
+}
+
+// Resetter is a cache that can drop every entry at once.
+type Resetter interface {
+	Reset(ctx context.Context) error
+}
+
+// Listener deletes the notified keys from the cache of the instance.
+type Listener struct {
+	pool  *pgxpool.Pool
+	cache cache.Cache
+}
+
+func NewListener(pool *pgxpool.Pool, c cache.Cache) (*Listener, error) {
+	if pool == nil {
+		return nil, fmt.Errorf("database connection required on cache/invalidation module")
+	}
+	if c == nil {
+		return nil, fmt.Errorf("cache required on cache/invalidation module")
+	}
+
+	// Deleting through the wrapper would notify the keys all over again.
+	if wrapped, ok := c.(*Cache); ok {
+		c = wrapped.Cache
+	}
+
+	return &Listener{pool: pool, cache: c}, nil
+}
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Second * 30
+)
+
+// Run listens until ctx is done, and reconnects whenever the connection
+// is lost. Notifications sent while disconnected are lost, so the cache
+// is reset after a reconnection when it is a Resetter.
+func (l *Listener) Run(ctx context.Context) {
+	backoff := minBackoff
+	connected := false
+	for {
+		err := l.listen(ctx, func() {
+			if connected {
+				l.reset(ctx)
+			}
+
+			connected = true
+			backoff = minBackoff
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Dur("retry_in", backoff).Msg("listening for cache invalidations")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// listen runs on a connection of its own, as a pooled connection would
+// keep listening once it is given back. onListen is called once the
+// connection listens.
+func (l *Listener) listen(ctx context.Context, onListen func()) error {
+	conn, err := pgx.ConnectConfig(ctx, l.pool.Config().ConnConfig)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	defer func() {
+		// The context may be done already.
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		_ = conn.Close(closeCtx)
+	}()
+
+	_, err = conn.Exec(ctx, `LISTEN `+pgx.Identifier{Channel}.Sanitize())
+	if err != nil {
+		return fmt.Errorf("listening: %w", err)
+	}
+
+	onListen()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("waiting for notification: %w", err)
+		}
+
+		var p payload
+		err = json.Unmarshal([]byte(notification.Payload), &p)
+		if err != nil {
+			log.Warn().Err(err).Str("payload", notification.Payload).Msg("decoding cache invalidation")
+			continue
+		}
+
+		err = l.cache.Delete(ctx, p.Keys...)
+		if err != nil {
+			log.Warn().Err(err).Strs("keys", p.Keys).Msg("invalidating cache")
+		}
+	}
+}
+
+func (l *Listener) reset(ctx context.Context) {
+	resetter, ok := l.cache.(Resetter)
+	if !ok {
+		return
+	}
+
+	err := resetter.Reset(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("resetting cache after reconnecting")
+		return
+	}
+
+	log.Info().Msg("reset cache after reconnecting")
+}
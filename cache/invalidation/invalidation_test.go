@@ -0,0 +1,86 @@
+package invalidation_test
+
+import (
+	"context"
+	"encoding/json"
+	"kodiiing/cache/invalidation"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+type recorder struct {
+	payloads []string
+}
+
+func (r *recorder) Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error) {
+	r.payloads = append(r.payloads, arguments[1].(string))
+	return pgconn.CommandTag{}, nil
+}
+
+func TestNotify(t *testing.T) {
+	r := &recorder{}
+	err := invalidation.Notify(context.Background(), r, "user:id:1", "user:username:ronald")
+	if err != nil {
+		t.Fatalf("notifying: %v", err)
+	}
+
+	if len(r.payloads) != 1 {
+		t.Fatalf("expected a single notification, got %d", len(r.payloads))
+	}
+
+	if r.payloads[0] != `{"keys":["user:id:1","user:username:ronald"]}` {
+		t.Errorf("unexpected payload: %s", r.payloads[0])
+	}
+}
+
+func TestNotifySplitsLargePayloads(t *testing.T) {
+	keys := make([]string, 0, 200)
+	for i := 0; i < 200; i++ {
+		keys = append(keys, "user:email:"+strings.Repeat("a", 90))
+	}
+
+	r := &recorder{}
+	err := invalidation.Notify(context.Background(), r, keys...)
+	if err != nil {
+		t.Fatalf("notifying: %v", err)
+	}
+
+	if len(r.payloads) < 2 {
+		t.Fatalf("expected the keys to be split, got %d notifications", len(r.payloads))
+	}
+
+	notified := 0
+	for _, payload := range r.payloads {
+		if len(payload) >= 8000 {
+			t.Errorf("payload is too long: %d bytes", len(payload))
+		}
+
+		var decoded struct {
+			Keys []string `json:"keys"`
+		}
+		err := json.Unmarshal([]byte(payload), &decoded)
+		if err != nil {
+			t.Fatalf("decoding payload: %v", err)
+		}
+
+		notified += len(decoded.Keys)
+	}
+
+	if notified != len(keys) {
+		t.Errorf("expected %d keys to be notified, got %d", len(keys), notified)
+	}
+}
+
+func TestNotifyWithoutKeys(t *testing.T) {
+	r := &recorder{}
+	err := invalidation.Notify(context.Background(), r)
+	if err != nil {
+		t.Fatalf("notifying: %v", err)
+	}
+
+	if len(r.payloads) != 0 {
+		t.Errorf("expected no notification, got %d", len(r.payloads))
+	}
+}
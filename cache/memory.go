@@ -0,0 +1,135 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/allegro/bigcache/v3"
+)
+
+// MemoryConfig configures NewMemory.
+type MemoryConfig struct {
+	// LifeWindow is how long bigcache keeps any entry, it should be at
+	// least the longest TTL that is used. It defaults to an hour.
+	LifeWindow time.Duration
+	// MaxSizeMB caps the size of the cache, zero leaves it unbounded.
+	MaxSizeMB int
+}
+
+// Memory is a Cache on top of bigcache, local to the instance. bigcache
+// only has a single life window, so every entry is prefixed by its own
+// expiry time.
+type Memory struct {
+	cache *bigcache.BigCache
+}
+
+// expiryLength is the size of the expiry time that prefixes an entry.
+const expiryLength = 8
+
+func NewMemory(ctx context.Context, config MemoryConfig) (*Memory, error) {
+	if config.LifeWindow <= 0 {
+		config.LifeWindow = time.Hour
+	}
+
+	bigcacheConfig := bigcache.DefaultConfig(config.LifeWindow)
+	bigcacheConfig.HardMaxCacheSize = config.MaxSizeMB
+
+	memory, err := bigcache.New(ctx, bigcacheConfig)
+	if err != nil {
+		return nil, fmt.Errorf("creating bigcache: %w", err)
+	}
+
+	return &Memory{cache: memory}, nil
+}
+
+func (m *Memory) Get(ctx context.Context, key string) ([]byte, error) {
+	entry, err := m.cache.Get(key)
+	if err != nil {
+		if errors.Is(err, bigcache.ErrEntryNotFound) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("getting %s: %w", key, err)
+	}
+
+	value, ok := unwrapEntry(entry, time.Now())
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return value, nil
+}
+
+func (m *Memory) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixNano()
+	}
+
+	entry := make([]byte, expiryLength+len(value))
+	binary.BigEndian.PutUint64(entry, uint64(expiresAt))
+	copy(entry[expiryLength:], value)
+
+	err := m.cache.Set(key, entry)
+	if err != nil {
+		return fmt.Errorf("setting %s: %w", key, err)
+	}
+
+	return nil
+}
+
+func (m *Memory) Delete(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		err := m.cache.Delete(key)
+		if err != nil && !errors.Is(err, bigcache.ErrEntryNotFound) {
+			return fmt.Errorf("deleting %s: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Take(ctx context.Context, key string) ([]byte, error) {
+	value, err := m.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	// Whoever deletes the entry first gets to use it.
+	err = m.cache.Delete(key)
+	if err != nil {
+		if errors.Is(err, bigcache.ErrEntryNotFound) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("deleting %s: %w", key, err)
+	}
+
+	return value, nil
+}
+
+// Reset drops every entry.
+func (m *Memory) Reset(ctx context.Context) error {
+	return m.cache.Reset()
+}
+
+func (m *Memory) Close() error {
+	return m.cache.Close()
+}
+
+// unwrapEntry returns the value of the entry, unless it has expired.
+func unwrapEntry(entry []byte, now time.Time) ([]byte, bool) {
+	if len(entry) < expiryLength {
+		return nil, false
+	}
+
+	expiresAt := int64(binary.BigEndian.Uint64(entry))
+	if expiresAt != 0 && now.UnixNano() >= expiresAt {
+		return nil, false
+	}
+
+	return entry[expiryLength:], true
+}
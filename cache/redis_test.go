@@ -0,0 +1,314 @@
+package cache_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"kodiiing/cache"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is a minimal server of the Redis protocol, it keeps the
+// values in a map and ignores TTLs.
+type fakeRedis struct {
+	listener net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	commands []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	f := &fakeRedis{listener: listener, password: password, values: map[string][]byte{}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	reader := bufio.NewReader(conn)
+	authenticated := f.password == ""
+	for {
+		args, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+
+		// Clients may send commands in lower case.
+		args[0] = strings.ToUpper(args[0])
+
+		f.mu.Lock()
+		f.commands = append(f.commands, strings.Join(args, " "))
+		reply := f.reply(args, &authenticated)
+		f.mu.Unlock()
+
+		_, err = io.WriteString(conn, reply)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) reply(args []string, authenticated *bool) string {
+	name := strings.ToUpper(args[0])
+	if name == "AUTH" {
+		if args[1] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+
+		*authenticated = true
+		return "+OK\r\n"
+	}
+
+	if !*authenticated {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+
+	switch name {
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET", "GETDEL":
+		value, ok := f.values[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+
+		if name == "GETDEL" {
+			delete(f.values, args[1])
+		}
+
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + string(value) + "\r\n"
+	case "SET":
+		f.values[args[1]] = []byte(args[2])
+		return "+OK\r\n"
+	case "DEL":
+		deleted := 0
+		for _, key := range args[1:] {
+			if _, ok := f.values[key]; ok {
+				delete(f.values, key)
+				deleted++
+			}
+		}
+
+		return ":" + strconv.Itoa(deleted) + "\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func (f *fakeRedis) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]string(nil), f.commands...)
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("expected an array, got %q", line)
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+
+	args := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		length, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+
+		value := make([]byte, length+2)
+		_, err = io.ReadFull(r, value)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, string(value[:length]))
+	}
+
+	return args, nil
+}
+
+func newRedis(t *testing.T, server *fakeRedis, password string) *cache.Redis {
+	t.Helper()
+
+	redis, err := cache.NewRedis(cache.RedisConfig{
+		Address:  server.listener.Addr().String(),
+		Password: password,
+		DB:       2,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		t.Fatalf("creating redis cache: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = redis.Close()
+	})
+
+	return redis
+}
+
+func TestRedis(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "secret")
+	redis := newRedis(t, server, "secret")
+
+	_, err := redis.Get(ctx, "missing")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	err = redis.Set(ctx, "key", []byte("value\r\nwith a line break"), time.Minute)
+	if err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+
+	value, err := redis.Get(ctx, "key")
+	if err != nil || string(value) != "value\r\nwith a line break" {
+		t.Errorf("expected value, got %q, %v", value, err)
+	}
+
+	err = redis.Delete(ctx, "key", "missing")
+	if err != nil {
+		t.Errorf("deleting: %v", err)
+	}
+
+	_, err = redis.Get(ctx, "key")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+
+	// HELLO is refused by the fake server, the client falls
+	// back to AUTH and SELECT.
+	var commands []string
+	for _, command := range server.received() {
+		if !strings.HasPrefix(command, "HELLO") {
+			commands = append(commands, command)
+		}
+	}
+
+	expected := []string{"AUTH secret", "SELECT 2", "GET missing"}
+	for i, command := range expected {
+		if i >= len(commands) || commands[i] != command {
+			t.Fatalf("expected the connection to start with %q, got %q", expected, commands)
+		}
+	}
+
+	var set string
+	for _, command := range commands {
+		if strings.HasPrefix(command, "SET key") {
+			set = command
+		}
+	}
+
+	if !strings.HasSuffix(strings.ToUpper(set), " EX 60") {
+		t.Errorf("expected the TTL to be sent, got %q", set)
+	}
+}
+
+func TestRedisTake(t *testing.T) {
+	ctx := context.Background()
+	redis := newRedis(t, newFakeRedis(t, ""), "")
+
+	err := redis.Set(ctx, "key", []byte("value"), 0)
+	if err != nil {
+		t.Fatalf("setting: %v", err)
+	}
+
+	value, err := redis.Take(ctx, "key")
+	if err != nil || string(value) != "value" {
+		t.Errorf("expected value, got %q, %v", value, err)
+	}
+
+	_, err = redis.Take(ctx, "key")
+	if !errors.Is(err, cache.ErrNotFound) {
+		t.Errorf("expected ErrNotFound on the second take, got %v", err)
+	}
+}
+
+func TestRedisErrorReply(t *testing.T) {
+	ctx := context.Background()
+	redis := newRedis(t, newFakeRedis(t, "secret"), "wrong")
+
+	_, err := redis.Get(ctx, "key")
+	var redisErr goredis.Error
+	if !errors.As(err, &redisErr) {
+		t.Fatalf("expected an error reply, got %v", err)
+	}
+
+	if !strings.HasPrefix(redisErr.Error(), "WRONGPASS") {
+		t.Errorf("expected WRONGPASS, got %q", redisErr.Error())
+	}
+}
+
+func TestRedisFamily(t *testing.T) {
+	ctx := context.Background()
+	users := cache.NewFamily[user](newRedis(t, newFakeRedis(t, ""), ""), cache.FamilyConfig{
+		Prefix:      "user:",
+		TTL:         time.Minute,
+		NotFound:    errUserNotFound,
+		NegativeTTL: time.Minute,
+	})
+
+	loaded := user{ID: 1, Name: "ronald"}
+	got, err := users.Get(ctx, "1", func(ctx context.Context) (user, error) {
+		return loaded, nil
+	})
+	if err != nil || got != loaded {
+		t.Fatalf("expected %v, got %v, %v", loaded, got, err)
+	}
+
+	got, err = users.Get(ctx, "1", func(ctx context.Context) (user, error) {
+		return user{}, errors.New("expected the cached user")
+	})
+	if err != nil || got != loaded {
+		t.Errorf("expected the cached %v, got %v, %v", loaded, got, err)
+	}
+}
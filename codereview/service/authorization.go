@@ -0,0 +1,11 @@
+package codereview_service
+
+import "kodiiing/auth"
+
+// The permission that each RPC requires.
+var (
+	rpcGetAvailableTaskToReview = auth.RPC{Name: "GetAvailableTaskToReview", Permission: auth.PermissionReviewRead}
+	rpcSubmitTaskReview         = auth.RPC{Name: "SubmitTaskReview", Permission: auth.PermissionReviewSubmit}
+	rpcSubmitReviewComment      = auth.RPC{Name: "SubmitReviewComment", Permission: auth.PermissionReviewSubmit}
+	rpcApplyAsReviewer          = auth.RPC{Name: "ApplyAsReviewer", Permission: auth.PermissionReviewApply}
+)
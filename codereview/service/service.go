@@ -3,35 +3,58 @@ package codereview_service
 import (
 	"context"
 
+	"kodiiing/auth"
 	codereview_stub "kodiiing/codereview/stub"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type CodeReviewService struct {
-	pool        *pgxpool.Pool
-	environment string
+	pool          *pgxpool.Pool
+	environment   string
+	authorization auth.Authorize
 }
 
-func NewCodeReviewService(env string, pool *pgxpool.Pool) codereview_stub.CodeReviewServiceServer {
+func NewCodeReviewService(env string, pool *pgxpool.Pool, authorization auth.Authorize) codereview_stub.CodeReviewServiceServer {
 	return &CodeReviewService{
-		pool:        pool,
-		environment: env,
+		pool:          pool,
+		environment:   env,
+		authorization: authorization,
 	}
 }
 
 func (d *CodeReviewService) GetAvailableTaskToReview(ctx context.Context, req *codereview_stub.AvailableTaskToReviewRequest) (*codereview_stub.AvailableTaskToReviewResponse, *codereview_stub.CodeReviewServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcGetAvailableTaskToReview)
+	if authErr != nil {
+		return &codereview_stub.AvailableTaskToReviewResponse{}, &codereview_stub.CodeReviewServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &codereview_stub.AvailableTaskToReviewResponse{}, nil
 }
 
 func (d *CodeReviewService) SubmitTaskReview(ctx context.Context, req *codereview_stub.SubmitTaskReviewRequest) (*codereview_stub.SubmitTaskReviewResponse, *codereview_stub.CodeReviewServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcSubmitTaskReview)
+	if authErr != nil {
+		return &codereview_stub.SubmitTaskReviewResponse{}, &codereview_stub.CodeReviewServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &codereview_stub.SubmitTaskReviewResponse{}, nil
 }
 
 func (d *CodeReviewService) SubmitReviewComment(ctx context.Context, req *codereview_stub.SubmitReviewCommentRequest) (*codereview_stub.SubmitReviewCommentResponse, *codereview_stub.CodeReviewServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcSubmitReviewComment)
+	if authErr != nil {
+		return &codereview_stub.SubmitReviewCommentResponse{}, &codereview_stub.CodeReviewServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &codereview_stub.SubmitReviewCommentResponse{}, nil
 }
 
 func (d *CodeReviewService) ApplyAsReviewer(ctx context.Context, req *codereview_stub.ApplyAsReviewerRequest) (*codereview_stub.EmptyResponse, *codereview_stub.CodeReviewServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcApplyAsReviewer)
+	if authErr != nil {
+		return &codereview_stub.EmptyResponse{}, &codereview_stub.CodeReviewServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &codereview_stub.EmptyResponse{}, nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"os"
+	"time"
 
 	"dario.cat/mergo"
 
@@ -25,12 +26,217 @@ type Config struct {
 		Port string `yaml:"port" envconfig:"SEARCH_PORT" default:"8108"`
 		Key  string `yaml:"key" envconfig:"SEARCH_KEY" default:""`
 	} `yaml:"search"`
+	Providers struct {
+		// Timeout bounds every request to a provider.
+		Timeout   time.Duration `yaml:"timeout" envconfig:"PROVIDERS_TIMEOUT" default:"10s"`
+		UserAgent string        `yaml:"user_agent" envconfig:"PROVIDERS_USER_AGENT" default:"kodiiing"`
+		// MaxRepositories caps how many repositories are fetched per user.
+		MaxRepositories int `yaml:"max_repositories" envconfig:"PROVIDERS_MAX_REPOSITORIES" default:"1000"`
+		// ResponseRetention is how long responses are kept for their ETag
+		// once they are not revalidated anymore, it should outlive
+		// Sync.StaleAfter.
+		ResponseRetention time.Duration `yaml:"response_retention" envconfig:"PROVIDERS_RESPONSE_RETENTION" default:"168h"`
+		Github            struct {
+			ClientId     string `yaml:"client_id" envconfig:"GITHUB_CLIENT_ID"`
+			ClientSecret string `yaml:"client_secret" envconfig:"GITHUB_CLIENT_SECRET"`
+			// BaseURL and APIURL point to a GitHub Enterprise Server instance,
+			// and are left empty for github.com.
+			BaseURL     string `yaml:"base_url" envconfig:"GITHUB_BASE_URL"`
+			APIURL      string `yaml:"api_url" envconfig:"GITHUB_API_URL"`
+			RedirectURL string `yaml:"redirect_url" envconfig:"GITHUB_REDIRECT_URL"`
+		} `yaml:"github"`
+		Gitlab struct {
+			ClientId     string `yaml:"client_id" envconfig:"GITLAB_CLIENT_ID"`
+			ClientSecret string `yaml:"client_secret" envconfig:"GITLAB_CLIENT_SECRET"`
+			// BaseURL points to a self-hosted instance, and is left empty for gitlab.com.
+			BaseURL     string `yaml:"base_url" envconfig:"GITLAB_BASE_URL"`
+			RedirectURL string `yaml:"redirect_url" envconfig:"GITLAB_REDIRECT_URL"`
+		} `yaml:"gitlab"`
+		// Oidc is any OpenID Connect identity provider, the endpoints
+		// are read from the issuer's discovery document.
+		Oidc struct {
+			Issuer       string `yaml:"issuer" envconfig:"OIDC_ISSUER"`
+			ClientId     string `yaml:"client_id" envconfig:"OIDC_CLIENT_ID"`
+			ClientSecret string `yaml:"client_secret" envconfig:"OIDC_CLIENT_SECRET"`
+			RedirectURL  string `yaml:"redirect_url" envconfig:"OIDC_REDIRECT_URL"`
+		} `yaml:"oidc"`
+	} `yaml:"providers"`
+	// Cache keeps users, repositories and login states between
+	// requests. The memory driver is local to every instance, run more
+	// than one instance with the redis driver.
+	Cache struct {
+		// Driver is either "memory" or "redis".
+		Driver string `yaml:"driver" envconfig:"CACHE_DRIVER" default:"memory"`
+		// MaxSizeMB caps the memory driver, zero leaves it unbounded.
+		MaxSizeMB int `yaml:"max_size_mb" envconfig:"CACHE_MAX_SIZE_MB" default:"0"`
+		Redis     struct {
+			Address  string `yaml:"address" envconfig:"CACHE_REDIS_ADDRESS" default:"localhost:6379"`
+			Password string `yaml:"password" envconfig:"CACHE_REDIS_PASSWORD"`
+			DB       int    `yaml:"db" envconfig:"CACHE_REDIS_DB" default:"0"`
+		} `yaml:"redis"`
+		UserTTL         time.Duration `yaml:"user_ttl" envconfig:"CACHE_USER_TTL" default:"3m"`
+		UserNotFoundTTL time.Duration `yaml:"user_not_found_ttl" envconfig:"CACHE_USER_NOT_FOUND_TTL" default:"30s"`
+		RepositoriesTTL time.Duration `yaml:"repositories_ttl" envconfig:"CACHE_REPOSITORIES_TTL" default:"3m"`
+		LoginStateTTL   time.Duration `yaml:"login_state_ttl" envconfig:"CACHE_LOGIN_STATE_TTL" default:"10m"`
+	} `yaml:"cache"`
+	// Sync controls the background refresh of provider profiles and
+	// repositories. A zero interval disables the worker.
+	Sync struct {
+		Interval   time.Duration `yaml:"interval" envconfig:"SYNC_INTERVAL" default:"1h"`
+		StaleAfter time.Duration `yaml:"stale_after" envconfig:"SYNC_STALE_AFTER" default:"24h"`
+		BatchSize  int           `yaml:"batch_size" envconfig:"SYNC_BATCH_SIZE" default:"50"`
+	} `yaml:"sync"`
+	// Mail is the SMTP server that outgoing email is sent through. The
+	// defaults point to the mailcrab container of docker-compose, whose
+	// inbox is at http://localhost:8025.
+	Mail struct {
+		Host     string        `yaml:"host" envconfig:"MAIL_HOST" default:"localhost"`
+		Port     uint16        `yaml:"port" envconfig:"MAIL_PORT" default:"1025"`
+		Username string        `yaml:"username" envconfig:"MAIL_USERNAME"`
+		Password string        `yaml:"password" envconfig:"MAIL_PASSWORD"`
+		From     string        `yaml:"from" envconfig:"MAIL_FROM" default:"Kodiiing <no-reply@kodiiing.localhost>"`
+		Timeout  time.Duration `yaml:"timeout" envconfig:"MAIL_TIMEOUT" default:"10s"`
+	} `yaml:"mail"`
+	// MagicLink configures the passwordless email login, which is
+	// disabled unless Key is set.
+	MagicLink struct {
+		// Key is a hex encoded HMAC key of at least 32 bytes.
+		Key string `yaml:"key" envconfig:"MAGIC_LINK_KEY"`
+		// URL is the frontend page that consumes the link.
+		URL string        `yaml:"url" envconfig:"MAGIC_LINK_URL" default:"http://localhost:3000/login/email"`
+		TTL time.Duration `yaml:"ttl" envconfig:"MAGIC_LINK_TTL" default:"15m"`
+	} `yaml:"magic_link"`
+	// Account controls the deletion of accounts. A deleted account is kept
+	// for the grace period, during which the deletion can be canceled.
+	Account struct {
+		DeletionGracePeriod time.Duration `yaml:"deletion_grace_period" envconfig:"ACCOUNT_DELETION_GRACE_PERIOD" default:"720h"`
+		PurgeInterval       time.Duration `yaml:"purge_interval" envconfig:"ACCOUNT_PURGE_INTERVAL" default:"1h"`
+		PurgeBatchSize      int           `yaml:"purge_batch_size" envconfig:"ACCOUNT_PURGE_BATCH_SIZE" default:"50"`
+	} `yaml:"account"`
+	// Sandbox runs the code of learners in isolated processes, which
+	// requires user namespaces. Within a container, the seccomp profile
+	// has to allow them.
+	Sandbox struct {
+		// WorkDir defaults to the temporary directory.
+		WorkDir string `yaml:"work_dir" envconfig:"SANDBOX_WORK_DIR"`
+		// FirstUser and Users are the range of host users that code runs
+		// as, every box taking one of its own, and FirstGroup and Groups
+		// those of their groups. They default to the ranges delegated to
+		// the user of the server in /etc/subuid and /etc/subgid, which
+		// are required when it does not run as root.
+		FirstUser  int `yaml:"first_user" envconfig:"SANDBOX_FIRST_USER" default:"0"`
+		Users      int `yaml:"users" envconfig:"SANDBOX_USERS" default:"0"`
+		FirstGroup int `yaml:"first_group" envconfig:"SANDBOX_FIRST_GROUP" default:"0"`
+		Groups     int `yaml:"groups" envconfig:"SANDBOX_GROUPS" default:"0"`
+		// Mounts are the host paths that code sees, read-only. They
+		// default to those of the built-in runtimes, which has to be
+		// changed along with the runtimes.
+		Mounts []string `yaml:"mounts" envconfig:"SANDBOX_MOUNTS"`
+		// Concurrency caps the programs that run at once, zero uses the
+		// number of CPUs.
+		Concurrency int           `yaml:"concurrency" envconfig:"SANDBOX_CONCURRENCY" default:"0"`
+		CPUTime     time.Duration `yaml:"cpu_time" envconfig:"SANDBOX_CPU_TIME" default:"5s"`
+		WallTime    time.Duration `yaml:"wall_time" envconfig:"SANDBOX_WALL_TIME" default:"10s"`
+		MemoryMB    uint64        `yaml:"memory_mb" envconfig:"SANDBOX_MEMORY_MB" default:"512"`
+		Processes   uint64        `yaml:"processes" envconfig:"SANDBOX_PROCESSES" default:"64"`
+		OutputKB    int           `yaml:"output_kb" envconfig:"SANDBOX_OUTPUT_KB" default:"64"`
+		// Runtimes change the built-in language runtimes by their name,
+		// or add new ones. Their programs must be within the mounts.
+		Runtimes []RuntimeConfig `yaml:"runtimes" ignored:"true"`
+	} `yaml:"sandbox"`
+	// Executions queues the code of learners in the database, for workers
+	// to run it in the sandbox.
+	Executions struct {
+		// Mode is either "server", where the API server runs the workers,
+		// or "standalone", where they only run with `kodiiing worker`.
+		Mode string `yaml:"mode" envconfig:"EXECUTIONS_MODE" default:"server"`
+		// Workers is how many executions an instance runs at once.
+		Workers int `yaml:"workers" envconfig:"EXECUTIONS_WORKERS" default:"2"`
+		// PollInterval is how often workers check the queue, in case they
+		// missed a notification.
+		PollInterval time.Duration `yaml:"poll_interval" envconfig:"EXECUTIONS_POLL_INTERVAL" default:"5s"`
+		// Lease is how long an execution stays locked to a worker that
+		// stopped responding, before another worker runs it.
+		Lease       time.Duration `yaml:"lease" envconfig:"EXECUTIONS_LEASE" default:"1m"`
+		MaxAttempts int           `yaml:"max_attempts" envconfig:"EXECUTIONS_MAX_ATTEMPTS" default:"3"`
+		// Retention is how long finished executions are kept.
+		Retention time.Duration `yaml:"retention" envconfig:"EXECUTIONS_RETENTION" default:"24h"`
+	} `yaml:"executions"`
+	// Audit controls how failed authentications are counted. A client
+	// that fails too often within the window is blocked for a while.
+	Audit struct {
+		// TrustedProxies are the addresses or CIDR prefixes of the proxies in
+		// front of Kodiiing. The client IP is only taken from X-Forwarded-For
+		// when the request comes from one of them, otherwise every client
+		// behind the proxy would share its address.
+		TrustedProxies     []string      `yaml:"trusted_proxies" envconfig:"AUDIT_TRUSTED_PROXIES"`
+		MaxFailuresPerIP   int           `yaml:"max_failures_per_ip" envconfig:"AUDIT_MAX_FAILURES_PER_IP" default:"20"`
+		MaxFailuresPerUser int           `yaml:"max_failures_per_user" envconfig:"AUDIT_MAX_FAILURES_PER_USER" default:"10"`
+		FailureWindow      time.Duration `yaml:"failure_window" envconfig:"AUDIT_FAILURE_WINDOW" default:"15m"`
+		BlockFor           time.Duration `yaml:"block_for" envconfig:"AUDIT_BLOCK_FOR" default:"15m"`
+	} `yaml:"audit"`
+	Jwt struct {
+		Issuer          string        `yaml:"issuer" envconfig:"JWT_ISSUER" default:"kodiiing"`
+		Subject         string        `yaml:"subject" envconfig:"JWT_SUBJECT" default:"kodiiing-user"`
+		Audience        string        `yaml:"audience" envconfig:"JWT_AUDIENCE" default:"kodiiing"`
+		AccessTokenTTL  time.Duration `yaml:"access_token_ttl" envconfig:"JWT_ACCESS_TOKEN_TTL" default:"1h"`
+		RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" envconfig:"JWT_REFRESH_TOKEN_TTL" default:"720h"`
+		// AccessKeys and RefreshKeys are ordered, the first key signs new tokens
+		// while the rest are only used for verification.
+		AccessKeys  []JwtKey `yaml:"access_keys" ignored:"true"`
+		RefreshKeys []JwtKey `yaml:"refresh_keys" ignored:"true"`
+		// AccessPrivateKey and RefreshPrivateKey hold a PEM encoded key, and are
+		// used as the signing key when set, ahead of the keys from the file.
+		AccessPrivateKey  string `yaml:"-" envconfig:"JWT_ACCESS_PRIVATE_KEY"`
+		RefreshPrivateKey string `yaml:"-" envconfig:"JWT_REFRESH_PRIVATE_KEY"`
+	} `yaml:"jwt"`
+	Secrets struct {
+		// AccessTokenKeys are hex encoded AES keys (16, 24 or 32 bytes) used to
+		// encrypt provider access tokens at rest. The key with the highest version
+		// encrypts, the others are kept for decryption until
+		// `kodiiing secrets reencrypt` has been run.
+		AccessTokenKeys []SecretKey `yaml:"access_token_keys" ignored:"true"`
+		// AccessTokenKey is the key for version 1, for setups that never rotated.
+		AccessTokenKey string `yaml:"access_token_key" envconfig:"ACCESS_TOKEN_KEY"`
+	} `yaml:"secrets"`
 	Otel struct {
 		ReceiverOtlpGrpcEndpoint string `yaml:"receiver_otlp_grpc_endpoint" envconfig:"OTEL_RECEIVER_OTLP_GRPC_ENDPOINT"`
 		ReceiverOtlpHttpEndpoint string `yaml:"receiver_otlp_http_endpoint" envconfig:"OTEL_RECEIVER_OTLP_HTTP_ENDPOINT"`
 	} `yaml:"otel"`
 }
 
+type JwtKey struct {
+	// ID is the key ID ("kid"), it defaults to the key's thumbprint.
+	ID             string `yaml:"id"`
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PrivateKey     string `yaml:"private_key"`
+}
+
+// RuntimeConfig overrides a language runtime, fields left empty keep the
+// built-in value.
+type RuntimeConfig struct {
+	Name     string             `yaml:"name"`
+	Disabled bool               `yaml:"disabled"`
+	File     string             `yaml:"file"`
+	Seed     string             `yaml:"seed"`
+	Compile  *RuntimeStepConfig `yaml:"compile"`
+	Run      RuntimeStepConfig  `yaml:"run"`
+}
+
+type RuntimeStepConfig struct {
+	Command   []string      `yaml:"command"`
+	Env       []string      `yaml:"env"`
+	CPUTime   time.Duration `yaml:"cpu_time"`
+	WallTime  time.Duration `yaml:"wall_time"`
+	MemoryMB  uint64        `yaml:"memory_mb"`
+	Processes uint64        `yaml:"processes"`
+}
+
+type SecretKey struct {
+	Version uint32 `yaml:"version"`
+	Key     string `yaml:"key"`
+}
+
 func GetConfig(configFile string) (Config, error) {
 	var configurationFromEnvironment Config
 	err := envconfig.Process("", &configurationFromEnvironment)
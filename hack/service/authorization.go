@@ -0,0 +1,11 @@
+package hack_service
+
+import "kodiiing/auth"
+
+// The permission that each RPC requires.
+// List is public, so it is not declared here.
+var (
+	rpcCreate  = auth.RPC{Name: "Create", Permission: auth.PermissionHackPost}
+	rpcUpvote  = auth.RPC{Name: "Upvote", Permission: auth.PermissionHackVote}
+	rpcComment = auth.RPC{Name: "Comment", Permission: auth.PermissionHackComment}
+)
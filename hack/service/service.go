@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 
+	"kodiiing/auth"
 	hack_stub "kodiiing/hack/stub"
 
 	"github.com/jackc/pgx/v5/pgxpool"
@@ -11,28 +12,44 @@ import (
 )
 
 type HackService struct {
-	environment string
-	db          *sql.DB
-	pool        *pgxpool.Pool
-	search      *typesense.Client
+	environment   string
+	db            *sql.DB
+	pool          *pgxpool.Pool
+	search        *typesense.Client
+	authorization auth.Authorize
 }
 
-func NewHackService(env string, pool *pgxpool.Pool, search *typesense.Client) hack_stub.HackServiceServer {
-	return &HackService{environment: env, pool: pool, search: search}
+func NewHackService(env string, pool *pgxpool.Pool, search *typesense.Client, authorization auth.Authorize) hack_stub.HackServiceServer {
+	return &HackService{environment: env, pool: pool, search: search, authorization: authorization}
 }
 
 // Starts a new hack post.
 func (d *HackService) Create(ctx context.Context, req *hack_stub.CreateRequest) (*hack_stub.CreateResponse, *hack_stub.HackServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcCreate)
+	if authErr != nil {
+		return &hack_stub.CreateResponse{}, &hack_stub.HackServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &hack_stub.CreateResponse{}, nil
 }
 
 // Upvote a hack post.
 func (d *HackService) Upvote(ctx context.Context, req *hack_stub.UpvoteRequest) (*hack_stub.UpvoteResponse, *hack_stub.HackServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcUpvote)
+	if authErr != nil {
+		return &hack_stub.UpvoteResponse{}, &hack_stub.HackServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &hack_stub.UpvoteResponse{}, nil
 }
 
 // Comment to a hack post, or reply to an existing comment.
 func (d *HackService) Comment(ctx context.Context, req *hack_stub.CommentRequest) (*hack_stub.CommentResponse, *hack_stub.HackServiceError) {
+	_, _, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcComment)
+	if authErr != nil {
+		return &hack_stub.CommentResponse{}, &hack_stub.HackServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
 	return &hack_stub.CommentResponse{}, nil
 }
 
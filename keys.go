@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	authjwt "kodiiing/auth/jwt"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// loadJwtKeys reads the configured keys in order. A PEM encoded key given
+// through the environment is put in front, so it becomes the signing key.
+func loadJwtKeys(keys []JwtKey, environmentKey string) ([]authjwt.Key, error) {
+	var out []authjwt.Key
+	if environmentKey != "" {
+		key, err := authjwt.ParsePrivateKeyPEM("", []byte(environmentKey))
+		if err != nil {
+			return nil, fmt.Errorf("parsing key from environment: %w", err)
+		}
+
+		out = append(out, key)
+	}
+
+	for i, k := range keys {
+		data := []byte(k.PrivateKey)
+		if k.PrivateKeyFile != "" {
+			content, err := os.ReadFile(k.PrivateKeyFile)
+			if err != nil {
+				return nil, fmt.Errorf("reading key #%d: %w", i, err)
+			}
+
+			data = content
+		}
+
+		key, err := authjwt.ParsePrivateKeyPEM(k.ID, data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing key #%d: %w", i, err)
+		}
+
+		out = append(out, key)
+	}
+
+	return out, nil
+}
+
+func NewAuthJwt(config Config) (*authjwt.AuthJwt, error) {
+	accessKeys, err := loadJwtKeys(config.Jwt.AccessKeys, config.Jwt.AccessPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading access keys: %w", err)
+	}
+
+	refreshKeys, err := loadJwtKeys(config.Jwt.RefreshKeys, config.Jwt.RefreshPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("loading refresh keys: %w", err)
+	}
+
+	// Spare developers from generating keys, tokens simply won't
+	// survive a restart.
+	if config.Environment == "development" {
+		if len(accessKeys) == 0 {
+			key, err := authjwt.GenerateKey()
+			if err != nil {
+				return nil, err
+			}
+
+			log.Warn().Msg("No JWT access key configured, using an ephemeral key")
+			accessKeys = append(accessKeys, key)
+		}
+
+		if len(refreshKeys) == 0 {
+			key, err := authjwt.GenerateKey()
+			if err != nil {
+				return nil, err
+			}
+
+			log.Warn().Msg("No JWT refresh key configured, using an ephemeral key")
+			refreshKeys = append(refreshKeys, key)
+		}
+	}
+
+	return authjwt.New(authjwt.Config{
+		AccessKeys:      accessKeys,
+		RefreshKeys:     refreshKeys,
+		Issuer:          config.Jwt.Issuer,
+		Subject:         config.Jwt.Subject,
+		Audience:        config.Jwt.Audience,
+		AccessTokenTTL:  config.Jwt.AccessTokenTTL,
+		RefreshTokenTTL: config.Jwt.RefreshTokenTTL,
+	})
+}
+
+func GenerateKeyAction(c *cli.Context) error {
+	key, err := authjwt.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	encoded, err := authjwt.MarshalPrivateKeyPEM(key)
+	if err != nil {
+		return err
+	}
+
+	output := c.String("output")
+	if output == "" {
+		_, err = os.Stdout.Write(encoded)
+		if err != nil {
+			return fmt.Errorf("writing key: %w", err)
+		}
+	} else {
+		err = os.WriteFile(output, encoded, 0o600)
+		if err != nil {
+			return fmt.Errorf("writing key: %w", err)
+		}
+	}
+
+	log.Info().Str("kid", key.ID).Msg("Generated Ed25519 key")
+	return nil
+}
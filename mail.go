@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	authmagiclink "kodiiing/auth/magiclink"
+	"kodiiing/mail"
+)
+
+// NewMailer builds the SMTP sender of outgoing email.
+func NewMailer(config Config) (*mail.SMTP, error) {
+	return mail.NewSMTP(mail.SMTPConfig{
+		Host:     config.Mail.Host,
+		Port:     config.Mail.Port,
+		Username: config.Mail.Username,
+		Password: config.Mail.Password,
+		From:     config.Mail.From,
+		Timeout:  config.Mail.Timeout,
+	})
+}
+
+// NewMagicLink builds the signer of the email login links, it returns
+// nil when the email login is not configured.
+func NewMagicLink(config Config) (*authmagiclink.MagicLink, error) {
+	if config.MagicLink.Key == "" {
+		return nil, nil
+	}
+
+	key, err := hex.DecodeString(config.MagicLink.Key)
+	if err != nil {
+		return nil, fmt.Errorf("decoding magic link key: %w", err)
+	}
+
+	return authmagiclink.New(authmagiclink.Config{
+		Key: key,
+		URL: config.MagicLink.URL,
+		TTL: config.MagicLink.TTL,
+	})
+}
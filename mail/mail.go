@@ -0,0 +1,200 @@
+// Package mail sends plain text email over SMTP.
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers a message.
+type Sender interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SMTPConfig configures NewSMTP.
+type SMTPConfig struct {
+	Host string
+	Port uint16
+	// Username and Password are only used when Username is set. net/smtp
+	// refuses to send them without TLS, unless the host is localhost.
+	Username string
+	Password string
+	// From is the sender address, e.g. "Kodiiing <no-reply@kodiiing.com>".
+	From string
+	// Timeout bounds a whole delivery, it defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// SMTP sends messages through an SMTP server. STARTTLS is used whenever
+// the server offers it.
+type SMTP struct {
+	address  string
+	host     string
+	username string
+	password string
+	from     *mail.Address
+	timeout  time.Duration
+}
+
+var ErrInvalidAddress = errors.New("invalid email address")
+
+func NewSMTP(config SMTPConfig) (*SMTP, error) {
+	if config.Host == "" {
+		return nil, fmt.Errorf("smtp host is required")
+	}
+
+	if config.Port == 0 {
+		config.Port = 25
+	}
+
+	from, err := mail.ParseAddress(config.From)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from: %w", ErrInvalidAddress, err)
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = time.Second * 10
+	}
+
+	return &SMTP{
+		address:  net.JoinHostPort(config.Host, strconv.Itoa(int(config.Port))),
+		host:     config.Host,
+		username: config.Username,
+		password: config.Password,
+		from:     from,
+		timeout:  config.Timeout,
+	}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, message Message) error {
+	to, err := mail.ParseAddress(message.To)
+	if err != nil {
+		return fmt.Errorf("%w: to: %w", ErrInvalidAddress, err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("dialing smtp server: %w", err)
+	}
+
+	// net/smtp does not take a context, the deadline covers the
+	// whole conversation instead.
+	if deadline, ok := ctx.Deadline(); ok {
+		err = conn.SetDeadline(deadline)
+		if err != nil {
+			_ = conn.Close()
+			return fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	client, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("creating smtp client: %w", err)
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: s.host})
+		if err != nil {
+			return fmt.Errorf("starting tls: %w", err)
+		}
+	}
+
+	if s.username != "" {
+		err = client.Auth(smtp.PlainAuth("", s.username, s.password, s.host))
+		if err != nil {
+			return fmt.Errorf("authenticating: %w", err)
+		}
+	}
+
+	err = client.Mail(s.from.Address)
+	if err != nil {
+		return fmt.Errorf("sending MAIL: %w", err)
+	}
+
+	err = client.Rcpt(to.Address)
+	if err != nil {
+		return fmt.Errorf("sending RCPT: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("sending DATA: %w", err)
+	}
+
+	_, err = w.Write(s.compose(to, message))
+	if err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return fmt.Errorf("finishing message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// compose renders the message headers and body, with CRLF line endings.
+func (s *SMTP) compose(to *mail.Address, message Message) []byte {
+	var buf bytes.Buffer
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+
+	header("From", s.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", message.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+messageId()+"@"+domain(s.from.Address)+">")
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	buf.WriteString("\r\n")
+
+	body := strings.ReplaceAll(message.Body, "\r\n", "\n")
+	buf.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+
+	return buf.Bytes()
+}
+
+func messageId() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domain(address string) string {
+	_, d, ok := strings.Cut(address, "@")
+	if !ok {
+		return "localhost"
+	}
+
+	return d
+}
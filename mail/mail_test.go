@@ -0,0 +1,155 @@
+package mail_test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"kodiiing/mail"
+	"net"
+	"strings"
+	"testing"
+)
+
+// sink is a minimal SMTP server that keeps the messages it receives.
+type sink struct {
+	listener net.Listener
+	messages chan string
+	rcpt     chan string
+}
+
+func newSink(t *testing.T) *sink {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	s := &sink{listener: listener, messages: make(chan string, 1), rcpt: make(chan string, 1)}
+	go s.serve()
+	return s
+}
+
+func (s *sink) port() uint16 {
+	return uint16(s.listener.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *sink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *sink) handle(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) {
+		_, _ = conn.Write([]byte(line + "\r\n"))
+	}
+
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(command, "MAIL FROM"):
+			reply("250 ok")
+		case strings.HasPrefix(command, "RCPT TO"):
+			s.rcpt <- strings.TrimSpace(line)
+			reply("250 ok")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				if l == ".\r\n" {
+					break
+				}
+
+				data.WriteString(l)
+			}
+			s.messages <- data.String()
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	s := newSink(t)
+
+	sender, err := mail.NewSMTP(mail.SMTPConfig{
+		Host: "127.0.0.1",
+		Port: s.port(),
+		From: "Kodiiing <no-reply@kodiiing.test>",
+	})
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	err = sender.Send(context.Background(), mail.Message{
+		To:      "student@example.com",
+		Subject: "Sign in to Kodiiing",
+		Body:    "Hello\nhttps://kodiiing.test/login?token=abc",
+	})
+	if err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+
+	rcpt := <-s.rcpt
+	if !strings.Contains(rcpt, "<student@example.com>") {
+		t.Errorf("unexpected recipient: %s", rcpt)
+	}
+
+	message := <-s.messages
+	for _, expected := range []string{
+		"From: \"Kodiiing\" <no-reply@kodiiing.test>\r\n",
+		"To: <student@example.com>\r\n",
+		"Subject: Sign in to Kodiiing\r\n",
+		"\r\n\r\nHello\r\nhttps://kodiiing.test/login?token=abc",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("message is missing %q:\n%s", expected, message)
+		}
+	}
+}
+
+func TestSendInvalidAddress(t *testing.T) {
+	sender, err := mail.NewSMTP(mail.SMTPConfig{Host: "127.0.0.1", Port: 1, From: "no-reply@kodiiing.test"})
+	if err != nil {
+		t.Fatalf("failed to create sender: %v", err)
+	}
+
+	err = sender.Send(context.Background(), mail.Message{To: "not an address"})
+	if !errors.Is(err, mail.ErrInvalidAddress) {
+		t.Errorf("error is not ErrInvalidAddress: %v", err)
+	}
+
+	_, err = mail.NewSMTP(mail.SMTPConfig{Host: "127.0.0.1", From: "nobody"})
+	if !errors.Is(err, mail.ErrInvalidAddress) {
+		t.Errorf("error is not ErrInvalidAddress: %v", err)
+	}
+}
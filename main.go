@@ -12,23 +12,29 @@ import (
 	"os/signal"
 	"time"
 
-	authjwt "kodiiing/auth/jwt"
+	"kodiiing/auth/audit"
 	authmiddleware "kodiiing/auth/middleware"
+	authprovider "kodiiing/auth/provider"
+	"kodiiing/auth/revocation"
 	authservice "kodiiing/auth/service"
 	authstub "kodiiing/auth/stub"
+	"kodiiing/cache"
+	"kodiiing/cache/invalidation"
 	codereviewservice "kodiiing/codereview/service"
 	codereviewstub "kodiiing/codereview/stub"
 	hackservice "kodiiing/hack/service"
 	hackstub "kodiiing/hack/stub"
+	"kodiiing/task/execution"
 	taskrepository "kodiiing/task/repository"
+	"kodiiing/task/sandbox"
 	taskservice "kodiiing/task/service"
 	taskstub "kodiiing/task/stub"
+	useraccount "kodiiing/user/account"
 	userservice "kodiiing/user/service"
 	userstub "kodiiing/user/stub"
 
 	hackprovider "kodiiing/hack/provider"
 
-	"github.com/allegro/bigcache/v3"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	_ "github.com/lib/pq"
@@ -37,12 +43,8 @@ import (
 	"github.com/urfave/cli/v2"
 )
 
-func ApiServer(ctx context.Context) error {
-	config, err := GetConfig("configuration-file.yml")
-	if err != nil {
-		return fmt.Errorf("getting configuration file: %w", err)
-	}
-
+// NewDatabasePool connects to the configured PostgreSQL database.
+func NewDatabasePool(ctx context.Context, config Config) (*pgxpool.Pool, error) {
 	pgxConfig, err := pgxpool.ParseConfig(fmt.Sprintf(
 		"postgres://%s:%s@%s:%d/%s?sslmode=disable",
 		config.Databases.User,
@@ -52,12 +54,26 @@ func ApiServer(ctx context.Context) error {
 		config.Databases.Name,
 	))
 	if err != nil {
-		return fmt.Errorf("error parsing database configuration: %w", err)
+		return nil, fmt.Errorf("error parsing database configuration: %w", err)
 	}
 
 	pgxPool, err := pgxpool.NewWithConfig(ctx, pgxConfig)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return pgxPool, nil
+}
+
+func ApiServer(ctx context.Context) error {
+	config, err := GetConfig("configuration-file.yml")
+	if err != nil {
+		return fmt.Errorf("getting configuration file: %w", err)
+	}
+
+	pgxPool, err := NewDatabasePool(ctx, config)
+	if err != nil {
+		return err
 	}
 	defer pgxPool.Close()
 
@@ -67,17 +83,16 @@ func ApiServer(ctx context.Context) error {
 		typesense.WithAPIKey(config.Search.Key),
 	)
 
-	// TODO: Make default eviction time configurable from the configuration file
-	memory, err := bigcache.New(context.Background(), bigcache.DefaultConfig(time.Minute*3))
+	cacheStore, err := NewCache(context.Background(), config, pgxPool)
 	if err != nil {
-		return fmt.Errorf("error creating memory cache: %w", err)
+		return fmt.Errorf("error creating cache: %w", err)
 	}
-	defer func(memory *bigcache.BigCache) {
-		err := memory.Close()
+	defer func(cacheStore cache.Cache) {
+		err := cacheStore.Close()
 		if err != nil {
-			log.Warn().Err(err).Msg("Closing memory cache")
+			log.Warn().Err(err).Msg("Closing cache")
 		}
-	}(memory)
+	}(cacheStore)
 
 	//Collection schema (Typesense)
 	errCreateCollection := hackprovider.CreateCollections(ctx, search)
@@ -90,43 +105,135 @@ func ApiServer(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("creating user profile repository: %w", err)
 	}
+	accountRepository, err := useraccount.NewAccountRepository(pgxPool, search)
+	if err != nil {
+		return fmt.Errorf("creating account repository: %w", err)
+	}
 	taskRepository := taskrepository.NewTaskRepository(&taskrepository.Dependency{
 		DB: pgxPool,
 	})
 
+	// Build lib
+	authAes, err := NewKeyRing(config)
+	if err != nil {
+		return fmt.Errorf("creating key ring: %w", err)
+	}
+
+	authJwt, err := NewAuthJwt(config)
+	if err != nil {
+		return fmt.Errorf("creating jwt: %w", err)
+	}
+
+	revocationStore, err := revocation.NewStore(pgxPool, cacheStore)
+	if err != nil {
+		return fmt.Errorf("creating revocation store: %w", err)
+	}
+
+	auditLog, err := audit.NewLog(audit.Config{
+		Pool: pgxPool,
+		IPs: audit.LimiterConfig{
+			MaxFailures: config.Audit.MaxFailuresPerIP,
+			Window:      config.Audit.FailureWindow,
+			BlockFor:    config.Audit.BlockFor,
+		},
+		Users: audit.LimiterConfig{
+			MaxFailures: config.Audit.MaxFailuresPerUser,
+			Window:      config.Audit.FailureWindow,
+			BlockFor:    config.Audit.BlockFor,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("creating audit log: %w", err)
+	}
+
+	trustedProxies, err := audit.ParseTrustedProxies(config.Audit.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("parsing trusted proxies: %w", err)
+	}
+
 	// Build service
-	authService := authservice.NewAuthService(config.Environment, pgxPool, memory)
+	providerResponseStore, err := authprovider.NewResponseStore(pgxPool)
+	if err != nil {
+		return fmt.Errorf("creating provider response store: %w", err)
+	}
 
-	// Build lib
-	// TODO: change this into the actual value
-	authJwt := authjwt.NewJwt(
-		[]byte("todo_private_key"),
-		[]byte("todo_public_key"),
-		[]byte("todo_refresh_private_key"),
-		[]byte("todo_refresh_public_key"),
-		"todo_issuer",
-		"todo_subject",
-		"todo_audience",
-	)
+	authProviders, err := NewAuthProviders(config, providerResponseStore)
+	if err != nil {
+		return fmt.Errorf("creating auth providers: %w", err)
+	}
+
+	mailer, err := NewMailer(config)
+	if err != nil {
+		return fmt.Errorf("creating mailer: %w", err)
+	}
+
+	magicLink, err := NewMagicLink(config)
+	if err != nil {
+		return fmt.Errorf("creating magic link: %w", err)
+	}
+
+	authService, err := authservice.NewAuthService(&authservice.Config{
+		Environment: config.Environment,
+		Pool:        pgxPool,
+		Cache:       cacheStore,
+		CacheTTL:    NewCacheTTL(config),
+		Aes:         authAes,
+		Jwt:         authJwt,
+		Revocation:  revocationStore,
+		Audit:       auditLog,
+		Providers:   authProviders,
+		MagicLink:   magicLink,
+		Mailer:      mailer,
+	})
+	if err != nil {
+		return fmt.Errorf("creating auth service: %w", err)
+	}
 
 	// Build middleware
-	authMiddleware := authmiddleware.NewAuthMiddleware(authService, authJwt)
+	authMiddleware := authmiddleware.NewAuthMiddleware(authService, authJwt, revocationStore, auditLog)
+
+	languages, err := NewLanguages(config)
+	if err != nil {
+		return fmt.Errorf("creating language runtimes: %w", err)
+	}
+
+	executionListener, err := execution.NewListener(pgxPool)
+	if err != nil {
+		return fmt.Errorf("creating execution listener: %w", err)
+	}
+
+	var executionWorker *execution.Worker
+	switch config.Executions.Mode {
+	case executionsInServer:
+		executionWorker, err = NewExecutionWorker(config, taskRepository, executionListener)
+		if err != nil {
+			return fmt.Errorf("creating execution worker: %w", err)
+		}
+	case executionsStandalone:
+	default:
+		return fmt.Errorf("unknown executions mode: %q", config.Executions.Mode)
+	}
 
 	taskService, err := taskservice.NewTaskService(&taskservice.Config{
 		Pool:           pgxPool,
-		Authentication: authMiddleware,
+		Authorization:  authMiddleware,
 		TaskRepository: taskRepository,
+		Languages:      languages,
+		Executions:     executionListener,
+		Cache:          cacheStore,
 	})
 	if err != nil {
 		return fmt.Errorf("creating task service: %w", err)
 	}
 
 	app := chi.NewRouter()
+	app.Use(audit.Middleware(trustedProxies))
 
-	app.Mount("/Hack", hackstub.NewHackServiceServer(hackservice.NewHackService(config.Environment, pgxPool, search)))
-	app.Mount("/User", userstub.NewUserServiceServer(userservice.NewUserService(config.Environment, userProfileRepository)))
+	app.Get("/.well-known/jwks.json", authJwt.ServeJWKS)
+	app.Mount("/Hack", hackstub.NewHackServiceServer(hackservice.NewHackService(config.Environment, pgxPool, search, authMiddleware)))
+	app.Mount("/User", userstub.NewUserServiceServer(userservice.NewUserService(config.Environment, userProfileRepository, accountRepository, config.Account.DeletionGracePeriod, authMiddleware)))
 	app.Mount("/Auth", authstub.NewAuthenticationServiceServer(authService))
-	app.Mount("/CodeReview", codereviewstub.NewCodeReviewServiceServer(codereviewservice.NewCodeReviewService(config.Environment, pgxPool)))
+	app.Mount("/CodeReview", codereviewstub.NewCodeReviewServiceServer(codereviewservice.NewCodeReviewService(config.Environment, pgxPool, authMiddleware)))
 	app.Mount("/Task", taskstub.NewTaskServiceServer(taskService))
 
 	server := &http.Server{
@@ -147,6 +254,52 @@ func ApiServer(ctx context.Context) error {
 		HttpExporterEndpoint: config.Otel.ReceiverOtlpHttpEndpoint,
 	})
 
+	backgroundCtx, backgroundCancel := context.WithCancel(context.Background())
+	defer backgroundCancel()
+
+	invalidationListener, err := invalidation.NewListener(pgxPool, cacheStore)
+	if err != nil {
+		return fmt.Errorf("creating invalidation listener: %w", err)
+	}
+
+	go invalidationListener.Run(backgroundCtx)
+	go executionListener.Run(backgroundCtx)
+	go taskRepository.RunPruner(backgroundCtx, time.Hour, config.Executions.Retention)
+	go revocationStore.RunSweeper(backgroundCtx, time.Hour)
+	go providerResponseStore.RunPruner(backgroundCtx, time.Hour, config.Providers.ResponseRetention)
+	go auditLog.RunSweeper(backgroundCtx, time.Minute*5)
+
+	if config.Account.PurgeInterval > 0 {
+		go accountRepository.RunPurger(backgroundCtx, config.Account.PurgeInterval, config.Account.PurgeBatchSize)
+	}
+
+	if config.Sync.Interval > 0 {
+		syncer, err := authservice.NewSyncer(&authservice.SyncConfig{
+			Pool:      pgxPool,
+			Cache:     cacheStore,
+			CacheTTL:  NewCacheTTL(config),
+			Aes:       authAes,
+			Providers: authProviders,
+		})
+		if err != nil {
+			return fmt.Errorf("creating syncer: %w", err)
+		}
+
+		go syncer.RunWorker(backgroundCtx, config.Sync.Interval, config.Sync.StaleAfter, config.Sync.BatchSize)
+	}
+
+	// The workers are waited for on shutdown, so that they queue their
+	// executions again while the database is still reachable.
+	workerDone := make(chan struct{})
+	if executionWorker != nil {
+		go func() {
+			defer close(workerDone)
+			executionWorker.Run(backgroundCtx)
+		}()
+	} else {
+		close(workerDone)
+	}
+
 	go func() {
 		log.Info().Msgf("Listening on port: %s", config.Port)
 		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
@@ -172,6 +325,9 @@ func ApiServer(ctx context.Context) error {
 		log.Printf("error during shutting down server: %v", err)
 	}
 
+	backgroundCancel()
+	<-workerDone
+
 	for _, shutDownFunc := range telemetryShutDownFuncs {
 		err := shutDownFunc(shutdownCtx)
 		if err != nil {
@@ -229,6 +385,113 @@ func App() *cli.App {
 				},
 				Subcommands: []*cli.Command{},
 			},
+			{
+				Name:        "worker",
+				Description: "Runs the queued code executions, for servers whose executions mode is standalone.",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "workers",
+						Usage: "how many executions run at once, instead of the configured number",
+					},
+				},
+				Action: WorkerAction,
+			},
+			{
+				Name:        "keys",
+				Description: "Signing key management",
+				Subcommands: []*cli.Command{
+					{
+						Name:        "generate",
+						Description: "Generates a new Ed25519 key pair for signing tokens, printed as PEM.",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:      "output",
+								Aliases:   []string{"o"},
+								Usage:     "write the private key into a file instead of stdout",
+								TakesFile: true,
+							},
+						},
+						Action: GenerateKeyAction,
+					},
+				},
+			},
+			{
+				Name:        "secrets",
+				Description: "Encryption key management",
+				Subcommands: []*cli.Command{
+					{
+						Name:        "reencrypt",
+						Description: "Re-encrypts every stored provider token with the newest access token key.",
+						Action:      ReencryptAction,
+					},
+				},
+			},
+			{
+				Name:        "sync",
+				Description: "Provider data synchronization",
+				Subcommands: []*cli.Command{
+					{
+						Name:        "users",
+						Description: "Re-fetches the profile and repositories of users from their provider.",
+						Flags: []cli.Flag{
+							&cli.Int64Flag{
+								Name:  "user-id",
+								Usage: "only sync the given user",
+							},
+							&cli.BoolFlag{
+								Name:  "all",
+								Usage: "sync every user, not only the stale ones",
+							},
+							&cli.IntFlag{
+								Name:  "limit",
+								Usage: "maximum number of users to sync",
+								Value: 1000,
+							},
+						},
+						Action: SyncUsersAction,
+					},
+				},
+			},
+			{
+				Name:        "roles",
+				Description: "User role management",
+				Subcommands: []*cli.Command{
+					{
+						Name:        "grant",
+						Description: "Grants a role to a user, use it to bootstrap the first admin.",
+						Flags: []cli.Flag{
+							&cli.Int64Flag{
+								Name:     "user-id",
+								Usage:    "the user to change",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "role",
+								Usage:    "one of learner, reviewer, task_author, moderator or admin",
+								Required: true,
+							},
+						},
+						Action: GrantRoleAction,
+					},
+					{
+						Name:        "revoke",
+						Description: "Revokes a role from a user.",
+						Flags: []cli.Flag{
+							&cli.Int64Flag{
+								Name:     "user-id",
+								Usage:    "the user to change",
+								Required: true,
+							},
+							&cli.StringFlag{
+								Name:     "role",
+								Usage:    "one of learner, reviewer, task_author, moderator or admin",
+								Required: true,
+							},
+						},
+						Action: RevokeRoleAction,
+					},
+				},
+			},
 			{
 				Name:        "migrate",
 				Description: "Database migration",
@@ -308,6 +571,9 @@ func App() *cli.App {
 }
 
 func main() {
+	// The sandbox executes this binary to start the code of learners.
+	sandbox.Init()
+
 	err := App().Run(os.Args)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Running application")
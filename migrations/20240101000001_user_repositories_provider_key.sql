@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Repository IDs are only unique within a provider.
+CREATE UNIQUE INDEX IF NOT EXISTS user_repositories_provider_repository_id ON user_repositories (provider, repository_id);
+DROP INDEX IF EXISTS user_repositories_repository_id;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE UNIQUE INDEX IF NOT EXISTS user_repositories_repository_id ON user_repositories (repository_id);
+DROP INDEX IF EXISTS user_repositories_provider_repository_id;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Provider IDs are kept as the provider returns them, OpenID Connect
+-- subjects are opaque strings.
+ALTER TABLE users ALTER COLUMN provider_id TYPE VARCHAR(255) USING provider_id::TEXT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Fails while any user is keyed by a subject that is not numeric.
+ALTER TABLE users ALTER COLUMN provider_id TYPE INTEGER USING provider_id::INTEGER;
+-- +goose StatementEnd
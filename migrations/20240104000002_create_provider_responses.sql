@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Provider responses are revalidated by their ETag on the next sync, which
+-- is further away than any cache TTL.
+CREATE TABLE IF NOT EXISTS provider_responses (
+    key TEXT PRIMARY KEY,
+    etag TEXT NOT NULL,
+    header JSONB NOT NULL,
+    body BYTEA NOT NULL,
+    validated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS provider_responses_validated_at ON provider_responses (validated_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS provider_responses_validated_at;
+DROP TABLE IF EXISTS provider_responses;
+-- +goose StatementEnd
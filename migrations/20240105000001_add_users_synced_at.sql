@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS synced_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS users_synced_at ON users (synced_at NULLS FIRST);
+
+-- Provider tokens that expire are refreshed on sync with the stored
+-- refresh token. Tokens without an expiry are left NULL.
+ALTER TABLE user_accesstoken ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE user_accesstoken DROP COLUMN IF EXISTS expires_at;
+DROP INDEX IF EXISTS users_synced_at;
+ALTER TABLE users DROP COLUMN IF EXISTS synced_at;
+-- +goose StatementEnd
@@ -0,0 +1,56 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS user_identities (
+    id BIGSERIAL PRIMARY KEY,
+    user_id BIGINT NOT NULL,
+    provider SMALLINT NOT NULL,
+    provider_id VARCHAR(255) NOT NULL,
+    username VARCHAR(127) NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    linked_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_by VARCHAR(63) NOT NULL DEFAULT 'system',
+    CONSTRAINT user_identities_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_provider_id ON user_identities (provider, provider_id);
+
+-- A user has at most one identity per provider.
+CREATE UNIQUE INDEX IF NOT EXISTS user_identities_user_id_provider ON user_identities (user_id, provider);
+
+INSERT INTO user_identities (user_id, provider, provider_id, username, email, linked_at)
+SELECT id, provider, provider_id, username, email, registered_at FROM users
+ON CONFLICT DO NOTHING;
+
+-- A user that was merged into another one is kept as a tombstone,
+-- so tokens issued to it resolve to the user it was merged into.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS merged_into BIGINT;
+ALTER TABLE users ADD CONSTRAINT users_merged_into_fkey FOREIGN KEY (merged_into) REFERENCES users (id) ON DELETE SET NULL;
+-- Merged users give up their provider key, the identity belongs to the
+-- user they were merged into and may become its primary one.
+ALTER TABLE users ALTER COLUMN provider_id DROP NOT NULL;
+
+-- Provider tokens are stored per identity.
+ALTER TABLE user_accesstoken ADD COLUMN IF NOT EXISTS provider SMALLINT;
+UPDATE user_accesstoken SET provider = users.provider FROM users WHERE users.id = user_accesstoken.user_id;
+ALTER TABLE user_accesstoken ALTER COLUMN provider SET NOT NULL;
+DROP INDEX IF EXISTS user_accesstoken_user_id;
+CREATE UNIQUE INDEX IF NOT EXISTS user_accesstoken_user_id_provider ON user_accesstoken (user_id, provider);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM user_accesstoken USING users WHERE users.id = user_accesstoken.user_id AND users.provider <> user_accesstoken.provider;
+DROP INDEX IF EXISTS user_accesstoken_user_id_provider;
+CREATE UNIQUE INDEX IF NOT EXISTS user_accesstoken_user_id ON user_accesstoken (user_id);
+ALTER TABLE user_accesstoken DROP COLUMN IF EXISTS provider;
+-- The keys of merged users are kept by the identities of the users they
+-- were merged into, and are not restored.
+UPDATE users SET provider_id = 'merged:' || id WHERE provider_id IS NULL;
+ALTER TABLE users ALTER COLUMN provider_id SET NOT NULL;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_merged_into_fkey;
+ALTER TABLE users DROP COLUMN IF EXISTS merged_into;
+DROP INDEX IF EXISTS user_identities_user_id_provider;
+DROP INDEX IF EXISTS user_identities_provider_id;
+DROP TABLE IF EXISTS user_identities;
+-- +goose StatementEnd
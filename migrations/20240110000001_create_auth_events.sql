@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Events are only ever inserted. user_id has no foreign key, so the
+-- events of a deleted user are removed by the account purge.
+CREATE TABLE IF NOT EXISTS auth_events (
+    id BIGSERIAL PRIMARY KEY,
+    type VARCHAR(31) NOT NULL,
+    outcome VARCHAR(15) NOT NULL,
+    user_id BIGINT NULL,
+    provider SMALLINT NULL,
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent VARCHAR(511) NOT NULL DEFAULT '',
+    detail VARCHAR(511) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS auth_events_user_id ON auth_events (user_id, id);
+
+CREATE INDEX IF NOT EXISTS auth_events_ip ON auth_events (ip, id);
+
+CREATE INDEX IF NOT EXISTS auth_events_created_at ON auth_events (created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS auth_events_created_at;
+DROP INDEX IF EXISTS auth_events_ip;
+DROP INDEX IF EXISTS auth_events_user_id;
+DROP TABLE IF EXISTS auth_events;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deletion_scheduled_at TIMESTAMPTZ NULL;
+
+CREATE INDEX IF NOT EXISTS users_deletion_scheduled_at ON users (deletion_scheduled_at) WHERE deletion_scheduled_at IS NOT NULL;
+
+-- Personal data goes away with the user, authored tasks are kept
+-- without their author.
+ALTER TABLE user_profiles DROP CONSTRAINT IF EXISTS user_profiles_user_id_fkey;
+ALTER TABLE user_profiles ADD CONSTRAINT user_profiles_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE user_tasks DROP CONSTRAINT IF EXISTS user_tasks_user_id_fkey;
+ALTER TABLE user_tasks ADD CONSTRAINT user_tasks_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_author_fkey;
+ALTER TABLE tasks ADD CONSTRAINT tasks_author_fkey FOREIGN KEY (author) REFERENCES users (id) ON DELETE SET NULL;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_author_fkey;
+ALTER TABLE tasks ADD CONSTRAINT tasks_author_fkey FOREIGN KEY (author) REFERENCES users (id);
+
+ALTER TABLE user_tasks DROP CONSTRAINT IF EXISTS user_tasks_user_id_fkey;
+ALTER TABLE user_tasks ADD CONSTRAINT user_tasks_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE user_profiles DROP CONSTRAINT IF EXISTS user_profiles_user_id_fkey;
+ALTER TABLE user_profiles ADD CONSTRAINT user_profiles_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id);
+
+DROP INDEX IF EXISTS users_deletion_scheduled_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_scheduled_at;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- The languages that a solution of the task may be written in, a task
+-- without languages accepts every language.
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS languages TEXT[] NOT NULL DEFAULT '{}';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE tasks DROP COLUMN IF EXISTS languages;
+-- +goose StatementEnd
@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- weight is the share of the grade that a test case is worth, and
+-- time_limit_ms overrides the wall-clock limit of the runtime.
+ALTER TABLE task_test_cases ADD COLUMN IF NOT EXISTS weight INTEGER NOT NULL DEFAULT 1 CHECK (weight >= 0);
+ALTER TABLE task_test_cases ADD COLUMN IF NOT EXISTS time_limit_ms INTEGER NULL CHECK (time_limit_ms > 0);
+-- comparison is one of the task.COMPARISON_* modes, tolerance is only
+-- used when comparing numbers.
+ALTER TABLE task_test_cases ADD COLUMN IF NOT EXISTS comparison SMALLINT NOT NULL DEFAULT 0;
+ALTER TABLE task_test_cases ADD COLUMN IF NOT EXISTS tolerance DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (tolerance >= 0);
+ALTER TABLE task_test_cases ADD COLUMN IF NOT EXISTS created_by VARCHAR(63) NOT NULL DEFAULT 'system';
+ALTER TABLE task_test_cases ADD COLUMN IF NOT EXISTS updated_by VARCHAR(63) NOT NULL DEFAULT 'system';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE task_test_cases DROP COLUMN IF EXISTS updated_by;
+ALTER TABLE task_test_cases DROP COLUMN IF EXISTS created_by;
+ALTER TABLE task_test_cases DROP COLUMN IF EXISTS tolerance;
+ALTER TABLE task_test_cases DROP COLUMN IF EXISTS comparison;
+ALTER TABLE task_test_cases DROP COLUMN IF EXISTS time_limit_ms;
+ALTER TABLE task_test_cases DROP COLUMN IF EXISTS weight;
+-- +goose StatementEnd
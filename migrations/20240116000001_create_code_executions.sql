@@ -0,0 +1,78 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- code_executions is the queue of the code sent by learners. Workers claim
+-- the oldest queued execution with SELECT ... FOR UPDATE SKIP LOCKED, and
+-- hold it until locked_until, which they extend while running it.
+CREATE TABLE IF NOT EXISTS code_executions (
+    id BIGSERIAL PRIMARY KEY,
+    task_id BIGINT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    language VARCHAR(63) NOT NULL,
+    code TEXT NOT NULL,
+    -- 0 queued, 1 running, 2 completed, 3 failed.
+    status SMALLINT NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    worker VARCHAR(255) NULL,
+    locked_until TIMESTAMPTZ NULL,
+    output TEXT NOT NULL DEFAULT '',
+    allowed_to_submit BOOLEAN NOT NULL DEFAULT FALSE,
+    error TEXT NOT NULL DEFAULT '',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    started_at TIMESTAMPTZ NULL,
+    finished_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_executions_pending ON code_executions (id) WHERE status IN (0, 1);
+CREATE INDEX IF NOT EXISTS idx_code_executions_finished_at ON code_executions (finished_at);
+
+-- code_execution_test_cases copies the test cases of the task when an
+-- execution is queued, so that every attempt runs the same ones in the
+-- same order, whatever happens to the task meanwhile.
+CREATE TABLE IF NOT EXISTS code_execution_test_cases (
+    execution_id BIGINT NOT NULL REFERENCES code_executions(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    test_case_id BIGINT NOT NULL,
+    input TEXT NOT NULL DEFAULT '',
+    expected TEXT NOT NULL DEFAULT '',
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    weight INTEGER NOT NULL DEFAULT 1,
+    time_limit_ms INTEGER NULL,
+    comparison SMALLINT NOT NULL DEFAULT 0,
+    tolerance DOUBLE PRECISION NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (execution_id, position)
+);
+
+-- code_execution_results holds the result of every test case, as soon as it
+-- has run. The test case is copied, so that changing it does not change
+-- past results.
+CREATE TABLE IF NOT EXISTS code_execution_results (
+    execution_id BIGINT NOT NULL REFERENCES code_executions(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    test_case_id BIGINT NOT NULL,
+    hidden BOOLEAN NOT NULL DEFAULT FALSE,
+    input TEXT NOT NULL DEFAULT '',
+    expected TEXT NOT NULL DEFAULT '',
+    -- output is what the program printed, details adds its errors and
+    -- why it was stopped.
+    output TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL DEFAULT FALSE,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (execution_id, position)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS code_execution_results;
+DROP TABLE IF EXISTS code_execution_test_cases;
+DROP INDEX IF EXISTS idx_code_executions_finished_at;
+DROP INDEX IF EXISTS idx_code_executions_pending;
+DROP TABLE IF EXISTS code_executions;
+-- +goose StatementEnd
@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A track is an ordered list of tasks that a learner goes through.
+CREATE TABLE IF NOT EXISTS tracks (
+    id BIGSERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    description VARCHAR(511) NOT NULL DEFAULT '',
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_by VARCHAR(63) NOT NULL DEFAULT 'system',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_by VARCHAR(63) NOT NULL DEFAULT 'system'
+);
+
+CREATE TABLE IF NOT EXISTS track_tasks (
+    track_id BIGINT NOT NULL REFERENCES tracks(id) ON DELETE CASCADE,
+    task_id BIGINT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+
+    PRIMARY KEY (track_id, task_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_track_tasks_task_id ON track_tasks (task_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_track_tasks_task_id;
+DROP TABLE IF EXISTS track_tasks;
+DROP TABLE IF EXISTS tracks;
+-- +goose StatementEnd
@@ -0,0 +1,98 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A learner starts a task once. StartTask could not insert any row so far,
+-- duplicates are not expected, but the oldest one is kept if there are.
+DELETE FROM user_tasks AS duplicate
+    USING user_tasks AS original
+    WHERE duplicate.task_id = original.task_id
+        AND duplicate.user_id = original.user_id
+        AND duplicate.id > original.id;
+
+DROP INDEX IF EXISTS idx_user_task_id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_tasks_task_id_user_id ON user_tasks (task_id, user_id);
+
+-- task_submissions holds the final solution of a learner to a task, which
+-- is graded by running it against every test case.
+CREATE TABLE IF NOT EXISTS task_submissions (
+    id BIGSERIAL PRIMARY KEY,
+    task_id BIGINT NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    language VARCHAR(63) NOT NULL,
+    code TEXT NOT NULL,
+
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- A task may be submitted again until a submission passes, every
+-- submission is kept.
+CREATE INDEX IF NOT EXISTS idx_task_submissions_task_id_user_id ON task_submissions (task_id, user_id, id);
+
+-- The grade is written once, by the worker that ran the submission.
+CREATE TABLE IF NOT EXISTS task_submission_grades (
+    submission_id BIGINT PRIMARY KEY REFERENCES task_submissions(id) ON DELETE CASCADE,
+    -- score is the share of the weight of the test cases that passed.
+    score DOUBLE PRECISION NOT NULL CHECK (score >= 0 AND score <= 1),
+    passed BOOLEAN NOT NULL,
+    passed_weight BIGINT NOT NULL,
+    total_weight BIGINT NOT NULL,
+    output TEXT NOT NULL DEFAULT '',
+
+    graded_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS task_submission_results (
+    submission_id BIGINT NOT NULL REFERENCES task_submissions(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL,
+    test_case_id BIGINT NOT NULL,
+    hidden BOOLEAN NOT NULL,
+    weight INTEGER NOT NULL,
+    output TEXT NOT NULL DEFAULT '',
+    success BOOLEAN NOT NULL,
+
+    PRIMARY KEY (submission_id, position)
+);
+
+-- Submissions, grades and results never change. Only the owner of a
+-- submission may, when accounts are merged.
+CREATE OR REPLACE FUNCTION reject_task_submission_changes() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_TABLE_NAME = 'task_submissions' AND (to_jsonb(NEW) - 'user_id') = (to_jsonb(OLD) - 'user_id') THEN
+        RETURN NEW;
+    END IF;
+
+    RAISE EXCEPTION '% is immutable', TG_TABLE_NAME;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER task_submissions_immutable BEFORE UPDATE ON task_submissions
+    FOR EACH ROW EXECUTE FUNCTION reject_task_submission_changes();
+CREATE TRIGGER task_submission_grades_immutable BEFORE UPDATE ON task_submission_grades
+    FOR EACH ROW EXECUTE FUNCTION reject_task_submission_changes();
+CREATE TRIGGER task_submission_results_immutable BEFORE UPDATE ON task_submission_results
+    FOR EACH ROW EXECUTE FUNCTION reject_task_submission_changes();
+
+-- An execution with a submission grades it once it completes.
+ALTER TABLE code_executions ADD COLUMN IF NOT EXISTS submission_id BIGINT NULL REFERENCES task_submissions(id) ON DELETE CASCADE;
+ALTER TABLE code_execution_results ADD COLUMN IF NOT EXISTS weight INTEGER NOT NULL DEFAULT 1;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE code_execution_results DROP COLUMN IF EXISTS weight;
+ALTER TABLE code_executions DROP COLUMN IF EXISTS submission_id;
+
+DROP TRIGGER IF EXISTS task_submission_results_immutable ON task_submission_results;
+DROP TRIGGER IF EXISTS task_submission_grades_immutable ON task_submission_grades;
+DROP TRIGGER IF EXISTS task_submissions_immutable ON task_submissions;
+DROP FUNCTION IF EXISTS reject_task_submission_changes();
+
+DROP TABLE IF EXISTS task_submission_results;
+DROP TABLE IF EXISTS task_submission_grades;
+DROP INDEX IF EXISTS idx_task_submissions_task_id_user_id;
+DROP TABLE IF EXISTS task_submissions;
+
+DROP INDEX IF EXISTS idx_user_tasks_task_id_user_id;
+CREATE INDEX IF NOT EXISTS idx_user_task_id ON user_tasks (task_id, user_id);
+-- +goose StatementEnd
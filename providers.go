@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"kodiiing/auth"
+	authprovider "kodiiing/auth/provider"
+	"kodiiing/auth/provider/github"
+	"kodiiing/auth/provider/gitlab"
+	"kodiiing/auth/provider/oidc"
+)
+
+// NewAuthProviders builds every configured identity provider.
+// Providers without a client ID are left out.
+func NewAuthProviders(config Config, providerResponseCache authprovider.ResponseCache) (map[auth.Provider]authprovider.Authentication, error) {
+	authProviders := map[auth.Provider]authprovider.Authentication{}
+	providerHttpClient := &http.Client{Timeout: config.Providers.Timeout}
+	if config.Providers.Github.ClientId != "" {
+		githubProvider, err := github.New(github.Config{
+			ClientId:     config.Providers.Github.ClientId,
+			ClientSecret: config.Providers.Github.ClientSecret,
+			BaseURL:      config.Providers.Github.BaseURL,
+			APIURL:       config.Providers.Github.APIURL,
+			RedirectURL:  config.Providers.Github.RedirectURL,
+			HTTPClient:   providerHttpClient,
+			UserAgent:    config.Providers.UserAgent,
+
+			ResponseCache:   providerResponseCache,
+			MaxRepositories: config.Providers.MaxRepositories,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating github provider: %w", err)
+		}
+
+		authProviders[auth.ProviderGithub] = githubProvider
+	}
+	if config.Providers.Gitlab.ClientId != "" {
+		gitlabProvider, err := gitlab.New(gitlab.Config{
+			ClientId:     config.Providers.Gitlab.ClientId,
+			ClientSecret: config.Providers.Gitlab.ClientSecret,
+			BaseURL:      config.Providers.Gitlab.BaseURL,
+			RedirectURL:  config.Providers.Gitlab.RedirectURL,
+			HTTPClient:   providerHttpClient,
+			UserAgent:    config.Providers.UserAgent,
+
+			ResponseCache:   providerResponseCache,
+			MaxRepositories: config.Providers.MaxRepositories,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating gitlab provider: %w", err)
+		}
+
+		authProviders[auth.ProviderGitlab] = gitlabProvider
+	}
+	if config.Providers.Oidc.Issuer != "" && config.Providers.Oidc.ClientId != "" {
+		oidcProvider, err := oidc.New(oidc.Config{
+			Issuer:       config.Providers.Oidc.Issuer,
+			ClientId:     config.Providers.Oidc.ClientId,
+			ClientSecret: config.Providers.Oidc.ClientSecret,
+			RedirectURL:  config.Providers.Oidc.RedirectURL,
+			HTTPClient:   providerHttpClient,
+			UserAgent:    config.Providers.UserAgent,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("creating oidc provider: %w", err)
+		}
+
+		authProviders[auth.ProviderOIDC] = oidcProvider
+	}
+
+	return authProviders, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"kodiiing/auth"
+	authservice "kodiiing/auth/service"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// grantedByCommandLine is recorded as the grantor of roles that are
+// changed from the command line.
+const grantedByCommandLine = "cli"
+
+func GrantRoleAction(c *cli.Context) error {
+	return changeRoleAction(c, true)
+}
+
+func RevokeRoleAction(c *cli.Context) error {
+	return changeRoleAction(c, false)
+}
+
+// changeRoleAction grants or revokes a role directly on the database, which
+// is how the first admin gets bootstrapped. Running servers pick up the
+// change once their cached user expires.
+func changeRoleAction(c *cli.Context, grant bool) error {
+	config, err := GetConfig(c.String("configuration-file"))
+	if err != nil {
+		return fmt.Errorf("getting configuration file: %w", err)
+	}
+
+	role, err := auth.ParseRole(c.String("role"))
+	if err != nil {
+		return err
+	}
+
+	userId := c.Int64("user-id")
+	if userId == 0 {
+		return fmt.Errorf("user id is required")
+	}
+
+	pgxPool, err := NewDatabasePool(c.Context, config)
+	if err != nil {
+		return err
+	}
+	defer pgxPool.Close()
+
+	if grant {
+		err = authservice.GrantUserRole(c.Context, pgxPool, userId, role, grantedByCommandLine)
+		if err != nil {
+			return fmt.Errorf("granting role: %w", err)
+		}
+
+		log.Info().Int64("user_id", userId).Str("role", role.String()).Msg("Granted role")
+		return nil
+	}
+
+	err = authservice.RevokeUserRole(c.Context, pgxPool, userId, role)
+	if err != nil {
+		return fmt.Errorf("revoking role: %w", err)
+	}
+
+	log.Info().Int64("user_id", userId).Str("role", role.String()).Msg("Revoked role")
+	return nil
+}
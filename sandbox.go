@@ -0,0 +1,62 @@
+package main
+
+import (
+	"kodiiing/task/language"
+	"kodiiing/task/sandbox"
+)
+
+// NewSandbox builds the sandbox that runs the code of learners.
+func NewSandbox(config Config) (*sandbox.Sandbox, error) {
+	return sandbox.New(sandbox.Config{
+		WorkDir:     config.Sandbox.WorkDir,
+		Users:       sandbox.IDRange{First: config.Sandbox.FirstUser, Count: config.Sandbox.Users},
+		Groups:      sandbox.IDRange{First: config.Sandbox.FirstGroup, Count: config.Sandbox.Groups},
+		Mounts:      config.Sandbox.Mounts,
+		Concurrency: config.Sandbox.Concurrency,
+		Limits: sandbox.Limits{
+			CPUTime:     config.Sandbox.CPUTime,
+			WallTime:    config.Sandbox.WallTime,
+			MemoryBytes: config.Sandbox.MemoryMB << 20,
+			Processes:   config.Sandbox.Processes,
+			OutputBytes: config.Sandbox.OutputKB << 10,
+		},
+	})
+}
+
+// NewLanguages builds the registry of the built-in runtimes, changed by
+// the configured ones.
+func NewLanguages(config Config) (*language.Registry, error) {
+	overrides := make([]language.Override, 0, len(config.Sandbox.Runtimes))
+	for _, runtime := range config.Sandbox.Runtimes {
+		override := language.Override{
+			Runtime: language.Runtime{
+				Name: runtime.Name,
+				File: runtime.File,
+				Seed: runtime.Seed,
+				Run:  newRuntimeStep(runtime.Run),
+			},
+			Disabled: runtime.Disabled,
+		}
+		if runtime.Compile != nil {
+			compile := newRuntimeStep(*runtime.Compile)
+			override.Compile = &compile
+		}
+
+		overrides = append(overrides, override)
+	}
+
+	return language.NewRegistry(language.Merge(language.Defaults(), overrides))
+}
+
+func newRuntimeStep(config RuntimeStepConfig) language.Step {
+	return language.Step{
+		Command: config.Command,
+		Env:     config.Env,
+		Limits: sandbox.Limits{
+			CPUTime:     config.CPUTime,
+			WallTime:    config.WallTime,
+			MemoryBytes: config.MemoryMB << 20,
+			Processes:   config.Processes,
+		},
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	authaes "kodiiing/auth/aes"
+	authservice "kodiiing/auth/service"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// NewKeyRing builds the key ring that provider tokens are encrypted with.
+func NewKeyRing(config Config) (*authaes.Aes, error) {
+	var keys []authaes.Key
+	if config.Secrets.AccessTokenKey != "" {
+		secret, err := hex.DecodeString(config.Secrets.AccessTokenKey)
+		if err != nil {
+			return nil, fmt.Errorf("decoding access token key: %w", err)
+		}
+
+		keys = append(keys, authaes.Key{Version: 1, Secret: secret})
+	}
+
+	for i, k := range config.Secrets.AccessTokenKeys {
+		secret, err := hex.DecodeString(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("decoding access token key #%d: %w", i, err)
+		}
+
+		keys = append(keys, authaes.Key{Version: k.Version, Secret: secret})
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("access token key is required")
+	}
+
+	return authaes.NewKeyRing(keys)
+}
+
+func ReencryptAction(c *cli.Context) error {
+	config, err := GetConfig(c.String("configuration-file"))
+	if err != nil {
+		return fmt.Errorf("getting configuration file: %w", err)
+	}
+
+	keyRing, err := NewKeyRing(config)
+	if err != nil {
+		return fmt.Errorf("creating key ring: %w", err)
+	}
+
+	pgxPool, err := NewDatabasePool(c.Context, config)
+	if err != nil {
+		return err
+	}
+	defer pgxPool.Close()
+
+	updated, err := authservice.ReencryptUserAccessTokens(c.Context, pgxPool, keyRing)
+	if err != nil {
+		return fmt.Errorf("re-encrypting user access tokens: %w", err)
+	}
+
+	log.Info().Int64("updated", updated).Msg("Re-encrypted user access tokens")
+	return nil
+}
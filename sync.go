@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	authprovider "kodiiing/auth/provider"
+	authservice "kodiiing/auth/service"
+	"kodiiing/cache"
+
+	"github.com/rs/zerolog/log"
+	"github.com/urfave/cli/v2"
+)
+
+// SyncUsersAction syncs users from their provider once. The cache entries it
+// invalidates are notified through the database, running servers evict them
+// from their own cache.
+func SyncUsersAction(c *cli.Context) error {
+	config, err := GetConfig(c.String("configuration-file"))
+	if err != nil {
+		return fmt.Errorf("getting configuration file: %w", err)
+	}
+
+	pgxPool, err := NewDatabasePool(c.Context, config)
+	if err != nil {
+		return err
+	}
+	defer pgxPool.Close()
+
+	cacheStore, err := NewCache(context.Background(), config, pgxPool)
+	if err != nil {
+		return fmt.Errorf("error creating cache: %w", err)
+	}
+	defer func(cacheStore cache.Cache) {
+		err := cacheStore.Close()
+		if err != nil {
+			log.Warn().Err(err).Msg("Closing cache")
+		}
+	}(cacheStore)
+
+	keyRing, err := NewKeyRing(config)
+	if err != nil {
+		return fmt.Errorf("creating key ring: %w", err)
+	}
+
+	providerResponseStore, err := authprovider.NewResponseStore(pgxPool)
+	if err != nil {
+		return fmt.Errorf("creating provider response store: %w", err)
+	}
+
+	authProviders, err := NewAuthProviders(config, providerResponseStore)
+	if err != nil {
+		return fmt.Errorf("creating auth providers: %w", err)
+	}
+
+	syncer, err := authservice.NewSyncer(&authservice.SyncConfig{
+		Pool:      pgxPool,
+		Cache:     cacheStore,
+		CacheTTL:  NewCacheTTL(config),
+		Aes:       keyRing,
+		Providers: authProviders,
+	})
+	if err != nil {
+		return fmt.Errorf("creating syncer: %w", err)
+	}
+
+	if userId := c.Int64("user-id"); userId != 0 {
+		err := syncer.SyncUser(c.Context, userId)
+		if err != nil {
+			return fmt.Errorf("syncing user %d: %w", userId, err)
+		}
+
+		log.Info().Int64("user_id", userId).Msg("Synced user")
+		return nil
+	}
+
+	staleAfter := config.Sync.StaleAfter
+	if c.Bool("all") {
+		staleAfter = 0
+	}
+
+	synced, err := syncer.SyncStaleUsers(c.Context, staleAfter, c.Int("limit"))
+	if err != nil {
+		return fmt.Errorf("syncing users: %w", err)
+	}
+
+	log.Info().Int("synced", synced).Msg("Synced users")
+	return nil
+}
@@ -0,0 +1,67 @@
+// Package execution runs the queued code of learners against the test cases
+// of their task, and tells the API servers about the progress.
+//
+// Executions are queued in PostgreSQL. A Worker claims them one at a time
+// with SELECT ... FOR UPDATE SKIP LOCKED, and records the result of every
+// test case as soon as it has run. Workers either run within the API
+// server, or on their own with `kodiiing worker`.
+package execution
+
+import (
+	"context"
+	"fmt"
+	"kodiiing/task/language"
+	taskRepository "kodiiing/task/repository"
+	"kodiiing/task/sandbox"
+)
+
+// RunTestCase runs the program with the input of the test case, and
+// compares its output to the expected one. The error is only set when the
+// program could not be run.
+func RunTestCase(ctx context.Context, program *language.Program, testCase taskRepository.TestCase) (taskRepository.CodeExecutionResult, error) {
+	result, err := program.Run(ctx, []byte(testCase.Input), Limits(testCase))
+	if err != nil {
+		return taskRepository.CodeExecutionResult{}, fmt.Errorf("running test case %d: %w", testCase.Id, err)
+	}
+
+	return taskRepository.CodeExecutionResult{
+		TestCaseId: testCase.Id,
+		Hidden:     testCase.Hidden,
+		Weight:     testCase.Weight,
+		Input:      testCase.Input,
+		Expected:   testCase.Expected,
+		Output:     string(result.Stdout),
+		Details:    Describe(result, ""),
+		Success:    result.Succeeded() && testCase.Matches(string(result.Stdout)),
+	}, nil
+}
+
+// Limits are the limits that the test case overrides.
+func Limits(testCase taskRepository.TestCase) sandbox.Limits {
+	return sandbox.Limits{
+		CPUTime:  testCase.TimeLimit,
+		WallTime: testCase.TimeLimit,
+	}
+}
+
+// Describe is the output of a run, as shown to the learner: stdout, then
+// stderr, then why the program was stopped, if it was. failure is shown
+// when the program failed for any other reason.
+func Describe(result sandbox.Result, failure string) string {
+	output := string(result.Stdout) + string(result.Stderr)
+
+	switch {
+	case result.TimedOut:
+		output += "\nTime limit exceeded"
+	case result.OutputExceeded:
+		output += "\nOutput limit exceeded"
+	case result.Signal != "":
+		output += fmt.Sprintf("\nKilled: %s", result.Signal)
+	case result.ExitCode != 0 && failure != "":
+		output += "\n" + failure
+	case result.ExitCode != 0:
+		output += fmt.Sprintf("\nExited with code %d", result.ExitCode)
+	}
+
+	return output
+}
@@ -0,0 +1,138 @@
+package execution_test
+
+import (
+	"context"
+	"errors"
+	"kodiiing/task"
+	"kodiiing/task/execution"
+	"kodiiing/task/language"
+	taskRepository "kodiiing/task/repository"
+	"kodiiing/task/sandbox"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	sandbox.Init()
+	os.Exit(m.Run())
+}
+
+func TestDescribe(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   sandbox.Result
+		failure  string
+		expected string
+	}{
+		{"success", sandbox.Result{Stdout: []byte("42\n")}, "", "42\n"},
+		{"stderr", sandbox.Result{Stdout: []byte("a\n"), Stderr: []byte("b\n"), ExitCode: 1}, "", "a\nb\n\nExited with code 1"},
+		{"failure", sandbox.Result{Stderr: []byte("error\n"), ExitCode: 1}, "Compilation failed", "error\n\nCompilation failed"},
+		{"timed out", sandbox.Result{TimedOut: true, Signal: "killed"}, "", "\nTime limit exceeded"},
+		{"output exceeded", sandbox.Result{OutputExceeded: true}, "", "\nOutput limit exceeded"},
+		{"signal", sandbox.Result{Signal: "segmentation fault"}, "", "\nKilled: segmentation fault"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if described := execution.Describe(test.result, test.failure); described != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, described)
+			}
+		})
+	}
+}
+
+func TestRunTestCase(t *testing.T) {
+	registry, err := language.NewRegistry(language.Defaults())
+	if err != nil {
+		t.Fatalf("creating registry: %v", err)
+	}
+
+	python, err := registry.Get("python")
+	if errors.Is(err, language.ErrUnknown) {
+		t.Skip("python is not installed")
+	}
+
+	config := sandbox.Config{WorkDir: t.TempDir()}
+	// Root may run boxes as any users, others take the delegated ones.
+	if os.Getuid() == 0 {
+		config.Users = sandbox.IDRange{First: 200000, Count: 1000}
+	}
+
+	s, err := sandbox.New(config)
+	if errors.Is(err, sandbox.ErrUnsupported) {
+		t.Skipf("sandbox unsupported: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("creating sandbox: %v", err)
+	}
+
+	program, err := python.Build(context.Background(), s, "import time\nn = int(input())\nif n < 0:\n    time.sleep(10)\nprint(n * 2)\n")
+	if err != nil {
+		t.Fatalf("building: %v", err)
+	}
+	defer func() {
+		_ = program.Close()
+	}()
+
+	t.Run("passes", func(t *testing.T) {
+		result, err := execution.RunTestCase(context.Background(), program, taskRepository.TestCase{
+			Id:       1,
+			Input:    "21\n",
+			Expected: "42",
+			Hidden:   true,
+		})
+		if err != nil {
+			t.Fatalf("running: %v", err)
+		}
+
+		if !result.Success || result.Output != "42\n" || result.TestCaseId != 1 || !result.Hidden {
+			t.Errorf("expected the test case to pass, got %+v", result)
+		}
+	})
+
+	t.Run("compares", func(t *testing.T) {
+		result, err := execution.RunTestCase(context.Background(), program, taskRepository.TestCase{
+			Input:      "21\n",
+			Expected:   `4\d`,
+			Comparison: task.COMPARISON_REGEX,
+		})
+		if err != nil {
+			t.Fatalf("running: %v", err)
+		}
+
+		if !result.Success {
+			t.Errorf("expected the output to match the expression, got %+v", result)
+		}
+	})
+
+	t.Run("fails", func(t *testing.T) {
+		result, err := execution.RunTestCase(context.Background(), program, taskRepository.TestCase{
+			Input:    "20\n",
+			Expected: "42",
+		})
+		if err != nil {
+			t.Fatalf("running: %v", err)
+		}
+
+		if result.Success || result.Output != "40\n" {
+			t.Errorf("expected the test case to fail, got %+v", result)
+		}
+	})
+
+	t.Run("time limit", func(t *testing.T) {
+		result, err := execution.RunTestCase(context.Background(), program, taskRepository.TestCase{
+			Input:     "-1\n",
+			Expected:  "-2",
+			TimeLimit: time.Millisecond * 500,
+		})
+		if err != nil {
+			t.Fatalf("running: %v", err)
+		}
+
+		if result.Success || !strings.HasSuffix(result.Details, "Time limit exceeded") {
+			t.Errorf("expected the time limit of the test case to apply, got %+v", result)
+		}
+	})
+}
@@ -0,0 +1,200 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+	taskRepository "kodiiing/task/repository"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+// Listener wakes up whoever waits on an execution whenever it progresses,
+// and the workers whenever an execution is queued. A single connection
+// listens for the whole instance.
+//
+// Notifications may be lost, while reconnecting for instance, so waiters
+// should poll every now and then as well.
+type Listener struct {
+	pool *pgxpool.Pool
+
+	mu         sync.Mutex
+	executions map[int64]map[chan struct{}]struct{}
+	queued     map[chan struct{}]struct{}
+}
+
+func NewListener(pool *pgxpool.Pool) (*Listener, error) {
+	if pool == nil {
+		return nil, fmt.Errorf("database connection required on task/execution module")
+	}
+
+	return &Listener{
+		pool:       pool,
+		executions: make(map[int64]map[chan struct{}]struct{}),
+		queued:     make(map[chan struct{}]struct{}),
+	}, nil
+}
+
+// Subscribe returns a channel that receives a value whenever the execution
+// progresses. Wake-ups are merged while the channel is not read. Call the
+// returned function once done.
+func (l *Listener) Subscribe(id int64) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.executions[id] == nil {
+		l.executions[id] = make(map[chan struct{}]struct{})
+	}
+	l.executions[id][wake] = struct{}{}
+
+	return wake, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.executions[id], wake)
+		if len(l.executions[id]) == 0 {
+			delete(l.executions, id)
+		}
+	}
+}
+
+// Queued returns a channel that receives a value whenever an execution is
+// queued. Call the returned function once done.
+func (l *Listener) Queued() (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.queued[wake] = struct{}{}
+
+	return wake, func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		delete(l.queued, wake)
+	}
+}
+
+func (l *Listener) wakeExecution(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for wake := range l.executions[id] {
+		signal(wake)
+	}
+}
+
+func (l *Listener) wakeQueued() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for wake := range l.queued {
+		signal(wake)
+	}
+}
+
+// wakeAll is called after a reconnection, as notifications may have been
+// missed meanwhile.
+func (l *Listener) wakeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, subscribers := range l.executions {
+		for wake := range subscribers {
+			signal(wake)
+		}
+	}
+	for wake := range l.queued {
+		signal(wake)
+	}
+}
+
+func signal(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+const (
+	minBackoff = time.Second
+	maxBackoff = time.Second * 30
+)
+
+// Run listens until ctx is done, and reconnects whenever the connection is
+// lost.
+func (l *Listener) Run(ctx context.Context) {
+	backoff := minBackoff
+	for {
+		err := l.listen(ctx, func() {
+			l.wakeAll()
+			backoff = minBackoff
+		})
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Warn().Err(err).Dur("retry_in", backoff).Msg("listening for code executions")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// listen runs on a connection of its own, as a pooled connection would
+// keep listening once it is given back. onListen is called once the
+// connection listens.
+func (l *Listener) listen(ctx context.Context, onListen func()) error {
+	conn, err := pgx.ConnectConfig(ctx, l.pool.Config().ConnConfig)
+	if err != nil {
+		return fmt.Errorf("connecting: %w", err)
+	}
+	defer func() {
+		// The context may be done already.
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+
+		_ = conn.Close(closeCtx)
+	}()
+
+	for _, channel := range []string{taskRepository.CodeExecutionQueuedChannel, taskRepository.CodeExecutionProgressChannel} {
+		_, err = conn.Exec(ctx, `LISTEN `+pgx.Identifier{channel}.Sanitize())
+		if err != nil {
+			return fmt.Errorf("listening on %s: %w", channel, err)
+		}
+	}
+
+	onListen()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("waiting for notification: %w", err)
+		}
+
+		if notification.Channel == taskRepository.CodeExecutionQueuedChannel {
+			l.wakeQueued()
+			continue
+		}
+
+		id, err := strconv.ParseInt(notification.Payload, 10, 64)
+		if err != nil {
+			log.Warn().Err(err).Str("payload", notification.Payload).Msg("decoding code execution notification")
+			continue
+		}
+
+		l.wakeExecution(id)
+	}
+}
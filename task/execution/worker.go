@@ -0,0 +1,356 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/task"
+	"kodiiing/task/language"
+	taskRepository "kodiiing/task/repository"
+	"kodiiing/task/sandbox"
+	task_stub "kodiiing/task/stub"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var tracer = otel.Tracer("kodiiing/task/execution")
+
+// Worker runs queued executions on a pool of goroutines.
+type Worker struct {
+	taskRepository *taskRepository.Repository
+	sandbox        *sandbox.Sandbox
+	languages      *language.Registry
+	listener       *Listener
+
+	name         string
+	workers      int
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int32
+}
+
+type WorkerConfig struct {
+	TaskRepository *taskRepository.Repository
+	Sandbox        *sandbox.Sandbox
+	Languages      *language.Registry
+	// Listener wakes the workers up as soon as an execution is queued,
+	// they only poll without it.
+	Listener *Listener
+
+	// Name identifies the instance in the queue, it defaults to the host
+	// name and the process ID.
+	Name string
+	// Workers is how many executions run at once, one by default.
+	Workers int
+	// PollInterval is how often the queue is checked, five seconds by
+	// default.
+	PollInterval time.Duration
+	// Lease is how long an execution stays locked without news from its
+	// worker, after which another worker claims it. A minute by default.
+	Lease time.Duration
+	// MaxAttempts is how many times an execution is claimed before it is
+	// given up, three by default.
+	MaxAttempts int
+}
+
+func NewWorker(config *WorkerConfig) (*Worker, error) {
+	if config.TaskRepository == nil {
+		return nil, fmt.Errorf("taskRepository required on task/execution module")
+	}
+	if config.Sandbox == nil {
+		return nil, fmt.Errorf("sandbox required on task/execution module")
+	}
+	if config.Languages == nil {
+		return nil, fmt.Errorf("languages required on task/execution module")
+	}
+
+	name := config.Name
+	if name == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "worker"
+		}
+		name = hostname + ":" + strconv.Itoa(os.Getpid())
+	}
+
+	worker := &Worker{
+		taskRepository: config.TaskRepository,
+		sandbox:        config.Sandbox,
+		languages:      config.Languages,
+		listener:       config.Listener,
+		name:           name,
+		workers:        max(config.Workers, 1),
+		pollInterval:   config.PollInterval,
+		lease:          config.Lease,
+		maxAttempts:    int32(config.MaxAttempts),
+	}
+	if worker.pollInterval <= 0 {
+		worker.pollInterval = time.Second * 5
+	}
+	if worker.lease <= 0 {
+		worker.lease = time.Minute
+	}
+	if worker.maxAttempts <= 0 {
+		worker.maxAttempts = 3
+	}
+
+	return worker, nil
+}
+
+// Run runs executions until ctx is done. An execution that is running by
+// then is queued again, for another worker to take over.
+func (w *Worker) Run(ctx context.Context) {
+	log.Info().Str("worker", w.name).Int("workers", w.workers).Msg("running code executions")
+
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			w.loop(ctx, name)
+		}(w.name + "/" + strconv.Itoa(i))
+	}
+
+	wg.Wait()
+}
+
+func (w *Worker) loop(ctx context.Context, name string) {
+	var queued <-chan struct{}
+	if w.listener != nil {
+		var unsubscribe func()
+		queued, unsubscribe = w.listener.Queued()
+		defer unsubscribe()
+	}
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// The queue is drained before waiting again.
+		for ctx.Err() == nil {
+			claimed, err := w.claim(ctx, name)
+			if err != nil {
+				log.Error().Err(err).Str("worker", name).Msg("claiming code execution")
+				break
+			}
+			if !claimed {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-queued:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim runs the next execution of the queue, if there is one.
+func (w *Worker) claim(ctx context.Context, name string) (bool, error) {
+	execution, err := w.taskRepository.ClaimCodeExecution(ctx, name, w.lease)
+	if err != nil {
+		if errors.Is(err, taskRepository.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	w.process(ctx, name, execution)
+
+	return true, nil
+}
+
+// process runs the execution while renewing its lease, and stores how it
+// ended.
+func (w *Worker) process(ctx context.Context, name string, execution taskRepository.CodeExecution) {
+	ctx, span := tracer.Start(ctx, "Worker.process")
+	defer span.End()
+
+	span.SetAttributes(
+		attribute.Int64("execution_id", execution.Id),
+		attribute.Int64("task_id", execution.TaskId),
+		attribute.String("language", execution.Language),
+		attribute.Int("attempt", int(execution.Attempts)),
+	)
+
+	executionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go w.renew(executionCtx, cancel, name, execution.Id)
+
+	grade, err := w.execute(executionCtx, name, &execution)
+
+	switch {
+	case ctx.Err() != nil:
+		// The context of the worker is done already.
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer releaseCancel()
+
+		err := w.taskRepository.ReleaseCodeExecution(releaseCtx, execution.Id, name)
+		if err != nil && !errors.Is(err, taskRepository.ErrNoRows) {
+			log.Error().Err(err).Int64("execution_id", execution.Id).Msg("releasing code execution")
+		}
+		return
+	case executionCtx.Err() != nil:
+		// The lease was lost, another worker runs the execution now.
+		return
+	case err != nil:
+		span.SetStatus(codes.Error, "error when running code execution")
+		span.RecordError(err)
+		log.Error().Err(err).Int64("execution_id", execution.Id).Msg("running code execution")
+
+		execution.Status = task_stub.CODE_EXECUTION_STATUS_FAILED
+		execution.Error = "The code could not be run, please try again later."
+		grade = nil
+	}
+
+	err = w.taskRepository.FinishCodeExecution(ctx, execution, name, grade)
+	if err != nil && !errors.Is(err, taskRepository.ErrNoRows) {
+		span.SetStatus(codes.Error, "error when finishing code execution")
+		span.RecordError(err)
+		log.Error().Err(err).Int64("execution_id", execution.Id).Msg("finishing code execution")
+	}
+}
+
+// renew extends the lease of the execution until ctx is done, and cancels
+// it once the lease is lost.
+func (w *Worker) renew(ctx context.Context, cancel context.CancelFunc, name string, id int64) {
+	ticker := time.NewTicker(w.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := w.taskRepository.ExtendCodeExecution(ctx, id, name, w.lease)
+			if errors.Is(err, taskRepository.ErrNoRows) {
+				log.Warn().Int64("execution_id", id).Msg("lost the lease of code execution")
+				cancel()
+				return
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Warn().Err(err).Int64("execution_id", id).Msg("extending code execution")
+			}
+		}
+	}
+}
+
+// execute builds the code and runs it against every test case, recording
+// the results as they come. The results of a previous attempt are kept. It
+// sets the status and output of the execution, and returns the grade of
+// the code once it has completed. The error is only set when the code could
+// not be run.
+func (w *Worker) execute(ctx context.Context, name string, execution *taskRepository.CodeExecution) (*task.Grade, error) {
+	execution.Status = task_stub.CODE_EXECUTION_STATUS_FAILED
+	if execution.Attempts > w.maxAttempts {
+		execution.Error = fmt.Sprintf("The code could not be run after %d attempts.", w.maxAttempts)
+		return nil, nil
+	}
+
+	runtime, err := w.languages.Get(execution.Language)
+	if err != nil {
+		execution.Error = fmt.Sprintf("The %s language is not available anymore.", execution.Language)
+		return nil, nil
+	}
+
+	// The test cases were copied when the execution was queued, so the
+	// results of a previous attempt match them by position.
+	testCases, err := w.taskRepository.CodeExecutionTestCases(ctx, execution.Id)
+	if err != nil {
+		return nil, fmt.Errorf("listing test cases: %w", err)
+	}
+
+	previous, err := w.taskRepository.CodeExecutionResults(ctx, execution.Id, -1)
+	if err != nil {
+		return nil, fmt.Errorf("listing previous results: %w", err)
+	}
+	done := make(map[int32]taskRepository.CodeExecutionResult, len(previous))
+	for _, result := range previous {
+		done[result.Position] = result
+	}
+
+	program, err := runtime.Build(ctx, w.sandbox, execution.Code)
+	if err != nil {
+		return nil, fmt.Errorf("building code: %w", err)
+	}
+	defer func() {
+		err := program.Close()
+		if err != nil {
+			log.Warn().Err(err).Int64("execution_id", execution.Id).Msg("closing program")
+		}
+	}()
+
+	graded := make([]task.GradedTestCase, 0, len(testCases))
+	if !program.Compiled() {
+		for i, testCase := range testCases {
+			err := w.taskRepository.AddCodeExecutionResult(ctx, name, taskRepository.CodeExecutionResult{
+				ExecutionId: execution.Id,
+				Position:    int32(i),
+				TestCaseId:  testCase.Id,
+				Hidden:      testCase.Hidden,
+				Weight:      testCase.Weight,
+				Input:       testCase.Input,
+				Expected:    testCase.Expected,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			graded = append(graded, task.GradedTestCase{Weight: testCase.Weight})
+		}
+
+		execution.Status = task_stub.CODE_EXECUTION_STATUS_COMPLETED
+		execution.Output = Describe(*program.Compilation, "Compilation failed")
+		grade := task.GradeTestCases(graded, false)
+		return &grade, nil
+	}
+
+	execution.AllowedToSubmit = true
+	outputShown := false
+	for i, testCase := range testCases {
+		result, ok := done[int32(i)]
+		if !ok {
+			result, err = RunTestCase(ctx, program, testCase)
+			if err != nil {
+				return nil, err
+			}
+
+			result.ExecutionId = execution.Id
+			result.Position = int32(i)
+			err = w.taskRepository.AddCodeExecutionResult(ctx, name, result)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		execution.AllowedToSubmit = execution.AllowedToSubmit && result.Success
+		graded = append(graded, task.GradedTestCase{Weight: result.Weight, Passed: result.Success})
+		if !testCase.Hidden && !outputShown {
+			execution.Output = result.Details
+			outputShown = true
+		}
+	}
+
+	// The output of a hidden test case would give its input away.
+	switch {
+	case len(testCases) == 0:
+		execution.Output = "The task has no test cases."
+	case !outputShown:
+		execution.Output = "The output of hidden test cases is not shown."
+	}
+
+	execution.Status = task_stub.CODE_EXECUTION_STATUS_COMPLETED
+	grade := task.GradeTestCases(graded, execution.AllowedToSubmit)
+	return &grade, nil
+}
@@ -0,0 +1,49 @@
+package task
+
+// GradedTestCase is a test case that a submission was run against.
+type GradedTestCase struct {
+	Weight int32
+	Passed bool
+}
+
+// Grade is how well a submission did on the test cases of its task.
+type Grade struct {
+	// Score is the share of the weight of the test cases that passed,
+	// between 0 and 1.
+	Score        float64
+	PassedWeight int64
+	TotalWeight  int64
+	// Passed is set when every test case passed.
+	Passed bool
+}
+
+// GradeTestCases grades a submission by its test cases. When none of them
+// has a weight, they all weigh the same. Without test cases, the grade only
+// depends on whether the program succeeded.
+func GradeTestCases(testCases []GradedTestCase, succeeded bool) Grade {
+	grade := Grade{Passed: true}
+	passed := 0
+	for _, testCase := range testCases {
+		grade.TotalWeight += int64(testCase.Weight)
+		if testCase.Passed {
+			grade.PassedWeight += int64(testCase.Weight)
+			passed++
+		} else {
+			grade.Passed = false
+		}
+	}
+
+	switch {
+	case len(testCases) == 0:
+		grade.Passed = succeeded
+		if succeeded {
+			grade.Score = 1
+		}
+	case grade.TotalWeight == 0:
+		grade.Score = float64(passed) / float64(len(testCases))
+	default:
+		grade.Score = float64(grade.PassedWeight) / float64(grade.TotalWeight)
+	}
+
+	return grade
+}
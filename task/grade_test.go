@@ -0,0 +1,73 @@
+package task_test
+
+import (
+	"kodiiing/task"
+	"testing"
+)
+
+func TestGradeTestCases(t *testing.T) {
+	tests := []struct {
+		name      string
+		testCases []task.GradedTestCase
+		succeeded bool
+		expected  task.Grade
+	}{
+		{
+			name: "every test case passed",
+			testCases: []task.GradedTestCase{
+				{Weight: 1, Passed: true},
+				{Weight: 3, Passed: true},
+			},
+			succeeded: true,
+			expected:  task.Grade{Score: 1, PassedWeight: 4, TotalWeight: 4, Passed: true},
+		},
+		{
+			name: "weighted",
+			testCases: []task.GradedTestCase{
+				{Weight: 1, Passed: true},
+				{Weight: 3, Passed: false},
+			},
+			succeeded: true,
+			expected:  task.Grade{Score: 0.25, PassedWeight: 1, TotalWeight: 4},
+		},
+		{
+			name: "a test case without weight still has to pass",
+			testCases: []task.GradedTestCase{
+				{Weight: 2, Passed: true},
+				{Weight: 0, Passed: false},
+			},
+			succeeded: true,
+			expected:  task.Grade{Score: 1, PassedWeight: 2, TotalWeight: 2},
+		},
+		{
+			name: "no weights",
+			testCases: []task.GradedTestCase{
+				{Passed: true},
+				{Passed: false},
+				{Passed: false},
+				{Passed: true},
+			},
+			succeeded: true,
+			expected:  task.Grade{Score: 0.5},
+		},
+		{
+			name:      "no test cases",
+			succeeded: true,
+			expected:  task.Grade{Score: 1, Passed: true},
+		},
+		{
+			name:      "no test cases and a failed program",
+			succeeded: false,
+			expected:  task.Grade{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			grade := task.GradeTestCases(test.testCases, test.succeeded)
+			if grade != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, grade)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package language
+
+import (
+	"kodiiing/task/sandbox"
+	"time"
+)
+
+// Defaults are the runtimes of the languages served out of the box, with
+// the paths of the Debian packages. The Go toolchain is expected in
+// /usr/local/go, as installed from the official archive.
+func Defaults() []Runtime {
+	return []Runtime{
+		{
+			Name: "python",
+			File: "main.py",
+			Run: Step{
+				Command: []string{"/usr/bin/python3", "main.py"},
+				Env:     []string{"PYTHONDONTWRITEBYTECODE=1", "PYTHONIOENCODING=utf-8"},
+			},
+		},
+		{
+			Name: "javascript",
+			File: "main.js",
+			Run: Step{
+				Command: []string{"/usr/bin/node", "--max-old-space-size=256", "main.js"},
+				// V8 reserves its code range upfront.
+				Limits: sandbox.Limits{MemoryBytes: 1 << 30},
+			},
+		},
+		{
+			Name: "go",
+			File: "main.go",
+			// Building the standard library takes most of the time of a
+			// compilation, point Seed to a warm cache to skip it.
+			Compile: &Step{
+				Command: []string{"/usr/local/go/bin/go", "build", "-o", "main", "main.go"},
+				Env:     []string{"CGO_ENABLED=0", "GOTOOLCHAIN=local", "GOFLAGS=-buildvcs=false", "GOPROXY=off"},
+				Limits: sandbox.Limits{
+					CPUTime:     time.Second * 60,
+					WallTime:    time.Second * 120,
+					MemoryBytes: 2 << 30,
+					Processes:   256,
+				},
+			},
+			Run: Step{
+				Command: []string{"./main"},
+				Env:     []string{"GOMEMLIMIT=256MiB"},
+				// The Go runtime reserves its heap arenas upfront.
+				Limits: sandbox.Limits{MemoryBytes: 1 << 30},
+			},
+		},
+		{
+			Name: "c",
+			File: "main.c",
+			Compile: &Step{
+				Command: []string{"/usr/bin/gcc", "-O2", "-std=c17", "-o", "main", "main.c", "-lm"},
+				Limits: sandbox.Limits{
+					CPUTime:  time.Second * 10,
+					WallTime: time.Second * 20,
+				},
+			},
+			Run: Step{
+				Command: []string{"./main"},
+			},
+		},
+		{
+			Name: "java",
+			File: "Main.java",
+			Compile: &Step{
+				Command: []string{"/usr/bin/javac", "-J-Xmx256m", "-J-XX:+UseSerialGC", "-J-XX:-UsePerfData", "Main.java"},
+				Limits: sandbox.Limits{
+					CPUTime:     time.Second * 30,
+					WallTime:    time.Second * 60,
+					MemoryBytes: 4 << 30,
+					Processes:   256,
+				},
+			},
+			Run: Step{
+				Command: []string{"/usr/bin/java", "-Xmx256m", "-Xss64m", "-XX:+UseSerialGC", "-XX:-UsePerfData", "-XX:TieredStopAtLevel=1", "Main"},
+				// The JVM reserves its class space and code cache upfront.
+				Limits: sandbox.Limits{
+					MemoryBytes: 4 << 30,
+					Processes:   256,
+				},
+			},
+		},
+	}
+}
+
+// Override changes the runtime of the same name, or adds a runtime when
+// the name is new. Fields left empty keep the value of the runtime.
+type Override struct {
+	Runtime
+	// Disabled removes the runtime.
+	Disabled bool
+}
+
+// Merge applies the overrides to the runtimes, in order.
+func Merge(runtimes []Runtime, overrides []Override) []Runtime {
+	merged := append([]Runtime(nil), runtimes...)
+	for _, override := range overrides {
+		index := -1
+		for i, runtime := range merged {
+			if runtime.Name == override.Name {
+				index = i
+				break
+			}
+		}
+
+		switch {
+		case override.Disabled && index >= 0:
+			merged = append(merged[:index], merged[index+1:]...)
+		case override.Disabled:
+		case index < 0:
+			merged = append(merged, override.Runtime)
+		default:
+			merged[index] = merged[index].merge(override.Runtime)
+		}
+	}
+
+	return merged
+}
+
+func (r Runtime) merge(override Runtime) Runtime {
+	if override.File != "" {
+		r.File = override.File
+	}
+	if override.Seed != "" {
+		r.Seed = override.Seed
+	}
+	if override.Compile != nil {
+		var compile Step
+		if r.Compile != nil {
+			compile = *r.Compile
+		}
+		compile = compile.merge(*override.Compile)
+		r.Compile = &compile
+	}
+	r.Run = r.Run.merge(override.Run)
+
+	return r
+}
+
+func (s Step) merge(override Step) Step {
+	if len(override.Command) > 0 {
+		s.Command = override.Command
+	}
+	if override.Env != nil {
+		s.Env = override.Env
+	}
+	s.Limits = override.Limits.WithDefaults(s.Limits)
+
+	return s
+}
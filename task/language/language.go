@@ -0,0 +1,252 @@
+// Package language describes how the code of each programming language is
+// compiled and run in the sandbox.
+//
+// A Runtime is the recipe of a language: the file the code is written
+// to, an optional compile step, the run step and their limits. The
+// Registry holds the runtimes that are installed on the machine.
+package language
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/task/sandbox"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrUnknown is returned for a language that has no runtime.
+var ErrUnknown = errors.New("unknown language")
+
+// Step is a command that a runtime runs in a box.
+type Step struct {
+	// Command is the program followed by its arguments. A program that
+	// starts with "./" is taken from the box, e.g. what was compiled,
+	// any other is looked up in PATH.
+	Command []string
+	// Env is added to the environment of the sandbox.
+	Env []string
+	// Limits override the limits of the sandbox, for runtimes that need
+	// more, e.g. the address space that a JVM reserves.
+	Limits sandbox.Limits
+}
+
+// Runtime is how the code of a language is compiled and run.
+type Runtime struct {
+	// Name is the lower case name that requests and tasks refer to.
+	Name string
+	// File is the name that the code is written to.
+	File string
+	// Seed is a directory linked into every box before compiling, e.g.
+	// a warm build cache. It is optional.
+	Seed string
+	// Compile is nil for interpreted languages.
+	Compile *Step
+	Run     Step
+}
+
+// Registry holds the runtimes by their name.
+type Registry struct {
+	runtimes map[string]Runtime
+}
+
+// NewRegistry resolves the programs of the runtimes. Runtimes whose
+// programs are not installed are left out with a warning, so that a
+// machine only has to install the languages it serves.
+func NewRegistry(runtimes []Runtime) (*Registry, error) {
+	registry := &Registry{runtimes: make(map[string]Runtime, len(runtimes))}
+	for _, runtime := range runtimes {
+		err := runtime.validate()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := registry.runtimes[runtime.Name]; ok {
+			return nil, fmt.Errorf("duplicate runtime %s", runtime.Name)
+		}
+
+		runtime, err = runtime.resolve()
+		if err != nil {
+			log.Warn().Err(err).Str("language", runtime.Name).Msg("runtime unavailable")
+			continue
+		}
+
+		registry.runtimes[runtime.Name] = runtime
+	}
+
+	return registry, nil
+}
+
+// Get returns the runtime of the language, names are case insensitive.
+func (r *Registry) Get(name string) (Runtime, error) {
+	runtime, ok := r.runtimes[strings.ToLower(name)]
+	if !ok {
+		return Runtime{}, fmt.Errorf("%w: %s", ErrUnknown, name)
+	}
+
+	return runtime, nil
+}
+
+// Names returns the name of every available runtime, sorted.
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.runtimes))
+	for name := range r.runtimes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (r Runtime) validate() error {
+	if r.Name == "" || r.Name != strings.ToLower(r.Name) {
+		return fmt.Errorf("runtime name must be lower case and not empty: %q", r.Name)
+	}
+	if r.File == "" || strings.Contains(r.File, "/") {
+		return fmt.Errorf("runtime %s: invalid file name %q", r.Name, r.File)
+	}
+	if len(r.Run.Command) == 0 {
+		return fmt.Errorf("runtime %s: run command required", r.Name)
+	}
+	if r.Compile != nil && len(r.Compile.Command) == 0 {
+		return fmt.Errorf("runtime %s: empty compile command", r.Name)
+	}
+
+	return nil
+}
+
+// resolve turns the programs that are looked up in PATH into absolute
+// paths, as the sandbox has no PATH to look them up in.
+func (r Runtime) resolve() (Runtime, error) {
+	if r.Compile != nil {
+		compile, err := r.Compile.resolve()
+		if err != nil {
+			return r, err
+		}
+		r.Compile = &compile
+	}
+
+	run, err := r.Run.resolve()
+	if err != nil {
+		return r, err
+	}
+	r.Run = run
+
+	return r, nil
+}
+
+func (s Step) resolve() (Step, error) {
+	program := s.Command[0]
+	if strings.HasPrefix(program, "./") {
+		return s, nil
+	}
+
+	path, err := exec.LookPath(program)
+	if err != nil {
+		return s, fmt.Errorf("finding %s: %w", program, err)
+	}
+
+	path, err = filepath.Abs(path)
+	if err != nil {
+		return s, fmt.Errorf("finding %s: %w", program, err)
+	}
+
+	// The arguments are copied, the runtime may be shared.
+	s.Command = append([]string{path}, s.Command[1:]...)
+	return s, nil
+}
+
+// command is the step as a sandbox command that runs in the box.
+func (s Step) command(box *sandbox.Box, stdin []byte, limits sandbox.Limits) sandbox.Command {
+	program := s.Command[0]
+	if strings.HasPrefix(program, "./") {
+		program = filepath.Join(box.Dir(), program)
+	}
+
+	return sandbox.Command{
+		Path:   program,
+		Args:   s.Command[1:],
+		Stdin:  stdin,
+		Env:    s.Env,
+		Limits: limits.WithDefaults(s.Limits),
+	}
+}
+
+// Program is code written into a box, and compiled if its runtime has to.
+type Program struct {
+	runtime Runtime
+	box     *sandbox.Box
+	// Compilation is the result of the compile step, nil when there is
+	// none.
+	Compilation *sandbox.Result
+}
+
+// Build writes the code into a new box of the sandbox, and compiles it.
+// A compilation that fails is not an error, see Compiled. The program
+// must be closed once done with.
+func (r Runtime) Build(ctx context.Context, s *sandbox.Sandbox, code string) (*Program, error) {
+	box, err := s.Prepare(map[string][]byte{r.File: []byte(code)})
+	if err != nil {
+		return nil, err
+	}
+
+	program := &Program{runtime: r, box: box}
+	if r.Seed != "" {
+		err := box.Seed(r.Seed)
+		if err != nil {
+			_ = program.Close()
+			return nil, fmt.Errorf("seeding %s box: %w", r.Name, err)
+		}
+	}
+
+	if r.Compile == nil {
+		return program, nil
+	}
+
+	result, err := box.Run(ctx, r.Compile.command(box, nil, sandbox.Limits{}))
+	if err != nil {
+		_ = program.Close()
+		return nil, fmt.Errorf("compiling %s: %w", r.Name, err)
+	}
+
+	program.Compilation = &result
+	return program, nil
+}
+
+// Compiled tells whether the program can be run.
+func (p *Program) Compiled() bool {
+	return p.Compilation == nil || p.Compilation.Succeeded()
+}
+
+// Run runs the program with stdin as its input. The limits override those
+// of the runtime. Every run happens in a box of its own, holding a
+// read-only copy of the build, so that it sees nothing of other runs.
+func (p *Program) Run(ctx context.Context, stdin []byte, limits sandbox.Limits) (sandbox.Result, error) {
+	if !p.Compiled() {
+		return sandbox.Result{}, fmt.Errorf("running %s: program did not compile", p.runtime.Name)
+	}
+
+	box, err := p.box.Copy()
+	if err != nil {
+		return sandbox.Result{}, fmt.Errorf("running %s: %w", p.runtime.Name, err)
+	}
+	defer func() {
+		_ = box.Close()
+	}()
+
+	result, err := box.Run(ctx, p.runtime.Run.command(box, stdin, limits))
+	if err != nil {
+		return result, fmt.Errorf("running %s: %w", p.runtime.Name, err)
+	}
+
+	return result, nil
+}
+
+// Close removes the program and its box.
+func (p *Program) Close() error {
+	return p.box.Close()
+}
@@ -0,0 +1,248 @@
+package language_test
+
+import (
+	"context"
+	"errors"
+	"kodiiing/task/language"
+	"kodiiing/task/sandbox"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	sandbox.Init()
+	os.Exit(m.Run())
+}
+
+func TestMerge(t *testing.T) {
+	runtimes := []language.Runtime{
+		{
+			Name: "python",
+			File: "main.py",
+			Run:  language.Step{Command: []string{"/usr/bin/python3", "main.py"}, Env: []string{"A=1"}},
+		},
+		{
+			Name: "c",
+			File: "main.c",
+			Compile: &language.Step{
+				Command: []string{"/usr/bin/gcc", "-o", "main", "main.c"},
+				Limits:  sandbox.Limits{CPUTime: time.Second * 10},
+			},
+			Run: language.Step{Command: []string{"./main"}},
+		},
+	}
+
+	merged := language.Merge(runtimes, []language.Override{
+		{Runtime: language.Runtime{Name: "python", Run: language.Step{Command: []string{"/opt/python/bin/python3", "main.py"}}}},
+		{Runtime: language.Runtime{Name: "c", Compile: &language.Step{Limits: sandbox.Limits{WallTime: time.Second * 30}}}},
+		{Runtime: language.Runtime{Name: "ruby", File: "main.rb", Run: language.Step{Command: []string{"ruby", "main.rb"}}}},
+		{Runtime: language.Runtime{Name: "java"}, Disabled: true},
+	})
+
+	if len(merged) != 3 {
+		t.Fatalf("expected 3 runtimes, got %d", len(merged))
+	}
+
+	python := merged[0]
+	if !reflect.DeepEqual(python.Run.Command, []string{"/opt/python/bin/python3", "main.py"}) {
+		t.Errorf("expected the python command to be overridden, got %v", python.Run.Command)
+	}
+	if !reflect.DeepEqual(python.Run.Env, []string{"A=1"}) || python.File != "main.py" {
+		t.Errorf("expected the other python fields to be kept, got %+v", python)
+	}
+
+	c := merged[1]
+	if c.Compile.Limits.CPUTime != time.Second*10 || c.Compile.Limits.WallTime != time.Second*30 {
+		t.Errorf("expected the compile limits to be merged, got %+v", c.Compile.Limits)
+	}
+	if len(c.Compile.Command) != 4 {
+		t.Errorf("expected the compile command to be kept, got %v", c.Compile.Command)
+	}
+	if runtimes[1].Compile.Limits.WallTime != 0 {
+		t.Error("expected the original runtimes to be left untouched")
+	}
+
+	if merged[2].Name != "ruby" {
+		t.Errorf("expected ruby to be added, got %s", merged[2].Name)
+	}
+
+	merged = language.Merge(merged, []language.Override{{Runtime: language.Runtime{Name: "c"}, Disabled: true}})
+	if len(merged) != 2 || merged[1].Name != "ruby" {
+		t.Errorf("expected c to be removed, got %+v", merged)
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	registry, err := language.NewRegistry([]language.Runtime{
+		{Name: "shell", File: "main.sh", Run: language.Step{Command: []string{"sh", "main.sh"}}},
+		{Name: "missing", File: "main.x", Run: language.Step{Command: []string{"/does/not/exist", "main.x"}}},
+	})
+	if err != nil {
+		t.Fatalf("creating registry: %v", err)
+	}
+
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"shell"}) {
+		t.Errorf("expected only the installed runtime, got %v", names)
+	}
+
+	shell, err := registry.Get("Shell")
+	if err != nil {
+		t.Fatalf("getting shell: %v", err)
+	}
+	if shell.Run.Command[0] == "sh" {
+		t.Errorf("expected the program to be resolved, got %v", shell.Run.Command)
+	}
+
+	_, err = registry.Get("missing")
+	if !errors.Is(err, language.ErrUnknown) {
+		t.Errorf("expected ErrUnknown, got %v", err)
+	}
+}
+
+func TestRegistryRejectsInvalidRuntimes(t *testing.T) {
+	invalid := []language.Runtime{
+		{Name: "", File: "main", Run: language.Step{Command: []string{"sh"}}},
+		{Name: "Shell", File: "main", Run: language.Step{Command: []string{"sh"}}},
+		{Name: "shell", File: "../main", Run: language.Step{Command: []string{"sh"}}},
+		{Name: "shell", File: "main"},
+	}
+
+	for _, runtime := range invalid {
+		_, err := language.NewRegistry([]language.Runtime{runtime})
+		if err == nil {
+			t.Errorf("expected %+v to be rejected", runtime)
+		}
+	}
+}
+
+func newSandbox(t *testing.T) *sandbox.Sandbox {
+	t.Helper()
+
+	config := sandbox.Config{WorkDir: t.TempDir()}
+	// Root may run boxes as any users, others take the delegated ones.
+	if os.Getuid() == 0 {
+		config.Users = sandbox.IDRange{First: 200000, Count: 1000}
+	}
+
+	s, err := sandbox.New(config)
+	if errors.Is(err, sandbox.ErrUnsupported) {
+		t.Skipf("sandbox unsupported: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("creating sandbox: %v", err)
+	}
+
+	return s
+}
+
+func TestBuildAndRun(t *testing.T) {
+	registry, err := language.NewRegistry(language.Defaults())
+	if err != nil {
+		t.Fatalf("creating registry: %v", err)
+	}
+	s := newSandbox(t)
+
+	programs := map[string]string{
+		"python":     "print(int(input()) * 2)\n",
+		"javascript": "const n = Number(require('fs').readFileSync(0, 'utf8'));\nconsole.log(n * 2);\n",
+		"c":          "#include <stdio.h>\nint main(void) { int n; scanf(\"%d\", &n); printf(\"%d\\n\", n * 2); return 0; }\n",
+	}
+
+	for name, code := range programs {
+		t.Run(name, func(t *testing.T) {
+			runtime, err := registry.Get(name)
+			if errors.Is(err, language.ErrUnknown) {
+				t.Skipf("%s is not installed", name)
+			}
+
+			program, err := runtime.Build(context.Background(), s, code)
+			if err != nil {
+				t.Fatalf("building: %v", err)
+			}
+			defer func() {
+				_ = program.Close()
+			}()
+
+			if !program.Compiled() {
+				t.Fatalf("expected the program to compile, got %s", program.Compilation.Stderr)
+			}
+
+			result, err := program.Run(context.Background(), []byte("21\n"), sandbox.Limits{})
+			if err != nil {
+				t.Fatalf("running: %v", err)
+			}
+			if string(result.Stdout) != "42\n" || !result.Succeeded() {
+				t.Errorf("expected 42, got %+v (%s)", result, result.Stderr)
+			}
+		})
+	}
+}
+
+func TestBuildCompilationFailure(t *testing.T) {
+	registry, err := language.NewRegistry(language.Defaults())
+	if err != nil {
+		t.Fatalf("creating registry: %v", err)
+	}
+
+	c, err := registry.Get("c")
+	if errors.Is(err, language.ErrUnknown) {
+		t.Skip("c is not installed")
+	}
+
+	program, err := c.Build(context.Background(), newSandbox(t), "int main(void) { return missing; }\n")
+	if err != nil {
+		t.Fatalf("building: %v", err)
+	}
+	defer func() {
+		_ = program.Close()
+	}()
+
+	if program.Compiled() {
+		t.Fatal("expected the compilation to fail")
+	}
+	if len(program.Compilation.Stderr) == 0 {
+		t.Error("expected the errors of the compiler")
+	}
+
+	_, err = program.Run(context.Background(), nil, sandbox.Limits{})
+	if err == nil {
+		t.Error("expected running a program that did not compile to fail")
+	}
+}
+
+func TestRunsAreIsolated(t *testing.T) {
+	registry, err := language.NewRegistry([]language.Runtime{
+		{Name: "shell", File: "main.sh", Run: language.Step{Command: []string{"sh", "main.sh"}}},
+	})
+	if err != nil {
+		t.Fatalf("creating registry: %v", err)
+	}
+	shell, err := registry.Get("shell")
+	if errors.Is(err, language.ErrUnknown) {
+		t.Skip("no shell available")
+	}
+
+	program, err := shell.Build(context.Background(), newSandbox(t), "cat seen 2>/dev/null; read input; echo $input > seen; echo changed >> main.sh\n")
+	if err != nil {
+		t.Fatalf("building: %v", err)
+	}
+	defer func() {
+		_ = program.Close()
+	}()
+
+	for _, input := range []string{"first", "second"} {
+		result, err := program.Run(context.Background(), []byte(input+"\n"), sandbox.Limits{})
+		if err != nil {
+			t.Fatalf("running: %v", err)
+		}
+
+		if len(result.Stdout) != 0 {
+			t.Errorf("expected the run not to see what the previous one wrote, got %q", result.Stdout)
+		}
+		if len(result.Stderr) == 0 {
+			t.Error("expected the program to be read-only")
+		}
+	}
+}
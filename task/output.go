@@ -0,0 +1,144 @@
+package task
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Comparison is how the output of a program is compared to the expected
+// output of a test case.
+type Comparison int8
+
+const (
+	// COMPARISON_LINES ignores the trailing whitespace of every line, and
+	// trailing empty lines.
+	COMPARISON_LINES Comparison = iota
+	// COMPARISON_EXACT requires the very same bytes.
+	COMPARISON_EXACT
+	// COMPARISON_WHITESPACE only compares the words, however they are
+	// separated.
+	COMPARISON_WHITESPACE
+	// COMPARISON_FLOAT compares the words, numbers may differ by the
+	// tolerance, either absolute or relative to the larger number.
+	COMPARISON_FLOAT
+	// COMPARISON_REGEX takes the expected output as a regular expression
+	// that the whole output must match, trailing whitespace aside.
+	COMPARISON_REGEX
+)
+
+// DefaultTolerance is the tolerance of COMPARISON_FLOAT when none is set.
+const DefaultTolerance = 1e-6
+
+// Validate checks that the expected output can be compared this way.
+func (c Comparison) Validate(expected string, tolerance float64) error {
+	switch c {
+	case COMPARISON_LINES, COMPARISON_EXACT, COMPARISON_WHITESPACE:
+		return nil
+	case COMPARISON_FLOAT:
+		if tolerance < 0 || math.IsNaN(tolerance) || math.IsInf(tolerance, 0) {
+			return fmt.Errorf("tolerance must be a finite number, not negative")
+		}
+
+		return nil
+	case COMPARISON_REGEX:
+		_, err := compileExpected(expected)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression: %w", err)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unknown comparison: %d", c)
+	}
+}
+
+// Matches tells whether a program printed the expected output. An
+// expected output that does not validate never matches.
+func (c Comparison) Matches(expected string, actual string, tolerance float64) bool {
+	switch c {
+	case COMPARISON_LINES:
+		return OutputMatches(expected, actual)
+	case COMPARISON_EXACT:
+		return expected == actual
+	case COMPARISON_WHITESPACE:
+		return equalWords(strings.Fields(expected), strings.Fields(actual), func(expected, actual string) bool {
+			return expected == actual
+		})
+	case COMPARISON_FLOAT:
+		if tolerance <= 0 {
+			tolerance = DefaultTolerance
+		}
+
+		return equalWords(strings.Fields(expected), strings.Fields(actual), func(expected, actual string) bool {
+			return expected == actual || closeNumbers(expected, actual, tolerance)
+		})
+	case COMPARISON_REGEX:
+		pattern, err := compileExpected(expected)
+		if err != nil {
+			return false
+		}
+
+		return pattern.MatchString(strings.TrimRight(actual, " \t\r\n"))
+	default:
+		return false
+	}
+}
+
+// OutputMatches compares outputs with COMPARISON_LINES. The difference
+// between \r\n and \n is ignored as well.
+func OutputMatches(expected string, actual string) bool {
+	return normalizeOutput(expected) == normalizeOutput(actual)
+}
+
+func normalizeOutput(output string) string {
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t\r")
+	}
+
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n")
+}
+
+func equalWords(expected []string, actual []string, equal func(expected, actual string) bool) bool {
+	if len(expected) != len(actual) {
+		return false
+	}
+
+	for i := range expected {
+		if !equal(expected[i], actual[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func closeNumbers(expected string, actual string, tolerance float64) bool {
+	a, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+	b, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false
+	}
+
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if math.IsInf(a, 0) || math.IsInf(b, 0) {
+		return a == b
+	}
+
+	difference := math.Abs(a - b)
+	return difference <= tolerance || difference <= tolerance*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// compileExpected anchors the expression, so that it matches the whole
+// output rather than a part of it.
+func compileExpected(expected string) (*regexp.Regexp, error) {
+	return regexp.Compile(`^(?:` + expected + `)$`)
+}
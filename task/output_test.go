@@ -0,0 +1,87 @@
+package task_test
+
+import (
+	"kodiiing/task"
+	"testing"
+)
+
+func TestOutputMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+		actual   string
+		matches  bool
+	}{
+		{name: "identical", expected: "1\n2\n", actual: "1\n2\n", matches: true},
+		{name: "missing trailing newline", expected: "1\n2\n", actual: "1\n2", matches: true},
+		{name: "extra trailing lines", expected: "1\n2", actual: "1\n2\n\n\n", matches: true},
+		{name: "trailing spaces", expected: "a b\n", actual: "a b  \t\n", matches: true},
+		{name: "windows line endings", expected: "a\nb\n", actual: "a\r\nb\r\n", matches: true},
+		{name: "leading spaces matter", expected: "a\n", actual: " a\n", matches: false},
+		{name: "inner blank line matters", expected: "a\nb\n", actual: "a\n\nb\n", matches: false},
+		{name: "different", expected: "42\n", actual: "43\n", matches: false},
+		{name: "empty", expected: "", actual: "\n", matches: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := task.OutputMatches(test.expected, test.actual); got != test.matches {
+				t.Errorf("OutputMatches(%q, %q) = %v, expected %v", test.expected, test.actual, got, test.matches)
+			}
+		})
+	}
+}
+
+func TestComparisonMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		comparison task.Comparison
+		expected   string
+		actual     string
+		tolerance  float64
+		matches    bool
+	}{
+		{name: "lines", comparison: task.COMPARISON_LINES, expected: "a\n", actual: "a  \n\n", matches: true},
+		{name: "exact", comparison: task.COMPARISON_EXACT, expected: "a\n", actual: "a\n", matches: true},
+		{name: "exact trailing space", comparison: task.COMPARISON_EXACT, expected: "a\n", actual: "a \n", matches: false},
+		{name: "exact missing newline", comparison: task.COMPARISON_EXACT, expected: "a\n", actual: "a", matches: false},
+		{name: "whitespace", comparison: task.COMPARISON_WHITESPACE, expected: "1 2\n3", actual: "  1\t2 3\n", matches: true},
+		{name: "whitespace different words", comparison: task.COMPARISON_WHITESPACE, expected: "1 2 3", actual: "1 2 4", matches: false},
+		{name: "whitespace missing word", comparison: task.COMPARISON_WHITESPACE, expected: "1 2 3", actual: "1 2", matches: false},
+		{name: "float within default tolerance", comparison: task.COMPARISON_FLOAT, expected: "0.3333333", actual: "0.33333333333", matches: true},
+		{name: "float outside tolerance", comparison: task.COMPARISON_FLOAT, expected: "0.5", actual: "0.51", tolerance: 0.001, matches: false},
+		{name: "float absolute tolerance", comparison: task.COMPARISON_FLOAT, expected: "0.5", actual: "0.51", tolerance: 0.05, matches: true},
+		{name: "float relative tolerance", comparison: task.COMPARISON_FLOAT, expected: "1000000", actual: "1000001", tolerance: 1e-5, matches: true},
+		{name: "float with words", comparison: task.COMPARISON_FLOAT, expected: "area 3.14159", actual: "area 3.1415926", tolerance: 1e-4, matches: true},
+		{name: "float different words", comparison: task.COMPARISON_FLOAT, expected: "area 3.14", actual: "volume 3.14", matches: false},
+		{name: "float not a number", comparison: task.COMPARISON_FLOAT, expected: "1.0", actual: "one", matches: false},
+		{name: "float nan", comparison: task.COMPARISON_FLOAT, expected: "NaN", actual: "nan", matches: true},
+		{name: "regex", comparison: task.COMPARISON_REGEX, expected: `\d+ items?`, actual: "12 items\n", matches: true},
+		{name: "regex is anchored", comparison: task.COMPARISON_REGEX, expected: `\d+`, actual: "12 items\n", matches: false},
+		{name: "regex invalid", comparison: task.COMPARISON_REGEX, expected: `(`, actual: "(", matches: false},
+		{name: "unknown", comparison: task.Comparison(42), expected: "a", actual: "a", matches: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.comparison.Matches(test.expected, test.actual, test.tolerance); got != test.matches {
+				t.Errorf("Matches(%q, %q, %v) = %v, expected %v", test.expected, test.actual, test.tolerance, got, test.matches)
+			}
+		})
+	}
+}
+
+func TestComparisonValidate(t *testing.T) {
+	if err := task.COMPARISON_REGEX.Validate(`[a-z]+`, 0); err != nil {
+		t.Errorf("expected a valid expression, got %v", err)
+	}
+	if err := task.COMPARISON_REGEX.Validate(`[a-z`, 0); err == nil {
+		t.Error("expected an invalid expression to be rejected")
+	}
+	if err := task.COMPARISON_FLOAT.Validate("1.0", -1); err == nil {
+		t.Error("expected a negative tolerance to be rejected")
+	}
+	if err := task.Comparison(42).Validate("a", 0); err == nil {
+		t.Error("expected an unknown comparison to be rejected")
+	}
+}
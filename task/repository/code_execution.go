@@ -0,0 +1,529 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"kodiiing/task"
+	task_stub "kodiiing/task/stub"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// CodeExecutionQueuedChannel is notified whenever an execution is
+	// queued, to wake the workers up.
+	CodeExecutionQueuedChannel = "code_execution_queued"
+	// CodeExecutionProgressChannel is notified with the ID of an execution
+	// whenever a result is added to it, or it finishes.
+	CodeExecutionProgressChannel = "code_execution_progress"
+)
+
+// CodeExecution is the code of a learner, run against the test cases of a
+// task by a worker.
+type CodeExecution struct {
+	Id     int64
+	TaskId int64
+	UserId int64
+	// SubmissionId is set when the execution grades a submission.
+	SubmissionId sql.NullInt64
+	Language     string
+	Code         string
+	Status       task_stub.CodeExecutionStatus
+	// Attempts counts the workers that have claimed the execution.
+	Attempts int32
+	// Output is what the program printed, as shown to the learner.
+	Output          string
+	AllowedToSubmit bool
+	// Error tells why the execution failed.
+	Error      string
+	CreatedAt  time.Time
+	StartedAt  sql.NullTime
+	FinishedAt sql.NullTime
+}
+
+// Finished tells whether the execution has completed or failed.
+func (c CodeExecution) Finished() bool {
+	return c.Status == task_stub.CODE_EXECUTION_STATUS_COMPLETED || c.Status == task_stub.CODE_EXECUTION_STATUS_FAILED
+}
+
+// CodeExecutionResult is the result of a test case, which is copied along.
+type CodeExecutionResult struct {
+	ExecutionId int64
+	Position    int32
+	TestCaseId  int64
+	Hidden      bool
+	Weight      int32
+	Input       string
+	Expected    string
+	// Output is what the program printed, Details adds its errors and why
+	// it was stopped.
+	Output  string
+	Details string
+	Success bool
+}
+
+const selectCodeExecutionSql = `
+	SELECT
+		id, task_id, user_id, submission_id, language, code, status, attempts, output, allowed_to_submit,
+		error, created_at, started_at, finished_at
+	FROM
+		code_executions`
+
+const returningCodeExecutionSql = `
+	RETURNING
+		id, task_id, user_id, submission_id, language, code, status, attempts, output, allowed_to_submit,
+		error, created_at, started_at, finished_at`
+
+func scanCodeExecution(row pgx.Row) (CodeExecution, error) {
+	var execution CodeExecution
+	err := row.Scan(
+		&execution.Id, &execution.TaskId, &execution.UserId, &execution.SubmissionId, &execution.Language,
+		&execution.Code, &execution.Status, &execution.Attempts, &execution.Output, &execution.AllowedToSubmit,
+		&execution.Error, &execution.CreatedAt, &execution.StartedAt, &execution.FinishedAt,
+	)
+
+	return execution, err
+}
+
+func notifyCodeExecution(ctx context.Context, tx pgx.Tx, channel string, id int64) error {
+	_, err := tx.Exec(ctx, `SELECT pg_notify($1, $2)`, channel, strconv.FormatInt(id, 10))
+	if err != nil {
+		return fmt.Errorf("notifying code execution: %w", err)
+	}
+
+	return nil
+}
+
+// EnqueueCodeExecution queues the execution, and returns it as stored.
+func (r *Repository) EnqueueCodeExecution(ctx context.Context, execution CodeExecution) (CodeExecution, error) {
+	ctx, span := tracer.Start(ctx, "Repository.EnqueueCodeExecution")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return CodeExecution{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	queued, err := enqueueCodeExecution(ctx, tx, execution)
+	if err != nil {
+		span.SetStatus(codes.Error, "enqueuing code execution")
+		span.RecordError(err)
+		return CodeExecution{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return CodeExecution{}, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return queued, nil
+}
+
+// enqueueCodeExecution queues the execution within the transaction, the
+// workers are notified once it commits.
+func enqueueCodeExecution(ctx context.Context, tx pgx.Tx, execution CodeExecution) (CodeExecution, error) {
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO code_executions
+			(task_id, user_id, submission_id, language, code)
+		VALUES
+			($1, $2, $3, $4, $5)`+returningCodeExecutionSql,
+		execution.TaskId, execution.UserId, execution.SubmissionId, execution.Language, execution.Code,
+	)
+	queued, err := scanCodeExecution(row)
+	if err != nil {
+		return CodeExecution{}, fmt.Errorf("enqueuing code execution: %w", err)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO code_execution_test_cases
+			(execution_id, position, test_case_id, input, expected, hidden, weight, time_limit_ms, comparison, tolerance)
+		SELECT
+			$1, ROW_NUMBER() OVER (ORDER BY position, id) - 1,
+			id, input, expected, hidden, weight, time_limit_ms, comparison, tolerance
+		FROM
+			task_test_cases
+		WHERE
+			task_id = $2`,
+		queued.Id, queued.TaskId,
+	)
+	if err != nil {
+		return CodeExecution{}, fmt.Errorf("copying test cases: %w", err)
+	}
+
+	err = notifyCodeExecution(ctx, tx, CodeExecutionQueuedChannel, queued.Id)
+	if err != nil {
+		return CodeExecution{}, err
+	}
+
+	return queued, nil
+}
+
+// CodeExecutionTestCases returns the test cases of the execution, as they
+// were when it was queued, in their order.
+func (r *Repository) CodeExecutionTestCases(ctx context.Context, id int64) ([]TestCase, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT
+			ctc.test_case_id, ce.task_id, ctc.position, ctc.input, ctc.expected, ctc.hidden, ctc.weight,
+			ctc.time_limit_ms, ctc.comparison, ctc.tolerance
+		FROM
+			code_execution_test_cases AS ctc
+			JOIN code_executions AS ce ON ce.id = ctc.execution_id
+		WHERE
+			ctc.execution_id = $1
+		ORDER BY
+			ctc.position`,
+		id,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing code execution test cases: %w", err)
+	}
+
+	testCases, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (TestCase, error) {
+		return scanTestCase(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning code execution test cases: %w", err)
+	}
+
+	return testCases, nil
+}
+
+// CodeExecution returns the execution. It returns ErrNoRows when it does
+// not exist.
+func (r *Repository) CodeExecution(ctx context.Context, id int64) (CodeExecution, error) {
+	execution, err := scanCodeExecution(r.db.QueryRow(ctx, selectCodeExecutionSql+` WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return CodeExecution{}, ErrNoRows
+		}
+
+		return CodeExecution{}, fmt.Errorf("finding code execution: %w", err)
+	}
+
+	return execution, nil
+}
+
+// ClaimCodeExecution locks the oldest queued execution for the worker until
+// the lease is over, skipping those locked by other workers. An execution
+// whose lease is over is claimed again, as its worker is gone. It returns
+// ErrNoRows when there is nothing to run.
+func (r *Repository) ClaimCodeExecution(ctx context.Context, worker string, lease time.Duration) (CodeExecution, error) {
+	ctx, span := tracer.Start(ctx, "Repository.ClaimCodeExecution")
+	defer span.End()
+
+	row := r.db.QueryRow(
+		ctx,
+		`UPDATE
+			code_executions
+		SET
+			status = $1,
+			attempts = attempts + 1,
+			worker = $2,
+			locked_until = NOW() + $3 * INTERVAL '1 millisecond',
+			started_at = COALESCE(started_at, NOW())
+		WHERE
+			id = (
+				SELECT
+					id
+				FROM
+					code_executions
+				WHERE
+					status = $4
+					OR (status = $1 AND locked_until < NOW())
+				ORDER BY
+					id
+				LIMIT 1
+				FOR UPDATE SKIP LOCKED
+			)`+returningCodeExecutionSql,
+		task_stub.CODE_EXECUTION_STATUS_RUNNING, worker, lease.Milliseconds(), task_stub.CODE_EXECUTION_STATUS_QUEUED,
+	)
+	execution, err := scanCodeExecution(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return CodeExecution{}, ErrNoRows
+		}
+
+		span.SetStatus(codes.Error, "claiming code execution")
+		span.RecordError(err)
+		return CodeExecution{}, fmt.Errorf("claiming code execution: %w", err)
+	}
+
+	return execution, nil
+}
+
+// ExtendCodeExecution renews the lease of the worker on the execution. It
+// returns ErrNoRows when the worker no longer holds it.
+func (r *Repository) ExtendCodeExecution(ctx context.Context, id int64, worker string, lease time.Duration) error {
+	tag, err := r.db.Exec(
+		ctx,
+		`UPDATE
+			code_executions
+		SET
+			locked_until = NOW() + $3 * INTERVAL '1 millisecond'
+		WHERE
+			id = $1
+			AND worker = $2
+			AND status = $4`,
+		id, worker, lease.Milliseconds(), task_stub.CODE_EXECUTION_STATUS_RUNNING,
+	)
+	if err != nil {
+		return fmt.Errorf("extending code execution: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// ReleaseCodeExecution queues the execution again, for a worker that stops
+// before finishing it. The attempt is not counted.
+func (r *Repository) ReleaseCodeExecution(ctx context.Context, id int64, worker string) error {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE
+			code_executions
+		SET
+			status = $3,
+			attempts = attempts - 1,
+			worker = NULL,
+			locked_until = NULL
+		WHERE
+			id = $1
+			AND worker = $2
+			AND status = $4`,
+		id, worker, task_stub.CODE_EXECUTION_STATUS_QUEUED, task_stub.CODE_EXECUTION_STATUS_RUNNING,
+	)
+	if err != nil {
+		return fmt.Errorf("releasing code execution: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	err = notifyCodeExecution(ctx, tx, CodeExecutionQueuedChannel, id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// AddCodeExecutionResult records the result of a test case, for an
+// execution that the worker holds. A result that was recorded by a previous
+// attempt is kept.
+func (r *Repository) AddCodeExecutionResult(ctx context.Context, worker string, result CodeExecutionResult) error {
+	ctx, span := tracer.Start(ctx, "Repository.AddCodeExecutionResult")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO code_execution_results
+			(execution_id, position, test_case_id, hidden, weight, input, expected, output, details, success)
+		SELECT
+			$1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+		WHERE
+			EXISTS (SELECT 1 FROM code_executions WHERE id = $1 AND worker = $11 AND status = $12)
+		ON CONFLICT (execution_id, position) DO NOTHING`,
+		result.ExecutionId, result.Position, result.TestCaseId, result.Hidden, result.Weight, result.Input,
+		result.Expected, result.Output, result.Details, result.Success, worker, task_stub.CODE_EXECUTION_STATUS_RUNNING,
+	)
+	if err != nil {
+		span.SetStatus(codes.Error, "adding code execution result")
+		span.RecordError(err)
+		return fmt.Errorf("adding code execution result: %w", err)
+	}
+
+	err = notifyCodeExecution(ctx, tx, CodeExecutionProgressChannel, result.ExecutionId)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CodeExecutionResults returns the results of the execution that come after
+// the position, in order. Pass a negative position for every result.
+func (r *Repository) CodeExecutionResults(ctx context.Context, id int64, afterPosition int32) ([]CodeExecutionResult, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT
+			execution_id, position, test_case_id, hidden, weight, input, expected, output, details, success
+		FROM
+			code_execution_results
+		WHERE
+			execution_id = $1
+			AND position > $2
+		ORDER BY
+			position`,
+		id, afterPosition,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing code execution results: %w", err)
+	}
+
+	results, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (CodeExecutionResult, error) {
+		var result CodeExecutionResult
+		err := row.Scan(
+			&result.ExecutionId, &result.Position, &result.TestCaseId, &result.Hidden, &result.Weight,
+			&result.Input, &result.Expected, &result.Output, &result.Details, &result.Success,
+		)
+		return result, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning code execution results: %w", err)
+	}
+
+	return results, nil
+}
+
+// FinishCodeExecution stores the status, output and error of an execution
+// that the worker holds, and unlocks it. The grade of its submission is
+// stored along, with a copy of the results. It returns ErrNoRows when the
+// worker no longer holds it.
+func (r *Repository) FinishCodeExecution(ctx context.Context, execution CodeExecution, worker string, grade *task.Grade) error {
+	ctx, span := tracer.Start(ctx, "Repository.FinishCodeExecution")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	tag, err := tx.Exec(
+		ctx,
+		`UPDATE
+			code_executions
+		SET
+			status = $3,
+			output = $4,
+			allowed_to_submit = $5,
+			error = $6,
+			locked_until = NULL,
+			finished_at = NOW()
+		WHERE
+			id = $1
+			AND worker = $2
+			AND status = $7`,
+		execution.Id, worker, execution.Status, execution.Output, execution.AllowedToSubmit, execution.Error,
+		task_stub.CODE_EXECUTION_STATUS_RUNNING,
+	)
+	if err != nil {
+		span.SetStatus(codes.Error, "finishing code execution")
+		span.RecordError(err)
+		return fmt.Errorf("finishing code execution: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	if grade != nil && execution.SubmissionId.Valid {
+		err = gradeSubmission(ctx, tx, execution, *grade)
+		if err != nil {
+			span.SetStatus(codes.Error, "grading submission")
+			span.RecordError(err)
+			return err
+		}
+	}
+
+	err = notifyCodeExecution(ctx, tx, CodeExecutionProgressChannel, execution.Id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// CountPendingCodeExecutions counts the executions of the user that are
+// queued or running.
+func (r *Repository) CountPendingCodeExecutions(ctx context.Context, userId int64) (count int, err error) {
+	err = r.db.QueryRow(
+		ctx,
+		`SELECT COUNT(*) FROM code_executions WHERE user_id = $1 AND status IN ($2, $3)`,
+		userId, task_stub.CODE_EXECUTION_STATUS_QUEUED, task_stub.CODE_EXECUTION_STATUS_RUNNING,
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("counting pending code executions: %w", err)
+	}
+
+	return count, nil
+}
+
+// PruneCodeExecutions deletes the executions that finished before the
+// time, along with their results.
+func (r *Repository) PruneCodeExecutions(ctx context.Context, finishedBefore time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, `DELETE FROM code_executions WHERE finished_at < $1`, finishedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("pruning code executions: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// RunPruner deletes the executions that finished more than retention ago,
+// on every interval until ctx is done.
+func (r *Repository) RunPruner(ctx context.Context, interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			pruned, err := r.PruneCodeExecutions(ctx, time.Now().Add(-retention))
+			if err != nil {
+				log.Error().Err(err).Msg("pruning code executions")
+				continue
+			}
+
+			log.Debug().Int64("pruned", pruned).Msg("pruned code executions")
+		}
+	}
+}
@@ -3,3 +3,19 @@ package repository
 import "errors"
 
 var ErrNoRows = errors.New("no rows in result set")
+
+// ErrTestCaseOrder is returned when an order does not list every test case
+// of a task exactly once.
+var ErrTestCaseOrder = errors.New("order must list every test case of the task once")
+
+// ErrTaskNotStarted is returned when a task is submitted by a user who has
+// not started it.
+var ErrTaskNotStarted = errors.New("task was not started")
+
+// ErrTaskFinished is returned when a task is submitted again once a
+// submission has passed.
+var ErrTaskFinished = errors.New("task was passed already")
+
+// ErrSubmissionPending is returned when a task is submitted again while
+// the previous submission is still being graded.
+var ErrSubmissionPending = errors.New("previous submission is still being graded")
@@ -37,7 +37,7 @@ func (r *Repository) ListTask(ctx context.Context, userId int64, trackId string)
 
 	var findTaskSql = `
 	SELECT
-		t.id AS task_id, t.title, t.description, t.difficulty, t.content, t.author AS author,
+		t.id AS task_id, t.title, t.description, t.difficulty, t.content, t.author AS author, t.languages,
 		t.created_at, t.created_by, t.updated_at, t.updated_by,
 		ut.finished_at, ut.satisfaction_level,
 		CASE
@@ -68,7 +68,7 @@ func (r *Repository) ListTask(ctx context.Context, userId int64, trackId string)
 		var row ListTaskOut
 		err = rows.Scan(
 			&row.Task.Id, &row.Task.Title, &row.Task.Description, &row.Task.Difficulty, &row.Task.Content,
-			&row.Task.Author, &row.Task.CreatedAt, &row.Task.CreatedBy, &row.Task.UpdatedAt, &row.Task.UpdatedBy,
+			&row.Task.Author, &row.Task.Languages, &row.Task.CreatedAt, &row.Task.CreatedBy, &row.Task.UpdatedAt, &row.Task.UpdatedBy,
 			&row.CompletedAt, &row.SatisfactionLevel, &row.Completed,
 		)
 		if err != nil {
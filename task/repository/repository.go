@@ -21,6 +21,8 @@ type Task struct {
 	CreatedBy   string
 	UpdatedAt   time.Time
 	UpdatedBy   string
+	// Languages that a solution may be written in, empty for any.
+	Languages []string
 }
 
 type Repository struct {
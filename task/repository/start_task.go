@@ -14,7 +14,7 @@ type StartTaskOut struct {
 
 	Completed         bool
 	CompletedAt       sql.NullTime
-	SatisfactionLevel int64
+	SatisfactionLevel sql.NullInt64
 }
 
 func (r *Repository) StartTask(ctx context.Context, userId, taskId int64) (out StartTaskOut, err error) {
@@ -22,26 +22,38 @@ func (r *Repository) StartTask(ctx context.Context, userId, taskId int64) (out S
 		return StartTaskOut{}, pgx.ErrNoRows
 	}
 
-	var selectTaskSql = `	
+	// The author is gone once their account is deleted.
+	var selectTaskSql = `
 	SELECT
-		t.id AS task_id, t.title, t.description, t.difficulty, t.content, u.name AS author,
+		t.id AS task_id, t.title, t.description, t.difficulty, t.content, COALESCE(u.name, '') AS author, t.languages,
 		t.created_at, t.created_by, t.updated_at, t.updated_by
 	FROM
 		tasks AS t
-		INNER JOIN users AS u ON u.id = t.author`
-	err = r.db.QueryRow(ctx, selectTaskSql).Scan(
+		LEFT JOIN users AS u ON u.id = t.author
+	WHERE
+		t.id = $1`
+	err = r.db.QueryRow(ctx, selectTaskSql, taskId).Scan(
 		&out.Task.Id, &out.Task.Title, &out.Task.Description, &out.Task.Difficulty, &out.Task.Content,
-		&out.Task.Author, &out.Task.CreatedAt, &out.Task.CreatedBy, &out.Task.UpdatedAt,
+		&out.Task.Author, &out.Task.Languages, &out.Task.CreatedAt, &out.Task.CreatedBy, &out.Task.UpdatedAt,
 		&out.Task.UpdatedBy,
 	)
 	if err != nil {
 		return
 	}
 
-	var insertUserTaskSql = "INSERT INTO user_tasks (task_id, user_id, status, started_at) VALUES ($1, $2, $3, $d) RETURNING finished_at, satisfaction_level"
+	// Starting a task again keeps its progress.
+	var insertUserTaskSql = `
+	INSERT INTO user_tasks
+		(task_id, user_id, status, started_at)
+	VALUES
+		($1, $2, $3, $4)
+	ON CONFLICT (task_id, user_id) DO UPDATE SET
+		task_id = EXCLUDED.task_id
+	RETURNING
+		finished_at, satisfaction_level`
 
 	err = r.db.QueryRow(ctx, insertUserTaskSql,
-		taskId, userId, task.USER_TASK_STATUS_IN_PROGRESS, time.Now().UTC().Format(time.RFC3339),
+		taskId, userId, task.USER_TASK_STATUS_IN_PROGRESS, time.Now().UTC(),
 	).Scan(
 		&out.CompletedAt, &out.SatisfactionLevel,
 	)
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"kodiiing/task"
+	task_stub "kodiiing/task/stub"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Submission is a solution of a user to a task, it never changes. A task
+// may be submitted again until a submission passes.
+type Submission struct {
+	Id        int64
+	TaskId    int64
+	UserId    int64
+	Language  string
+	Code      string
+	CreatedAt time.Time
+}
+
+// SubmitTask stores the submission, and queues the execution that grades
+// it. The task of the user is finished once a submission passes. It
+// returns ErrTaskNotStarted when the user has not started the task,
+// ErrTaskFinished when a submission has passed already, and
+// ErrSubmissionPending while the previous one is being graded.
+func (r *Repository) SubmitTask(ctx context.Context, submission Submission) (Submission, CodeExecution, error) {
+	ctx, span := tracer.Start(ctx, "Repository.SubmitTask")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return Submission{}, CodeExecution{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var finishedAt sql.NullTime
+	err = tx.QueryRow(
+		ctx,
+		`SELECT finished_at FROM user_tasks WHERE task_id = $1 AND user_id = $2 FOR UPDATE`,
+		submission.TaskId, submission.UserId,
+	).Scan(&finishedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Submission{}, CodeExecution{}, ErrTaskNotStarted
+		}
+
+		span.SetStatus(codes.Error, "finding user task")
+		span.RecordError(err)
+		return Submission{}, CodeExecution{}, fmt.Errorf("finding user task: %w", err)
+	}
+	if finishedAt.Valid {
+		return Submission{}, CodeExecution{}, ErrTaskFinished
+	}
+
+	// The user task is locked, so submissions are checked one at a time.
+	var pending bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT EXISTS (
+			SELECT
+				1
+			FROM
+				task_submissions AS s
+				JOIN code_executions AS ce ON ce.submission_id = s.id
+			WHERE
+				s.task_id = $1
+				AND s.user_id = $2
+				AND ce.status IN ($3, $4)
+		)`,
+		submission.TaskId, submission.UserId, task_stub.CODE_EXECUTION_STATUS_QUEUED, task_stub.CODE_EXECUTION_STATUS_RUNNING,
+	).Scan(&pending)
+	if err != nil {
+		span.SetStatus(codes.Error, "finding pending submission")
+		span.RecordError(err)
+		return Submission{}, CodeExecution{}, fmt.Errorf("finding pending submission: %w", err)
+	}
+	if pending {
+		return Submission{}, CodeExecution{}, ErrSubmissionPending
+	}
+
+	err = tx.QueryRow(
+		ctx,
+		`INSERT INTO task_submissions
+			(task_id, user_id, language, code)
+		VALUES
+			($1, $2, $3, $4)
+		RETURNING
+			id, task_id, user_id, language, code, created_at`,
+		submission.TaskId, submission.UserId, submission.Language, submission.Code,
+	).Scan(&submission.Id, &submission.TaskId, &submission.UserId, &submission.Language, &submission.Code, &submission.CreatedAt)
+	if err != nil {
+		span.SetStatus(codes.Error, "storing submission")
+		span.RecordError(err)
+		return Submission{}, CodeExecution{}, fmt.Errorf("storing submission: %w", err)
+	}
+
+	execution, err := enqueueCodeExecution(ctx, tx, CodeExecution{
+		TaskId:       submission.TaskId,
+		UserId:       submission.UserId,
+		SubmissionId: sql.NullInt64{Int64: submission.Id, Valid: true},
+		Language:     submission.Language,
+		Code:         submission.Code,
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, "enqueuing code execution")
+		span.RecordError(err)
+		return Submission{}, CodeExecution{}, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return Submission{}, CodeExecution{}, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return submission, execution, nil
+}
+
+// gradeSubmission stores the grade of the submission of the execution, and
+// copies the results of the execution, which are pruned after a while. The
+// task of the user is finished when the submission passed.
+func gradeSubmission(ctx context.Context, tx pgx.Tx, execution CodeExecution, grade task.Grade) error {
+	_, err := tx.Exec(
+		ctx,
+		`INSERT INTO task_submission_grades
+			(submission_id, score, passed, passed_weight, total_weight, output)
+		VALUES
+			($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (submission_id) DO NOTHING`,
+		execution.SubmissionId, grade.Score, grade.Passed, grade.PassedWeight, grade.TotalWeight, execution.Output,
+	)
+	if err != nil {
+		return fmt.Errorf("storing grade: %w", err)
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`INSERT INTO task_submission_results
+			(submission_id, position, test_case_id, hidden, weight, output, success)
+		SELECT
+			$1, position, test_case_id, hidden, weight, output, success
+		FROM
+			code_execution_results
+		WHERE
+			execution_id = $2
+		ON CONFLICT (submission_id, position) DO NOTHING`,
+		execution.SubmissionId, execution.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("storing submission results: %w", err)
+	}
+
+	if !grade.Passed {
+		return nil
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE user_tasks SET status = $3, finished_at = NOW() WHERE task_id = $1 AND user_id = $2 AND finished_at IS NULL`,
+		execution.TaskId, execution.UserId, task.USER_TASK_STATUS_FINISHED,
+	)
+	if err != nil {
+		return fmt.Errorf("finishing user task: %w", err)
+	}
+
+	return nil
+}
+
+// NextTask returns the task that the user should take after this one: the
+// first unfinished task that follows it on the track of the user, or that
+// precedes it when every following task is finished. The track of the user
+// is the track of the task that the user has started the most tasks on. It
+// returns an invalid ID when there is no such task.
+func (r *Repository) NextTask(ctx context.Context, userId int64, taskId int64) (next sql.NullInt64, err error) {
+	ctx, span := tracer.Start(ctx, "Repository.NextTask")
+	defer span.End()
+
+	err = r.db.QueryRow(
+		ctx,
+		`WITH track AS (
+			SELECT
+				current.track_id,
+				current.position
+			FROM
+				track_tasks AS current
+				LEFT JOIN track_tasks AS other ON other.track_id = current.track_id
+				LEFT JOIN user_tasks AS ut ON ut.task_id = other.task_id AND ut.user_id = $2
+			WHERE
+				current.task_id = $1
+			GROUP BY
+				current.track_id, current.position
+			ORDER BY
+				COUNT(ut.id) DESC, current.track_id
+			LIMIT 1
+		)
+		SELECT
+			tt.task_id
+		FROM
+			track_tasks AS tt
+			JOIN track ON track.track_id = tt.track_id
+		WHERE
+			tt.task_id <> $1
+			AND NOT EXISTS (
+				SELECT 1 FROM user_tasks AS ut WHERE ut.task_id = tt.task_id AND ut.user_id = $2 AND ut.finished_at IS NOT NULL
+			)
+		ORDER BY
+			(tt.position, tt.task_id) < (track.position, $1::BIGINT), tt.position, tt.task_id
+		LIMIT 1`,
+		taskId, userId,
+	).Scan(&next)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return sql.NullInt64{}, nil
+		}
+
+		span.SetStatus(codes.Error, "finding next task")
+		span.RecordError(err)
+		return sql.NullInt64{}, fmt.Errorf("finding next task: %w", err)
+	}
+
+	return next, nil
+}
@@ -0,0 +1,24 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TaskLanguages returns the languages that the task accepts, none meaning
+// any. It returns ErrNoRows when the task does not exist.
+func (r *Repository) TaskLanguages(ctx context.Context, taskId int64) (languages []string, err error) {
+	err = r.db.QueryRow(ctx, `SELECT languages FROM tasks WHERE id = $1`, taskId).Scan(&languages)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNoRows
+		}
+
+		return nil, fmt.Errorf("finding task languages: %w", err)
+	}
+
+	return languages, nil
+}
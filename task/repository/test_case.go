@@ -0,0 +1,311 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"kodiiing/task"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/codes"
+)
+
+type TestCase struct {
+	Id       int64
+	TaskId   int64
+	Position int32
+	Input    string
+	Expected string
+	Hidden   bool
+	// Weight is the share of the grade that the test case is worth.
+	Weight int32
+	// TimeLimit overrides the wall-clock limit of the runtime, zero keeps it.
+	TimeLimit  time.Duration
+	Comparison task.Comparison
+	Tolerance  float64
+}
+
+// Matches tells whether a program printed the expected output.
+func (t TestCase) Matches(output string) bool {
+	return t.Comparison.Matches(t.Expected, output, t.Tolerance)
+}
+
+const selectTestCaseSql = `
+	SELECT
+		id, task_id, position, input, expected, hidden, weight, time_limit_ms, comparison, tolerance
+	FROM
+		task_test_cases`
+
+func scanTestCase(row pgx.Row) (TestCase, error) {
+	var testCase TestCase
+	var timeLimitMs sql.NullInt32
+	err := row.Scan(
+		&testCase.Id, &testCase.TaskId, &testCase.Position, &testCase.Input, &testCase.Expected,
+		&testCase.Hidden, &testCase.Weight, &timeLimitMs, &testCase.Comparison, &testCase.Tolerance,
+	)
+	if timeLimitMs.Valid {
+		testCase.TimeLimit = time.Duration(timeLimitMs.Int32) * time.Millisecond
+	}
+
+	return testCase, err
+}
+
+// timeLimitMs is the time limit as stored, NULL when there is none.
+func (t TestCase) timeLimitMs() sql.NullInt32 {
+	if t.TimeLimit <= 0 {
+		return sql.NullInt32{}
+	}
+
+	return sql.NullInt32{Int32: int32(t.TimeLimit.Milliseconds()), Valid: true}
+}
+
+// ListTestCases returns the test cases of the task in their order. It
+// returns ErrNoRows when the task does not exist.
+func (r *Repository) ListTestCases(ctx context.Context, taskId int64) ([]TestCase, error) {
+	ctx, span := tracer.Start(ctx, "Repository.ListTestCases")
+	defer span.End()
+
+	var exists bool
+	err := r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM tasks WHERE id = $1)`, taskId).Scan(&exists)
+	if err != nil {
+		span.SetStatus(codes.Error, "finding task")
+		span.RecordError(err)
+		return nil, fmt.Errorf("finding task: %w", err)
+	}
+	if !exists {
+		return nil, ErrNoRows
+	}
+
+	rows, err := r.db.Query(ctx, selectTestCaseSql+`
+	WHERE
+		task_id = $1
+	ORDER BY
+		position, id`,
+		taskId,
+	)
+	if err != nil {
+		span.SetStatus(codes.Error, "listing test cases")
+		span.RecordError(err)
+		return nil, fmt.Errorf("listing test cases: %w", err)
+	}
+
+	testCases, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (TestCase, error) {
+		return scanTestCase(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning test cases: %w", err)
+	}
+
+	return testCases, nil
+}
+
+// TaskAuthor returns the author of the task, who is no longer set once
+// their account is deleted. It returns ErrNoRows when the task does not
+// exist.
+func (r *Repository) TaskAuthor(ctx context.Context, taskId int64) (author sql.NullInt64, err error) {
+	err = r.db.QueryRow(ctx, `SELECT author FROM tasks WHERE id = $1`, taskId).Scan(&author)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return author, ErrNoRows
+		}
+
+		return author, fmt.Errorf("finding task author: %w", err)
+	}
+
+	return author, nil
+}
+
+// CreateTestCase adds the test case after the other test cases of its
+// task, and returns it as stored. It returns ErrNoRows when the task does
+// not exist.
+func (r *Repository) CreateTestCase(ctx context.Context, testCase TestCase, createdBy string) (TestCase, error) {
+	ctx, span := tracer.Start(ctx, "Repository.CreateTestCase")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return TestCase{}, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Test cases created at once would take the same position otherwise.
+	err = lockTask(ctx, tx, testCase.TaskId)
+	if err != nil {
+		return TestCase{}, err
+	}
+
+	row := tx.QueryRow(
+		ctx,
+		`INSERT INTO task_test_cases
+			(task_id, position, input, expected, hidden, weight, time_limit_ms, comparison, tolerance, created_by, updated_by)
+		SELECT
+			$1,
+			COALESCE((SELECT MAX(position) + 1 FROM task_test_cases WHERE task_id = $1), 0),
+			$2, $3, $4, $5, $6, $7, $8, $9, $9
+		RETURNING
+			id, task_id, position, input, expected, hidden, weight, time_limit_ms, comparison, tolerance`,
+		testCase.TaskId, testCase.Input, testCase.Expected, testCase.Hidden, testCase.Weight,
+		testCase.timeLimitMs(), testCase.Comparison, testCase.Tolerance, createdBy,
+	)
+	created, err := scanTestCase(row)
+	if err != nil {
+		span.SetStatus(codes.Error, "creating test case")
+		span.RecordError(err)
+		return TestCase{}, fmt.Errorf("creating test case: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return TestCase{}, fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return created, nil
+}
+
+// lockTask locks the row of the task until the end of the transaction,
+// which serializes the changes to the order of its test cases. It returns
+// ErrNoRows when the task does not exist.
+func lockTask(ctx context.Context, tx pgx.Tx, taskId int64) error {
+	var id int64
+	err := tx.QueryRow(ctx, `SELECT id FROM tasks WHERE id = $1 FOR UPDATE`, taskId).Scan(&id)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNoRows
+		}
+
+		return fmt.Errorf("locking task: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateTestCase changes every field of the test case but its position.
+// It returns ErrNoRows when the task has no such test case.
+func (r *Repository) UpdateTestCase(ctx context.Context, testCase TestCase, updatedBy string) (TestCase, error) {
+	ctx, span := tracer.Start(ctx, "Repository.UpdateTestCase")
+	defer span.End()
+
+	row := r.db.QueryRow(
+		ctx,
+		`UPDATE
+			task_test_cases
+		SET
+			input = $3,
+			expected = $4,
+			hidden = $5,
+			weight = $6,
+			time_limit_ms = $7,
+			comparison = $8,
+			tolerance = $9,
+			updated_at = NOW(),
+			updated_by = $10
+		WHERE
+			id = $1
+			AND task_id = $2
+		RETURNING
+			id, task_id, position, input, expected, hidden, weight, time_limit_ms, comparison, tolerance`,
+		testCase.Id, testCase.TaskId, testCase.Input, testCase.Expected, testCase.Hidden, testCase.Weight,
+		testCase.timeLimitMs(), testCase.Comparison, testCase.Tolerance, updatedBy,
+	)
+	updated, err := scanTestCase(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return TestCase{}, ErrNoRows
+		}
+
+		span.SetStatus(codes.Error, "updating test case")
+		span.RecordError(err)
+		return TestCase{}, fmt.Errorf("updating test case: %w", err)
+	}
+
+	return updated, nil
+}
+
+// DeleteTestCase removes the test case. It returns ErrNoRows when the task
+// has no such test case.
+func (r *Repository) DeleteTestCase(ctx context.Context, taskId int64, testCaseId int64) error {
+	tag, err := r.db.Exec(ctx, `DELETE FROM task_test_cases WHERE id = $1 AND task_id = $2`, testCaseId, taskId)
+	if err != nil {
+		return fmt.Errorf("deleting test case: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoRows
+	}
+
+	return nil
+}
+
+// ReorderTestCases orders the test cases of the task as the IDs are. The
+// IDs must list every test case of the task once, or ErrTestCaseOrder is
+// returned. It returns ErrNoRows when the task does not exist.
+func (r *Repository) ReorderTestCases(ctx context.Context, taskId int64, testCaseIds []int64, updatedBy string) error {
+	ctx, span := tracer.Start(ctx, "Repository.ReorderTestCases")
+	defer span.End()
+
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	// Test cases created meanwhile would be left out otherwise.
+	err = lockTask(ctx, tx, taskId)
+	if err != nil {
+		return err
+	}
+
+	var matching, total int
+	err = tx.QueryRow(
+		ctx,
+		`SELECT
+			COUNT(DISTINCT id) FILTER (WHERE id = ANY($2)),
+			COUNT(*)
+		FROM
+			task_test_cases
+		WHERE
+			task_id = $1`,
+		taskId, testCaseIds,
+	).Scan(&matching, &total)
+	if err != nil {
+		span.SetStatus(codes.Error, "checking test cases")
+		span.RecordError(err)
+		return fmt.Errorf("checking test cases: %w", err)
+	}
+	if matching != total || len(testCaseIds) != total {
+		return ErrTestCaseOrder
+	}
+
+	_, err = tx.Exec(
+		ctx,
+		`UPDATE
+			task_test_cases AS tc
+		SET
+			position = ordered.position - 1,
+			updated_at = NOW(),
+			updated_by = $3
+		FROM
+			unnest($2::BIGINT[]) WITH ORDINALITY AS ordered (id, position)
+		WHERE
+			tc.id = ordered.id
+			AND tc.task_id = $1`,
+		taskId, testCaseIds, updatedBy,
+	)
+	if err != nil {
+		span.SetStatus(codes.Error, "reordering test cases")
+		span.RecordError(err)
+		return fmt.Errorf("reordering test cases: %w", err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,77 @@
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// The init process runs in two stages. The first one waits for the users
+// of the namespace to be mapped by the server, then executes the second
+// one, which is root within the namespace from then on and sets it up
+// before running the program.
+const (
+	initName      = "kodiiing-sandbox-init"
+	initSetupName = "kodiiing-sandbox-setup"
+)
+
+// initFailure is the exit code of an init process that could not start
+// the program, its stderr then starts with initFailurePrefix.
+const (
+	initFailure       = 127
+	initFailurePrefix = "kodiiing-sandbox: "
+)
+
+// initSpec is what the init process is told to run, passed as its sole
+// argument.
+type initSpec struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	// Dir is the box, which the program runs in.
+	Dir string   `json:"dir"`
+	Env []string `json:"env"`
+	// Root is an empty directory that the root of the program is built
+	// upon, out of the read-only Mounts.
+	Root   string   `json:"root"`
+	Mounts []string `json:"mounts"`
+	Limits Limits   `json:"limits"`
+	// Remove is a box to remove instead of running a program, along with
+	// the files that programs left in it.
+	Remove string `json:"remove,omitempty"`
+}
+
+func (s initSpec) encode() (string, error) {
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("encoding init spec: %w", err)
+	}
+
+	return string(encoded), nil
+}
+
+// Init runs the init process of a sandbox when the binary is executed as
+// one, and never returns in that case. Otherwise it does nothing. It has
+// to be called at the very start of main, or of TestMain in tests that
+// run programs.
+func Init() {
+	if len(os.Args) != 2 || (os.Args[0] != initName && os.Args[0] != initSetupName) {
+		return
+	}
+
+	var spec initSpec
+	err := json.Unmarshal([]byte(os.Args[1]), &spec)
+	if err != nil {
+		initFail(fmt.Errorf("decoding init spec: %w", err))
+	}
+
+	// Both stages only return on failure.
+	if os.Args[0] == initName {
+		initFail(awaitMapping(os.Args[1]))
+	}
+	initFail(runInit(spec))
+}
+
+func initFail(err error) {
+	_, _ = fmt.Fprintf(os.Stderr, "%s%v\n", initFailurePrefix, err)
+	os.Exit(initFailure)
+}
@@ -0,0 +1,57 @@
+package sandbox
+
+import (
+	"bytes"
+	"sync"
+)
+
+// outputLimit is the output that a program may still write, shared by its
+// stdout and stderr. exceeded is called once the program writes more.
+type outputLimit struct {
+	mu        sync.Mutex
+	remaining int
+	overflow  bool
+	exceeded  func()
+}
+
+// take returns how much of n bytes may be kept.
+func (o *outputLimit) take(n int) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if n <= o.remaining {
+		o.remaining -= n
+		return n
+	}
+
+	kept := o.remaining
+	o.remaining = 0
+	if !o.overflow {
+		o.overflow = true
+		o.exceeded()
+	}
+
+	return kept
+}
+
+func (o *outputLimit) hasExceeded() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.overflow
+}
+
+// limitedWriter keeps what fits within the limit, and discards the rest.
+// It never fails, so that the program is killed by the limit rather than
+// by a broken pipe.
+type limitedWriter struct {
+	limit  *outputLimit
+	buffer bytes.Buffer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	kept := w.limit.take(len(p))
+	w.buffer.Write(p[:kept])
+
+	return len(p), nil
+}
@@ -0,0 +1,601 @@
+// Package sandbox runs untrusted programs, such as the code of a learner,
+// on the local machine without Docker.
+//
+// Every run happens in a child process with its own user, PID, mount,
+// network, IPC and UTS namespaces, so that it has no network, cannot see
+// or signal the processes of the server, and holds no privilege on the
+// host. Its root is a read-only tree holding only the toolchains, along
+// with its box, a private /tmp, /proc and a few devices, so that it sees
+// nothing else of the host. Every box runs as a host user of its own,
+// and is bounded by resource limits on CPU time, memory, processes, file
+// size and open files, along with a wall-clock timeout and a cap on its
+// output.
+//
+// Resource limits are applied by the binary of the server itself, which
+// is executed again inside the namespaces as a small init process, hence
+// Init has to be called at the very start of main.
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrUnsupported is returned on systems where programs cannot be isolated.
+var ErrUnsupported = errors.New("sandbox: unsupported on this system")
+
+// Limits bounds the resources of a run. Zero values fall back to the
+// limits of the Sandbox.
+type Limits struct {
+	// CPUTime is the processor time the program may use.
+	CPUTime time.Duration
+	// WallTime is the time the program may take, sleeping included.
+	WallTime time.Duration
+	// MemoryBytes caps the address space of every process.
+	MemoryBytes uint64
+	// Processes caps the processes and threads the program may have.
+	Processes uint64
+	// OutputBytes caps stdout and stderr together, the program is killed
+	// once it writes more.
+	OutputBytes int
+	// FileSizeBytes caps the size of any file the program writes.
+	FileSizeBytes uint64
+	// OpenFiles caps the file descriptors of every process.
+	OpenFiles uint64
+}
+
+// WithDefaults fills the limits that are unset with the defaults.
+func (l Limits) WithDefaults(defaults Limits) Limits {
+	if l.CPUTime <= 0 {
+		l.CPUTime = defaults.CPUTime
+	}
+	if l.WallTime <= 0 {
+		l.WallTime = defaults.WallTime
+	}
+	if l.MemoryBytes == 0 {
+		l.MemoryBytes = defaults.MemoryBytes
+	}
+	if l.Processes == 0 {
+		l.Processes = defaults.Processes
+	}
+	if l.OutputBytes <= 0 {
+		l.OutputBytes = defaults.OutputBytes
+	}
+	if l.FileSizeBytes == 0 {
+		l.FileSizeBytes = defaults.FileSizeBytes
+	}
+	if l.OpenFiles == 0 {
+		l.OpenFiles = defaults.OpenFiles
+	}
+
+	return l
+}
+
+// DefaultLimits are used for the limits that Config leaves unset.
+var DefaultLimits = Limits{
+	CPUTime:       time.Second * 5,
+	WallTime:      time.Second * 10,
+	MemoryBytes:   512 << 20,
+	Processes:     64,
+	OutputBytes:   64 << 10,
+	FileSizeBytes: 16 << 20,
+	OpenFiles:     64,
+}
+
+// DefaultMounts are the host paths that programs see by default, those
+// of the toolchains of Defaults in language. Patterns are expanded as by
+// filepath.Glob, and paths that do not exist are left out.
+var DefaultMounts = []string{
+	"/usr",
+	"/bin",
+	"/lib",
+	"/lib32",
+	"/lib64",
+	"/etc/alternatives",
+	"/etc/ld.so.cache",
+	"/etc/java-*",
+}
+
+// Config configures New.
+type Config struct {
+	// WorkDir is where the boxes are created, it defaults to the
+	// temporary directory of the system.
+	WorkDir string
+	// Users are the host users that programs run as, every box taking
+	// one of its own, and Groups their groups. They default to the ranges
+	// delegated to the user of the server in /etc/subuid and /etc/subgid.
+	// A server that is not root may only use delegated ranges, and needs
+	// newuidmap and newgidmap to. Servers sharing a host need ranges of
+	// their own.
+	Users  IDRange
+	Groups IDRange
+	// Mounts are the host paths that programs see, read-only, it defaults
+	// to DefaultMounts.
+	Mounts []string
+	// Concurrency caps the runs that happen at once, it defaults to the
+	// number of CPUs.
+	Concurrency int
+	Limits      Limits
+}
+
+type Sandbox struct {
+	workDir string
+	root    string
+	mounts  []string
+	users   IDRange
+	groups  IDRange
+	limits  Limits
+	slots   chan struct{}
+
+	// ids are the indexes within users and groups that boxes take.
+	ids struct {
+		sync.Mutex
+		next int
+		free []int
+	}
+}
+
+func New(config Config) (*Sandbox, error) {
+	if config.WorkDir == "" {
+		config.WorkDir = os.TempDir()
+	}
+	if config.Mounts == nil {
+		config.Mounts = DefaultMounts
+	}
+	if config.Concurrency <= 0 {
+		config.Concurrency = runtime.NumCPU()
+	}
+
+	err := supported()
+	if err != nil {
+		return nil, err
+	}
+
+	users, groups, err := resolveIDs(config.Users, config.Groups)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts, err := resolveMounts(config.Mounts)
+	if err != nil {
+		return nil, err
+	}
+
+	// The root of every program is built upon this directory, within its
+	// own mount namespace.
+	root := filepath.Join(config.WorkDir, "kodiiing-sandbox-root")
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, fmt.Errorf("creating work directory: %w", err)
+	}
+
+	return &Sandbox{
+		workDir: config.WorkDir,
+		root:    root,
+		mounts:  mounts,
+		users:   users,
+		groups:  groups,
+		limits:  config.Limits.WithDefaults(DefaultLimits),
+		slots:   make(chan struct{}, config.Concurrency),
+	}, nil
+}
+
+// resolveMounts expands the patterns of the mounts.
+func resolveMounts(patterns []string) ([]string, error) {
+	var mounts []string
+	for _, pattern := range patterns {
+		if !filepath.IsAbs(pattern) {
+			return nil, fmt.Errorf("mount must be an absolute path: %q", pattern)
+		}
+
+		matches, err := filepath.Glob(filepath.Clean(pattern))
+		if err != nil {
+			return nil, fmt.Errorf("invalid mount %q: %w", pattern, err)
+		}
+		if len(matches) > 0 && matches[0] == "/" {
+			return nil, errors.New("mount must not be the root of the host")
+		}
+
+		mounts = append(mounts, matches...)
+	}
+
+	return mounts, nil
+}
+
+// acquireID reserves the index of the user and group of a box.
+func (s *Sandbox) acquireID() (int, error) {
+	s.ids.Lock()
+	defer s.ids.Unlock()
+
+	if len(s.ids.free) > 0 {
+		id := s.ids.free[len(s.ids.free)-1]
+		s.ids.free = s.ids.free[:len(s.ids.free)-1]
+		return id, nil
+	}
+
+	if s.ids.next >= min(s.users.Count, s.groups.Count) {
+		return 0, errors.New("every sandbox user is taken")
+	}
+
+	id := s.ids.next
+	s.ids.next++
+	return id, nil
+}
+
+func (s *Sandbox) releaseID(id int) {
+	s.ids.Lock()
+	defer s.ids.Unlock()
+
+	s.ids.free = append(s.ids.free, id)
+}
+
+// Box is a directory holding the files of a program, in which commands
+// are run. Files written by a command stay in the box for the next ones,
+// e.g. the binary that a compiler produced.
+type Box struct {
+	sandbox *Sandbox
+	dir     string
+	// id is the index of the user and group of the box.
+	id     int
+	closed bool
+}
+
+// Prepare creates a box that holds the files, keyed by their name. It
+// must be closed once done with.
+func (s *Sandbox) Prepare(files map[string][]byte) (*Box, error) {
+	id, err := s.acquireID()
+	if err != nil {
+		return nil, fmt.Errorf("creating box: %w", err)
+	}
+
+	dir, err := os.MkdirTemp(s.workDir, "kodiiing-sandbox-")
+	if err != nil {
+		s.releaseID(id)
+		return nil, fmt.Errorf("creating box: %w", err)
+	}
+
+	box := &Box{sandbox: s, dir: dir, id: id}
+
+	// The init process gives the box to its user, the server still has
+	// to read what programs leave in it.
+	err = os.Chmod(dir, 0o755)
+	if err != nil {
+		_ = box.Close()
+		return nil, fmt.Errorf("changing box permissions: %w", err)
+	}
+
+	for name, content := range files {
+		if name == "" || strings.Contains(name, "/") || name == "." || name == ".." {
+			_ = box.Close()
+			return nil, fmt.Errorf("invalid file name: %q", name)
+		}
+
+		err = os.WriteFile(filepath.Join(dir, name), content, 0o644)
+		if err != nil {
+			_ = box.Close()
+			return nil, fmt.Errorf("writing %s: %w", name, err)
+		}
+	}
+
+	return box, nil
+}
+
+// Copy creates a box holding a read-only copy of the files at the top of
+// the box, e.g. for a program that a compiler produced to run without
+// seeing what other runs wrote. It must be closed once done with.
+func (b *Box) Copy() (*Box, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading box: %w", err)
+	}
+
+	box, err := b.sandbox.Prepare(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			_ = box.Close()
+			return nil, fmt.Errorf("reading %s: %w", entry.Name(), err)
+		}
+
+		mode := 0o444 | info.Mode().Perm()&0o111
+		err = copyFile(filepath.Join(b.dir, entry.Name()), filepath.Join(box.dir, entry.Name()), mode)
+		if err != nil {
+			_ = box.Close()
+			return nil, err
+		}
+	}
+
+	return box, nil
+}
+
+// Seed links the content of dir into the box, keeping its layout, e.g. a
+// build cache that saves every run from building it again. Files are hard
+// linked when programs may read them but not change them, and copied
+// otherwise.
+func (b *Box) Seed(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(b.dir, relative)
+
+		switch {
+		case entry.IsDir():
+			// Programs may add files next to the seeded ones, the init
+			// process gives the directories to the user of the box.
+			err := os.MkdirAll(target, 0o755)
+			if err != nil {
+				return fmt.Errorf("creating %s: %w", relative, err)
+			}
+
+			return nil
+		case entry.Type().IsRegular():
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+
+			if b.sandbox.canLink(info) && os.Link(path, target) == nil {
+				return nil
+			}
+
+			return copyFile(path, target, 0o644)
+		default:
+			// Links and devices are left out.
+			return nil
+		}
+	})
+}
+
+func copyFile(source string, target string, mode fs.FileMode) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", source, err)
+	}
+	defer func() {
+		_ = in.Close()
+	}()
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", target, err)
+	}
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		_ = out.Close()
+		return fmt.Errorf("copying %s: %w", source, err)
+	}
+
+	return out.Close()
+}
+
+// Dir is the directory of the box, which commands run in.
+func (b *Box) Dir() string {
+	return b.dir
+}
+
+// Close removes the box along with every file in it.
+func (b *Box) Close() error {
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	defer b.sandbox.releaseID(b.id)
+
+	err := os.RemoveAll(b.dir)
+	if err == nil || !errors.Is(err, fs.ErrPermission) {
+		return err
+	}
+
+	// Files that programs left belong to the user of the box, which a
+	// server that is not root may only remove within the namespace.
+	ctx, cancel := context.WithTimeout(context.Background(), b.sandbox.limits.WallTime)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	_, err = b.sandbox.run(ctx, b.id, initSpec{Remove: b.dir}, nil, nil, stderr)
+	if err != nil {
+		return fmt.Errorf("removing box: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// Command is a program to run in a box.
+type Command struct {
+	// Path is the absolute path of the program.
+	Path string
+	// Args are the arguments, without the name of the program.
+	Args  []string
+	Stdin []byte
+	// Env is added to the minimal environment that programs get.
+	Env    []string
+	Limits Limits
+}
+
+// Result is the outcome of a run.
+type Result struct {
+	Stdout []byte
+	Stderr []byte
+	// ExitCode is -1 when the program was killed by a signal.
+	ExitCode int
+	// Signal is the signal that killed the program, if any.
+	Signal string
+	// TimedOut is set when the program ran out of wall-clock time.
+	TimedOut bool
+	// OutputExceeded is set when the program was killed for writing too
+	// much, its output is then cut at the limit.
+	OutputExceeded bool
+	Duration       time.Duration
+}
+
+// Succeeded tells whether the program exited on its own with a zero code.
+func (r Result) Succeeded() bool {
+	return r.ExitCode == 0 && !r.TimedOut && !r.OutputExceeded
+}
+
+// Run runs the command in the box, and waits for it. The error only
+// reports failures of the sandbox, a program that fails is described by
+// the Result.
+func (b *Box) Run(ctx context.Context, command Command) (Result, error) {
+	if !filepath.IsAbs(command.Path) {
+		return Result{}, fmt.Errorf("program path must be absolute: %q", command.Path)
+	}
+
+	select {
+	case b.sandbox.slots <- struct{}{}:
+		defer func() { <-b.sandbox.slots }()
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+
+	limits := command.Limits.WithDefaults(b.sandbox.limits)
+
+	ctx, cancel := context.WithTimeout(ctx, limits.WallTime)
+	defer cancel()
+
+	spec := initSpec{
+		Path:   command.Path,
+		Args:   append([]string{filepath.Base(command.Path)}, command.Args...),
+		Dir:    b.dir,
+		Env:    append(b.environment(), command.Env...),
+		Root:   b.sandbox.root,
+		Mounts: b.sandbox.mounts,
+		Limits: limits,
+	}
+
+	output := &outputLimit{remaining: limits.OutputBytes, exceeded: cancel}
+	stdout := &limitedWriter{limit: output}
+	stderr := &limitedWriter{limit: output}
+
+	startedAt := time.Now()
+	cmd, err := b.sandbox.run(ctx, b.id, spec, bytes.NewReader(command.Stdin), stdout, stderr)
+	result := Result{
+		Stdout:         stdout.buffer.Bytes(),
+		Stderr:         stderr.buffer.Bytes(),
+		OutputExceeded: output.hasExceeded(),
+		Duration:       time.Since(startedAt),
+	}
+	if !result.OutputExceeded {
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			result.TimedOut = true
+		case ctx.Err() != nil:
+			// The caller gave up, the program did nothing wrong.
+			return result, ctx.Err()
+		}
+	}
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.ExitCode = 0
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+		result.Signal = exitSignal(exitErr)
+	case errors.Is(err, exec.ErrWaitDelay):
+		// The program exited, some process it started kept its output open.
+		result.ExitCode = cmd.ProcessState.ExitCode()
+	default:
+		return result, fmt.Errorf("running sandboxed program: %w", err)
+	}
+
+	if result.ExitCode == initFailure && bytes.HasPrefix(result.Stderr, []byte(initFailurePrefix)) {
+		return result, fmt.Errorf("starting sandboxed program: %s", strings.TrimSpace(string(result.Stderr[len(initFailurePrefix):])))
+	}
+
+	return result, nil
+}
+
+// run runs the init process with the spec, and waits for it. The init
+// process waits in turn for the users of its namespace to be mapped.
+func (s *Sandbox) run(ctx context.Context, id int, spec initSpec, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*exec.Cmd, error) {
+	encoded, err := spec.encode()
+	if err != nil {
+		return nil, err
+	}
+
+	mapped, signalMapped, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating pipe: %w", err)
+	}
+	defer func() {
+		_ = signalMapped.Close()
+	}()
+
+	cmd := exec.CommandContext(ctx, "/proc/self/exe")
+	cmd.Args = []string{initName, encoded}
+	// The environment of the server holds its secrets.
+	cmd.Env = []string{}
+	cmd.Dir = s.workDir
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.ExtraFiles = []*os.File{mapped}
+	cmd.SysProcAttr = sysProcAttr()
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Start()
+	_ = mapped.Close()
+	if err != nil {
+		return cmd, err
+	}
+
+	err = s.mapIDs(cmd.Process.Pid, id)
+	if err == nil {
+		_, err = signalMapped.Write([]byte{1})
+	}
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return cmd, fmt.Errorf("mapping sandbox users: %w", err)
+	}
+
+	return cmd, cmd.Wait()
+}
+
+// environment is the whole environment of a program, besides Command.Env.
+func (b *Box) environment() []string {
+	return []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + b.dir,
+		"TMPDIR=/tmp",
+		"LANG=C.UTF-8",
+	}
+}
+
+// exitSignal is the name of the signal that killed the program, if any.
+func exitSignal(err *exec.ExitError) string {
+	status, ok := err.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return ""
+	}
+
+	return status.Signal().String()
+}
@@ -0,0 +1,400 @@
+package sandbox
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxUser is the user and group that programs run as within their
+// namespace, mapped to the host user and group of their box. The server
+// is mapped to root, so that the init process may set up the namespace.
+const sandboxUser = 1000
+
+// tmpSize caps the private /tmp of every run, which takes memory.
+const tmpSize = 64 << 20
+
+// devices are the devices that programs see.
+var devices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom"}
+
+func supported() error {
+	_, err := os.Stat("/proc/self/ns/user")
+	if err != nil {
+		return fmt.Errorf("%w: user namespaces are not available: %v", ErrUnsupported, err)
+	}
+
+	// Only root may map other users than itself by writing the maps.
+	if os.Getuid() != 0 {
+		for _, program := range []string{"newuidmap", "newgidmap"} {
+			_, err := exec.LookPath(program)
+			if err != nil {
+				return fmt.Errorf("%w: %s is required when not running as root: %v", ErrUnsupported, program, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// canLink tells whether a file may be shared with programs through a hard
+// link, which requires that they cannot write to it.
+func (s *Sandbox) canLink(info fs.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return false
+	}
+
+	if s.users.contains(int(stat.Uid)) {
+		return false
+	}
+	if s.groups.contains(int(stat.Gid)) && info.Mode().Perm()&0o020 != 0 {
+		return false
+	}
+
+	return info.Mode().Perm()&0o002 == 0
+}
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWUSER |
+			syscall.CLONE_NEWPID |
+			syscall.CLONE_NEWNET |
+			syscall.CLONE_NEWIPC |
+			syscall.CLONE_NEWUTS |
+			syscall.CLONE_NEWNS,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// mapIDs maps the server to root, and the sandbox user to the user and
+// group of the box, within the namespace of the init process.
+func (s *Sandbox) mapIDs(pid int, id int) error {
+	user, group := s.users.First+id, s.groups.First+id
+	uidMap := []int{0, os.Getuid(), 1, sandboxUser, user, 1}
+	gidMap := []int{0, os.Getgid(), 1, sandboxUser, group, 1}
+
+	if os.Getuid() == 0 {
+		err := writeIDMap(fmt.Sprintf("/proc/%d/uid_map", pid), uidMap)
+		if err != nil {
+			return err
+		}
+
+		return writeIDMap(fmt.Sprintf("/proc/%d/gid_map", pid), gidMap)
+	}
+
+	err := runIDMap("newuidmap", pid, uidMap)
+	if err != nil {
+		return err
+	}
+
+	return runIDMap("newgidmap", pid, gidMap)
+}
+
+func writeIDMap(path string, mapping []int) error {
+	var content []byte
+	for i := 0; i < len(mapping); i += 3 {
+		content = fmt.Appendf(content, "%d %d %d\n", mapping[i], mapping[i+1], mapping[i+2])
+	}
+
+	// The map has to be written at once.
+	err := os.WriteFile(path, content, 0)
+	if err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func runIDMap(program string, pid int, mapping []int) error {
+	args := []string{strconv.Itoa(pid)}
+	for _, id := range mapping {
+		args = append(args, strconv.Itoa(id))
+	}
+
+	output, err := exec.Command(program, args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("running %s: %w: %s", program, err, output)
+	}
+
+	return nil
+}
+
+// awaitMapping is the first stage of the init process, which waits for
+// the server to map the users, then executes the second stage. Only then
+// is it root within the namespace, with the capabilities that come with
+// it.
+func awaitMapping(arg string) error {
+	mapped := os.NewFile(3, "mapped")
+	n, _ := mapped.Read(make([]byte, 1))
+	if n != 1 {
+		return fmt.Errorf("the users of the namespace were not mapped")
+	}
+	_ = mapped.Close()
+
+	err := unix.Exec("/proc/self/exe", []string{initSetupName, arg}, []string{})
+	return fmt.Errorf("executing the setup of the init process: %w", err)
+}
+
+// runInit builds the root of the program, drops to the sandbox user,
+// applies the limits, and replaces the init process by the program. It
+// runs as the first process of the PID namespace, so the whole namespace
+// goes away with the program.
+func runInit(spec initSpec) error {
+	if spec.Remove != "" {
+		err := os.RemoveAll(spec.Remove)
+		if err != nil {
+			return fmt.Errorf("removing box: %w", err)
+		}
+
+		os.Exit(0)
+	}
+
+	err := buildRoot(spec)
+	if err != nil {
+		return err
+	}
+
+	// Setting the ids drops every capability. The syscall package sets
+	// them on every thread.
+	err = syscall.Setgroups(nil)
+	if err != nil {
+		return fmt.Errorf("dropping groups: %w", err)
+	}
+	err = syscall.Setresgid(sandboxUser, sandboxUser, sandboxUser)
+	if err != nil {
+		return fmt.Errorf("setting group: %w", err)
+	}
+	err = syscall.Setresuid(sandboxUser, sandboxUser, sandboxUser)
+	if err != nil {
+		return fmt.Errorf("setting user: %w", err)
+	}
+
+	err = unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("setting no new privileges: %w", err)
+	}
+
+	cpuSeconds := uint64((spec.Limits.CPUTime + 999_999_999) / 1_000_000_000)
+	limits := []struct {
+		resource int
+		value    uint64
+	}{
+		{unix.RLIMIT_CPU, cpuSeconds},
+		{unix.RLIMIT_AS, spec.Limits.MemoryBytes},
+		{unix.RLIMIT_NPROC, spec.Limits.Processes},
+		{unix.RLIMIT_FSIZE, spec.Limits.FileSizeBytes},
+		{unix.RLIMIT_NOFILE, spec.Limits.OpenFiles},
+		{unix.RLIMIT_CORE, 0},
+	}
+	for _, limit := range limits {
+		err := unix.Setrlimit(limit.resource, &unix.Rlimit{Cur: limit.value, Max: limit.value})
+		if err != nil {
+			return fmt.Errorf("setting resource limit %d: %w", limit.resource, err)
+		}
+	}
+
+	err = os.Chdir(spec.Dir)
+	if err != nil {
+		return fmt.Errorf("changing directory: %w", err)
+	}
+
+	err = unix.Exec(spec.Path, spec.Args, spec.Env)
+	return fmt.Errorf("executing %s: %w", spec.Path, err)
+}
+
+// buildRoot mounts a tmpfs on the root directory, holding the read-only
+// mounts, the devices, /proc, a private /tmp and the box, then makes it
+// the read-only root of the namespace.
+func buildRoot(spec initSpec) error {
+	// Nothing mounted from then on may reach the host.
+	err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("making mounts private: %w", err)
+	}
+
+	err = unix.Mount("tmpfs", spec.Root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755,size=1m")
+	if err != nil {
+		return fmt.Errorf("mounting root: %w", err)
+	}
+
+	for _, path := range spec.Mounts {
+		err := bindMount(path, filepath.Join(spec.Root, path), true)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, device := range devices {
+		err := bindMount(device, filepath.Join(spec.Root, device), false)
+		if err != nil {
+			return err
+		}
+	}
+	links := map[string]string{"fd": "/proc/self/fd", "stdin": "/proc/self/fd/0", "stdout": "/proc/self/fd/1", "stderr": "/proc/self/fd/2"}
+	for name, target := range links {
+		err := os.Symlink(target, filepath.Join(spec.Root, "dev", name))
+		if err != nil {
+			return fmt.Errorf("linking /dev/%s: %w", name, err)
+		}
+	}
+
+	err = mountFilesystem("proc", filepath.Join(spec.Root, "proc"), unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	if err != nil {
+		return err
+	}
+
+	err = mountFilesystem("tmpfs", filepath.Join(spec.Root, "tmp"), unix.MS_NOSUID|unix.MS_NODEV, fmt.Sprintf("mode=1777,size=%d", tmpSize))
+	if err != nil {
+		return err
+	}
+
+	err = giveBox(spec.Dir)
+	if err != nil {
+		return err
+	}
+
+	err = bindMount(spec.Dir, filepath.Join(spec.Root, spec.Dir), false)
+	if err != nil {
+		return err
+	}
+
+	// The former root is stacked under the new one, then detached.
+	err = os.Chdir(spec.Root)
+	if err != nil {
+		return fmt.Errorf("changing to root: %w", err)
+	}
+	err = unix.PivotRoot(".", ".")
+	if err != nil {
+		return fmt.Errorf("pivoting root: %w", err)
+	}
+	err = unix.Unmount(".", unix.MNT_DETACH)
+	if err != nil {
+		return fmt.Errorf("detaching the host root: %w", err)
+	}
+
+	err = unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_BIND|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, "")
+	if err != nil {
+		return fmt.Errorf("making root read-only: %w", err)
+	}
+
+	return nil
+}
+
+// bindMount mounts the host path on the target, which is created as the
+// path is, a directory or a file. Symbolic links are copied instead.
+func bindMount(path string, target string, readOnly bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0o755)
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		link, err := os.Readlink(path)
+		if err != nil {
+			return fmt.Errorf("mounting %s: %w", path, err)
+		}
+
+		err = os.Symlink(link, target)
+		if err != nil && !os.IsExist(err) {
+			return fmt.Errorf("mounting %s: %w", path, err)
+		}
+
+		return nil
+	case info.IsDir():
+		err = os.MkdirAll(target, 0o755)
+	default:
+		var f *os.File
+		f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644)
+		if err == nil {
+			err = f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+
+	err = unix.Mount(path, target, "", unix.MS_BIND|unix.MS_REC, "")
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+
+	// Remounting has to keep the flags that the host mount locks.
+	var stat unix.Statfs_t
+	err = unix.Statfs(target, &stat)
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+
+	flags := uintptr(stat.Flags)&(unix.MS_RDONLY|unix.MS_NODEV|unix.MS_NOEXEC|unix.MS_NOATIME|unix.MS_NODIRATIME|unix.MS_RELATIME) |
+		unix.MS_REMOUNT | unix.MS_BIND | unix.MS_NOSUID
+	if readOnly {
+		flags |= unix.MS_RDONLY | unix.MS_NODEV
+	}
+	if info.IsDir() {
+		flags |= unix.MS_NODEV
+	}
+
+	err = unix.Mount("", target, "", flags, "")
+	if err != nil {
+		return fmt.Errorf("remounting %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func mountFilesystem(kind string, target string, flags uintptr, data string) error {
+	err := os.MkdirAll(target, 0o755)
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", kind, err)
+	}
+
+	err = unix.Mount(kind, target, kind, flags, data)
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", kind, err)
+	}
+
+	return nil
+}
+
+// giveBox gives the directories of the box that the server created to
+// the sandbox user. Files are left to the server, they may be linked from
+// elsewhere.
+func giveBox(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok || stat.Uid != 0 {
+			// What programs created is theirs already.
+			return filepath.SkipDir
+		}
+
+		err = os.Lchown(path, sandboxUser, sandboxUser)
+		if err != nil {
+			return fmt.Errorf("giving %s to the sandbox user: %w", path, err)
+		}
+
+		return nil
+	})
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"fmt"
+	"io/fs"
+	"runtime"
+	"syscall"
+)
+
+func supported() error {
+	return fmt.Errorf("%w: %s", ErrUnsupported, runtime.GOOS)
+}
+
+func (s *Sandbox) canLink(info fs.FileInfo) bool {
+	return false
+}
+
+func sysProcAttr() *syscall.SysProcAttr {
+	return nil
+}
+
+func (s *Sandbox) mapIDs(pid int, id int) error {
+	return ErrUnsupported
+}
+
+func awaitMapping(arg string) error {
+	return ErrUnsupported
+}
+
+func runInit(spec initSpec) error {
+	return ErrUnsupported
+}
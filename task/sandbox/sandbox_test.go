@@ -0,0 +1,295 @@
+package sandbox_test
+
+import (
+	"context"
+	"errors"
+	"kodiiing/task/sandbox"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	sandbox.Init()
+	os.Exit(m.Run())
+}
+
+// newSandbox creates a sandbox with a work directory of the test.
+func newSandbox(t *testing.T, limits sandbox.Limits) *sandbox.Sandbox {
+	t.Helper()
+
+	config := sandbox.Config{WorkDir: t.TempDir(), Limits: limits}
+	// Root may run boxes as any users, others take the delegated ones.
+	if os.Getuid() == 0 {
+		config.Users = sandbox.IDRange{First: 200000, Count: 1000}
+	}
+
+	s, err := sandbox.New(config)
+	if errors.Is(err, sandbox.ErrUnsupported) {
+		t.Skipf("sandbox unsupported: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("creating sandbox: %v", err)
+	}
+
+	return s
+}
+
+func newBox(t *testing.T, limits sandbox.Limits, files map[string][]byte) *sandbox.Box {
+	t.Helper()
+
+	box, err := newSandbox(t, limits).Prepare(files)
+	if err != nil {
+		t.Fatalf("preparing box: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = box.Close()
+	})
+
+	return box
+}
+
+// run runs a shell script in the box, and skips the test when the system
+// does not allow user namespaces.
+func run(t *testing.T, box *sandbox.Box, script string, stdin string) sandbox.Result {
+	t.Helper()
+
+	shell, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("no shell available")
+	}
+
+	result, err := box.Run(context.Background(), sandbox.Command{
+		Path:  shell,
+		Args:  []string{"-c", script},
+		Stdin: []byte(stdin),
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "operation not permitted") || strings.Contains(err.Error(), "invalid argument") {
+			t.Skipf("user namespaces unavailable: %v", err)
+		}
+
+		t.Fatalf("running: %v", err)
+	}
+
+	return result
+}
+
+func TestRunStdinAndOutput(t *testing.T) {
+	box := newBox(t, sandbox.Limits{}, map[string][]byte{"input.txt": []byte("from file\n")})
+
+	result := run(t, box, "cat; cat input.txt; echo oops >&2; exit 3", "from stdin\n")
+
+	if got := string(result.Stdout); got != "from stdin\nfrom file\n" {
+		t.Errorf("unexpected stdout: %q", got)
+	}
+	if got := string(result.Stderr); got != "oops\n" {
+		t.Errorf("unexpected stderr: %q", got)
+	}
+	if result.ExitCode != 3 {
+		t.Errorf("expected exit code 3, got %d", result.ExitCode)
+	}
+}
+
+func TestRunIsolation(t *testing.T) {
+	box := newBox(t, sandbox.Limits{}, nil)
+
+	result := run(t, box, "id -u; echo $$; cat /proc/net/dev; env", "")
+	if !result.Succeeded() {
+		t.Fatalf("expected success, got %+v (%s)", result, result.Stderr)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(result.Stdout)), "\n")
+	if lines[0] != "1000" {
+		t.Errorf("expected to run as the sandbox user, got uid %s", lines[0])
+	}
+	if lines[1] != "1" {
+		t.Errorf("expected to be the first process of its namespace, got pid %s", lines[1])
+	}
+	// /proc/net shows the network namespace of the reader.
+	if !strings.Contains(string(result.Stdout), "lo:") || strings.Contains(string(result.Stdout), "eth") {
+		t.Errorf("expected only a loopback interface, got %q", result.Stdout)
+	}
+	for _, line := range lines {
+		if strings.HasPrefix(line, "GOPATH=") || strings.HasPrefix(line, "GOROOT=") {
+			t.Errorf("expected the environment of the server to be dropped, got %s", line)
+		}
+	}
+}
+
+func TestRunFilesystem(t *testing.T) {
+	s := newSandbox(t, sandbox.Limits{})
+	box, err := s.Prepare(nil)
+	if err != nil {
+		t.Fatalf("preparing box: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = box.Close()
+	})
+
+	secret := filepath.Join(filepath.Dir(box.Dir()), "secret")
+	err = os.WriteFile(secret, []byte("secret\n"), 0o644)
+	if err != nil {
+		t.Fatalf("writing secret: %v", err)
+	}
+
+	script := "cat " + secret + "; ls /; touch /usr/escape /escape; echo tmp > /tmp/file && cat /tmp/file"
+	result := run(t, box, script, "")
+
+	if strings.Contains(string(result.Stdout), "secret") {
+		t.Errorf("expected the files of the host to be hidden, got %q", result.Stdout)
+	}
+	for _, hidden := range []string{"root", "home", "var"} {
+		if strings.Contains(string(result.Stdout), hidden+"\n") {
+			t.Errorf("expected /%s to be hidden, got %q", hidden, result.Stdout)
+		}
+	}
+	if !strings.Contains(string(result.Stdout), "tmp\n") {
+		t.Errorf("expected /tmp to be writable, got %q (%s)", result.Stdout, result.Stderr)
+	}
+	if strings.Count(string(result.Stderr), "Read-only file system") != 2 {
+		t.Errorf("expected the root to be read-only, got %q", result.Stderr)
+	}
+}
+
+func TestRunUsersOfBoxes(t *testing.T) {
+	s := newSandbox(t, sandbox.Limits{})
+
+	owners := make(map[uint32]bool)
+	for i := 0; i < 2; i++ {
+		box, err := s.Prepare(nil)
+		if err != nil {
+			t.Fatalf("preparing box: %v", err)
+		}
+		t.Cleanup(func() {
+			_ = box.Close()
+		})
+
+		result := run(t, box, "echo > file", "")
+		if !result.Succeeded() {
+			t.Fatalf("expected success, got %+v (%s)", result, result.Stderr)
+		}
+
+		info, err := os.Stat(filepath.Join(box.Dir(), "file"))
+		if err != nil {
+			t.Fatalf("reading file: %v", err)
+		}
+		owner := info.Sys().(*syscall.Stat_t).Uid
+		if int(owner) == os.Getuid() {
+			t.Errorf("expected the file to belong to the user of the box, got %d", owner)
+		}
+
+		owners[owner] = true
+	}
+
+	if len(owners) != 2 {
+		t.Errorf("expected every box to run as a user of its own, got %v", owners)
+	}
+}
+
+func TestRunWritesIntoTheBox(t *testing.T) {
+	box := newBox(t, sandbox.Limits{}, nil)
+
+	result := run(t, box, "echo compiled > program && cat program", "")
+	if string(result.Stdout) != "compiled\n" {
+		t.Errorf("expected to write into the box, got %+v (%s)", result, result.Stderr)
+	}
+
+	_, err := os.Stat(box.Dir() + "/program")
+	if err != nil {
+		t.Errorf("expected the file to stay in the box: %v", err)
+	}
+}
+
+func TestRunWallTimeout(t *testing.T) {
+	box := newBox(t, sandbox.Limits{WallTime: time.Millisecond * 300}, nil)
+
+	result := run(t, box, "sleep 5", "")
+	if !result.TimedOut {
+		t.Errorf("expected a timeout, got %+v", result)
+	}
+	if result.Duration > time.Second*3 {
+		t.Errorf("expected the program to be killed early, took %s", result.Duration)
+	}
+}
+
+func TestRunCPULimit(t *testing.T) {
+	box := newBox(t, sandbox.Limits{CPUTime: time.Second, WallTime: time.Second * 10}, nil)
+
+	result := run(t, box, "while :; do :; done", "")
+	if result.Succeeded() || result.TimedOut {
+		t.Errorf("expected the CPU limit to kill the program, got %+v", result)
+	}
+}
+
+func TestRunOutputLimit(t *testing.T) {
+	box := newBox(t, sandbox.Limits{OutputBytes: 1024}, nil)
+
+	result := run(t, box, "while :; do echo aaaaaaaaaaaaaaaaaaaa; done", "")
+	if !result.OutputExceeded {
+		t.Errorf("expected the output limit to be exceeded, got %+v", result)
+	}
+	if len(result.Stdout) != 1024 {
+		t.Errorf("expected the output to be cut at 1024 bytes, got %d", len(result.Stdout))
+	}
+}
+
+func TestRunProcessLimit(t *testing.T) {
+	box := newBox(t, sandbox.Limits{Processes: 8}, nil)
+
+	result := run(t, box, "for i in 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16; do sleep 1 & done; wait", "")
+	if !strings.Contains(string(result.Stderr), "fork") && !strings.Contains(string(result.Stderr), "resource") {
+		t.Errorf("expected forks to fail, got %+v (%s)", result, result.Stderr)
+	}
+}
+
+func TestRunMissingProgram(t *testing.T) {
+	box := newBox(t, sandbox.Limits{}, nil)
+
+	_, err := box.Run(context.Background(), sandbox.Command{Path: "/does/not/exist"})
+	if err == nil {
+		t.Error("expected an error for a missing program")
+	}
+}
+
+func TestPrepareRejectsPaths(t *testing.T) {
+	_, err := newSandbox(t, sandbox.Limits{}).Prepare(map[string][]byte{"../escape": []byte("x")})
+	if err == nil {
+		t.Error("expected a file outside of the box to be rejected")
+	}
+}
+
+func TestSeed(t *testing.T) {
+	seed := t.TempDir()
+	err := os.MkdirAll(seed+"/cache/00", 0o755)
+	if err != nil {
+		t.Fatalf("creating seed: %v", err)
+	}
+	err = os.WriteFile(seed+"/cache/00/entry", []byte("cached\n"), 0o644)
+	if err != nil {
+		t.Fatalf("creating seed: %v", err)
+	}
+
+	box := newBox(t, sandbox.Limits{}, nil)
+	err = box.Seed(seed)
+	if err != nil {
+		t.Fatalf("seeding: %v", err)
+	}
+
+	result := run(t, box, "cat cache/00/entry; echo new > cache/00/other && cat cache/00/other; echo changed >> cache/00/entry", "")
+	if got := string(result.Stdout); got != "cached\nnew\n" {
+		t.Errorf("expected the seed to be readable and extendable, got %q (%s)", got, result.Stderr)
+	}
+
+	original, err := os.ReadFile(seed + "/cache/00/entry")
+	if err != nil {
+		t.Fatalf("reading seed: %v", err)
+	}
+	if string(original) != "cached\n" {
+		t.Errorf("expected the seed to be left untouched, got %q", original)
+	}
+}
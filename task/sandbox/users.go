@@ -0,0 +1,133 @@
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// IDRange is a range of host user or group ids.
+type IDRange struct {
+	First int
+	Count int
+}
+
+func (r IDRange) contains(id int) bool {
+	return id >= r.First && id < r.First+r.Count
+}
+
+func (r IDRange) within(other IDRange) bool {
+	return r.First >= other.First && r.First+r.Count <= other.First+other.Count
+}
+
+// resolveIDs fills the ranges that are unset with the delegated ones, and
+// checks that the server may map them.
+func resolveIDs(users IDRange, groups IDRange) (IDRange, IDRange, error) {
+	// Root may map any id, and the groups of the users by default.
+	if os.Getuid() == 0 && groups.Count == 0 && users.Count > 0 {
+		groups = users
+	}
+
+	users, err := resolveIDRange(users, "/etc/subuid", os.Getuid())
+	if err != nil {
+		return users, groups, fmt.Errorf("sandbox users: %w", err)
+	}
+
+	groups, err = resolveIDRange(groups, "/etc/subgid", os.Getgid())
+	if err != nil {
+		return users, groups, fmt.Errorf("sandbox groups: %w", err)
+	}
+
+	return users, groups, nil
+}
+
+func resolveIDRange(configured IDRange, file string, own int) (IDRange, error) {
+	if configured.First < 0 || configured.Count < 0 {
+		return configured, fmt.Errorf("invalid range %d+%d", configured.First, configured.Count)
+	}
+	if configured.Count > 0 && (configured.contains(0) || configured.contains(own)) {
+		return configured, fmt.Errorf("range %d+%d holds the server or root", configured.First, configured.Count)
+	}
+	if configured.Count > 0 && os.Getuid() == 0 {
+		return configured, nil
+	}
+
+	delegated, err := delegatedRanges(file)
+	if err != nil {
+		return configured, err
+	}
+
+	if configured.Count == 0 {
+		if len(delegated) == 0 {
+			return configured, fmt.Errorf("%w: no range is configured, nor delegated to the server in %s", ErrUnsupported, file)
+		}
+
+		return delegated[0], nil
+	}
+
+	for _, r := range delegated {
+		if configured.within(r) {
+			return configured, nil
+		}
+	}
+
+	return configured, fmt.Errorf("%w: range %d+%d is not delegated to the server in %s", ErrUnsupported, configured.First, configured.Count, file)
+}
+
+// delegatedRanges reads the ranges that file, in the format of
+// /etc/subuid, delegates to the user of the server.
+func delegatedRanges(file string) ([]IDRange, error) {
+	owners := []string{strconv.Itoa(os.Getuid())}
+	current, err := user.LookupId(owners[0])
+	if err == nil {
+		owners = append(owners, current.Username)
+	}
+
+	f, err := os.Open(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+
+	var ranges []IDRange
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) != 3 {
+			continue
+		}
+
+		owned := false
+		for _, owner := range owners {
+			owned = owned || fields[0] == owner
+		}
+		if !owned {
+			continue
+		}
+
+		first, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil || count <= 0 {
+			continue
+		}
+
+		ranges = append(ranges, IDRange{First: first, Count: count})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", file, err)
+	}
+
+	return ranges, nil
+}
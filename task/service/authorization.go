@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	taskRepository "kodiiing/task/repository"
+	task_stub "kodiiing/task/stub"
+	"net/http"
+)
+
+// The permission that each RPC requires.
+var (
+	rpcListTasks           = auth.RPC{Name: "ListTasks", Permission: auth.PermissionTaskRead}
+	rpcStartTask           = auth.RPC{Name: "StartTask", Permission: auth.PermissionTaskAttempt}
+	rpcExecuteCode         = auth.RPC{Name: "ExecuteCode", Permission: auth.PermissionTaskAttempt}
+	rpcGetCodeExecution    = auth.RPC{Name: "GetCodeExecution", Permission: auth.PermissionTaskAttempt}
+	rpcCreateStreamTicket  = auth.RPC{Name: "CreateStreamTicket", Permission: auth.PermissionTaskAttempt}
+	rpcStreamCodeExecution = auth.RPC{Name: "StreamCodeExecution", Permission: auth.PermissionTaskAttempt}
+	rpcSubmitTask          = auth.RPC{Name: "SubmitTask", Permission: auth.PermissionTaskAttempt}
+	rpcPostTaskAssessment  = auth.RPC{Name: "PostTaskAssessment", Permission: auth.PermissionTaskAttempt}
+	rpcSubmitTaskFeedback  = auth.RPC{Name: "SubmitTaskFeedback", Permission: auth.PermissionTaskAttempt}
+	rpcListTestCases       = auth.RPC{Name: "ListTestCases", Permission: auth.PermissionTaskAuthor}
+	rpcCreateTestCase      = auth.RPC{Name: "CreateTestCase", Permission: auth.PermissionTaskAuthor}
+	rpcUpdateTestCase      = auth.RPC{Name: "UpdateTestCase", Permission: auth.PermissionTaskAuthor}
+	rpcDeleteTestCase      = auth.RPC{Name: "DeleteTestCase", Permission: auth.PermissionTaskAuthor}
+	rpcReorderTestCases    = auth.RPC{Name: "ReorderTestCases", Permission: auth.PermissionTaskAuthor}
+)
+
+// authorizeTaskAuthor checks that the user may change the task, which only
+// its author and moderators may do.
+func (s *TaskService) authorizeTaskAuthor(ctx context.Context, user *auth.User, taskId int64) *task_stub.TaskServiceError {
+	author, err := s.taskRepository.TaskAuthor(ctx, taskId)
+	if err != nil {
+		if errors.Is(err, taskRepository.ErrNoRows) {
+			return &task_stub.TaskServiceError{
+				StatusCode: http.StatusNotFound,
+				Error:      fmt.Errorf("task not found"),
+			}
+		}
+
+		return &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	if user.HasPermission(auth.PermissionTaskModerate) || (author.Valid && author.Int64 == user.ID) {
+		return nil
+	}
+
+	return &task_stub.TaskServiceError{
+		StatusCode: http.StatusForbidden,
+		Error:      fmt.Errorf("%w: only the author of the task may change it", auth.ErrForbidden),
+	}
+}
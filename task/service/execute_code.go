@@ -2,10 +2,375 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/task/language"
+	taskRepository "kodiiing/task/repository"
 	task_stub "kodiiing/task/stub"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	// maxCodeLength caps the code that a learner may send.
+	maxCodeLength = 64 << 10
+	// maxPendingExecutions caps the executions of a learner that wait in
+	// the queue or run.
+	maxPendingExecutions = 3
+	// streamPollInterval is how often a stream checks on its execution, in
+	// case a notification was missed.
+	streamPollInterval = time.Second * 5
+	// streamHeartbeatInterval keeps proxies from closing idle streams.
+	streamHeartbeatInterval = time.Second * 15
 )
 
 func (s *TaskService) ExecuteCode(ctx context.Context, req *task_stub.ExecuteCodeRequest) (*task_stub.ExecuteCodeResponse, *task_stub.TaskServiceError) {
-	//TODO implement me
-	panic("implement me")
+	ctx, span := tracer.Start(ctx, "TaskService.ExecuteCode")
+	defer span.End()
+
+	ctx, user, authErr := auth.AuthorizeRPC(ctx, s.authorization, req.Auth.AccessToken, rpcExecuteCode)
+	if authErr != nil {
+		span.SetStatus(codes.Error, "error when authorizing user")
+		span.RecordError(authErr)
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	taskId, err := strconv.ParseInt(req.TaskId, 10, 64)
+	if err != nil {
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("invalid task id"),
+		}
+	}
+	if req.Code == "" {
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("code is required"),
+		}
+	}
+	if len(req.Code) > maxCodeLength {
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Error:      fmt.Errorf("code is longer than %d bytes", maxCodeLength),
+		}
+	}
+
+	span.SetAttributes(attribute.Int64("task_id", taskId))
+
+	runtime, serviceErr := s.runtimeOf(ctx, taskId, req.Language)
+	if serviceErr != nil {
+		return &task_stub.ExecuteCodeResponse{}, serviceErr
+	}
+
+	span.SetAttributes(attribute.String("language", runtime.Name))
+
+	pending, err := s.taskRepository.CountPendingCodeExecutions(ctx, user.ID)
+	if err != nil {
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+	if pending >= maxPendingExecutions {
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusTooManyRequests,
+			Error:      fmt.Errorf("wait for your previous code to finish running"),
+		}
+	}
+
+	execution, err := s.taskRepository.EnqueueCodeExecution(ctx, taskRepository.CodeExecution{
+		TaskId:   taskId,
+		UserId:   user.ID,
+		Language: runtime.Name,
+		Code:     req.Code,
+	})
+	if err != nil {
+		span.SetStatus(codes.Error, "error when enqueuing code execution")
+		span.RecordError(err)
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	span.SetAttributes(attribute.Int64("execution_id", execution.Id))
+
+	return codeExecutionResponse(execution, nil), nil
+}
+
+func (s *TaskService) GetCodeExecution(ctx context.Context, req *task_stub.GetCodeExecutionRequest) (*task_stub.ExecuteCodeResponse, *task_stub.TaskServiceError) {
+	ctx, span := tracer.Start(ctx, "TaskService.GetCodeExecution")
+	defer span.End()
+
+	ctx, execution, serviceErr := s.authorizeCodeExecution(ctx, req, rpcGetCodeExecution)
+	if serviceErr != nil {
+		return &task_stub.ExecuteCodeResponse{}, serviceErr
+	}
+
+	results, err := s.taskRepository.CodeExecutionResults(ctx, execution.Id, -1)
+	if err != nil {
+		return &task_stub.ExecuteCodeResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	response := codeExecutionResponse(execution, results)
+	err = s.setNextTask(ctx, execution, response)
+	if err != nil {
+		return &task_stub.ExecuteCodeResponse{}, codeExecutionError(err)
+	}
+
+	return response, nil
+}
+
+func (s *TaskService) StreamCodeExecution(ctx context.Context, req *task_stub.StreamCodeExecutionRequest, stream task_stub.CodeExecutionStream) *task_stub.TaskServiceError {
+	ctx, span := tracer.Start(ctx, "TaskService.StreamCodeExecution")
+	defer span.End()
+
+	var execution taskRepository.CodeExecution
+	var serviceErr *task_stub.TaskServiceError
+	if req.Ticket != "" {
+		execution, serviceErr = s.consumeStreamTicket(ctx, req.Ticket)
+	} else {
+		ctx, execution, serviceErr = s.authorizeCodeExecution(ctx, &task_stub.GetCodeExecutionRequest{
+			Auth:        req.Auth,
+			ExecutionId: req.ExecutionId,
+		}, rpcStreamCodeExecution)
+	}
+	if serviceErr != nil {
+		return serviceErr
+	}
+
+	// Subscribing first, so that no progress is missed in between.
+	progress, unsubscribe := s.executions.Subscribe(execution.Id)
+	defer unsubscribe()
+
+	poll := time.NewTicker(streamPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	var results []taskRepository.CodeExecutionResult
+	position := int32(-1)
+	for {
+		var err error
+		execution, err = s.taskRepository.CodeExecution(ctx, execution.Id)
+		if err != nil {
+			return codeExecutionError(err)
+		}
+
+		// The results are read after the execution, so that none that
+		// came before it finished are missed.
+		added, err := s.taskRepository.CodeExecutionResults(ctx, execution.Id, position)
+		if err != nil {
+			return codeExecutionError(err)
+		}
+
+		for _, result := range added {
+			err := stream.Send(task_stub.CODE_EXECUTION_EVENT_TEST_CASE, maskTestCase(result))
+			if err != nil {
+				// The client is gone.
+				return nil
+			}
+
+			position = result.Position
+		}
+		results = append(results, added...)
+
+		if execution.Finished() {
+			response := codeExecutionResponse(execution, results)
+			err := s.setNextTask(ctx, execution, response)
+			if err != nil {
+				return codeExecutionError(err)
+			}
+
+			err = stream.Send(task_stub.CODE_EXECUTION_EVENT_DONE, response)
+			if err != nil {
+				span.RecordError(fmt.Errorf("sending done event: %w", err))
+			}
+
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-progress:
+		case <-poll.C:
+		case <-heartbeat.C:
+			err := stream.Heartbeat()
+			if err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// authorizeCodeExecution authorizes the RPC, and returns the execution when
+// it belongs to the user.
+func (s *TaskService) authorizeCodeExecution(ctx context.Context, req *task_stub.GetCodeExecutionRequest, rpc auth.RPC) (context.Context, taskRepository.CodeExecution, *task_stub.TaskServiceError) {
+	ctx, user, authErr := auth.AuthorizeRPC(ctx, s.authorization, req.Auth.AccessToken, rpc)
+	if authErr != nil {
+		return ctx, taskRepository.CodeExecution{}, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	executionId, err := strconv.ParseInt(req.ExecutionId, 10, 64)
+	if err != nil {
+		return ctx, taskRepository.CodeExecution{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("invalid execution id"),
+		}
+	}
+
+	execution, err := s.taskRepository.CodeExecution(ctx, executionId)
+	if err != nil {
+		return ctx, taskRepository.CodeExecution{}, codeExecutionError(err)
+	}
+
+	// The code of other learners is not to be seen, nor is the existence
+	// of their executions.
+	if execution.UserId != user.ID {
+		return ctx, taskRepository.CodeExecution{}, codeExecutionError(taskRepository.ErrNoRows)
+	}
+
+	return ctx, execution, nil
+}
+
+func codeExecutionError(err error) *task_stub.TaskServiceError {
+	if errors.Is(err, taskRepository.ErrNoRows) {
+		return &task_stub.TaskServiceError{
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("code execution not found"),
+		}
+	}
+
+	return &task_stub.TaskServiceError{
+		StatusCode: http.StatusInternalServerError,
+		Error:      err,
+	}
+}
+
+// codeExecutionResponse is the execution as shown to the learner, its
+// output is only set once it has finished.
+func codeExecutionResponse(execution taskRepository.CodeExecution, results []taskRepository.CodeExecutionResult) *task_stub.ExecuteCodeResponse {
+	response := &task_stub.ExecuteCodeResponse{
+		ExecutionId: strconv.FormatInt(execution.Id, 10),
+		Status:      execution.Status,
+		TestCases:   make([]task_stub.TestCase, 0, len(results)),
+		Error:       execution.Error,
+	}
+	for _, result := range results {
+		response.TestCases = append(response.TestCases, maskTestCase(result))
+	}
+
+	if execution.Finished() {
+		response.Output = execution.Output
+		response.AllowedToSubmit = execution.AllowedToSubmit
+	}
+
+	return response
+}
+
+// setNextTask sets the task to take next on the response of an execution
+// that graded a submission. It is only computed once the execution has
+// finished, as the grade decides whether the task is finished.
+func (s *TaskService) setNextTask(ctx context.Context, execution taskRepository.CodeExecution, response *task_stub.ExecuteCodeResponse) error {
+	if !execution.SubmissionId.Valid || !execution.Finished() {
+		return nil
+	}
+
+	nextTaskId, err := s.taskRepository.NextTask(ctx, execution.UserId, execution.TaskId)
+	if err != nil {
+		return err
+	}
+	if nextTaskId.Valid {
+		response.NextTaskId = strconv.FormatInt(nextTaskId.Int64, 10)
+	}
+
+	return nil
+}
+
+// runtimeOf returns the runtime of the requested language. The language may
+// be left out for a task that accepts a single one.
+func (s *TaskService) runtimeOf(ctx context.Context, taskId int64, requested string) (language.Runtime, *task_stub.TaskServiceError) {
+	accepted, err := s.taskRepository.TaskLanguages(ctx, taskId)
+	if err != nil {
+		if errors.Is(err, taskRepository.ErrNoRows) {
+			return language.Runtime{}, &task_stub.TaskServiceError{
+				StatusCode: http.StatusNotFound,
+				Error:      fmt.Errorf("task not found"),
+			}
+		}
+
+		return language.Runtime{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	requested = strings.ToLower(strings.TrimSpace(requested))
+	if requested == "" {
+		if len(accepted) != 1 {
+			return language.Runtime{}, &task_stub.TaskServiceError{
+				StatusCode: http.StatusBadRequest,
+				Error:      fmt.Errorf("language is required"),
+			}
+		}
+
+		requested = accepted[0]
+	}
+
+	if len(accepted) > 0 && !acceptsLanguage(accepted, requested) {
+		return language.Runtime{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("task does not accept %s, use one of %s", requested, strings.Join(accepted, ", ")),
+		}
+	}
+
+	runtime, err := s.languages.Get(requested)
+	if err != nil {
+		return language.Runtime{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("unsupported language %s, use one of %s", requested, strings.Join(s.languages.Names(), ", ")),
+		}
+	}
+
+	return runtime, nil
+}
+
+func acceptsLanguage(accepted []string, name string) bool {
+	for _, language := range accepted {
+		if strings.EqualFold(language, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskTestCase is the result of a test case as shown to the learner,
+// hidden test cases only tell whether they passed.
+func maskTestCase(result taskRepository.CodeExecutionResult) task_stub.TestCase {
+	if result.Hidden {
+		return task_stub.TestCase{
+			Position: result.Position,
+			Success:  result.Success,
+			Hidden:   true,
+		}
+	}
+
+	return task_stub.TestCase{
+		Position: result.Position,
+		Input:    result.Input,
+		Expected: result.Expected,
+		Output:   result.Output,
+		Success:  result.Success,
+	}
 }
@@ -4,39 +4,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"kodiiing/auth"
 	"net/http"
 	"time"
 
-	"kodiiing/auth"
 	task_stub "kodiiing/task/stub"
 
 	"github.com/jackc/pgx/v5"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/trace"
 )
 
 func (s *TaskService) ListTasks(ctx context.Context, req *task_stub.ListTasksRequest) (*task_stub.ListTasksResponse, *task_stub.TaskServiceError) {
 	ctx, span := tracer.Start(ctx, "TaskService.ListTasks")
 	defer span.End()
 
-	// Authenticate user
-	span.AddEvent("authenticating user")
-	authenticatedUser, err := s.authentication.Authenticate(ctx, req.Auth.AccessToken)
-	if err != nil {
-		span.SetStatus(codes.Error, "error when authenticating user")
-		if errors.Is(err, auth.ErrParameterEmpty) || errors.Is(err, auth.ErrUserNotFound) {
-			return &task_stub.ListTasksResponse{}, &task_stub.TaskServiceError{
-				StatusCode: http.StatusUnauthorized,
-				Error:      fmt.Errorf("unauthenticated: %w", err),
-			}
-		}
-
-		span.RecordError(err, trace.WithAttributes(attribute.String("body", "tes")))
-		return nil, &task_stub.TaskServiceError{
-			StatusCode: http.StatusInternalServerError,
-			Error:      fmt.Errorf("authenticating user: %w", err),
-		}
+	// Authorize user
+	span.AddEvent("authorizing user")
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, s.authorization, req.Auth.AccessToken, rpcListTasks)
+	if authErr != nil {
+		span.SetStatus(codes.Error, "error when authorizing user")
+		span.RecordError(authErr)
+		return &task_stub.ListTasksResponse{}, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
 	}
 
 	// TODO: filter task by track ID
@@ -68,6 +56,7 @@ func (s *TaskService) ListTasks(ctx context.Context, req *task_stub.ListTasksReq
 			Completed:   task.Completed,
 			Content:     task.Task.Content,
 			Author:      task.Task.Author,
+			Languages:   task.Task.Languages,
 		}
 
 		if task.SatisfactionLevel.Valid {
@@ -40,19 +40,9 @@ func ValidatePostTaskAssessmentReq(req task_stub.PostTaskAssessmentRequest) *tas
 
 func (s *TaskService) PostTaskAssessment(ctx context.Context, req *task_stub.PostTaskAssessmentRequest) (*task_stub.EmptyResponse, *task_stub.TaskServiceError) {
 	// authenticate user
-	authenticatedUser, err := s.authentication.Authenticate(ctx, req.Auth.AccessToken)
-	if err != nil {
-		if errors.Is(err, auth.ErrParameterEmpty) || errors.Is(err, auth.ErrUserNotFound) {
-			return &task_stub.EmptyResponse{}, &task_stub.TaskServiceError{
-				StatusCode: http.StatusUnauthorized,
-				Error:      fmt.Errorf("unauthenticated: %w", err),
-			}
-		}
-
-		return nil, &task_stub.TaskServiceError{
-			StatusCode: http.StatusInternalServerError,
-			Error:      fmt.Errorf("authenticating user: %w", err),
-		}
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, s.authorization, req.Auth.AccessToken, rpcPostTaskAssessment)
+	if authErr != nil {
+		return &task_stub.EmptyResponse{}, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
 	}
 
 	// validate request
@@ -3,6 +3,9 @@ package service
 import (
 	"fmt"
 	"kodiiing/auth"
+	"kodiiing/cache"
+	"kodiiing/task/execution"
+	"kodiiing/task/language"
 	taskRepository "kodiiing/task/repository"
 	task_stub "kodiiing/task/stub"
 
@@ -11,16 +14,27 @@ import (
 )
 
 type TaskService struct {
-	pool           *pgxpool.Pool
-	authentication auth.Authenticate
+	pool          *pgxpool.Pool
+	authorization auth.Authorize
 
 	taskRepository *taskRepository.Repository
+	languages      *language.Registry
+	executions     *execution.Listener
+	streamTickets  *cache.Family[streamTicket]
 }
 
 type Config struct {
 	Pool           *pgxpool.Pool
-	Authentication auth.Authenticate
+	Authorization  auth.Authorize
 	TaskRepository *taskRepository.Repository
+	// Languages are the runtimes that code may be written for.
+	Languages *language.Registry
+	// Executions tells the streams of code executions about their
+	// progress.
+	Executions *execution.Listener
+	// Cache holds the tickets of the streams of code executions, it must
+	// be shared by every instance that serves the task service.
+	Cache cache.Cache
 }
 
 var tracer = otel.Tracer("kodiiing/task/service")
@@ -29,16 +43,31 @@ func NewTaskService(config *Config) (task_stub.TaskServiceServer, error) {
 	if config.Pool == nil {
 		return nil, fmt.Errorf("database connection required on task/service module")
 	}
-	if config.Authentication == nil {
-		return nil, fmt.Errorf("authentication service required on task/service module")
+	if config.Authorization == nil {
+		return nil, fmt.Errorf("authorization service required on task/service module")
 	}
 	if config.TaskRepository == nil {
 		return nil, fmt.Errorf("taskRepository required on task/service module")
 	}
+	if config.Languages == nil {
+		return nil, fmt.Errorf("languages required on task/service module")
+	}
+	if config.Executions == nil {
+		return nil, fmt.Errorf("executions listener required on task/service module")
+	}
+	if config.Cache == nil {
+		return nil, fmt.Errorf("cache required on task/service module")
+	}
 
 	return &TaskService{
 		pool:           config.Pool,
-		authentication: config.Authentication,
+		authorization:  config.Authorization,
 		taskRepository: config.TaskRepository,
+		languages:      config.Languages,
+		executions:     config.Executions,
+		streamTickets: cache.NewFamily[streamTicket](config.Cache, cache.FamilyConfig{
+			Prefix: "task:stream:ticket:",
+			TTL:    streamTicketTTL,
+		}),
 	}, nil
 }
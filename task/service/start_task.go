@@ -15,19 +15,9 @@ import (
 
 func (s *TaskService) StartTask(ctx context.Context, req *task_stub.StartTaskRequest) (*task_stub.StartTaskResponse, *task_stub.TaskServiceError) {
 	// Authenticate user
-	authenticatedUser, err := s.authentication.Authenticate(ctx, req.Auth.AccessToken)
-	if err != nil {
-		if errors.Is(err, auth.ErrParameterEmpty) || errors.Is(err, auth.ErrUserNotFound) {
-			return &task_stub.StartTaskResponse{}, &task_stub.TaskServiceError{
-				StatusCode: http.StatusUnauthorized,
-				Error:      fmt.Errorf("unauthenticated: %w", err),
-			}
-		}
-
-		return nil, &task_stub.TaskServiceError{
-			StatusCode: http.StatusInternalServerError,
-			Error:      fmt.Errorf("authenticating user: %w", err),
-		}
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, s.authorization, req.Auth.AccessToken, rpcStartTask)
+	if authErr != nil {
+		return &task_stub.StartTaskResponse{}, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
 	}
 
 	taskId, err := strconv.ParseInt(req.TaskId, 10, 64)
@@ -54,16 +44,19 @@ func (s *TaskService) StartTask(ctx context.Context, req *task_stub.StartTaskReq
 
 	responseData := task_stub.StartTaskResponse{
 		Task: task_stub.Task{
-			Id:                fmt.Sprintf("%d", task.Task.Id),
-			Title:             task.Task.Title,
-			Description:       task.Task.Description,
-			Difficulty:        task.Task.Difficulty,
-			Completed:         task.Completed,
-			Content:           task.Task.Content,
-			Author:            task.Task.Author,
-			SatisfactionLevel: int32(task.SatisfactionLevel),
+			Id:          fmt.Sprintf("%d", task.Task.Id),
+			Title:       task.Task.Title,
+			Description: task.Task.Description,
+			Difficulty:  task.Task.Difficulty,
+			Completed:   task.Completed,
+			Content:     task.Task.Content,
+			Author:      task.Task.Author,
+			Languages:   task.Task.Languages,
 		},
 	}
+	if task.SatisfactionLevel.Valid {
+		responseData.Task.SatisfactionLevel = int32(task.SatisfactionLevel.Int64)
+	}
 	if task.CompletedAt.Valid {
 		responseData.Task.CompletedAt = task.CompletedAt.Time.Format(time.RFC3339)
 	}
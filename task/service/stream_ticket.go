@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/cache"
+	taskRepository "kodiiing/task/repository"
+	task_stub "kodiiing/task/stub"
+	"net/http"
+	"time"
+)
+
+// streamTicketTTL bounds the time between CreateStreamTicket and the
+// request that opens the stream.
+const streamTicketTTL = time.Second * 30
+
+// errInvalidStreamTicket is returned when the ticket is unknown, expired
+// or already used.
+var errInvalidStreamTicket = errors.New("invalid or expired stream ticket")
+
+// streamTicket is kept in the cache between CreateStreamTicket and
+// StreamCodeExecution, it only opens the stream of its execution, which
+// was checked to belong to the user when the ticket was issued.
+type streamTicket struct {
+	ExecutionId int64
+}
+
+func (s *TaskService) CreateStreamTicket(ctx context.Context, req *task_stub.GetCodeExecutionRequest) (*task_stub.StreamTicketResponse, *task_stub.TaskServiceError) {
+	ctx, span := tracer.Start(ctx, "TaskService.CreateStreamTicket")
+	defer span.End()
+
+	ctx, execution, serviceErr := s.authorizeCodeExecution(ctx, req, rpcCreateStreamTicket)
+	if serviceErr != nil {
+		return &task_stub.StreamTicketResponse{}, serviceErr
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return &task_stub.StreamTicketResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("generating stream ticket: %w", err),
+		}
+	}
+	ticket := base64.RawURLEncoding.EncodeToString(b)
+
+	err := s.streamTickets.Set(ctx, ticket, streamTicket{
+		ExecutionId: execution.Id,
+	})
+	if err != nil {
+		return &task_stub.StreamTicketResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("storing stream ticket: %w", err),
+		}
+	}
+
+	return &task_stub.StreamTicketResponse{
+		Ticket:    ticket,
+		ExpiresIn: int64(streamTicketTTL / time.Second),
+	}, nil
+}
+
+// consumeStreamTicket returns the execution that the ticket was issued for,
+// and forgets the ticket so it can only be used once.
+func (s *TaskService) consumeStreamTicket(ctx context.Context, ticket string) (taskRepository.CodeExecution, *task_stub.TaskServiceError) {
+	// Whoever takes the entry first gets to use it.
+	stored, err := s.streamTickets.Take(ctx, ticket)
+	if err != nil {
+		if errors.Is(err, cache.ErrNotFound) {
+			return taskRepository.CodeExecution{}, &task_stub.TaskServiceError{
+				StatusCode: http.StatusUnauthorized,
+				Error:      fmt.Errorf("%w: %w", auth.ErrUnauthenticated, errInvalidStreamTicket),
+			}
+		}
+
+		return taskRepository.CodeExecution{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      fmt.Errorf("getting stream ticket: %w", err),
+		}
+	}
+
+	execution, err := s.taskRepository.CodeExecution(ctx, stored.ExecutionId)
+	if err != nil {
+		return taskRepository.CodeExecution{}, codeExecutionError(err)
+	}
+
+	return execution, nil
+}
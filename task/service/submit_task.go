@@ -2,10 +2,86 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	taskRepository "kodiiing/task/repository"
 	task_stub "kodiiing/task/stub"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 func (s *TaskService) SubmitTask(ctx context.Context, req *task_stub.SubmitTaskRequest) (*task_stub.SubmitTaskResponse, *task_stub.TaskServiceError) {
-	//TODO implement me
-	panic("implement me")
+	ctx, span := tracer.Start(ctx, "TaskService.SubmitTask")
+	defer span.End()
+
+	ctx, user, authErr := auth.AuthorizeRPC(ctx, s.authorization, req.Auth.AccessToken, rpcSubmitTask)
+	if authErr != nil {
+		span.SetStatus(codes.Error, "error when authorizing user")
+		span.RecordError(authErr)
+		return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	taskId, err := strconv.ParseInt(req.TaskId, 10, 64)
+	if err != nil {
+		return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("invalid task id"),
+		}
+	}
+	if req.Submission == "" {
+		return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("submission is required"),
+		}
+	}
+	if len(req.Submission) > maxCodeLength {
+		return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusRequestEntityTooLarge,
+			Error:      fmt.Errorf("submission is longer than %d bytes", maxCodeLength),
+		}
+	}
+
+	span.SetAttributes(attribute.Int64("task_id", taskId))
+
+	runtime, serviceErr := s.runtimeOf(ctx, taskId, req.Language)
+	if serviceErr != nil {
+		return &task_stub.SubmitTaskResponse{}, serviceErr
+	}
+
+	submission, execution, err := s.taskRepository.SubmitTask(ctx, taskRepository.Submission{
+		TaskId:   taskId,
+		UserId:   user.ID,
+		Language: runtime.Name,
+		Code:     req.Submission,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, taskRepository.ErrTaskNotStarted):
+			return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{
+				StatusCode: http.StatusPreconditionFailed,
+				Error:      fmt.Errorf("task must be started before it is submitted"),
+			}
+		case errors.Is(err, taskRepository.ErrTaskFinished), errors.Is(err, taskRepository.ErrSubmissionPending):
+			return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{
+				StatusCode: http.StatusConflict,
+				Error:      err,
+			}
+		default:
+			span.SetStatus(codes.Error, "error when submitting task")
+			span.RecordError(err)
+			return &task_stub.SubmitTaskResponse{}, &task_stub.TaskServiceError{
+				StatusCode: http.StatusInternalServerError,
+				Error:      err,
+			}
+		}
+	}
+
+	return &task_stub.SubmitTaskResponse{
+		SubmissionId: strconv.FormatInt(submission.Id, 10),
+		ExecutionId:  strconv.FormatInt(execution.Id, 10),
+	}, nil
 }
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/task"
+	taskRepository "kodiiing/task/repository"
+	task_stub "kodiiing/task/stub"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxTestCaseLength caps the input and the expected output of a test case.
+	maxTestCaseLength = 1 << 20
+	// maxTestCaseTimeLimit caps the time limit that a test case may set.
+	maxTestCaseTimeLimit = time.Minute
+)
+
+func (s *TaskService) ListTestCases(ctx context.Context, req *task_stub.ListTestCasesRequest) (*task_stub.ListTestCasesResponse, *task_stub.TaskServiceError) {
+	ctx, taskId, serviceErr := s.authorizeTestCases(ctx, req.Auth.AccessToken, rpcListTestCases, req.TaskId)
+	if serviceErr != nil {
+		return &task_stub.ListTestCasesResponse{}, serviceErr
+	}
+
+	return s.listTestCases(ctx, taskId)
+}
+
+func (s *TaskService) CreateTestCase(ctx context.Context, req *task_stub.CreateTestCaseRequest) (*task_stub.TestCaseResponse, *task_stub.TaskServiceError) {
+	ctx, taskId, serviceErr := s.authorizeTestCases(ctx, req.Auth.AccessToken, rpcCreateTestCase, req.TaskId)
+	if serviceErr != nil {
+		return &task_stub.TestCaseResponse{}, serviceErr
+	}
+
+	testCase, serviceErr := testCaseFromDefinition(taskId, req.TestCase)
+	if serviceErr != nil {
+		return &task_stub.TestCaseResponse{}, serviceErr
+	}
+
+	created, err := s.taskRepository.CreateTestCase(ctx, testCase, updatedBy(ctx))
+	if errors.Is(err, taskRepository.ErrNoRows) {
+		return &task_stub.TestCaseResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("task not found"),
+		}
+	}
+	if err != nil {
+		return &task_stub.TestCaseResponse{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return &task_stub.TestCaseResponse{TestCase: testCaseDefinition(created)}, nil
+}
+
+func (s *TaskService) UpdateTestCase(ctx context.Context, req *task_stub.UpdateTestCaseRequest) (*task_stub.TestCaseResponse, *task_stub.TaskServiceError) {
+	ctx, taskId, serviceErr := s.authorizeTestCases(ctx, req.Auth.AccessToken, rpcUpdateTestCase, req.TaskId)
+	if serviceErr != nil {
+		return &task_stub.TestCaseResponse{}, serviceErr
+	}
+
+	testCase, serviceErr := testCaseFromDefinition(taskId, req.TestCase)
+	if serviceErr != nil {
+		return &task_stub.TestCaseResponse{}, serviceErr
+	}
+
+	testCase.Id, serviceErr = parseTestCaseId(req.TestCase.Id)
+	if serviceErr != nil {
+		return &task_stub.TestCaseResponse{}, serviceErr
+	}
+
+	updated, err := s.taskRepository.UpdateTestCase(ctx, testCase, updatedBy(ctx))
+	if err != nil {
+		return &task_stub.TestCaseResponse{}, testCaseError(err)
+	}
+
+	return &task_stub.TestCaseResponse{TestCase: testCaseDefinition(updated)}, nil
+}
+
+func (s *TaskService) DeleteTestCase(ctx context.Context, req *task_stub.DeleteTestCaseRequest) (*task_stub.EmptyResponse, *task_stub.TaskServiceError) {
+	ctx, taskId, serviceErr := s.authorizeTestCases(ctx, req.Auth.AccessToken, rpcDeleteTestCase, req.TaskId)
+	if serviceErr != nil {
+		return &task_stub.EmptyResponse{}, serviceErr
+	}
+
+	testCaseId, serviceErr := parseTestCaseId(req.TestCaseId)
+	if serviceErr != nil {
+		return &task_stub.EmptyResponse{}, serviceErr
+	}
+
+	err := s.taskRepository.DeleteTestCase(ctx, taskId, testCaseId)
+	if err != nil {
+		return &task_stub.EmptyResponse{}, testCaseError(err)
+	}
+
+	return &task_stub.EmptyResponse{}, nil
+}
+
+func (s *TaskService) ReorderTestCases(ctx context.Context, req *task_stub.ReorderTestCasesRequest) (*task_stub.ListTestCasesResponse, *task_stub.TaskServiceError) {
+	ctx, taskId, serviceErr := s.authorizeTestCases(ctx, req.Auth.AccessToken, rpcReorderTestCases, req.TaskId)
+	if serviceErr != nil {
+		return &task_stub.ListTestCasesResponse{}, serviceErr
+	}
+
+	testCaseIds := make([]int64, 0, len(req.TestCaseIds))
+	for _, id := range req.TestCaseIds {
+		testCaseId, serviceErr := parseTestCaseId(id)
+		if serviceErr != nil {
+			return &task_stub.ListTestCasesResponse{}, serviceErr
+		}
+
+		testCaseIds = append(testCaseIds, testCaseId)
+	}
+
+	err := s.taskRepository.ReorderTestCases(ctx, taskId, testCaseIds, updatedBy(ctx))
+	if err != nil {
+		return &task_stub.ListTestCasesResponse{}, testCaseError(err)
+	}
+
+	return s.listTestCases(ctx, taskId)
+}
+
+// authorizeTestCases authorizes the RPC, and checks that the user may
+// change the test cases of the task.
+func (s *TaskService) authorizeTestCases(ctx context.Context, accessToken string, rpc auth.RPC, rawTaskId string) (context.Context, int64, *task_stub.TaskServiceError) {
+	ctx, user, authErr := auth.AuthorizeRPC(ctx, s.authorization, accessToken, rpc)
+	if authErr != nil {
+		return ctx, 0, &task_stub.TaskServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	taskId, err := strconv.ParseInt(rawTaskId, 10, 64)
+	if err != nil {
+		return ctx, 0, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("invalid task id"),
+		}
+	}
+
+	serviceErr := s.authorizeTaskAuthor(ctx, user, taskId)
+	if serviceErr != nil {
+		return ctx, 0, serviceErr
+	}
+
+	return ctx, taskId, nil
+}
+
+func (s *TaskService) listTestCases(ctx context.Context, taskId int64) (*task_stub.ListTestCasesResponse, *task_stub.TaskServiceError) {
+	testCases, err := s.taskRepository.ListTestCases(ctx, taskId)
+	if err != nil {
+		return &task_stub.ListTestCasesResponse{}, testCaseError(err)
+	}
+
+	response := &task_stub.ListTestCasesResponse{
+		TestCases: make([]task_stub.TestCaseDefinition, 0, len(testCases)),
+	}
+	for _, testCase := range testCases {
+		response.TestCases = append(response.TestCases, testCaseDefinition(testCase))
+	}
+
+	return response, nil
+}
+
+// updatedBy is who changes the test cases, as recorded along with them.
+func updatedBy(ctx context.Context) string {
+	user, ok := auth.UserFromContext(ctx)
+	if !ok {
+		return auth.UpdatedBy(ctx, "system")
+	}
+
+	return auth.UpdatedBy(ctx, "user:"+strconv.FormatInt(user.ID, 10))
+}
+
+func parseTestCaseId(id string) (int64, *task_stub.TaskServiceError) {
+	testCaseId, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("invalid test case id"),
+		}
+	}
+
+	return testCaseId, nil
+}
+
+// testCaseFromDefinition validates the definition of an author.
+func testCaseFromDefinition(taskId int64, definition task_stub.TestCaseDefinition) (taskRepository.TestCase, *task_stub.TaskServiceError) {
+	invalid := func(err error) (taskRepository.TestCase, *task_stub.TaskServiceError) {
+		return taskRepository.TestCase{}, &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      err,
+		}
+	}
+
+	if len(definition.Input) > maxTestCaseLength || len(definition.Expected) > maxTestCaseLength {
+		return invalid(fmt.Errorf("input and expected output must not be longer than %d bytes", maxTestCaseLength))
+	}
+	if definition.Weight < 0 {
+		return invalid(fmt.Errorf("weight must not be negative"))
+	}
+
+	timeLimit := time.Duration(definition.TimeLimitMs) * time.Millisecond
+	if timeLimit < 0 || timeLimit > maxTestCaseTimeLimit {
+		return invalid(fmt.Errorf("time limit must be between 0 and %d ms", maxTestCaseTimeLimit.Milliseconds()))
+	}
+
+	comparison := task.Comparison(definition.Comparison)
+	if definition.Comparison > task_stub.TEST_CASE_COMPARISON_REGEX {
+		return invalid(fmt.Errorf("unknown comparison: %d", definition.Comparison))
+	}
+	err := comparison.Validate(definition.Expected, definition.Tolerance)
+	if err != nil {
+		return invalid(err)
+	}
+
+	return taskRepository.TestCase{
+		TaskId:     taskId,
+		Input:      definition.Input,
+		Expected:   definition.Expected,
+		Hidden:     definition.Hidden,
+		Weight:     definition.Weight,
+		TimeLimit:  timeLimit,
+		Comparison: comparison,
+		Tolerance:  definition.Tolerance,
+	}, nil
+}
+
+func testCaseDefinition(testCase taskRepository.TestCase) task_stub.TestCaseDefinition {
+	return task_stub.TestCaseDefinition{
+		Id:          strconv.FormatInt(testCase.Id, 10),
+		Position:    testCase.Position,
+		Input:       testCase.Input,
+		Expected:    testCase.Expected,
+		Hidden:      testCase.Hidden,
+		Weight:      testCase.Weight,
+		TimeLimitMs: int32(testCase.TimeLimit.Milliseconds()),
+		Comparison:  task_stub.TestCaseComparison(testCase.Comparison),
+		Tolerance:   testCase.Tolerance,
+	}
+}
+
+func testCaseError(err error) *task_stub.TaskServiceError {
+	switch {
+	case errors.Is(err, taskRepository.ErrNoRows):
+		return &task_stub.TaskServiceError{
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("test case not found"),
+		}
+	case errors.Is(err, taskRepository.ErrTestCaseOrder):
+		return &task_stub.TaskServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      err,
+		}
+	default:
+		return &task_stub.TaskServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+}
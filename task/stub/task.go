@@ -4,8 +4,11 @@ package task
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"go.opentelemetry.io/otel"
@@ -35,25 +38,61 @@ type StartTaskResponse struct {
 }
 
 type ExecuteCodeRequest struct {
-	Auth   Authentication `json:"auth"`
-	TaskId string         `json:"task_id"`
-	Code   string         `json:"code"`
+	Auth     Authentication `json:"auth"`
+	TaskId   string         `json:"task_id"`
+	Code     string         `json:"code"`
+	Language string         `json:"language"`
 }
 
+// ExecuteCodeResponse is an execution of code, which is queued and run
+// in the background. The other fields are set once it has finished.
 type ExecuteCodeResponse struct {
-	Output          string     `json:"output"`
-	TestCases       []TestCase `json:"test_cases"`
-	AllowedToSubmit bool       `json:"allowed_to_submit"`
+	ExecutionId     string              `json:"execution_id"`
+	Status          CodeExecutionStatus `json:"status"`
+	Output          string              `json:"output"`
+	TestCases       []TestCase          `json:"test_cases"`
+	AllowedToSubmit bool                `json:"allowed_to_submit"`
+	// Error tells why the execution failed.
+	Error string `json:"error"`
+	// NextTaskId is the task to take next, once the execution has graded a
+	// submission. It is empty once the track is done.
+	NextTaskId string `json:"next_task_id"`
+}
+
+type GetCodeExecutionRequest struct {
+	Auth        Authentication `json:"auth"`
+	ExecutionId string         `json:"execution_id"`
+}
+
+// StreamTicketResponse holds a ticket that streams the execution it was
+// issued for, in place of the access token. It is used once, and expires
+// after ExpiresIn seconds.
+type StreamTicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresIn int64  `json:"expires_in"`
+}
+
+// StreamCodeExecutionRequest is authenticated either by Auth, or by a
+// ticket from CreateStreamTicket, which sets the execution to stream.
+type StreamCodeExecutionRequest struct {
+	Auth        Authentication `json:"auth"`
+	ExecutionId string         `json:"execution_id"`
+	Ticket      string         `json:"ticket"`
 }
 
 type SubmitTaskRequest struct {
 	Auth       Authentication `json:"auth"`
 	TaskId     string         `json:"task_id"`
 	Submission string         `json:"submission"`
+	Language   string         `json:"language"`
 }
 
+// SubmitTaskResponse points to the execution that grades the submission,
+// to be streamed like any other. The task to take next is returned with
+// the execution once it has finished.
 type SubmitTaskResponse struct {
-	NextTaskId string `json:"next_task_id"`
+	SubmissionId string `json:"submission_id"`
+	ExecutionId  string `json:"execution_id"`
 }
 
 type PostTaskAssessmentRequest struct {
@@ -77,6 +116,43 @@ type SubmitTaskFeedbackResponse struct {
 	Feedback []Feedback `json:"feedback"`
 }
 
+type ListTestCasesRequest struct {
+	Auth   Authentication `json:"auth"`
+	TaskId string         `json:"task_id"`
+}
+
+type ListTestCasesResponse struct {
+	TestCases []TestCaseDefinition `json:"test_cases"`
+}
+
+type CreateTestCaseRequest struct {
+	Auth     Authentication     `json:"auth"`
+	TaskId   string             `json:"task_id"`
+	TestCase TestCaseDefinition `json:"test_case"`
+}
+
+type UpdateTestCaseRequest struct {
+	Auth     Authentication     `json:"auth"`
+	TaskId   string             `json:"task_id"`
+	TestCase TestCaseDefinition `json:"test_case"`
+}
+
+type TestCaseResponse struct {
+	TestCase TestCaseDefinition `json:"test_case"`
+}
+
+type DeleteTestCaseRequest struct {
+	Auth       Authentication `json:"auth"`
+	TaskId     string         `json:"task_id"`
+	TestCaseId string         `json:"test_case_id"`
+}
+
+type ReorderTestCasesRequest struct {
+	Auth        Authentication `json:"auth"`
+	TaskId      string         `json:"task_id"`
+	TestCaseIds []string       `json:"test_case_ids"`
+}
+
 type Authentication struct {
 	AccessToken string `json:"access_token"`
 }
@@ -91,9 +167,11 @@ type Task struct {
 	Author            string         `json:"author"`
 	CompletedAt       string         `json:"completed_at"`
 	SatisfactionLevel int32          `json:"satisfaction_level"`
+	Languages         []string       `json:"languages"`
 }
 
 type TestCase struct {
+	Position int32  `json:"position"`
 	Input    string `json:"input"`
 	Expected string `json:"expected"`
 	Output   string `json:"output"`
@@ -101,6 +179,22 @@ type TestCase struct {
 	Hidden   bool   `json:"hidden"`
 }
 
+// TestCaseDefinition is a test case as its author sees it.
+type TestCaseDefinition struct {
+	Id       string `json:"id"`
+	Position int32  `json:"position"`
+	Input    string `json:"input"`
+	Expected string `json:"expected"`
+	Hidden   bool   `json:"hidden"`
+	// Weight is the share of the grade that the test case is worth.
+	Weight int32 `json:"weight"`
+	// TimeLimitMs overrides the time limit of the language, zero keeps it.
+	TimeLimitMs int32              `json:"time_limit_ms"`
+	Comparison  TestCaseComparison `json:"comparison"`
+	// Tolerance is used by TEST_CASE_COMPARISON_FLOAT.
+	Tolerance float64 `json:"tolerance"`
+}
+
 type Feedback struct {
 	AuthorId   string `json:"author_id"`
 	AuthorName string `json:"author_name"`
@@ -117,6 +211,42 @@ const (
 	TASK_DIFFICULTY_HARD        TaskDifficulty = 3
 )
 
+type TestCaseComparison uint32
+
+const (
+	TEST_CASE_COMPARISON_LINES      TestCaseComparison = 0
+	TEST_CASE_COMPARISON_EXACT      TestCaseComparison = 1
+	TEST_CASE_COMPARISON_WHITESPACE TestCaseComparison = 2
+	TEST_CASE_COMPARISON_FLOAT      TestCaseComparison = 3
+	TEST_CASE_COMPARISON_REGEX      TestCaseComparison = 4
+)
+
+type CodeExecutionStatus uint32
+
+const (
+	CODE_EXECUTION_STATUS_QUEUED    CodeExecutionStatus = 0
+	CODE_EXECUTION_STATUS_RUNNING   CodeExecutionStatus = 1
+	CODE_EXECUTION_STATUS_COMPLETED CodeExecutionStatus = 2
+	CODE_EXECUTION_STATUS_FAILED    CodeExecutionStatus = 3
+)
+
+// Events sent on the stream of a code execution. A test_case event carries
+// a TestCase as soon as it has run, the done event carries the whole
+// ExecuteCodeResponse and ends the stream.
+const (
+	CODE_EXECUTION_EVENT_TEST_CASE = "test_case"
+	CODE_EXECUTION_EVENT_DONE      = "done"
+	CODE_EXECUTION_EVENT_ERROR     = "error"
+)
+
+// CodeExecutionStream sends Server-Sent Events to the client.
+type CodeExecutionStream interface {
+	// Send writes an event, with its data encoded as JSON.
+	Send(event string, data any) error
+	// Heartbeat writes a comment, which keeps idle connections open.
+	Heartbeat() error
+}
+
 var tracer = otel.Tracer("kodiiing/task/stub")
 
 type TaskServiceServer interface {
@@ -124,10 +254,21 @@ type TaskServiceServer interface {
 	ListTasks(ctx context.Context, req *ListTasksRequest) (*ListTasksResponse, *TaskServiceError)
 	// Starts a task, will marks the task as "ongoing" when viewed by the current user.
 	StartTask(ctx context.Context, req *StartTaskRequest) (*StartTaskResponse, *TaskServiceError)
-	// Executes a code that resides on task if it's a coding task. Will return a test cases result.
+	// Queues a code that resides on task if it's a coding task. The test cases results are
+	// read with GetCodeExecution, or streamed with StreamCodeExecution.
 	ExecuteCode(ctx context.Context, req *ExecuteCodeRequest) (*ExecuteCodeResponse, *TaskServiceError)
-	// Submit a task as a final submission, no more changes after this one.
-	// This should be called after StartTask rpc was called.
+	// Returns a code execution, with the results of the test cases that have run so far.
+	GetCodeExecution(ctx context.Context, req *GetCodeExecutionRequest) (*ExecuteCodeResponse, *TaskServiceError)
+	// Issues a short-lived ticket to stream a code execution with. EventSource can't send the
+	// access token in a header, and tokens in URLs end up in logs, history and Referer headers.
+	CreateStreamTicket(ctx context.Context, req *GetCodeExecutionRequest) (*StreamTicketResponse, *TaskServiceError)
+	// Streams the results of a code execution as Server-Sent Events, until it has finished.
+	// It is also served over GET for EventSource, with only a ticket in the query.
+	StreamCodeExecution(ctx context.Context, req *StreamCodeExecutionRequest, stream CodeExecutionStream) *TaskServiceError
+	// Submit a task, the submission never changes once sent. The task is finished once a
+	// submission passes, until then it may be submitted again, one submission at a time.
+	// This should be called after StartTask rpc was called. The submission is graded against
+	// every test case, hidden ones included, by a code execution.
 	SubmitTask(ctx context.Context, req *SubmitTaskRequest) (*SubmitTaskResponse, *TaskServiceError)
 	// Give an assessment to the user about the task, whether they are happy with it or they
 	// don't like the given task.
@@ -135,6 +276,15 @@ type TaskServiceServer interface {
 	// Submit task feedback from the user who did the task. For submitting feedback that comes
 	// from the code reviewers, see the codereview proto.
 	SubmitTaskFeedback(ctx context.Context, req *SubmitTaskFeedbackRequest) (*SubmitTaskFeedbackResponse, *TaskServiceError)
+	// Lists the test cases of a task, hidden ones included. Only for the author of the task and moderators.
+	ListTestCases(ctx context.Context, req *ListTestCasesRequest) (*ListTestCasesResponse, *TaskServiceError)
+	// Adds a test case after the other test cases of the task.
+	CreateTestCase(ctx context.Context, req *CreateTestCaseRequest) (*TestCaseResponse, *TaskServiceError)
+	// Changes a test case, its position is changed with ReorderTestCases.
+	UpdateTestCase(ctx context.Context, req *UpdateTestCaseRequest) (*TestCaseResponse, *TaskServiceError)
+	DeleteTestCase(ctx context.Context, req *DeleteTestCaseRequest) (*EmptyResponse, *TaskServiceError)
+	// Orders the test cases of a task, every test case must be listed once.
+	ReorderTestCases(ctx context.Context, req *ReorderTestCasesRequest) (*ListTestCasesResponse, *TaskServiceError)
 }
 
 func NewTaskServiceServer(implementation TaskServiceServer) *chi.Mux {
@@ -244,6 +394,125 @@ func NewTaskServiceServer(implementation TaskServiceServer) *chi.Mux {
 		}
 	})
 
+	mux.Post("/GetCodeExecution", func(w http.ResponseWriter, r *http.Request) {
+		var req GetCodeExecutionRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - GetCodeExecutionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.GetCodeExecution(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - GetCodeExecutionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - GetCodeExecutionerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/CreateStreamTicket", func(w http.ResponseWriter, r *http.Request) {
+		var req GetCodeExecutionRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - CreateStreamTicketerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.CreateStreamTicket(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - CreateStreamTicketerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - CreateStreamTicketerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	streamCodeExecution := func(w http.ResponseWriter, r *http.Request, req *StreamCodeExecutionRequest) {
+		stream := &eventStream{w: w, controller: http.NewResponseController(w)}
+		err := implementation.StreamCodeExecution(r.Context(), req, stream)
+		if err != nil {
+			if stream.started {
+				e := stream.Send(CODE_EXECUTION_EVENT_ERROR, map[string]string{
+					"message": err.Error.Error(),
+				})
+				if e != nil {
+					log.Printf("[TaskService - StreamCodeExecutionerror] writing to response stream: %s", e.Error())
+				}
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - StreamCodeExecutionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+	}
+
+	mux.Post("/StreamCodeExecution", func(w http.ResponseWriter, r *http.Request) {
+		var req StreamCodeExecutionRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - StreamCodeExecutionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		streamCodeExecution(w, r, &req)
+	})
+
+	// EventSource in browsers only sends GET requests, they are authenticated
+	// by a ticket from CreateStreamTicket: ?ticket=...
+	mux.Get("/StreamCodeExecution", func(w http.ResponseWriter, r *http.Request) {
+		req := StreamCodeExecutionRequest{
+			Ticket: r.URL.Query().Get("ticket"),
+		}
+		streamCodeExecution(w, r, &req)
+	})
+
 	mux.Post("/SubmitTask", func(w http.ResponseWriter, r *http.Request) {
 		var req SubmitTaskRequest
 		e := json.NewDecoder(r.Body).Decode(&req)
@@ -346,5 +615,236 @@ func NewTaskServiceServer(implementation TaskServiceServer) *chi.Mux {
 		}
 	})
 
+	mux.Post("/ListTestCases", func(w http.ResponseWriter, r *http.Request) {
+		var req ListTestCasesRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - ListTestCaseserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ListTestCases(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - ListTestCaseserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - ListTestCaseserror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/CreateTestCase", func(w http.ResponseWriter, r *http.Request) {
+		var req CreateTestCaseRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - CreateTestCaseerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.CreateTestCase(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - CreateTestCaseerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - CreateTestCaseerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/UpdateTestCase", func(w http.ResponseWriter, r *http.Request) {
+		var req UpdateTestCaseRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - UpdateTestCaseerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.UpdateTestCase(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - UpdateTestCaseerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - UpdateTestCaseerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/DeleteTestCase", func(w http.ResponseWriter, r *http.Request) {
+		var req DeleteTestCaseRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - DeleteTestCaseerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.DeleteTestCase(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - DeleteTestCaseerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - DeleteTestCaseerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/ReorderTestCases", func(w http.ResponseWriter, r *http.Request) {
+		var req ReorderTestCasesRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - ReorderTestCaseserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ReorderTestCases(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[TaskService - ReorderTestCaseserror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[TaskService - ReorderTestCaseserror] writing to response stream: %s", e.Error())
+		}
+	})
+
 	return mux
 }
+
+// eventStream writes Server-Sent Events. The headers are written along
+// with the first event, so that an error can still be sent as JSON before.
+type eventStream struct {
+	w          http.ResponseWriter
+	controller *http.ResponseController
+	started    bool
+}
+
+func (s *eventStream) start() error {
+	if s.started {
+		return nil
+	}
+
+	// A stream outlives the write timeout of the server.
+	e := s.controller.SetWriteDeadline(time.Time{})
+	if e != nil && !errors.Is(e, http.ErrNotSupported) {
+		return e
+	}
+
+	s.w.Header().Set("Content-Type", "text/event-stream")
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.Header().Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+	s.started = true
+
+	return nil
+}
+
+func (s *eventStream) Send(event string, data any) error {
+	e := s.start()
+	if e != nil {
+		return e
+	}
+
+	encoded, e := json.Marshal(data)
+	if e != nil {
+		return e
+	}
+
+	_, e = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", event, encoded)
+	if e != nil {
+		return e
+	}
+
+	return s.controller.Flush()
+}
+
+func (s *eventStream) Heartbeat() error {
+	e := s.start()
+	if e != nil {
+		return e
+	}
+
+	_, e = fmt.Fprint(s.w, ": heartbeat\n\n")
+	if e != nil {
+		return e
+	}
+
+	return s.controller.Flush()
+}
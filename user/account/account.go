@@ -0,0 +1,93 @@
+// Package user_account exports and deletes everything Kodiiing holds
+// about a user.
+//
+// A user that was merged into another one is kept as a tombstone, the
+// tombstones are exported and deleted along with the user they point to.
+package user_account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/typesense/typesense-go/typesense"
+)
+
+// ErrUserNotFound is returned when the user does not exist,
+// or was merged into another one.
+var ErrUserNotFound = errors.New("user not found")
+
+type Repository struct {
+	db     *pgxpool.Pool
+	search *typesense.Client
+}
+
+func NewAccountRepository(db *pgxpool.Pool, search *typesense.Client) (*Repository, error) {
+	if db == nil {
+		return nil, fmt.Errorf("db is nil")
+	}
+
+	if search == nil {
+		return nil, fmt.Errorf("search is nil")
+	}
+
+	return &Repository{db: db, search: search}, nil
+}
+
+// owner is a user with its tombstones.
+type owner struct {
+	ids       []int64
+	usernames []string
+	// emails are every address known for the user, personal data
+	// that is not keyed by the user ID is found through them.
+	emails []string
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func findOwner(ctx context.Context, q querier, userId int64) (owner, error) {
+	var o owner
+	err := q.QueryRow(
+		ctx,
+		`SELECT
+			ARRAY(SELECT id FROM users WHERE id = $1 OR merged_into = $1 ORDER BY id),
+			ARRAY(SELECT username FROM users WHERE (id = $1 OR merged_into = $1) AND username <> ''),
+			ARRAY(
+				SELECT email FROM users WHERE (id = $1 OR merged_into = $1) AND email <> ''
+				UNION
+				SELECT email FROM user_identities WHERE user_id = $1 AND email <> ''
+			)
+		WHERE
+			EXISTS (SELECT 1 FROM users WHERE id = $1 AND merged_into IS NULL)`,
+		userId,
+	).Scan(&o.ids, &o.usernames, &o.emails)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return owner{}, ErrUserNotFound
+		}
+
+		return owner{}, fmt.Errorf("getting user: %w", err)
+	}
+
+	return o, nil
+}
+
+// filterValue quotes a value for a Typesense filter_by expression.
+func filterValue(value string) string {
+	return "`" + strings.ReplaceAll(value, "`", "") + "`"
+}
+
+// emailFilter matches the documents of any of the emails.
+func emailFilter(emails []string) string {
+	values := make([]string, 0, len(emails))
+	for _, email := range emails {
+		values = append(values, filterValue(email))
+	}
+
+	return "email:=[" + strings.Join(values, ",") + "]"
+}
@@ -0,0 +1,220 @@
+package user_account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	"kodiiing/cache/invalidation"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/typesense/typesense-go/typesense/api"
+)
+
+// ScheduleDeletion schedules the user to be deleted at the given time. A
+// deletion that was already scheduled keeps its time, which is returned.
+func (r *Repository) ScheduleDeletion(ctx context.Context, userId int64, at time.Time) (time.Time, error) {
+	var scheduledAt time.Time
+	err := r.db.QueryRow(
+		ctx,
+		`UPDATE
+			users
+		SET
+			deletion_scheduled_at = COALESCE(deletion_scheduled_at, $2),
+			updated_at = NOW(),
+			updated_by = 'system:deletion'
+		WHERE
+			id = $1
+			AND merged_into IS NULL
+		RETURNING deletion_scheduled_at`,
+		userId,
+		at,
+	).Scan(&scheduledAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return time.Time{}, ErrUserNotFound
+		}
+
+		return time.Time{}, fmt.Errorf("scheduling deletion: %w", err)
+	}
+
+	return scheduledAt, nil
+}
+
+// CancelDeletion cancels the scheduled deletion of the user. It returns
+// false when no deletion was scheduled.
+func (r *Repository) CancelDeletion(ctx context.Context, userId int64) (bool, error) {
+	commandTag, err := r.db.Exec(
+		ctx,
+		`UPDATE
+			users
+		SET
+			deletion_scheduled_at = NULL,
+			updated_at = NOW(),
+			updated_by = 'system:deletion'
+		WHERE
+			id = $1
+			AND deletion_scheduled_at IS NOT NULL`,
+		userId,
+	)
+	if err != nil {
+		return false, fmt.Errorf("canceling deletion: %w", err)
+	}
+
+	return commandTag.RowsAffected() > 0, nil
+}
+
+// Purge deletes at most limit users whose deletion is due. It returns the
+// number of users that were deleted. A user that fails to be deleted is
+// logged and skipped, so it doesn't hold back the others, and the errors
+// are returned together.
+func (r *Repository) Purge(ctx context.Context, now time.Time, limit int) (int, error) {
+	rows, err := r.db.Query(
+		ctx,
+		`SELECT id FROM users WHERE deletion_scheduled_at <= $1 AND merged_into IS NULL ORDER BY deletion_scheduled_at LIMIT $2`,
+		now,
+		limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("getting due deletions: %w", err)
+	}
+
+	userIds, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, fmt.Errorf("getting due deletions: %w", err)
+	}
+
+	purged := 0
+	var errs []error
+	for _, userId := range userIds {
+		if ctx.Err() != nil {
+			return purged, errors.Join(append(errs, ctx.Err())...)
+		}
+
+		deleted, err := r.delete(ctx, userId, now)
+		if err != nil {
+			log.Error().Err(err).Int64("user_id", userId).Msg("purging deleted account")
+			errs = append(errs, fmt.Errorf("deleting user %d: %w", userId, err))
+			continue
+		}
+
+		if deleted {
+			purged++
+		}
+	}
+
+	return purged, errors.Join(errs...)
+}
+
+// delete hard deletes the personal data of the user, and anonymizes what
+// the user authored. The deletion is checked again under a lock, in case
+// it was canceled in the meantime.
+func (r *Repository) delete(ctx context.Context, userId int64, now time.Time) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
+	if err != nil {
+		return false, fmt.Errorf("creating transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	var due bool
+	err = tx.QueryRow(
+		ctx,
+		`SELECT deletion_scheduled_at <= $2 FROM users WHERE id = $1 FOR UPDATE`,
+		userId,
+		now,
+	).Scan(&due)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("locking user: %w", err)
+	}
+
+	if !due {
+		return false, nil
+	}
+
+	o, err := findOwner(ctx, tx, userId)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	// Everything that references users cascades, except for the
+	// tables below which are not keyed by the user ID.
+	statements := []string{
+		`UPDATE authors SET name = 'Deleted user', email = '', access_token = 'deleted:' || id, profile_url = '', picture_url = '', updated_at = NOW() WHERE email = ANY($2)`,
+		`DELETE FROM magic_links WHERE email = ANY($2)`,
+		`DELETE FROM auth_events WHERE user_id = ANY($1)`,
+		`DELETE FROM users WHERE id = ANY($1)`,
+	}
+	for _, statement := range statements {
+		_, err := tx.Exec(ctx, statement, o.ids, o.emails)
+		if err != nil {
+			return false, fmt.Errorf("deleting user: %w", err)
+		}
+	}
+
+	// Delivered on commit, every instance then drops the user it has cached.
+	err = invalidation.Notify(ctx, tx, auth.UserCacheKeys(o.ids, o.usernames, o.emails)...)
+	if err != nil {
+		return false, err
+	}
+
+	// Typesense goes first, a failure there leaves the user
+	// in place to be retried on the next purge.
+	err = r.deleteSearchAuthors(o.emails)
+	if err != nil {
+		return false, err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return false, fmt.Errorf("commiting transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *Repository) deleteSearchAuthors(emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	filter := emailFilter(emails)
+	_, err := r.search.Collection("authors").Documents().Delete(&api.DeleteDocumentsParams{FilterBy: &filter})
+	if err != nil {
+		return fmt.Errorf("deleting search authors: %w", err)
+	}
+
+	return nil
+}
+
+// RunPurger purges the due deletions on every interval until ctx is done.
+func (r *Repository) RunPurger(ctx context.Context, interval time.Duration, batchSize int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purged, err := r.Purge(ctx, time.Now(), batchSize)
+			if err != nil {
+				log.Error().Err(err).Int("purged", purged).Msg("purging deleted accounts")
+				continue
+			}
+
+			log.Debug().Int("purged", purged).Msg("purged deleted accounts")
+		}
+	}
+}
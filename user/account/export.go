@@ -0,0 +1,143 @@
+package user_account
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/typesense/typesense-go/typesense/api"
+)
+
+// Export is everything held about a user, each section lists the rows
+// of a table as JSON objects. Secrets such as token hashes and provider
+// tokens are left out.
+type Export struct {
+	ExportedAt time.Time                    `json:"exported_at"`
+	Sections   map[string][]json.RawMessage `json:"sections"`
+}
+
+// section is a query that returns a single JSON array. $1 is the IDs of the
+// user and its tombstones, $2 is the emails of the user.
+type section struct {
+	name  string
+	query string
+}
+
+var sections = []section{
+	{"users", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM users t WHERE t.id = ANY($1)`},
+	{"user_identities", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM user_identities t WHERE t.user_id = ANY($1)`},
+	{"user_statistics", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM user_statistics t WHERE t.user_id = ANY($1)`},
+	{"user_repositories", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM user_repositories t WHERE t.user_id = ANY($1)`},
+	{"user_accesstoken", `SELECT COALESCE(jsonb_agg(to_jsonb(t) - 'access_token' - 'refresh_token' ORDER BY t.id), '[]') FROM user_accesstoken t WHERE t.user_id = ANY($1)`},
+	{"user_profiles", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM user_profiles t WHERE t.user_id = ANY($1)`},
+	{"user_roles", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.role), '[]') FROM user_roles t WHERE t.user_id = ANY($1)`},
+	{"user_tasks", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM user_tasks t WHERE t.user_id = ANY($1)`},
+	{"task_submissions", `SELECT COALESCE(jsonb_agg(to_jsonb(t) || jsonb_build_object('grade', to_jsonb(g) - 'submission_id') ORDER BY t.id), '[]') FROM task_submissions t LEFT JOIN task_submission_grades g ON g.submission_id = t.id WHERE t.user_id = ANY($1)`},
+	{"tasks", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM tasks t WHERE t.author = ANY($1)`},
+	{"user_sessions", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.created_at), '[]') FROM user_sessions t WHERE t.user_id = ANY($1)`},
+	{"personal_access_tokens", `SELECT COALESCE(jsonb_agg(to_jsonb(t) - 'token_hash' ORDER BY t.id), '[]') FROM personal_access_tokens t WHERE t.user_id = ANY($1)`},
+	{"auth_events", `SELECT COALESCE(jsonb_agg(to_jsonb(t) ORDER BY t.id), '[]') FROM auth_events t WHERE t.user_id = ANY($1)`},
+	{"magic_links", `SELECT COALESCE(jsonb_agg(to_jsonb(t) - 'id' ORDER BY t.created_at), '[]') FROM magic_links t WHERE t.email = ANY($2)`},
+	{"authors", `SELECT COALESCE(jsonb_agg(to_jsonb(t) - 'access_token' ORDER BY t.id), '[]') FROM authors t WHERE t.email = ANY($2)`},
+}
+
+// searchPageSize is how many documents are read from Typesense at once.
+const searchPageSize = 250
+
+// Export collects everything held about the user, from the database and
+// from the authors collection of Typesense.
+func (r *Repository) Export(ctx context.Context, userId int64) (Export, error) {
+	// A single snapshot, so the sections are consistent with each other.
+	tx, err := r.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return Export{}, fmt.Errorf("creating transaction: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	o, err := findOwner(ctx, tx, userId)
+	if err != nil {
+		return Export{}, err
+	}
+
+	export := Export{
+		ExportedAt: time.Now(),
+		Sections:   make(map[string][]json.RawMessage, len(sections)+1),
+	}
+
+	for _, s := range sections {
+		var rows []json.RawMessage
+		err = tx.QueryRow(ctx, s.query, o.ids, o.emails).Scan(&rows)
+		if err != nil {
+			return Export{}, fmt.Errorf("exporting %s: %w", s.name, err)
+		}
+
+		export.Sections[s.name] = rows
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return Export{}, fmt.Errorf("commiting transaction: %w", err)
+	}
+
+	authors, err := r.searchAuthors(o.emails)
+	if err != nil {
+		return Export{}, err
+	}
+
+	export.Sections["search_authors"] = authors
+
+	return export, nil
+}
+
+// searchAuthors returns the documents of the authors collection
+// that belong to any of the emails.
+func (r *Repository) searchAuthors(emails []string) ([]json.RawMessage, error) {
+	documents := []json.RawMessage{}
+	if len(emails) == 0 {
+		return documents, nil
+	}
+
+	filter := emailFilter(emails)
+	perPage := searchPageSize
+	for page := 1; ; page++ {
+		page := page
+		result, err := r.search.Collection("authors").Documents().Search(&api.SearchCollectionParams{
+			Q:        "*",
+			QueryBy:  "email",
+			FilterBy: &filter,
+			Page:     &page,
+			PerPage:  &perPage,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("searching authors: %w", err)
+		}
+
+		if result.Hits == nil || len(*result.Hits) == 0 {
+			return documents, nil
+		}
+
+		for _, hit := range *result.Hits {
+			if hit.Document == nil {
+				continue
+			}
+
+			document := *hit.Document
+			delete(document, "access_token")
+
+			encoded, err := json.Marshal(document)
+			if err != nil {
+				return nil, fmt.Errorf("encoding author: %w", err)
+			}
+
+			documents = append(documents, encoded)
+		}
+
+		if len(*result.Hits) < perPage {
+			return documents, nil
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package user_service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kodiiing/auth"
+	user_account "kodiiing/user/account"
+	user_stub "kodiiing/user/stub"
+	"net/http"
+	"time"
+)
+
+// requireOwner refuses impersonated users, an admin acting as the user
+// must not take the user's data or account away.
+func requireOwner(user *auth.User) *user_stub.UserServiceError {
+	if user.ImpersonatedBy != 0 {
+		return &user_stub.UserServiceError{
+			StatusCode: http.StatusForbidden,
+			Error:      fmt.Errorf("%w: not allowed while impersonating", auth.ErrForbidden),
+		}
+	}
+
+	return nil
+}
+
+func (d *UserService) ExportData(ctx context.Context, req *user_stub.ExportDataRequest) (*user_stub.ExportDataResponse, *user_stub.UserServiceError) {
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcExportData)
+	if authErr != nil {
+		return &user_stub.ExportDataResponse{}, &user_stub.UserServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	if ownerErr := requireOwner(authenticatedUser); ownerErr != nil {
+		return &user_stub.ExportDataResponse{}, ownerErr
+	}
+
+	export, err := d.accountRepository.Export(ctx, authenticatedUser.ID)
+	if err != nil {
+		if errors.Is(err, user_account.ErrUserNotFound) {
+			return &user_stub.ExportDataResponse{}, &user_stub.UserServiceError{
+				StatusCode: http.StatusNotFound,
+				Error:      err,
+			}
+		}
+
+		return &user_stub.ExportDataResponse{}, &user_stub.UserServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return &user_stub.ExportDataResponse{
+		ExportedAt: export.ExportedAt.Unix(),
+		Sections:   export.Sections,
+	}, nil
+}
+
+// DeleteAccount schedules the account to be deleted once the grace period
+// is over. Until then the user can still log in and cancel the deletion.
+func (d *UserService) DeleteAccount(ctx context.Context, req *user_stub.DeleteAccountRequest) (*user_stub.DeleteAccountResponse, *user_stub.UserServiceError) {
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcDeleteAccount)
+	if authErr != nil {
+		return &user_stub.DeleteAccountResponse{}, &user_stub.UserServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	if ownerErr := requireOwner(authenticatedUser); ownerErr != nil {
+		return &user_stub.DeleteAccountResponse{}, ownerErr
+	}
+
+	if req.Confirmation == "" || req.Confirmation != authenticatedUser.Username {
+		return &user_stub.DeleteAccountResponse{}, &user_stub.UserServiceError{
+			StatusCode: http.StatusBadRequest,
+			Error:      fmt.Errorf("confirmation must be the username"),
+		}
+	}
+
+	scheduledAt, err := d.accountRepository.ScheduleDeletion(ctx, authenticatedUser.ID, time.Now().Add(d.deletionGracePeriod))
+	if err != nil {
+		if errors.Is(err, user_account.ErrUserNotFound) {
+			return &user_stub.DeleteAccountResponse{}, &user_stub.UserServiceError{
+				StatusCode: http.StatusNotFound,
+				Error:      err,
+			}
+		}
+
+		return &user_stub.DeleteAccountResponse{}, &user_stub.UserServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	return &user_stub.DeleteAccountResponse{DeletionScheduledAt: scheduledAt.Unix()}, nil
+}
+
+func (d *UserService) CancelAccountDeletion(ctx context.Context, req *user_stub.CancelAccountDeletionRequest) (*user_stub.EmptyResponse, *user_stub.UserServiceError) {
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcCancelAccountDeletion)
+	if authErr != nil {
+		return &user_stub.EmptyResponse{}, &user_stub.UserServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
+	}
+
+	if ownerErr := requireOwner(authenticatedUser); ownerErr != nil {
+		return &user_stub.EmptyResponse{}, ownerErr
+	}
+
+	canceled, err := d.accountRepository.CancelDeletion(ctx, authenticatedUser.ID)
+	if err != nil {
+		return &user_stub.EmptyResponse{}, &user_stub.UserServiceError{
+			StatusCode: http.StatusInternalServerError,
+			Error:      err,
+		}
+	}
+
+	if !canceled {
+		return &user_stub.EmptyResponse{}, &user_stub.UserServiceError{
+			StatusCode: http.StatusNotFound,
+			Error:      fmt.Errorf("no deletion is scheduled"),
+		}
+	}
+
+	return &user_stub.EmptyResponse{}, nil
+}
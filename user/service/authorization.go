@@ -0,0 +1,11 @@
+package user_service
+
+import "kodiiing/auth"
+
+// The permission that each RPC requires.
+var (
+	rpcOnboarding            = auth.RPC{Name: "Onboarding", Permission: auth.PermissionUserOnboard}
+	rpcExportData            = auth.RPC{Name: "ExportData", Permission: auth.PermissionUserAccount}
+	rpcDeleteAccount         = auth.RPC{Name: "DeleteAccount", Permission: auth.PermissionUserAccount}
+	rpcCancelAccountDeletion = auth.RPC{Name: "CancelAccountDeletion", Permission: auth.PermissionUserAccount}
+)
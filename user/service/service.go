@@ -2,9 +2,8 @@ package user_service
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"kodiiing/auth"
+	user_account "kodiiing/user/account"
 	"kodiiing/user/user_profile"
 	"net/http"
 	"time"
@@ -15,28 +14,27 @@ import (
 type UserService struct {
 	environment           string
 	userProfileRepository *user_profile.Repository
-	authentication        auth.Authenticate
+	accountRepository     *user_account.Repository
+	// deletionGracePeriod is how long a deleted account can be restored.
+	deletionGracePeriod time.Duration
+	authorization       auth.Authorize
 }
 
-func NewUserService(env string, userProfileRepository *user_profile.Repository) user_stub.UserServiceServer {
-	return &UserService{environment: env, userProfileRepository: userProfileRepository}
+func NewUserService(env string, userProfileRepository *user_profile.Repository, accountRepository *user_account.Repository, deletionGracePeriod time.Duration, authorization auth.Authorize) user_stub.UserServiceServer {
+	return &UserService{
+		environment:           env,
+		userProfileRepository: userProfileRepository,
+		accountRepository:     accountRepository,
+		deletionGracePeriod:   deletionGracePeriod,
+		authorization:         authorization,
+	}
 }
 
 func (d *UserService) Onboarding(ctx context.Context, req *user_stub.OnboardingRequest) (*user_stub.EmptyResponse, *user_stub.UserServiceError) {
-	// Authenticate user
-	authenticatedUser, err := d.authentication.Authenticate(ctx, req.Auth.AccessToken)
-	if err != nil {
-		if errors.Is(err, auth.ErrParameterEmpty) || errors.Is(err, auth.ErrUserNotFound) {
-			return &user_stub.EmptyResponse{}, &user_stub.UserServiceError{
-				StatusCode: http.StatusUnauthorized,
-				Error:      fmt.Errorf("unauthenticated: %w", err),
-			}
-		}
-
-		return nil, &user_stub.UserServiceError{
-			StatusCode: http.StatusInternalServerError,
-			Error:      fmt.Errorf("authenticating user: %w", err),
-		}
+	// Authorize user
+	ctx, authenticatedUser, authErr := auth.AuthorizeRPC(ctx, d.authorization, req.Auth.AccessToken, rpcOnboarding)
+	if authErr != nil {
+		return &user_stub.EmptyResponse{}, &user_stub.UserServiceError{StatusCode: auth.StatusCode(authErr), Error: authErr}
 	}
 
 	// If user has onboarded before, return an empty response
@@ -61,7 +59,7 @@ func (d *UserService) Onboarding(ctx context.Context, req *user_stub.OnboardingR
 		Languages:       req.Languages,
 		Target:          req.Target,
 		UpdatedAt:       time.Now(),
-		UpdatedBy:       "system",
+		UpdatedBy:       auth.UpdatedBy(ctx, "system"),
 	})
 	if err != nil {
 		return nil, &user_stub.UserServiceError{
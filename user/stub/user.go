@@ -26,6 +26,33 @@ type OnboardingRequest struct {
 type EmptyResponse struct {
 }
 
+type ExportDataRequest struct {
+	Auth Authentication `json:"auth"`
+}
+
+// ExportDataResponse lists the rows held about the user per table,
+// ExportedAt is in unix seconds.
+type ExportDataResponse struct {
+	ExportedAt int64 `json:"exported_at"`
+	Sections map[string][]json.RawMessage `json:"sections"`
+}
+
+type DeleteAccountRequest struct {
+	// Confirmation must be the username of the user.
+	Confirmation string `json:"confirmation"`
+	Auth Authentication `json:"auth"`
+}
+
+// DeleteAccountResponse has the time the account will be deleted at, in
+// unix seconds. The deletion can be canceled until then.
+type DeleteAccountResponse struct {
+	DeletionScheduledAt int64 `json:"deletion_scheduled_at"`
+}
+
+type CancelAccountDeletionRequest struct {
+	Auth Authentication `json:"auth"`
+}
+
 type Authentication struct {
 	AccessToken string `json:"access_token"`
 }
@@ -42,6 +69,12 @@ const (
 
 type UserServiceServer interface {
 	Onboarding(ctx context.Context, req *OnboardingRequest) (*EmptyResponse, *UserServiceError)
+	// Exports everything held about the logged in user.
+	ExportData(ctx context.Context, req *ExportDataRequest) (*ExportDataResponse, *UserServiceError)
+	// Schedules the deletion of the logged in user, after a grace period.
+	DeleteAccount(ctx context.Context, req *DeleteAccountRequest) (*DeleteAccountResponse, *UserServiceError)
+	// Cancels the scheduled deletion of the logged in user.
+	CancelAccountDeletion(ctx context.Context, req *CancelAccountDeletionRequest) (*EmptyResponse, *UserServiceError)
 }
 
 func NewUserServiceServer(implementation UserServiceServer) *chi.Mux {
@@ -80,5 +113,107 @@ func NewUserServiceServer(implementation UserServiceServer) *chi.Mux {
 		}
 	})
 
+	mux.Post("/ExportData", func(w http.ResponseWriter, r *http.Request) {
+		var req ExportDataRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[UserService - ExportDataerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.ExportData(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[UserService - ExportDataerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[UserService - ExportDataerror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/DeleteAccount", func(w http.ResponseWriter, r *http.Request) {
+		var req DeleteAccountRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[UserService - DeleteAccounterror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.DeleteAccount(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[UserService - DeleteAccounterror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[UserService - DeleteAccounterror] writing to response stream: %s", e.Error())
+		}
+	})
+
+	mux.Post("/CancelAccountDeletion", func(w http.ResponseWriter, r *http.Request) {
+		var req CancelAccountDeletionRequest
+		e := json.NewDecoder(r.Body).Decode(&req)
+		if e != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(400)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": e.Error(),
+			})
+			if e != nil {
+				log.Printf("[UserService - CancelAccountDeletionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		resp, err := implementation.CancelAccountDeletion(r.Context(), &req)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(err.StatusCode)
+			e := json.NewEncoder(w).Encode(map[string]string{
+				"message": err.Error.Error(),
+			})
+			if e != nil {
+				log.Printf("[UserService - CancelAccountDeletionerror] writing to response stream: %s", e.Error())
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		e = json.NewEncoder(w).Encode(resp)
+		if e != nil {
+			log.Printf("[UserService - CancelAccountDeletionerror] writing to response stream: %s", e.Error())
+		}
+	})
+
 	return mux
 }
@@ -4,16 +4,24 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"kodiiing/auth"
+	"kodiiing/cache/invalidation"
 	user_stub "kodiiing/user/stub"
 	"strings"
+
+	"github.com/jackc/pgx/v5"
 )
 
 func (u *Repository) Create(ctx context.Context, profile UserProfile) error {
-	conn, err := u.db.Acquire(ctx)
+	// The notification is sent along with the insert, so the profile
+	// is never stored without the caches being told.
+	tx, err := u.db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.ReadCommitted})
 	if err != nil {
-		return fmt.Errorf("acquiring connection from pool: %w", err)
+		return fmt.Errorf("creating transaction: %w", err)
 	}
-	defer conn.Release()
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
 
 	var insertStmt = `INSERT INTO 
     user_profiles 
@@ -23,11 +31,13 @@ func (u *Repository) Create(ctx context.Context, profile UserProfile) error {
      join_reason_other,
      coded_before,
      languages,
-     target
+     target,
+     updated_at,
+     updated_by
     )
     VALUES 
-    ($1, $2, $3, $4, $5, $6)`
-	_, err = conn.Exec(ctx, insertStmt,
+    ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.Exec(ctx, insertStmt,
 		profile.UserID,
 		profile.JoinReason,
 		sql.NullString{
@@ -43,10 +53,23 @@ func (u *Repository) Create(ctx context.Context, profile UserProfile) error {
 			String: profile.Target,
 			Valid:  profile.Target != "",
 		},
+		profile.UpdatedAt,
+		profile.UpdatedBy,
 	)
 	if err != nil {
 		return fmt.Errorf("executing insert query: %w", err)
 	}
 
+	// The user has onboarded, every instance drops the user it has cached.
+	err = invalidation.Notify(ctx, tx, auth.UserCacheKeys([]int64{profile.UserID}, nil, nil)...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return fmt.Errorf("committing transaction: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"kodiiing/task/execution"
+	taskrepository "kodiiing/task/repository"
+
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	// executionsInServer runs the workers within the API server.
+	executionsInServer = "server"
+	// executionsStandalone leaves the workers to `kodiiing worker`.
+	executionsStandalone = "standalone"
+)
+
+// NewExecutionWorker builds the worker that runs the queued code of
+// learners in the sandbox.
+func NewExecutionWorker(config Config, taskRepository *taskrepository.Repository, listener *execution.Listener) (*execution.Worker, error) {
+	codeSandbox, err := NewSandbox(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating sandbox: %w", err)
+	}
+
+	languages, err := NewLanguages(config)
+	if err != nil {
+		return nil, fmt.Errorf("creating language runtimes: %w", err)
+	}
+
+	return execution.NewWorker(&execution.WorkerConfig{
+		TaskRepository: taskRepository,
+		Sandbox:        codeSandbox,
+		Languages:      languages,
+		Listener:       listener,
+		Workers:        config.Executions.Workers,
+		PollInterval:   config.Executions.PollInterval,
+		Lease:          config.Executions.Lease,
+		MaxAttempts:    config.Executions.MaxAttempts,
+	})
+}
+
+// WorkerAction runs the queued code executions until interrupted. Executions
+// that are running by then are queued again for another worker.
+func WorkerAction(c *cli.Context) error {
+	config, err := GetConfig(c.String("configuration-file"))
+	if err != nil {
+		return fmt.Errorf("getting configuration file: %w", err)
+	}
+
+	if workers := c.Int("workers"); workers > 0 {
+		config.Executions.Workers = workers
+	}
+
+	ctx, stop := signal.NotifyContext(c.Context, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	pgxPool, err := NewDatabasePool(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer pgxPool.Close()
+
+	taskRepository := taskrepository.NewTaskRepository(&taskrepository.Dependency{
+		DB: pgxPool,
+	})
+
+	listener, err := execution.NewListener(pgxPool)
+	if err != nil {
+		return fmt.Errorf("creating execution listener: %w", err)
+	}
+
+	worker, err := NewExecutionWorker(config, taskRepository, listener)
+	if err != nil {
+		return fmt.Errorf("creating execution worker: %w", err)
+	}
+
+	go listener.Run(ctx)
+	worker.Run(ctx)
+
+	return nil
+}